@@ -2,8 +2,15 @@ package main
 
 import (
 	"github.com/kelseyhightower/envconfig"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
+	"github.com/subzerobo/ratatoskr/internal/services/identity"
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
+	"github.com/subzerobo/ratatoskr/pkg/currency"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
 	"github.com/subzerobo/ratatoskr/platform/postgres"
 	"github.com/subzerobo/ratatoskr/platform/redis"
 	"gopkg.in/yaml.v2"
@@ -21,6 +28,13 @@ type Config struct {
 	Redis          redis.Config           `yaml:"REDIS"`
 	Mailer         MailerConfig           `yaml:"MAILER"`
 	Authentication authentication2.Config `yaml:"AUTHENTICATION"`
+	Currency       currency.Config        `yaml:"CURRENCY"`
+	Applications   applications.Config    `yaml:"APPLICATIONS"`
+	Tags           tags.Config            `yaml:"TAGS"`
+	Identity       identity.Config        `yaml:"IDENTITY"`
+	Quotas         quotas.Config          `yaml:"QUOTAS"`
+	Webhooks       webhooks.Config        `yaml:"WEBHOOKS"`
+	Encryption     utils.KeyConfig        `yaml:"ENCRYPTION"`
 }
 
 type PrometheusConfig struct {
@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/internal/services/users"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
 	"github.com/subzerobo/ratatoskr/pkg/rest"
@@ -27,17 +29,23 @@ type BifrostHandler struct {
 	HTTPServer     *http.Server
 	applicationSvc applications.Service
 	deviceSvc      devices.Service
+	eventSvc       events.Service
+	userSvc        users.Service
 }
 
 func CreateBifrostHandler(
 	applicationSvc applications.Service,
 	deviceSvd devices.Service,
+	eventSvc events.Service,
+	userSvc users.Service,
 	logger *logger.StandardLogger,
 ) *BifrostHandler {
 	return &BifrostHandler{
 		Logger:         logger,
 		applicationSvc: applicationSvc,
 		deviceSvc:      deviceSvd,
+		eventSvc:       eventSvc,
+		userSvc:        userSvc,
 	}
 }
 
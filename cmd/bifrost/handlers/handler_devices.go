@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/rest"
@@ -19,6 +20,7 @@ import (
 // @Param Device body DeviceRequest true "Create Device Request"
 // @Success 200 {object} rest.StandardResponse "Success Result"
 // @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Rejected tags"
 // @Failure 500 {object} rest.StandardResponse
 // @Router /v1/devices [post]
 func (h *BifrostHandler) HandleAddDevice(c *gin.Context) {
@@ -50,8 +52,7 @@ func (h *BifrostHandler) HandleAddDevice(c *gin.Context) {
 		Tags:               req.Tags,
 	}, req.AppId)
 	if err != nil {
-		kind, _ := errors.AsKindContext(err)
-		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		c.JSON(getFailResponse(err))
 		return
 	}
 
@@ -94,13 +95,15 @@ func (h *BifrostHandler) HandleViewDevice(c *gin.Context) {
 // @Param last_device_id query int false "Previous max record id.Default is 0. Results are sorted by id;"
 // @Security APIKey
 // @Success 200 {object} rest.StandardResponse{data=[]DeviceViewResponse} "Success Result"
+// @Failure 401 {object} rest.StandardResponse "Invalid auth key"
+// @Failure 403 {object} rest.StandardResponse "Missing devices:read scope"
 // @Failure 500 {object} rest.StandardResponse
 // @Router /v1/devices [get]
 func (h *BifrostHandler) HandleViewDevices(c *gin.Context) {
 	appUUID := c.Query("app_uuid")
 
 	authToken := c.GetHeader("Authorization")
-	err := h.applicationSvc.CheckApplicationToken(authToken, appUUID)
+	err := h.applicationSvc.CheckApplicationToken(authToken, appUUID, applications.ScopeReadDevices)
 	if err != nil {
 		kind, _ := errors.AsKindContext(err)
 		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
@@ -133,6 +136,8 @@ func (h *BifrostHandler) HandleViewDevices(c *gin.Context) {
 // @Param Device body DeviceRequest true "Create Device Request"
 // @Success 200 {object} rest.StandardResponse "Success Result"
 // @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid external user id hash"
+// @Failure 422 {object} rest.StandardResponse "Rejected tags"
 // @Failure 500 {object} rest.StandardResponse
 // @Router /v1/devices/{UUID} [put]
 func (h *BifrostHandler) HandleEditDevice(c *gin.Context) {
@@ -146,31 +151,31 @@ func (h *BifrostHandler) HandleEditDevice(c *gin.Context) {
 	}
 
 	_, err := h.deviceSvc.Update(devices.DeviceModel{
-		UUID:              &uuid,
-		DeviceType:        req.DeviceType,
-		Identifier:        req.Identifier,
-		Language:          req.Language,
-		Timezone:          req.Timezone,
-		AppVersion:        req.AppVersion,
-		DeviceVendor:      req.DeviceVendor,
-		DeviceModel:       req.DeviceModel,
-		DeviceOS:          req.DeviceOS,
-		DeviceOSVersion:   req.DeviceOSVersion,
-		ADID:              req.ADID,
-		SDK:               req.SDK,
-		SessionCount:      req.SessionCount,
-		NotificationTypes: req.NotificationTypes,
-		Long:              req.Long,
-		Lat:               req.Lat,
-		Country:           req.Country,
-		ExternalUserID:    req.ExternalUserID,
-		Tags:              req.Tags,
-		BadgeCount:        req.BadgeCount,
-		AmountSpent:       req.AmountSpent,
+		UUID:               &uuid,
+		DeviceType:         req.DeviceType,
+		Identifier:         req.Identifier,
+		Language:           req.Language,
+		Timezone:           req.Timezone,
+		AppVersion:         req.AppVersion,
+		DeviceVendor:       req.DeviceVendor,
+		DeviceModel:        req.DeviceModel,
+		DeviceOS:           req.DeviceOS,
+		DeviceOSVersion:    req.DeviceOSVersion,
+		ADID:               req.ADID,
+		SDK:                req.SDK,
+		SessionCount:       req.SessionCount,
+		NotificationTypes:  req.NotificationTypes,
+		Long:               req.Long,
+		Lat:                req.Lat,
+		Country:            req.Country,
+		ExternalUserID:     req.ExternalUserID,
+		ExternalUserIDHash: req.ExternalUserIDHash,
+		Tags:               req.Tags,
+		BadgeCount:         req.BadgeCount,
+		AmountSpent:        req.AmountSpent,
 	})
 	if err != nil {
-		kind, _ := errors.AsKindContext(err)
-		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		c.JSON(getFailResponse(err))
 		return
 	}
 
@@ -189,6 +194,8 @@ func (h *BifrostHandler) HandleEditDevice(c *gin.Context) {
 // @Param UserTags body UserTagRequest true "List of User Tags"
 // @Success 200 {object} rest.StandardResponse "Success Result"
 // @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid external user id hash"
+// @Failure 422 {object} rest.StandardResponse "Rejected tags"
 // @Failure 500 {object} rest.StandardResponse
 // @Router /v1/applications/{APP_UUID}/users/{EXTERNAL_USER_ID} [put]
 func (h *BifrostHandler) HandleEditUserTags(c *gin.Context) {
@@ -202,7 +209,161 @@ func (h *BifrostHandler) HandleEditUserTags(c *gin.Context) {
 		return
 	}
 
-	err := h.deviceSvc.UpdateUserTags(appUUID, externalUserID, req.Tags)
+	err := h.deviceSvc.UpdateUserTags(appUUID, externalUserID, req.ExternalUserIDHash, req.Tags)
+	if err != nil {
+		c.JSON(getFailResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleEditUsersTags godoc
+// @Summary Update the tags of the devices of many external users in one of your Ratatoskr apps
+// @Description Applies up to 10000 entries of external user tags at once, the result has an entry per given entry in the same order
+// @ID handle_edit_users_tags
+// @Tags Devices
+// @Accept	json
+// @Produce	json
+// @Security APIKey
+// @Param app_uuid path string true "App Unique Identifier UUID"
+// @Param UsersTags body UsersTagsRequest true "List of external users and their tags"
+// @Success 200 {object} rest.StandardResponse{data=[]devices.UserTagsResultModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid auth key"
+// @Failure 403 {object} rest.StandardResponse "Missing tags:write scope"
+// @Failure 413 {object} rest.StandardResponse "Too many entries"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/apps/{app_uuid}/users/tags [post]
+func (h *BifrostHandler) HandleEditUsersTags(c *gin.Context) {
+	req := UsersTagsRequest{}
+
+	appUUID := c.Param("app_uuid")
+
+	authToken := c.GetHeader("Authorization")
+	err := h.applicationSvc.CheckApplicationToken(authToken, appUUID, applications.ScopeWriteTags)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	res, err := h.deviceSvc.UpdateUsersTags(appUUID, req.Users)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDeviceSession godoc
+// @Summary Track a new session of an existing device in one of your Ratatoskr apps
+// @Description Increments the session count of the device, marks it as active and refreshes the app version and language
+// @ID handle_device_session
+// @Tags Devices,SDK
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "Device Unique Identifier"
+// @Param Session body DeviceSessionRequest true "Device Session Request"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse "Device not found"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/devices/{uuid}/on_session [post]
+func (h *BifrostHandler) HandleDeviceSession(c *gin.Context) {
+	req := DeviceSessionRequest{}
+
+	uuid := c.Param("uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	err := h.deviceSvc.TrackSession(uuid, req.AppId, devices.SessionModel{
+		AppVersion: req.AppVersion,
+		Language:   req.Language,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleDeviceFocus godoc
+// @Summary Track the usage time of an existing device in one of your Ratatoskr apps
+// @Description Adds the time in seconds the app has been in focus to the total usage time of the device
+// @ID handle_device_focus
+// @Tags Devices,SDK
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "Device Unique Identifier"
+// @Param Focus body DeviceFocusRequest true "Device Focus Request"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse "Device not found"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/devices/{uuid}/on_focus [post]
+func (h *BifrostHandler) HandleDeviceFocus(c *gin.Context) {
+	req := DeviceFocusRequest{}
+
+	uuid := c.Param("uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	err := h.deviceSvc.TrackFocus(uuid, req.AppId, req.ActiveTime)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleDevicePurchase godoc
+// @Summary Track a purchase of an existing device in one of your Ratatoskr apps
+// @Description Records the purchase and adds its amount, converted to the reporting currency, to the amount spent by the device
+// @ID handle_device_purchase
+// @Tags Devices,SDK
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "Device Unique Identifier"
+// @Param Purchase body DevicePurchaseRequest true "Device Purchase Request"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse "Device not found"
+// @Failure 422 {object} rest.StandardResponse "Unknown currency"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/devices/{uuid}/on_purchase [post]
+func (h *BifrostHandler) HandleDevicePurchase(c *gin.Context) {
+	req := DevicePurchaseRequest{}
+
+	uuid := c.Param("uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	err := h.deviceSvc.TrackPurchase(uuid, req.AppId, devices.PurchaseModel{
+		SKU:      req.SKU,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+	})
 	if err != nil {
 		kind, _ := errors.AsKindContext(err)
 		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
@@ -236,26 +397,45 @@ type DeviceRequest struct {
 }
 
 type DeviceEditRequest struct {
-	DeviceType        *string           `json:"device_type" example:"android | ios | web"`
-	Identifier        *string           `json:"identifier" example:"APA91bHbYHk7aq-Uam_2pyJ2qbZvqllyyh2wjfPRaw5gLEX2SUlQBRvOc6sck1sa7H7nGeLNlDco8lXj83HWWwzV..."`
-	Language          *string           `json:"language" example:"fa"`
-	Timezone          int               `json:"timezone" example:"12600"`
-	AppVersion        *string           `json:"app_version" example:"2.1.1"`
-	DeviceVendor      *string           `json:"device_vendor" example:"Samsung"`
-	DeviceModel       *string           `json:"device_model" example:"SM-989F"`
-	DeviceOS          *string           `json:"device_os" example:"Android"`
-	DeviceOSVersion   *string           `json:"device_os_version" example:"8.0"`
-	ADID              *string           `json:"adid" example:"dbdf14cc-a5e7-445f-a972-2112ab335b14"`
-	SDK               *string           `json:"sdk" example:"1.0"`
-	SessionCount      *int              `json:"session_count" example:"1"`
-	NotificationTypes *int              `json:"notification_types" example:"1"`
-	Long              *float32          `json:"long" example:"35.123456"`
-	Lat               *float32          `json:"lat" example:"54.123456"`
-	Country           *string           `json:"country" example:"IR"`
-	ExternalUserID    *string           `json:"external_user_id" example:"u-12"`
-	Tags              map[string]string `json:"tags"`
-	BadgeCount        *int              `json:"badge_count" example:"1"`
-	AmountSpent       *float32          `json:"amount_spent" example:"29.99"`
+	DeviceType         *string           `json:"device_type" example:"android | ios | web"`
+	Identifier         *string           `json:"identifier" example:"APA91bHbYHk7aq-Uam_2pyJ2qbZvqllyyh2wjfPRaw5gLEX2SUlQBRvOc6sck1sa7H7nGeLNlDco8lXj83HWWwzV..."`
+	Language           *string           `json:"language" example:"fa"`
+	Timezone           int               `json:"timezone" example:"12600"`
+	AppVersion         *string           `json:"app_version" example:"2.1.1"`
+	DeviceVendor       *string           `json:"device_vendor" example:"Samsung"`
+	DeviceModel        *string           `json:"device_model" example:"SM-989F"`
+	DeviceOS           *string           `json:"device_os" example:"Android"`
+	DeviceOSVersion    *string           `json:"device_os_version" example:"8.0"`
+	ADID               *string           `json:"adid" example:"dbdf14cc-a5e7-445f-a972-2112ab335b14"`
+	SDK                *string           `json:"sdk" example:"1.0"`
+	SessionCount       *int              `json:"session_count" example:"1"`
+	NotificationTypes  *int              `json:"notification_types" example:"1"`
+	Long               *float32          `json:"long" example:"35.123456"`
+	Lat                *float32          `json:"lat" example:"54.123456"`
+	Country            *string           `json:"country" example:"IR"`
+	ExternalUserID     *string           `json:"external_user_id" example:"u-12"`
+	ExternalUserIDHash *string           `json:"external_user_id_hash" example:"xxxxxxxx"`
+	Tags               map[string]string `json:"tags"`
+	BadgeCount         *int              `json:"badge_count" example:"1"`
+	AmountSpent        *float32          `json:"amount_spent" example:"29.99"`
+}
+
+type DeviceSessionRequest struct {
+	AppId      string  `json:"app_id" binding:"required" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+	AppVersion *string `json:"app_version" example:"2.1.1"`
+	Language   *string `json:"language" example:"fa"`
+}
+
+type DeviceFocusRequest struct {
+	AppId      string `json:"app_id" binding:"required" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+	ActiveTime int    `json:"active_time" binding:"required,min=1,max=86400" example:"60"`
+}
+
+type DevicePurchaseRequest struct {
+	AppId    string  `json:"app_id" binding:"required" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+	SKU      string  `json:"sku" binding:"required,max=255" example:"com.example.coins_100"`
+	Amount   float64 `json:"amount" binding:"required,gt=0" example:"4.99"`
+	Currency string  `json:"currency" binding:"required,len=3" example:"EUR"`
 }
 
 type DeviceViewResponse struct {
@@ -274,6 +454,8 @@ type DeviceViewResponse struct {
 	LastActiveAt    time.Time         `json:"last_active_at"`
 	ExternalUserID  string            `json:"external_user_id" example:"u-12"`
 	BadgeCount      int               `json:"badge_count" example:"1"`
+	SessionCount    int               `json:"session_count" example:"12"`
+	TotalUsageTime  int64             `json:"total_usage_time" example:"3600"`
 }
 
 type DeviceSuccessResponse struct {
@@ -281,10 +463,20 @@ type DeviceSuccessResponse struct {
 }
 
 type UserTagRequest struct {
-	Tags map[string]string `json:"tags" binding:"required"`
+	Tags               map[string]string `json:"tags" binding:"required"`
+	ExternalUserIDHash string            `json:"external_user_id_hash" example:"xxxxxxxx"`
+}
+
+type UsersTagsRequest struct {
+	Users []devices.UserTagsModel `json:"users" binding:"required,min=1"`
 }
 
 func toSingle(item *devices.DeviceModel) *DeviceViewResponse {
+	// Devices registered before session tracking have no activity record yet
+	lastActiveAt := item.LastActiveAt
+	if lastActiveAt.IsZero() {
+		lastActiveAt = item.UpdatedAt
+	}
 	return &DeviceViewResponse{
 		Identifier:      *item.Identifier,
 		DeviceType:      *item.DeviceType,
@@ -298,9 +490,11 @@ func toSingle(item *devices.DeviceModel) *DeviceViewResponse {
 		ADID:            *item.ADID,
 		Tags:            item.Tags,
 		CreatedAt:       item.CreatedAt,
-		LastActiveAt:    item.UpdatedAt,
+		LastActiveAt:    lastActiveAt,
 		ExternalUserID:  *item.ExternalUserID,
 		BadgeCount:      *item.BadgeCount,
+		SessionCount:    *item.SessionCount,
+		TotalUsageTime:  item.TotalUsageTime,
 	}
 }
 
@@ -311,3 +505,13 @@ func toList(list []*devices.DeviceModel) []*DeviceViewResponse {
 	}
 	return results
 }
+
+// getFailResponse builds the response of a failed request, rejected tags are listed in the errors of the response
+func getFailResponse(err error) (int, rest.StandardResponse) {
+	kind, ctx := errors.AsKindContext(err)
+	res := rest.GetFailMessageResponse(err.Error())
+	if rejected, ok := ctx["rejected"].([]string); ok {
+		res.Errors = rejected
+	}
+	return kind.GetHttpStatus(), res
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"time"
+)
+
+// HandleTrackEvents godoc
+// @Summary Track custom events performed by devices or external users
+// @Description Stores a single event or a batch of events (using the events field) performed by a device or an external user of one of your Ratatoskr apps
+// @ID handle_track_events
+// @Tags Events,SDK
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param Events body EventsRequest true "Single event or batch of events"
+// @Success 200 {object} rest.StandardResponse{data=EventsResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid external user id hash"
+// @Failure 413 {object} rest.StandardResponse "Too many events in batch"
+// @Failure 422 {object} rest.StandardResponse "Invalid event"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/apps/{app_uuid}/events [post]
+func (h *BifrostHandler) HandleTrackEvents(c *gin.Context) {
+	req := EventsRequest{}
+
+	appUUID := c.Param("app_uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	items := req.Events
+	if len(items) == 0 {
+		items = []EventRequest{req.EventRequest}
+	}
+
+	models := make([]events.EventModel, 0, len(items))
+	for _, item := range items {
+		model := events.EventModel{
+			DeviceUUID:         item.DeviceUUID,
+			ExternalUserID:     item.ExternalUserID,
+			ExternalUserIDHash: item.ExternalUserIDHash,
+			Name:               item.Name,
+			Properties:         item.Properties,
+		}
+		if item.Timestamp != nil {
+			model.OccurredAt = *item.Timestamp
+		}
+		models = append(models, model)
+	}
+
+	count, err := h.eventSvc.Track(appUUID, models)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(EventsResponse{Accepted: count}))
+}
+
+type EventRequest struct {
+	DeviceUUID     string `json:"device_uuid" example:"dbdf14cc-a5e7-445f-a972-2112ab335b14"`
+	ExternalUserID string `json:"external_user_id" example:"u-12"`
+	// ExternalUserIDHash is required for events of external users when identity verification is enabled
+	ExternalUserIDHash string                 `json:"external_user_id_hash" example:"xxxxxxxx"`
+	Name               string                 `json:"name" binding:"max=128" example:"level_completed"`
+	Properties         map[string]interface{} `json:"properties"`
+	Timestamp          *time.Time             `json:"timestamp" example:"2021-08-01T10:00:00Z"`
+}
+
+type EventsRequest struct {
+	EventRequest
+	Events []EventRequest `json:"events" binding:"omitempty,dive"`
+}
+
+type EventsResponse struct {
+	Accepted int `json:"accepted" example:"1"`
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleUserLogin godoc
+// @Summary Link an existing device to an external user in one of your Ratatoskr apps
+// @Description Links the device to the external user, the device gets the user tags and everything sent to the external user
+// @ID handle_user_login
+// @Tags Users,SDK
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "Device Unique Identifier"
+// @Param Login body UserLoginRequest true "User Login Request"
+// @Success 200 {object} rest.StandardResponse{data=users.UserModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid external user id hash"
+// @Failure 404 {object} rest.StandardResponse "Device not found"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/devices/{uuid}/login [post]
+func (h *BifrostHandler) HandleUserLogin(c *gin.Context) {
+	req := UserLoginRequest{}
+
+	uuid := c.Param("uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	res, err := h.userSvc.Login(req.AppId, uuid, req.ExternalUserID, req.ExternalUserIDHash)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUserLogout godoc
+// @Summary Unlink an existing device from its external user in one of your Ratatoskr apps
+// @Description Unlinks the device from its external user, the user tags are removed from the device
+// @ID handle_user_logout
+// @Tags Users,SDK
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "Device Unique Identifier"
+// @Param Logout body UserLogoutRequest true "User Logout Request"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse "Device not found"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/devices/{uuid}/logout [post]
+func (h *BifrostHandler) HandleUserLogout(c *gin.Context) {
+	req := UserLogoutRequest{}
+
+	uuid := c.Param("uuid")
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	err := h.userSvc.Logout(req.AppId, uuid)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleGetUser godoc
+// @Summary View an external user of one of your Ratatoskr apps
+// @Description Gets the external user with its tags and all of its linked devices
+// @ID handle_get_user
+// @Tags Users
+// @Produce	json
+// @Security APIKey
+// @Param app_uuid path string true "App Unique Identifier UUID"
+// @Param external_user_id path string true "External User ID"
+// @Success 200 {object} rest.StandardResponse{data=users.UserModel} "Success Result"
+// @Failure 401 {object} rest.StandardResponse "Invalid auth key"
+// @Failure 403 {object} rest.StandardResponse "Missing devices:read scope"
+// @Failure 404 {object} rest.StandardResponse "User not found"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/apps/{app_uuid}/users/{external_user_id} [get]
+func (h *BifrostHandler) HandleGetUser(c *gin.Context) {
+	appUUID := c.Param("app_uuid")
+	externalUserID := c.Param("external_user_id")
+
+	authToken := c.GetHeader("Authorization")
+	err := h.applicationSvc.CheckApplicationToken(authToken, appUUID, applications.ScopeReadDevices)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.userSvc.Get(appUUID, externalUserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+type UserLoginRequest struct {
+	AppId              string `json:"app_id" binding:"required" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+	ExternalUserID     string `json:"external_user_id" binding:"required,max=255" example:"u-12"`
+	ExternalUserIDHash string `json:"external_user_id_hash" example:"xxxxxxxx"`
+}
+
+type UserLogoutRequest struct {
+	AppId string `json:"app_id" binding:"required" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+}
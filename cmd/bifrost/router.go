@@ -63,10 +63,18 @@ func SetupRouter(handler *handlers.BifrostHandler, config PrometheusConfig, jwtC
 			publicV1.GET("/devices/:uuid/:app_uuid", handler.HandleViewDevice)
 			publicV1.GET("/devices", handler.HandleViewDevices)
 			publicV1.PUT("/devices/:uuid", handler.HandleEditDevice)
+			publicV1.POST("/devices/:uuid/on_session", handler.HandleDeviceSession)
+			publicV1.POST("/devices/:uuid/on_focus", handler.HandleDeviceFocus)
+			publicV1.POST("/devices/:uuid/on_purchase", handler.HandleDevicePurchase)
+			publicV1.POST("/devices/:uuid/login", handler.HandleUserLogin)
+			publicV1.POST("/devices/:uuid/logout", handler.HandleUserLogout)
 
 			// Application
+			publicV1.GET("/apps/:app_uuid/users/:external_user_id", handler.HandleGetUser)
 			publicV1.PUT("/apps/:app_uuid/users/:external_user_id", handler.HandleEditUserTags)
+			publicV1.POST("/apps/:app_uuid/users/tags", handler.HandleEditUsersTags)
 			publicV1.GET("/apps/:app_uuid/android_params", handler.HandleAndroidParams)
+			publicV1.POST("/apps/:app_uuid/events", handler.HandleTrackEvents)
 
 		}
 
@@ -8,9 +8,19 @@ import (
 	"github.com/subzerobo/ratatoskr/cmd/bifrost/handlers"
 	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/internal/services/identity"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/internal/services/users"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
 	"github.com/subzerobo/ratatoskr/internal/storage/postgres"
 	rs "github.com/subzerobo/ratatoskr/internal/storage/redis"
+	"github.com/subzerobo/ratatoskr/internal/storage/streaming"
+	"github.com/subzerobo/ratatoskr/pkg/currency"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
 	pg "github.com/subzerobo/ratatoskr/platform/postgres"
 	"github.com/subzerobo/ratatoskr/platform/redis"
 	"os"
@@ -45,8 +55,14 @@ func (s *server) Initialize(logger *logger.StandardLogger) error {
 		return err
 	}
 	
+	// Initialize Secrets Encryption
+	keyProvider, err := utils.CreateLocalKeyProvider(s.Config.Encryption)
+	if err != nil {
+		return err
+	}
+	
 	// Initialize Postgres Backed Repository
-	repository, err := postgres.CreateRepository(gorm)
+	repository, err := postgres.CreateRepository(gorm, utils.CreateEnvelope(keyProvider))
 	if err != nil {
 		return err
 	}
@@ -59,12 +75,25 @@ func (s *server) Initialize(logger *logger.StandardLogger) error {
 	}
 	cache := rs.CreateRedisStore(redisClient)
 	
+	// Initialize Streaming Store
+	streamingStore := streaming.CreateStreamingStore(s.Stan)
+	
+	// Initialize Currency Converter
+	converter := currency.CreateConverter(s.Config.Currency)
+	
 	// Create Services
-	applicationService := applications.CreateService(repository, cache)
-	deviceService := devices.CreateService(repository)
+	quotaService := quotas.CreateService(repository, s.Config.Quotas)
+	applicationService := applications.CreateService(repository, cache, quotaService, s.Config.Applications)
+	journeyService := journeys.CreateService(repository, streamingStore, quotaService, logger)
+	tagService := tags.CreateService(repository, s.Config.Tags)
+	webhookService := webhooks.CreateService(repository, s.Config.Webhooks)
+	verifier := identity.CreateVerifier(s.Config.Identity, logger)
+	deviceService := devices.CreateService(repository, converter, tagService, verifier, quotaService, journeyService, webhookService)
+	eventService := events.CreateService(repository, verifier, journeyService, webhookService)
+	userService := users.CreateService(repository, tagService, verifier, journeyService)
 	
 	// REST Handler
-	restHandler := handlers.CreateBifrostHandler(applicationService, deviceService, logger)
+	restHandler := handlers.CreateBifrostHandler(applicationService, deviceService, eventService, userService, logger)
 	
 	// Update GitCommit and BuildTime in handler
 	restHandler.HealthCheckInfo.GitCommit = GitCommit
@@ -2,13 +2,25 @@ package main
 
 import (
 	"github.com/kelseyhightower/envconfig"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
+	"github.com/subzerobo/ratatoskr/internal/services/exports"
+	"github.com/subzerobo/ratatoskr/internal/services/identity"
+	"github.com/subzerobo/ratatoskr/internal/services/organizations"
+	"github.com/subzerobo/ratatoskr/internal/services/privacy"
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
+	"github.com/subzerobo/ratatoskr/pkg/blob"
+	"github.com/subzerobo/ratatoskr/pkg/currency"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
 	"github.com/subzerobo/ratatoskr/platform/postgres"
 	"github.com/subzerobo/ratatoskr/platform/redis"
 	"gopkg.in/yaml.v2"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -21,6 +33,18 @@ type Config struct {
 	Redis          redis.Config           `yaml:"REDIS"`
 	Mailer         MailerConfig           `yaml:"MAILER"`
 	Authentication authentication2.Config `yaml:"AUTHENTICATION"`
+	Currency       currency.Config        `yaml:"CURRENCY"`
+	Applications   applications.Config    `yaml:"APPLICATIONS"`
+	Tags           tags.Config            `yaml:"TAGS"`
+	Identity       identity.Config        `yaml:"IDENTITY"`
+	Blob           blob.Config            `yaml:"BLOB"`
+	Exports        exports.Config         `yaml:"EXPORTS"`
+	Privacy        privacy.Config         `yaml:"PRIVACY"`
+	Organizations  organizations.Config   `yaml:"ORGANIZATIONS"`
+	Quotas         quotas.Config          `yaml:"QUOTAS"`
+	Webhooks       webhooks.Config        `yaml:"WEBHOOKS"`
+	Encryption     utils.KeyConfig        `yaml:"ENCRYPTION"`
+	Workers        WorkersConfig          `yaml:"WORKERS"`
 }
 
 type PrometheusConfig struct {
@@ -41,6 +65,26 @@ type MailerConfig struct {
 	Name  string `yaml:"SG_NAME" envconfig:"SG_MAILER_NAME"`
 }
 
+// WorkersConfig holds the settings of background workers, Interval is in seconds
+type WorkersConfig struct {
+	Interval  int `yaml:"INTERVAL" envconfig:"WORKERS_INTERVAL"`
+	BatchSize int `yaml:"BATCH_SIZE" envconfig:"WORKERS_BATCH_SIZE"`
+}
+
+func (w WorkersConfig) GetInterval() time.Duration {
+	if w.Interval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(w.Interval) * time.Second
+}
+
+func (w WorkersConfig) GetBatchSize() int {
+	if w.BatchSize <= 0 {
+		return 100
+	}
+	return w.BatchSize
+}
+
 func (s *STAN) GenerateURLs() string {
 	return strings.Join(s.NatsURLs, ",")
 }
@@ -6,8 +6,19 @@ import (
 	sigar "github.com/cloudfoundry/gosigar"
 	"github.com/gin-gonic/gin"
 	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/audit"
 	"github.com/subzerobo/ratatoskr/internal/services/authentication"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/exports"
+	"github.com/subzerobo/ratatoskr/internal/services/imports"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+	"github.com/subzerobo/ratatoskr/internal/services/organizations"
+	"github.com/subzerobo/ratatoskr/internal/services/privacy"
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/internal/services/users"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
 	"github.com/subzerobo/ratatoskr/pkg/rest"
@@ -24,24 +35,57 @@ type YggdrasilHandler struct {
 		ContainerName string
 		StartTime     time.Time
 	}
-	Logger         *logger.StandardLogger
-	HTTPServer     *http.Server
-	accountSvc     authentication.Service
-	applicationSvc applications.Service
-	deviceSvc      devices.Service
+	Logger          *logger.StandardLogger
+	HTTPServer      *http.Server
+	accountSvc      authentication.Service
+	applicationSvc  applications.Service
+	deviceSvc       devices.Service
+	journeySvc      journeys.Service
+	segmentSvc      segments.Service
+	importSvc       imports.Service
+	exportSvc       exports.Service
+	tagSvc          tags.Service
+	userSvc         users.Service
+	privacySvc      privacy.Service
+	organizationSvc organizations.Service
+	quotaSvc        quotas.Service
+	auditSvc        audit.Service
+	webhookSvc      webhooks.Service
 }
 
 func CreateYggdrasilHandler(
 	accountSvc authentication.Service,
 	applicationSvc applications.Service,
 	deviceSvd devices.Service,
+	journeySvc journeys.Service,
+	segmentSvc segments.Service,
+	importSvc imports.Service,
+	exportSvc exports.Service,
+	tagSvc tags.Service,
+	userSvc users.Service,
+	privacySvc privacy.Service,
+	organizationSvc organizations.Service,
+	quotaSvc quotas.Service,
+	auditSvc audit.Service,
+	webhookSvc webhooks.Service,
 	logger *logger.StandardLogger,
 ) *YggdrasilHandler {
 	return &YggdrasilHandler{
-		Logger:         logger,
-		accountSvc:     accountSvc,
-		applicationSvc: applicationSvc,
-		deviceSvc:      deviceSvd,
+		Logger:          logger,
+		accountSvc:      accountSvc,
+		applicationSvc:  applicationSvc,
+		deviceSvc:       deviceSvd,
+		journeySvc:      journeySvc,
+		segmentSvc:      segmentSvc,
+		importSvc:       importSvc,
+		exportSvc:       exportSvc,
+		tagSvc:          tagSvc,
+		userSvc:         userSvc,
+		privacySvc:      privacySvc,
+		organizationSvc: organizationSvc,
+		quotaSvc:        quotaSvc,
+		auditSvc:        auditSvc,
+		webhookSvc:      webhookSvc,
 	}
 }
 
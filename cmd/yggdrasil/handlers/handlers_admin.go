@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/authentication"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"time"
+)
+
+// HandleAdminSearchAccounts godoc
+// @Summary Search accounts
+// @Description Searches the accounts by their email or company name, all of the accounts are listed without a query
+// @ID handle_admin_search_accounts
+// @Tags Admin
+// @Security BearerToken
+// @Produce	json
+// @Param query query string false "Part of the email or company name"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]AdminAccountResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/accounts [get]
+func (h *YggdrasilHandler) HandleAdminSearchAccounts(c *gin.Context) {
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.accountSvc.SearchAccounts(c.Query("query"), paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	results := make([]*AdminAccountResponse, 0, len(res))
+	for _, item := range res {
+		results = append(results, toAdminAccount(item))
+	}
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(results))
+}
+
+// HandleAdminActivateAccount godoc
+// @Summary Activate account
+// @Description Activates the account so it can login again
+// @ID handle_admin_activate_account
+// @Tags Admin
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of account"
+// @Success 200 {object} rest.StandardResponse{data=AdminAccountResponse} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/accounts/{uuid}/activate [post]
+func (h *YggdrasilHandler) HandleAdminActivateAccount(c *gin.Context) {
+	h.setAccountActive(c, true)
+}
+
+// HandleAdminDeactivateAccount godoc
+// @Summary Deactivate account
+// @Description Deactivates the account and logs it out of all of its sessions, super users can not be deactivated
+// @ID handle_admin_deactivate_account
+// @Tags Admin
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of account"
+// @Success 200 {object} rest.StandardResponse{data=AdminAccountResponse} "Success Result"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/accounts/{uuid}/deactivate [post]
+func (h *YggdrasilHandler) HandleAdminDeactivateAccount(c *gin.Context) {
+	h.setAccountActive(c, false)
+}
+
+func (h *YggdrasilHandler) setAccountActive(c *gin.Context, active bool) {
+	UUID := c.Param("uuid")
+
+	res, err := h.accountSvc.SetAccountActive(UUID, active)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(toAdminAccount(res)))
+}
+
+// HandleAdminUpdateAccountPlan godoc
+// @Summary Change account plan
+// @Description Changes the plan of the account, the new plan is applied once the access tokens of the account are refreshed
+// @ID handle_admin_update_account_plan
+// @Tags Admin
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "UUID of account"
+// @Param Plan body PlanRequest true "Change Plan Request"
+// @Success 200 {object} rest.StandardResponse{data=AdminAccountResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/accounts/{uuid}/plan [put]
+func (h *YggdrasilHandler) HandleAdminUpdateAccountPlan(c *gin.Context) {
+	req := PlanRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	UUID := c.Param("uuid")
+
+	res, err := h.accountSvc.SetAccountPlan(UUID, authentication.Plan(req.Plan))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(toAdminAccount(res)))
+}
+
+// HandleAdminImpersonate godoc
+// @Summary Impersonate account
+// @Description Issues an access token of the account which can not be refreshed, the impersonation is recorded with its reason
+// @ID handle_admin_impersonate
+// @Tags Admin
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "UUID of account"
+// @Param Impersonation body ImpersonationRequest true "Impersonation Request"
+// @Success 200 {object} rest.StandardResponse{data=TokenResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/accounts/{uuid}/impersonate [post]
+func (h *YggdrasilHandler) HandleAdminImpersonate(c *gin.Context) {
+	req := ImpersonationRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	UUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.accountSvc.Impersonate(claims.UserID, UUID, req.Reason)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(TokenResponse{
+		Token:     res.AccessToken,
+		ExpiresIn: res.ExpiresIn,
+	}))
+}
+
+// HandleAdminGetImpersonations godoc
+// @Summary List impersonations
+// @Description Lists the audit records of the impersonations, newest first
+// @ID handle_admin_get_impersonations
+// @Tags Admin
+// @Security BearerToken
+// @Produce	json
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]authentication.ImpersonationModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/impersonations [get]
+func (h *YggdrasilHandler) HandleAdminGetImpersonations(c *gin.Context) {
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.accountSvc.ListImpersonations(paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleAdminGetApplications godoc
+// @Summary List all applications
+// @Description Lists the applications of all accounts with their device counts, newest first
+// @ID handle_admin_get_applications
+// @Tags Admin
+// @Security BearerToken
+// @Produce	json
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]AdminApplicationResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/admin/applications [get]
+func (h *YggdrasilHandler) HandleAdminGetApplications(c *gin.Context) {
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.applicationSvc.ListAll(paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	results := make([]*AdminApplicationResponse, 0, len(res))
+	for _, item := range res {
+		results = append(results, toAdminApplication(item))
+	}
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(results))
+}
+
+type PlanRequest struct {
+	Plan string `json:"plan" binding:"required,oneof=free pro" example:"pro"`
+}
+
+type ImpersonationRequest struct {
+	Reason string `json:"reason" binding:"required,max=1024" example:"Investigating support ticket #1234"`
+}
+
+type AdminAccountResponse struct {
+	UUID          string     `json:"uuid" example:"2550a565-98b4-47ce-9529-ab5c0da51556"`
+	Email         string     `json:"email" example:"john@myfancywebsite.com"`
+	Company       string     `json:"company" example:"My Fancy Company"`
+	Plan          string     `json:"plan" example:"free"`
+	IsSuperUser   bool       `json:"is_super_user"`
+	Active        bool       `json:"active"`
+	Confirmed     bool       `json:"confirmed"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	LastLoginDate *time.Time `json:"last_login_date,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type AdminApplicationResponse struct {
+	ID             uint       `json:"id" example:"1"`
+	UUID           string     `json:"uuid" example:"2550a565-98b4-47ce-9529-ab5c0da51556"`
+	Name           string     `json:"name" example:"My Fancy Application"`
+	AccountID      uint       `json:"account_id" example:"1"`
+	OrganizationID uint       `json:"organization_id,omitempty" example:"1"`
+	DeviceCount    int64      `json:"device_count" example:"1024"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+func toAdminAccount(item *authentication.AccountModel) *AdminAccountResponse {
+	res := &AdminAccountResponse{
+		UUID:        item.UUID,
+		Email:       item.Email,
+		Company:     item.CompanyName,
+		Plan:        string(item.Plan),
+		IsSuperUser: item.IsSuperUser,
+		Active:      item.Active,
+		Confirmed:   item.Confirmed,
+		MFAEnabled:  item.MFAEnabled,
+		CreatedAt:   item.CreatedAt,
+	}
+	if item.LastLoginDate.Valid {
+		res.LastLoginDate = &item.LastLoginDate.Time
+	}
+	return res
+}
+
+func toAdminApplication(item *applications.ApplicationModel) *AdminApplicationResponse {
+	return &AdminApplicationResponse{
+		ID:             item.ID,
+		UUID:           item.UUID,
+		Name:           item.Name,
+		AccountID:      item.AccountID,
+		OrganizationID: item.OrganizationID,
+		DeviceCount:    item.DeviceCount,
+		CreatedAt:      item.CreatedAt,
+		DeletedAt:      item.DeletedAt,
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"time"
+)
+
+// HandleCreateAPIKey godoc
+// @Summary Create api key
+// @Description Creates a named api key with the given scopes for the given Ratatoskr App, the key itself is only returned once
+// @ID handle_create_api_key
+// @Tags ApiKeys
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param APIKey body APIKeyRequest true "Create API Key Request"
+// @Success 200 {object} rest.StandardResponse{data=applications.APIKeyModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/api_keys [post]
+func (h *YggdrasilHandler) HandleCreateAPIKey(c *gin.Context) {
+	req := APIKeyRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	scopes := make([]applications.Scope, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, applications.Scope(scope))
+	}
+	res, err := h.applicationSvc.CreateAPIKey(claims.UserID, aUUID, applications.APIKeyModel{
+		Name:      req.Name,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetAPIKeys godoc
+// @Summary List api keys
+// @Description Lists the api keys of the given Ratatoskr App with their scopes, expiry and last use
+// @ID handle_get_api_keys
+// @Tags ApiKeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]applications.APIKeyModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/api_keys [get]
+func (h *YggdrasilHandler) HandleGetAPIKeys(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.applicationSvc.ListAPIKeys(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleRotateAPIKey godoc
+// @Summary Rotate api key
+// @Description Creates a replacement of the api key with the same name and scopes, the old key keeps working during the rotation overlap window
+// @ID handle_rotate_api_key
+// @Tags ApiKeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of api key"
+// @Success 200 {object} rest.StandardResponse{data=applications.APIKeyModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/api_keys/{uuid}/rotate [post]
+func (h *YggdrasilHandler) HandleRotateAPIKey(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	kUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.applicationSvc.RotateAPIKey(claims.UserID, aUUID, kUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleRevokeAPIKey godoc
+// @Summary Revoke api key
+// @Description Removes the api key of the given Ratatoskr App, it stops working right away
+// @ID handle_revoke_api_key
+// @Tags ApiKeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of api key"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/api_keys/{uuid} [delete]
+func (h *YggdrasilHandler) HandleRevokeAPIKey(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	kUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	err := h.applicationSvc.RevokeAPIKey(claims.UserID, aUUID, kUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=255" example:"Backend Server"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=devices:read tags:write notifications:send" example:"devices:read,tags:write"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
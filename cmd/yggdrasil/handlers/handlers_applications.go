@@ -7,6 +7,7 @@ import (
 	"github.com/subzerobo/ratatoskr/pkg/rest"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // HandleCreateApplication godoc
@@ -20,6 +21,7 @@ import (
 // @Param Application body ApplicationRequest true "Create Application Request"
 // @Success 200 {object} rest.StandardResponse{data=ApplicationResponse} "Success Result"
 // @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Invalid FCM service account"
 // @Failure 500 {object} rest.StandardResponse
 // @Router /v1/applications [post]
 func (h *YggdrasilHandler) HandleCreateApplication(c *gin.Context) {
@@ -98,6 +100,47 @@ func (h *YggdrasilHandler) HandleApplicationDetail(c *gin.Context) {
 	c.JSON(http.StatusOK, rest.GetSuccessResponse(toSingle(res)))
 }
 
+// HandleUpdateApplication godoc
+// @Summary Updates application settings
+// @Description Updates the name, url and FCM settings of the application, the FCM service account JSON is validated before saving
+// @ID handle_update_application
+// @Tags Applications
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "UUID of user-owned application"
+// @Param Application body ApplicationRequest true "Update Application Request"
+// @Success 200 {object} rest.StandardResponse{data=ApplicationResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 409 {object} rest.StandardResponse "FCM sender id is used by another application"
+// @Failure 422 {object} rest.StandardResponse "Invalid FCM service account"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/applications/{uuid} [put]
+func (h *YggdrasilHandler) HandleUpdateApplication(c *gin.Context) {
+	req := ApplicationRequest{}
+	uuid := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.applicationSvc.Update(claims.UserID, uuid, applications.ApplicationModel{
+		Name:         req.Name,
+		FCMSenderID:  req.FMCSenderID,
+		FCMAdminJSON: req.FCMAdminJson,
+		URL:          req.URL,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(toSingle(res)))
+}
+
 // HandleResetAuthToken godoc
 // @Summary Updates the Auth token with new one
 // @Description Updates the Auth token with new one
@@ -152,6 +195,59 @@ func (h *YggdrasilHandler) HandleUpdateIdentityVerification(c *gin.Context) {
 	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
 }
 
+// HandleDeleteApplication godoc
+// @Summary Deletes application
+// @Description Deletes the application, it stops serving SDK requests right away and is purged with all of its data after the grace period
+// @ID handle_delete_application
+// @Tags Applications
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=ApplicationResponse} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/applications/{uuid} [delete]
+func (h *YggdrasilHandler) HandleDeleteApplication(c *gin.Context) {
+	uuid := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.applicationSvc.Delete(claims.UserID, uuid)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(toSingle(res)))
+}
+
+// HandleRestoreApplication godoc
+// @Summary Restores deleted application
+// @Description Restores a deleted application which has not passed its deletion grace period
+// @ID handle_restore_application
+// @Tags Applications
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=ApplicationResponse} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 410 {object} rest.StandardResponse "Grace period is over"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/applications/{uuid}/restore [post]
+func (h *YggdrasilHandler) HandleRestoreApplication(c *gin.Context) {
+	uuid := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.applicationSvc.Restore(claims.UserID, uuid)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(toSingle(res)))
+}
+
 // HandleGetAndroidGroups godoc
 // @Summary Android groups and channels
 // @Description Gets a list of Android groups and child categories for the given Ratatoskr App
@@ -398,13 +494,16 @@ type ApplicationRequest struct {
 }
 
 type ApplicationResponse struct {
-	ID           uint   `json:"id" example:"1"`
-	UUID         string `json:"uuid" example:"2550a565-98b4-47ce-9529-ab5c0da51556"`
-	Name         string `json:"name"  example:"My Fancy Application"`
-	FMCSenderID  string `json:"fmc_sender_id" example:"123456789"`
-	FCMAdminJson string `json:"fcm_admin_json" example:"{....}"`
-	AuthKey      string `json:"auth_key" example:"E4YfpiZLajkjtOO8BbOlNK5Skbs2Ez63EdrFBE7xdiruInuB7geHYlHpkr5rPHSy"`
-	URL          string `json:"url" example:"https://myfancywebsite.com"`
+	ID           uint       `json:"id" example:"1"`
+	UUID         string     `json:"uuid" example:"2550a565-98b4-47ce-9529-ab5c0da51556"`
+	Name         string     `json:"name"  example:"My Fancy Application"`
+	FMCSenderID  string     `json:"fmc_sender_id" example:"123456789"`
+	FCMAdminJson string     `json:"fcm_admin_json,omitempty" example:"{....}"` // Only sent to roles which can edit the settings
+	AuthKey      string     `json:"auth_key" example:"E4YfpiZLajkjtOO8BbOlNK5Skbs2Ez63EdrFBE7xdiruInuB7geHYlHpkr5rPHSy"`
+	URL          string     `json:"url" example:"https://myfancywebsite.com"`
+	Role         string     `json:"role" example:"owner"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt      *time.Time `json:"purge_at,omitempty"`
 }
 
 type AuthKeyResponse struct {
@@ -430,14 +529,21 @@ type AndroidCategoryRequest struct {
 }
 
 func toSingle(item *applications.ApplicationModel) *ApplicationResponse {
-	return &ApplicationResponse{
-		ID:           item.ID,
-		UUID:         item.UUID,
-		Name:         item.Name,
-		FMCSenderID:  item.FCMSenderID,
-		FCMAdminJson: item.FCMAdminJSON,
-		URL:          item.URL,
+	res := &ApplicationResponse{
+		ID:          item.ID,
+		UUID:        item.UUID,
+		Name:        item.Name,
+		FMCSenderID: item.FCMSenderID,
+		URL:         item.URL,
+		Role:        string(item.Role),
+		DeletedAt:   item.DeletedAt,
+		PurgeAt:     item.PurgeAt,
+	}
+	// The FCM admin JSON holds the private key of the Firebase service account
+	if item.Role.Can(applications.PermissionEditSettings) {
+		res.FCMAdminJson = item.FCMAdminJSON
 	}
+	return res
 }
 
 func toList(list []*applications.ApplicationModel) []*ApplicationResponse {
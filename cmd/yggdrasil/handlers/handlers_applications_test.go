@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+)
+
+func TestToSingleRedactsFCMAdminJSON(t *testing.T) {
+	item := applications.ApplicationModel{UUID: "app", FCMAdminJSON: `{"private_key":"secret"}`}
+	for _, role := range []applications.Role{applications.RoleReadOnly, applications.RoleMarketer, applications.RoleDeveloper} {
+		item.Role = role
+		if res := toSingle(&item); res.FCMAdminJson != "" {
+			t.Fatalf("%s member got the fcm admin json", role)
+		}
+	}
+	for _, role := range []applications.Role{applications.RoleOwner, applications.RoleAdmin} {
+		item.Role = role
+		if res := toSingle(&item); res.FCMAdminJson != item.FCMAdminJSON {
+			t.Fatalf("%s member did not get the fcm admin json", role)
+		}
+	}
+}
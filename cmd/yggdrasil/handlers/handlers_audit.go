@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/audit"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"time"
+)
+
+// HandleGetAuditEntries godoc
+// @Summary Audit log
+// @Description Lists the mutating calls made on the given Ratatoskr App with the changes they have made, newest first
+// @ID handle_get_audit_entries
+// @Tags Applications
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of user-owned application"
+// @Param action query string false "Action of the entries, e.g. PATCH /v1/applications/:uuid"
+// @Param actor query string false "Email of the account which has made the calls"
+// @Param from query string false "Entries created at or after the time (RFC3339)"
+// @Param until query string false "Entries created before the time (RFC3339)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]audit.EntryModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/applications/{uuid}/audit [get]
+func (h *YggdrasilHandler) HandleGetAuditEntries(c *gin.Context) {
+	aUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	filter := audit.FilterModel{
+		Action:     c.Query("action"),
+		ActorEmail: c.Query("actor"),
+	}
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+			return
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+			return
+		}
+	}
+
+	res, err := h.auditSvc.List(claims.UserID, aUUID, filter, paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/authentication"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/rest"
 	"net/http"
@@ -40,13 +41,13 @@ func (h *YggdrasilHandler) HandleSignup(c *gin.Context) {
 
 // HandleLogin godoc
 // @Summary Login user using email and password combination
-// @Description Login user using email and password combination
+// @Description Login user using email and password combination, accounts with two-factor authentication get an mfa token to complete the login by /v1/auth/mfa/verify
 // @ID handle_login
 // @Tags Authentication
 // @Accept	json
 // @Produce	json
 // @Param EventMessage body LoginRequest true "Login Request Payload"
-// @Success 200 {object} rest.StandardResponse "success Result"
+// @Success 200 {object} rest.StandardResponse{data=LoginResponse} "success Result"
 // @Failure 400 {object} rest.StandardResponse "validation error"
 // @Failure 401 {object} rest.StandardResponse "invalid credentials"
 // @Failure 403 {object} rest.StandardResponse "account is not active or email is not confirmed"
@@ -67,16 +68,207 @@ func (h *YggdrasilHandler) HandleLogin(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, rest.GetSuccessResponse(LoginResponse{
-		Token: token,
-		UserInfo: userInfoResponse{
-			Company:      uInfo.CompanyName,
-			Email:        uInfo.Email,
-			ProfilePhoto: uInfo.Picture,
-		},
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(newLoginResponse(uInfo, token)))
+}
+
+// HandleRefreshToken godoc
+// @Summary Refresh the access token
+// @Description Issues a new access token and replaces the refresh token of the session, refresh tokens can only be used once and reusing one logs the session out
+// @ID handle_refresh_token
+// @Tags Authentication
+// @Accept	json
+// @Produce	json
+// @Param RefreshTokenRequest body RefreshTokenRequest true "Refresh Token Request Payload"
+// @Success 200 {object} rest.StandardResponse{data=TokenResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid, expired or reused refresh token"
+// @Failure 403 {object} rest.StandardResponse "Account is not active"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/refresh [post]
+func (h *YggdrasilHandler) HandleRefreshToken(c *gin.Context) {
+	req := RefreshTokenRequest{}
+	
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	
+	token, err := h.accountSvc.Refresh(req.RefreshToken)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(TokenResponse{
+		Token:        token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresIn:    token.ExpiresIn,
 	}))
 }
 
+// HandleLogout godoc
+// @Summary Logout the current session
+// @Description Removes the session of the access token, its refresh token and access tokens stop working right away
+// @ID handle_logout
+// @Tags Authentication
+// @Security BearerToken
+// @Produce	json
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 401 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/logout [post]
+func (h *YggdrasilHandler) HandleLogout(c *gin.Context) {
+	claims := getClaims(c)
+	
+	err := h.accountSvc.Logout(claims.UserID, claims.SessionID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleLogoutAll godoc
+// @Summary Logout all sessions
+// @Description Removes all of the sessions of the account including the current one, their tokens stop working right away
+// @ID handle_logout_all
+// @Tags Authentication
+// @Security BearerToken
+// @Produce	json
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 401 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/logout_all [post]
+func (h *YggdrasilHandler) HandleLogoutAll(c *gin.Context) {
+	claims := getClaims(c)
+	
+	err := h.accountSvc.LogoutAll(claims.UserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleVerifyEmail godoc
+// @Summary Confirm the email of an account
+// @Description Confirms the email of the account using the token of the link sent by signup, the account can login afterwards
+// @ID handle_verify_email
+// @Tags Authentication
+// @Produce	json
+// @Param token path string true "Confirmation token"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 404 {object} rest.StandardResponse "Invalid token"
+// @Failure 410 {object} rest.StandardResponse "Expired token"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/verify/{token} [get]
+func (h *YggdrasilHandler) HandleVerifyEmail(c *gin.Context) {
+	err := h.accountSvc.Verify(c.Param("token"))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleResendConfirmation godoc
+// @Summary Resend the confirmation email
+// @Description Sends a new confirmation link to an unconfirmed account, the result is the same for unknown emails
+// @ID handle_resend_confirmation
+// @Tags Authentication
+// @Accept	json
+// @Produce	json
+// @Param EmailRequest body EmailRequest true "Resend Confirmation Request Payload"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/resend_confirmation [post]
+func (h *YggdrasilHandler) HandleResendConfirmation(c *gin.Context) {
+	req := EmailRequest{}
+	
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	
+	err := h.accountSvc.ResendConfirmation(req.Email)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleForgotPassword godoc
+// @Summary Request a password reset email
+// @Description Sends a single use password reset link to the account, the result is the same for unknown emails
+// @ID handle_forgot_password
+// @Tags Authentication
+// @Accept	json
+// @Produce	json
+// @Param EmailRequest body EmailRequest true "Forgot Password Request Payload"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/forgot_password [post]
+func (h *YggdrasilHandler) HandleForgotPassword(c *gin.Context) {
+	req := EmailRequest{}
+	
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	
+	err := h.accountSvc.ForgotPassword(req.Email)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleResetPassword godoc
+// @Summary Reset the password of an account
+// @Description Replaces the password using the token of the link sent by forgot password, the token can only be used once
+// @ID handle_reset_password
+// @Tags Authentication
+// @Accept	json
+// @Produce	json
+// @Param ResetPasswordRequest body ResetPasswordRequest true "Reset Password Request Payload"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error or invalid token"
+// @Failure 410 {object} rest.StandardResponse "Expired token"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/reset_password [post]
+func (h *YggdrasilHandler) HandleResetPassword(c *gin.Context) {
+	req := ResetPasswordRequest{}
+	
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	
+	err := h.accountSvc.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
 // HandleOAuthLoginURL godoc
 // @SummaryGenerate the OAuth URL for the specified provider
 // @Description This endpoint generate an URL for the specified provider name on the url
@@ -99,6 +291,23 @@ func (h *YggdrasilHandler) HandleOAuthLoginURL(c *gin.Context) {
 	c.JSON(http.StatusOK, rest.GetSuccessResponse(OauthRedirectResponse{URL: res}))
 }
 
+// HandleOAuthCallback godoc
+// @Summary Complete the OAuth login of the specified provider
+// @Description Signs the user in using the code given by the provider, the identity is linked to the account with the same verified email or a new account is registered
+// @ID handle_oauth_step2
+// @Tags Authentication
+// @Produce	json
+// @Param provider path string true "OAuth provider name (google, facebook, github,..)"
+// @Param state query string true "State generated by the first step"
+// @Param code query string true "Authorization code given by the provider"
+// @Success 200 {object} rest.StandardResponse{data=LoginResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Provider has not shared an email"
+// @Failure 401 {object} rest.StandardResponse "Invalid state or code"
+// @Failure 403 {object} rest.StandardResponse "Account is not active"
+// @Failure 404 {object} rest.StandardResponse "Unknown provider"
+// @Failure 409 {object} rest.StandardResponse "Email is in use and is not verified by the provider"
+// @Failure 502 {object} rest.StandardResponse "Provider is not available"
+// @Router /v1/auth/oauth/callback/{provider} [get]
 func (h *YggdrasilHandler) HandleOAuthCallback(c *gin.Context) {
 	provider := c.Param("provider")
 	state := c.Query("state")
@@ -111,14 +320,7 @@ func (h *YggdrasilHandler) HandleOAuthCallback(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, rest.GetSuccessResponse(LoginResponse{
-		Token: token,
-		UserInfo: userInfoResponse{
-			Company:      uInfo.CompanyName,
-			Email:        uInfo.Email,
-			ProfilePhoto: uInfo.Picture,
-		},
-	}))
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(newLoginResponse(uInfo, token)))
 	
 }
 
@@ -133,9 +335,32 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required,min=8" example:"testpassword"`
 }
 
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email" example:"ali.kaviani@gmail.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"E4YfpiZLajkjtOO8BbOlNK5Skbs2Ez63EdrFBE7xdiruInuB7geHYlHpkr5rPHSy"`
+	Password string `json:"password" binding:"required,min=8" example:"testpassword"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"E4YfpiZLajkjtOO8BbOlNK5Skbs2Ez63EdrFBE7xdiruInuB7geHYlHpkr5rPHSy"`
+}
+
 type LoginResponse struct {
-	Token    string           `json:"token"`
-	UserInfo userInfoResponse `json:"user_info,omitempty"`
+	Token        string           `json:"token,omitempty"`
+	RefreshToken string           `json:"refresh_token,omitempty"`
+	ExpiresIn    int64            `json:"expires_in,omitempty"`
+	MFARequired  bool             `json:"mfa_required"`
+	MFAToken     string           `json:"mfa_token,omitempty"`
+	UserInfo     userInfoResponse `json:"user_info,omitempty"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 type userInfoResponse struct {
@@ -147,3 +372,18 @@ type userInfoResponse struct {
 type OauthRedirectResponse struct {
 	URL string `json:"url"`
 }
+
+func newLoginResponse(uInfo *authentication.AccountModel, token *authentication.TokenModel) LoginResponse {
+	return LoginResponse{
+		Token:        token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresIn:    token.ExpiresIn,
+		MFARequired:  token.MFAToken != "",
+		MFAToken:     token.MFAToken,
+		UserInfo: userInfoResponse{
+			Company:      uInfo.CompanyName,
+			Email:        uInfo.Email,
+			ProfilePhoto: uInfo.Picture,
+		},
+	}
+}
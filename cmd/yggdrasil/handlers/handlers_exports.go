@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/exports"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"strconv"
+)
+
+// HandleCreateExport godoc
+// @Summary Export devices
+// @Description Queues an export of all devices of the given Ratatoskr App including their tags, optionally limited to the devices of a segment
+// @ID handle_create_export
+// @Tags Exports
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param Export body ExportRequest true "Create Export Request"
+// @Success 200 {object} rest.StandardResponse{data=exports.ExportModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/exports [post]
+func (h *YggdrasilHandler) HandleCreateExport(c *gin.Context) {
+	req := ExportRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.exportSvc.Create(claims.UserID, aUUID, exports.Format(req.Format), req.SegmentUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetExports godoc
+// @Summary List exports
+// @Description Gets the list of device exports of the given Ratatoskr App, completed exports carry a short-lived download link
+// @ID handle_get_exports
+// @Tags Exports
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]exports.ExportModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/exports [get]
+func (h *YggdrasilHandler) HandleGetExports(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.exportSvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetExport godoc
+// @Summary Export details
+// @Description Gets the status of a device export of the given Ratatoskr App, completed exports carry a short-lived download link
+// @ID handle_get_export
+// @Tags Exports
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of export"
+// @Success 200 {object} rest.StandardResponse{data=exports.ExportModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/exports/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetExport(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	eUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.exportSvc.Details(claims.UserID, aUUID, eUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDownloadExport godoc
+// @Summary Download export
+// @Description Downloads the gzipped file of a completed export using the signed link of the export details
+// @ID handle_download_export
+// @Tags Exports
+// @Produce	application/gzip
+// @Param uuid path string true "UUID of export"
+// @Param expires query int true "Link expiration as unix timestamp"
+// @Param signature query string true "Link signature"
+// @Success 200 {file} file "Export file"
+// @Failure 403 {object} rest.StandardResponse "Invalid link"
+// @Failure 410 {object} rest.StandardResponse "Expired link or export"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/exports/{uuid}/download [get]
+func (h *YggdrasilHandler) HandleDownloadExport(c *gin.Context) {
+	eUUID := c.Param("uuid")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse("expires is invalid"))
+		return
+	}
+
+	item, file, err := h.exportSvc.Download(eUUID, expires, c.Query("signature"))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, item.Size, "application/gzip", file, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="export-%s.%s.gz"`, item.UUID, item.Format),
+	})
+}
+
+type ExportRequest struct {
+	Format      string `json:"format" binding:"omitempty,oneof=csv ndjson" example:"csv"`
+	SegmentUUID string `json:"segment_uuid" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/imports"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"io"
+	"net/http"
+)
+
+// HandleCreateImport godoc
+// @Summary Import devices
+// @Description Uploads a CSV or NDJSON file of devices which is imported in background, uploading the same file again returns the existing import
+// @ID handle_create_import
+// @Tags Imports
+// @Security BearerToken
+// @Accept	multipart/form-data
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param format query string false "File format (csv or ndjson), detected from the file extension when omitted"
+// @Param file formData file true "Devices file"
+// @Success 200 {object} rest.StandardResponse{data=imports.ImportModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/imports [post]
+func (h *YggdrasilHandler) HandleCreateImport(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	// The file is streamed to the import storage part by part instead of being buffered in memory
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		res, err := h.importSvc.Upload(claims.UserID, aUUID, part.FileName(), imports.Format(c.Query("format")), part)
+		if err != nil {
+			kind, _ := errors.AsKindContext(err)
+			c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse("file is required"))
+}
+
+// HandleGetImports godoc
+// @Summary List imports
+// @Description Gets the list of device imports of the given Ratatoskr App
+// @ID handle_get_imports
+// @Tags Imports
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]imports.ImportModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/imports [get]
+func (h *YggdrasilHandler) HandleGetImports(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.importSvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetImport godoc
+// @Summary Import details
+// @Description Gets the status and progress of a device import of the given Ratatoskr App
+// @ID handle_get_import
+// @Tags Imports
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of import"
+// @Success 200 {object} rest.StandardResponse{data=imports.ImportModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/imports/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetImport(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	iUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.importSvc.Details(claims.UserID, aUUID, iUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetImportErrors godoc
+// @Summary Import errors
+// @Description Gets the rejected rows of a device import of the given Ratatoskr App
+// @ID handle_get_import_errors
+// @Tags Imports
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of import"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]imports.RowErrorModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/imports/{uuid}/errors [get]
+func (h *YggdrasilHandler) HandleGetImportErrors(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	iUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.importSvc.Errors(claims.UserID, aUUID, iUUID, paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
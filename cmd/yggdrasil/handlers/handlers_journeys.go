@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleGetJourneys godoc
+// @Summary List journeys
+// @Description Gets the list of journeys defined for the given Ratatoskr App
+// @ID handle_get_journeys
+// @Tags Journeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]journeys.JourneyModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/journeys [get]
+func (h *YggdrasilHandler) HandleGetJourneys(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.journeySvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetJourney godoc
+// @Summary Journey details
+// @Description Gets the definition of a journey of the given Ratatoskr App
+// @ID handle_get_journey
+// @Tags Journeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of journey"
+// @Success 200 {object} rest.StandardResponse{data=journeys.JourneyModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/journeys/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetJourney(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	jUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.journeySvc.Details(claims.UserID, aUUID, jUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleCreateJourney godoc
+// @Summary Create journey
+// @Description Creates a new multi-step journey for the given Ratatoskr App
+// @ID handle_create_journey
+// @Tags Journeys
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param Journey body JourneyRequest true "Create Journey Request"
+// @Success 200 {object} rest.StandardResponse{data=journeys.JourneyModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Invalid journey definition"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/journeys [post]
+func (h *YggdrasilHandler) HandleCreateJourney(c *gin.Context) {
+	req := JourneyRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.journeySvc.Create(claims.UserID, aUUID, req.toModel())
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUpdateJourney godoc
+// @Summary Update journey
+// @Description Replaces the definition of a journey of the given Ratatoskr App, devices already inside the journey continue from their current step
+// @ID handle_update_journey
+// @Tags Journeys
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of journey"
+// @Param Journey body JourneyRequest true "Update Journey Request"
+// @Success 200 {object} rest.StandardResponse{data=journeys.JourneyModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Invalid journey definition"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/journeys/{uuid} [put]
+func (h *YggdrasilHandler) HandleUpdateJourney(c *gin.Context) {
+	req := JourneyRequest{}
+	aUUID := c.Param("app_uuid")
+	jUUID := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	model := req.toModel()
+	model.UUID = jUUID
+	res, err := h.journeySvc.Update(claims.UserID, aUUID, model)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDeleteJourney godoc
+// @Summary Delete journey
+// @Description Deletes a journey of the given Ratatoskr App alongside with the progress of its devices
+// @ID handle_delete_journey
+// @Tags Journeys
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of journey"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/journeys/{uuid} [delete]
+func (h *YggdrasilHandler) HandleDeleteJourney(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	jUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	err := h.journeySvc.Delete(claims.UserID, aUUID, jUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+type JourneyRequest struct {
+	Name      string                    `json:"name" binding:"required" example:"Onboarding"`
+	Active    bool                      `json:"active" example:"true"`
+	Trigger   journeys.TriggerModel     `json:"trigger" binding:"required"`
+	Steps     []journeys.StepModel      `json:"steps" binding:"required,min=1"`
+	ExitRules []journeys.ConditionModel `json:"exit_rules"`
+}
+
+func (r JourneyRequest) toModel() journeys.JourneyModel {
+	return journeys.JourneyModel{
+		Name:      r.Name,
+		Active:    r.Active,
+		Trigger:   r.Trigger,
+		Steps:     r.Steps,
+		ExitRules: r.ExitRules,
+	}
+}
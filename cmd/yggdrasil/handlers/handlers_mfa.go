@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleVerifyMFA godoc
+// @Summary Complete a login using two-factor authentication
+// @Description Completes the login of the mfa token given by login using a code of the authenticator app or a recovery code, codes can only be used once
+// @ID handle_verify_mfa
+// @Tags Authentication
+// @Accept	json
+// @Produce	json
+// @Param MFAVerifyRequest body MFAVerifyRequest true "Verify MFA Request Payload"
+// @Success 200 {object} rest.StandardResponse{data=LoginResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 401 {object} rest.StandardResponse "Invalid mfa token or code"
+// @Failure 403 {object} rest.StandardResponse "Account is not active"
+// @Failure 429 {object} rest.StandardResponse "Too many attempts"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/mfa/verify [post]
+func (h *YggdrasilHandler) HandleVerifyMFA(c *gin.Context) {
+	req := MFAVerifyRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+
+	uInfo, token, err := h.accountSvc.VerifyMFA(req.MFAToken, req.Code)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(newLoginResponse(uInfo, token)))
+}
+
+// HandleEnrollMFA godoc
+// @Summary Enroll two-factor authentication
+// @Description Creates a new totp secret and its otpauth uri to show as a QR code, it is not required on login until it is activated
+// @ID handle_enroll_mfa
+// @Tags Authentication
+// @Security BearerToken
+// @Produce	json
+// @Success 200 {object} rest.StandardResponse{data=MFAEnrollmentResponse} "Success Result"
+// @Failure 409 {object} rest.StandardResponse "Two-factor authentication is already enabled"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/mfa/enroll [post]
+func (h *YggdrasilHandler) HandleEnrollMFA(c *gin.Context) {
+	claims := getClaims(c)
+
+	res, err := h.accountSvc.EnrollMFA(claims.UserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(MFAEnrollmentResponse{
+		Secret: res.Secret,
+		URI:    res.URI,
+	}))
+}
+
+// HandleActivateMFA godoc
+// @Summary Activate two-factor authentication
+// @Description Enables the enrolled secret using a code of the authenticator app, the recovery codes are only returned once
+// @ID handle_activate_mfa
+// @Tags Authentication
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param MFACodeRequest body MFACodeRequest true "Activate MFA Request Payload"
+// @Success 200 {object} rest.StandardResponse{data=RecoveryCodesResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error, invalid code or not enrolled"
+// @Failure 409 {object} rest.StandardResponse "Two-factor authentication is already enabled"
+// @Failure 429 {object} rest.StandardResponse "Too many attempts"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/mfa/activate [post]
+func (h *YggdrasilHandler) HandleActivateMFA(c *gin.Context) {
+	req := MFACodeRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	codes, err := h.accountSvc.ActivateMFA(claims.UserID, req.Code)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+// HandleDisableMFA godoc
+// @Summary Disable two-factor authentication
+// @Description Removes the totp secret and the recovery codes using a code of the authenticator app or a recovery code
+// @ID handle_disable_mfa
+// @Tags Authentication
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param MFACodeRequest body MFACodeRequest true "Disable MFA Request Payload"
+// @Success 200 {object} rest.StandardResponse "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error, invalid code or not enabled"
+// @Failure 429 {object} rest.StandardResponse "Too many attempts"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/mfa/disable [post]
+func (h *YggdrasilHandler) HandleDisableMFA(c *gin.Context) {
+	req := MFACodeRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	err := h.accountSvc.DisableMFA(claims.UserID, req.Code)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleRegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replaces the recovery codes using a code of the authenticator app or a recovery code, the old codes stop working
+// @ID handle_regenerate_recovery_codes
+// @Tags Authentication
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param MFACodeRequest body MFACodeRequest true "Regenerate Recovery Codes Request Payload"
+// @Success 200 {object} rest.StandardResponse{data=RecoveryCodesResponse} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error, invalid code or not enabled"
+// @Failure 429 {object} rest.StandardResponse "Too many attempts"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/auth/mfa/recovery_codes [post]
+func (h *YggdrasilHandler) HandleRegenerateRecoveryCodes(c *gin.Context) {
+	req := MFACodeRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	codes, err := h.accountSvc.RegenerateRecoveryCodes(claims.UserID, req.Code)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=16" example:"123456"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,max=16" example:"123456"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -4,10 +4,12 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/juliangruber/go-intersect"
+	"github.com/subzerobo/ratatoskr/internal/services/audit"
 	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"net/http"
 	"regexp"
+	"strings"
 )
 
 var bearerRegexp = regexp.MustCompile(`^(?:B|b)earer (\S+$)`)
@@ -41,19 +43,79 @@ func (h *YggdrasilHandler) JWTMiddleware(secret string, allowedRoles []string) g
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
+		appClaims := token.Claims.(*authentication2.AppClaims)
 		if allowedRoles != nil {
-			appClaims := token.Claims.(*authentication2.AppClaims)
 			interSection := intersect.Hash(appClaims.Roles, allowedRoles)
 			if len(interSection.([]interface{})) == 0 {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
 		}
+		// Logged out sessions are revoked before their access tokens are expired
+		if err = h.accountSvc.CheckToken(appClaims); err != nil {
+			kind, _ := errors.AsKindContext(err)
+			c.AbortWithStatus(kind.GetHttpStatus())
+			return
+		}
 		c.Set(TokenKey, token)
 		c.Next()
 	}
 }
 
+// AuditMiddleware records the mutating calls of the logged-in accounts, calls made on an application are recorded
+// with the changes of the application settings between before and after the call. It runs after JWTMiddleware
+func (h *YggdrasilHandler) AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := getClaims(c)
+		method := c.Request.Method
+		if claims == nil || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		aUUID := auditApplicationUUID(c)
+		before, err := h.auditSvc.Snapshot(aUUID)
+		if err != nil {
+			h.Logger.Error(errors.WithMessage(err, "failed to take the audit snapshot"))
+		}
+
+		c.Next()
+
+		after, err := h.auditSvc.Snapshot(aUUID)
+		if err != nil {
+			h.Logger.Error(errors.WithMessage(err, "failed to take the audit snapshot"))
+		}
+		entry := audit.EntryModel{
+			ActorID:    claims.UserID,
+			ActorEmail: claims.Email,
+			SessionID:  claims.SessionID,
+			Action:     method + " " + c.FullPath(),
+			Status:     c.Writer.Status(),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+		}
+		if claims.Impersonator != nil {
+			entry.ImpersonatorID = claims.Impersonator.UserID
+			entry.ImpersonatorEmail = claims.Impersonator.Email
+		}
+		err = h.auditSvc.Record(entry, before, after)
+		if err != nil {
+			h.Logger.Error(errors.WithMessage(err, "failed to record the audit entry"))
+		}
+	}
+}
+
+// auditApplicationUUID returns the uuid of the application the call is made on, it is empty for other calls
+func auditApplicationUUID(c *gin.Context) string {
+	if aUUID := c.Param("app_uuid"); aUUID != "" {
+		return aUUID
+	}
+	if strings.HasPrefix(c.FullPath(), "/v1/applications/:uuid") {
+		return c.Param("uuid")
+	}
+	return ""
+}
+
 // extractBearerToken get the jwt token from header
 func extractBearerToken(c *gin.Context) (string, error) {
 	authHeader := c.GetHeader("Authorization")
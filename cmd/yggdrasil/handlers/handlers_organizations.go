@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleCreateOrganization godoc
+// @Summary Create organization
+// @Description Creates a new organization with the logged-in account as its owner
+// @ID handle_create_organization
+// @Tags Organizations
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param Organization body OrganizationRequest true "Create Organization Request"
+// @Success 200 {object} rest.StandardResponse{data=organizations.OrganizationModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations [post]
+func (h *YggdrasilHandler) HandleCreateOrganization(c *gin.Context) {
+	req := OrganizationRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.Create(claims.UserID, req.Name)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetOrganizations godoc
+// @Summary List organizations
+// @Description Lists the organizations the logged-in account is a member of with its role in them
+// @ID handle_get_organizations
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Success 200 {object} rest.StandardResponse{data=[]organizations.OrganizationModel} "Success Result"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations [get]
+func (h *YggdrasilHandler) HandleGetOrganizations(c *gin.Context) {
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.List(claims.UserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetOrganization godoc
+// @Summary Organization details
+// @Description Gets the organization with the role of the logged-in account in it
+// @ID handle_get_organization
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Success 200 {object} rest.StandardResponse{data=organizations.OrganizationModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetOrganization(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.Details(claims.UserID, oUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetOrganizationMembers godoc
+// @Summary List organization members
+// @Description Lists the members of the organization with their roles
+// @ID handle_get_organization_members
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Success 200 {object} rest.StandardResponse{data=[]organizations.MemberModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/members [get]
+func (h *YggdrasilHandler) HandleGetOrganizationMembers(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.ListMembers(claims.UserID, oUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUpdateOrganizationMember godoc
+// @Summary Change member role
+// @Description Changes the role of the member in the organization, only owners can give or take the owner role and the last owner can not be changed
+// @ID handle_update_organization_member
+// @Tags Organizations
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Param m_uuid path string true "UUID of member"
+// @Param Role body RoleRequest true "Member Role Request"
+// @Success 200 {object} rest.StandardResponse{data=organizations.MemberModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error or invalid role"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow the change"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 409 {object} rest.StandardResponse "Last owner of the organization"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/members/{m_uuid} [put]
+func (h *YggdrasilHandler) HandleUpdateOrganizationMember(c *gin.Context) {
+	req := RoleRequest{}
+	oUUID := c.Param("uuid")
+	mUUID := c.Param("m_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.UpdateMember(claims.UserID, oUUID, mUUID, applications.Role(req.Role))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleRemoveOrganizationMember godoc
+// @Summary Remove member
+// @Description Removes the member from the organization with its roles on the applications, members can remove themselves to leave the organization
+// @ID handle_remove_organization_member
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Param m_uuid path string true "UUID of member"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow the removal"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 409 {object} rest.StandardResponse "Last owner of the organization"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/members/{m_uuid} [delete]
+func (h *YggdrasilHandler) HandleRemoveOrganizationMember(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	mUUID := c.Param("m_uuid")
+	claims := getClaims(c)
+
+	err := h.organizationSvc.RemoveMember(claims.UserID, oUUID, mUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleCreateInvitation godoc
+// @Summary Invite to organization
+// @Description Emails a single use link to join the organization with the role, inviting an email again replaces its pending invitation
+// @ID handle_create_invitation
+// @Tags Organizations
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Param Invitation body InvitationRequest true "Invitation Request"
+// @Success 200 {object} rest.StandardResponse{data=organizations.InvitationModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error or invalid role"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow inviting"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 409 {object} rest.StandardResponse "Already a member"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/invitations [post]
+func (h *YggdrasilHandler) HandleCreateInvitation(c *gin.Context) {
+	req := InvitationRequest{}
+	oUUID := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.Invite(claims.UserID, oUUID, req.Email, applications.Role(req.Role))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetInvitations godoc
+// @Summary List invitations
+// @Description Lists the pending invitations of the organization
+// @ID handle_get_invitations
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Success 200 {object} rest.StandardResponse{data=[]organizations.InvitationModel} "Success Result"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow managing invitations"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/invitations [get]
+func (h *YggdrasilHandler) HandleGetInvitations(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.ListInvitations(claims.UserID, oUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleRevokeInvitation godoc
+// @Summary Revoke invitation
+// @Description Revokes the pending invitation, its link stops working right away
+// @ID handle_revoke_invitation
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Param i_uuid path string true "UUID of invitation"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow managing invitations"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/invitations/{i_uuid} [delete]
+func (h *YggdrasilHandler) HandleRevokeInvitation(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	iUUID := c.Param("i_uuid")
+	claims := getClaims(c)
+
+	err := h.organizationSvc.RevokeInvitation(claims.UserID, oUUID, iUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleAcceptInvitation godoc
+// @Summary Accept invitation
+// @Description Joins the organization using the token of the invitation email, it can only be accepted by the account with the confirmed email it has been sent to
+// @ID handle_accept_invitation
+// @Tags Organizations
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param Invitation body AcceptInvitationRequest true "Accept Invitation Request"
+// @Success 200 {object} rest.StandardResponse{data=organizations.OrganizationModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse "Invitation of another email or unconfirmed account"
+// @Failure 404 {object} rest.StandardResponse "Invalid invitation"
+// @Failure 409 {object} rest.StandardResponse "Already a member"
+// @Failure 410 {object} rest.StandardResponse "Invitation has been expired"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/invitations/accept [post]
+func (h *YggdrasilHandler) HandleAcceptInvitation(c *gin.Context) {
+	req := AcceptInvitationRequest{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.AcceptInvitation(claims.UserID, req.Token)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleMoveApplication godoc
+// @Summary Move application to organization
+// @Description Makes the application part of the organization, it requires the owner role on the application and the owner or admin role in the organization. The roles given on the application are removed
+// @ID handle_move_application
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param uuid path string true "UUID of organization"
+// @Param app_uuid path string true "UUID of application"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 403 {object} rest.StandardResponse "Role does not allow moving the application"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 409 {object} rest.StandardResponse "Application is already part of the organization"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/organizations/{uuid}/applications/{app_uuid} [post]
+func (h *YggdrasilHandler) HandleMoveApplication(c *gin.Context) {
+	oUUID := c.Param("uuid")
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	err := h.organizationSvc.MoveApplication(claims.UserID, oUUID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleGetApplicationMembers godoc
+// @Summary List application roles
+// @Description Lists the members of the organization which have been given a role on the given Ratatoskr App
+// @ID handle_get_application_members
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of application"
+// @Success 200 {object} rest.StandardResponse{data=[]organizations.ApplicationMemberModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/members [get]
+func (h *YggdrasilHandler) HandleGetApplicationMembers(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.organizationSvc.ListApplicationMembers(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleSetApplicationRole godoc
+// @Summary Give application role
+// @Description Gives the member of the organization a role on the given Ratatoskr App which replaces its role in the organization on it, owners and admins of the organization keep their role
+// @ID handle_set_application_role
+// @Tags Organizations
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of application"
+// @Param uuid path string true "UUID of organization member"
+// @Param Role body RoleRequest true "Application Role Request"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error, invalid role or personal application"
+// @Failure 403 {object} rest.StandardResponse "Role does not have the permission"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/members/{uuid} [put]
+func (h *YggdrasilHandler) HandleSetApplicationRole(c *gin.Context) {
+	req := RoleRequest{}
+	aUUID := c.Param("app_uuid")
+	mUUID := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	err := h.organizationSvc.SetApplicationRole(claims.UserID, aUUID, mUUID, applications.Role(req.Role))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleRemoveApplicationRole godoc
+// @Summary Take application role
+// @Description Takes the role given on the given Ratatoskr App, the member gets its role in the organization back
+// @ID handle_remove_application_role
+// @Tags Organizations
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of application"
+// @Param uuid path string true "UUID of organization member"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Personal application"
+// @Failure 403 {object} rest.StandardResponse "Role does not have the permission"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/members/{uuid} [delete]
+func (h *YggdrasilHandler) HandleRemoveApplicationRole(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	mUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	err := h.organizationSvc.RemoveApplicationRole(claims.UserID, aUUID, mUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255" example:"My Fancy Team"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin developer marketer read_only" example:"developer"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" binding:"required,email,max=255" example:"teammate@myfancywebsite.com"`
+	Role  string `json:"role" binding:"required,oneof=owner admin developer marketer read_only" example:"developer"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
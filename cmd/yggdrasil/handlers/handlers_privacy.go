@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/privacy"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+	"strconv"
+)
+
+// HandleCreatePrivacyRequest godoc
+// @Summary Create data subject request
+// @Description Queues an export or a permanent erasure of all devices, tags, events, purchases and journeys of an external user or a single device of the given Ratatoskr App
+// @ID handle_create_privacy_request
+// @Tags Privacy
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param PrivacyRequest body PrivacyRequest true "Data Subject Request"
+// @Success 200 {object} rest.StandardResponse{data=privacy.RequestModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/privacy_requests [post]
+func (h *YggdrasilHandler) HandleCreatePrivacyRequest(c *gin.Context) {
+	req := PrivacyRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.privacySvc.Create(claims.UserID, aUUID, privacy.RequestType(req.Type), privacy.SubjectModel{
+		ExternalUserID: req.ExternalUserID,
+		DeviceUUID:     req.DeviceUUID,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetPrivacyRequests godoc
+// @Summary List data subject requests
+// @Description Gets the audit trail of data subject requests of the given Ratatoskr App, completed exports carry a short-lived download link
+// @ID handle_get_privacy_requests
+// @Tags Privacy
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]privacy.RequestModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/privacy_requests [get]
+func (h *YggdrasilHandler) HandleGetPrivacyRequests(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.privacySvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetPrivacyRequest godoc
+// @Summary Data subject request details
+// @Description Gets the status and summary of a data subject request of the given Ratatoskr App, completed exports carry a short-lived download link
+// @ID handle_get_privacy_request
+// @Tags Privacy
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of data subject request"
+// @Success 200 {object} rest.StandardResponse{data=privacy.RequestModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/privacy_requests/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetPrivacyRequest(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	rUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.privacySvc.Details(claims.UserID, aUUID, rUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDownloadPrivacyExport godoc
+// @Summary Download subject data
+// @Description Downloads the JSON document of a completed data subject export using the signed link of the request details
+// @ID handle_download_privacy_export
+// @Tags Privacy
+// @Produce	json
+// @Param uuid path string true "UUID of data subject request"
+// @Param expires query int true "Link expiration as unix timestamp"
+// @Param signature query string true "Link signature"
+// @Success 200 {file} file "Subject data"
+// @Failure 403 {object} rest.StandardResponse "Invalid link"
+// @Failure 410 {object} rest.StandardResponse "Expired link or export"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/privacy_requests/{uuid}/download [get]
+func (h *YggdrasilHandler) HandleDownloadPrivacyExport(c *gin.Context) {
+	rUUID := c.Param("uuid")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse("expires is invalid"))
+		return
+	}
+
+	item, file, err := h.privacySvc.Download(rUUID, expires, c.Query("signature"))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, item.Size, "application/json", file, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="subject-%s.json"`, item.UUID),
+	})
+}
+
+type PrivacyRequest struct {
+	Type           string `json:"type" binding:"required,oneof=export erase" example:"export"`
+	ExternalUserID string `json:"external_user_id" binding:"omitempty,max=255" example:"user-1234"`
+	DeviceUUID     string `json:"device_uuid" binding:"omitempty,uuid" example:"407f8f90-d83b-4ad5-912c-556a27c8f249"`
+}
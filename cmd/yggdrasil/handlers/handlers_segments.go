@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleGetSegments godoc
+// @Summary List segments
+// @Description Gets the list of device segments defined for the given Ratatoskr App
+// @ID handle_get_segments
+// @Tags Segments
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]segments.SegmentModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments [get]
+func (h *YggdrasilHandler) HandleGetSegments(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.segmentSvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetSegment godoc
+// @Summary Segment details
+// @Description Gets the filters of a segment of the given Ratatoskr App
+// @ID handle_get_segment
+// @Tags Segments
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of segment"
+// @Success 200 {object} rest.StandardResponse{data=segments.SegmentModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetSegment(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	sUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.segmentSvc.Details(claims.UserID, aUUID, sUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetSegmentSize godoc
+// @Summary Segment size
+// @Description Counts the devices of the given Ratatoskr App which are currently matching the segment
+// @ID handle_get_segment_size
+// @Tags Segments
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of segment"
+// @Success 200 {object} rest.StandardResponse{data=SegmentSizeResponse} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments/{uuid}/size [get]
+func (h *YggdrasilHandler) HandleGetSegmentSize(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	sUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.segmentSvc.Size(claims.UserID, aUUID, sUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(SegmentSizeResponse{Devices: res}))
+}
+
+// HandleCreateSegment godoc
+// @Summary Create segment
+// @Description Creates a new device segment for the given Ratatoskr App
+// @ID handle_create_segment
+// @Tags Segments
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param Segment body SegmentRequest true "Create Segment Request"
+// @Success 200 {object} rest.StandardResponse{data=segments.SegmentModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Invalid filters"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments [post]
+func (h *YggdrasilHandler) HandleCreateSegment(c *gin.Context) {
+	req := SegmentRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.segmentSvc.Create(claims.UserID, aUUID, segments.SegmentModel{
+		Name:    req.Name,
+		Filters: req.Filters,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUpdateSegment godoc
+// @Summary Update segment
+// @Description Updates the name and filters of a segment of the given Ratatoskr App
+// @ID handle_update_segment
+// @Tags Segments
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of segment"
+// @Param Segment body SegmentRequest true "Update Segment Request"
+// @Success 200 {object} rest.StandardResponse{data=segments.SegmentModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 422 {object} rest.StandardResponse "Invalid filters"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments/{uuid} [put]
+func (h *YggdrasilHandler) HandleUpdateSegment(c *gin.Context) {
+	req := SegmentRequest{}
+	aUUID := c.Param("app_uuid")
+	sUUID := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.segmentSvc.Update(claims.UserID, aUUID, segments.SegmentModel{
+		UUID:    sUUID,
+		Name:    req.Name,
+		Filters: req.Filters,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDeleteSegment godoc
+// @Summary Delete segment
+// @Description Deletes a segment of the given Ratatoskr App
+// @ID handle_delete_segment
+// @Tags Segments
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of segment"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/segments/{uuid} [delete]
+func (h *YggdrasilHandler) HandleDeleteSegment(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	sUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	err := h.segmentSvc.Delete(claims.UserID, aUUID, sUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+type SegmentRequest struct {
+	Name    string                 `json:"name" binding:"required" example:"Active buyers"`
+	Filters []segments.FilterModel `json:"filters" binding:"required"`
+}
+
+type SegmentSizeResponse struct {
+	Devices int64 `json:"devices" example:"1024"`
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleGetTagKeys godoc
+// @Summary List tag keys
+// @Description Gets the tag keys schema of the given Ratatoskr App with the number of devices and distinct values of each key
+// @ID handle_get_tag_keys
+// @Tags Tags
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]tags.TagKeyModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/tags [get]
+func (h *YggdrasilHandler) HandleGetTagKeys(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.tagSvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDeclareTagKey godoc
+// @Summary Declare tag key type
+// @Description Declares the type of a tag key of the given Ratatoskr App, segment filters on the key compare values as this type
+// @ID handle_declare_tag_key
+// @Tags Tags
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param key path string true "Tag key"
+// @Param TagKey body TagKeyRequest true "Declare Tag Key Request"
+// @Success 200 {object} rest.StandardResponse{data=tags.TagKeyModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 422 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/tags/{key} [put]
+func (h *YggdrasilHandler) HandleDeclareTagKey(c *gin.Context) {
+	req := TagKeyRequest{}
+	aUUID := c.Param("app_uuid")
+	key := c.Param("key")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.tagSvc.Declare(claims.UserID, aUUID, key, tags.TagType(req.Type))
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUndeclareTagKey godoc
+// @Summary Undeclare tag key type
+// @Description Removes the declared type of a tag key of the given Ratatoskr App, the key gets the type inferred from its values
+// @ID handle_undeclare_tag_key
+// @Tags Tags
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param key path string true "Tag key"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/tags/{key} [delete]
+func (h *YggdrasilHandler) HandleUndeclareTagKey(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	key := c.Param("key")
+	claims := getClaims(c)
+
+	err := h.tagSvc.Undeclare(claims.UserID, aUUID, key)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleGetTagLimits godoc
+// @Summary Tag limits
+// @Description Gets the limits of the tags devices of the given Ratatoskr App can have, default is set when the app uses the default limits
+// @ID handle_get_tag_limits
+// @Tags Tags
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=tags.LimitsModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/tag_limits [get]
+func (h *YggdrasilHandler) HandleGetTagLimits(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.tagSvc.GetLimits(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUpdateTagLimits godoc
+// @Summary Update tag limits
+// @Description Replaces the limits of the tags devices of the given Ratatoskr App can have, SDK writes breaking the limits are rejected
+// @ID handle_update_tag_limits
+// @Tags Tags
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param TagLimits body TagLimitsRequest true "Tag Limits Request"
+// @Success 200 {object} rest.StandardResponse{data=tags.LimitsModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 422 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/tag_limits [put]
+func (h *YggdrasilHandler) HandleUpdateTagLimits(c *gin.Context) {
+	req := TagLimitsRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.tagSvc.UpdateLimits(claims.UserID, aUUID, tags.LimitsModel{
+		MaxKeys:          req.MaxKeys,
+		MaxValueLength:   req.MaxValueLength,
+		KeyPattern:       req.KeyPattern,
+		ReservedPrefixes: req.ReservedPrefixes,
+	})
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+type TagKeyRequest struct {
+	Type string `json:"type" binding:"required,oneof=string number boolean time" example:"number"`
+}
+
+type TagLimitsRequest struct {
+	MaxKeys          int      `json:"max_keys" binding:"required" example:"100"`
+	MaxValueLength   int      `json:"max_value_length" binding:"required" example:"255"`
+	KeyPattern       string   `json:"key_pattern" example:"^[a-z0-9_]+$"`
+	ReservedPrefixes []string `json:"reserved_prefixes" example:"rt_"`
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleGetUsage godoc
+// @Summary Plan usage
+// @Description Gets the applications, devices per application and notifications sent this month by the logged-in account against the limits of its plan
+// @ID handle_get_usage
+// @Tags Usage
+// @Security BearerToken
+// @Produce	json
+// @Success 200 {object} rest.StandardResponse{data=quotas.UsageModel} "Success Result"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/usage [get]
+func (h *YggdrasilHandler) HandleGetUsage(c *gin.Context) {
+	claims := getClaims(c)
+
+	res, err := h.quotaSvc.Usage(claims.UserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
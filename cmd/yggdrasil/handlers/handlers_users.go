@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleEditUsersTags godoc
+// @Summary Update tags of many users
+// @Description Applies up to 10000 entries of external user tags at once, the result has an entry per given entry in the same order
+// @ID handle_edit_users_tags
+// @Tags Users
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param UsersTags body UsersTagsRequest true "List of external users and their tags"
+// @Success 200 {object} rest.StandardResponse{data=[]devices.UserTagsResultModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse "Role does not have the permission"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 413 {object} rest.StandardResponse "Too many entries"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/users/tags [post]
+func (h *YggdrasilHandler) HandleEditUsersTags(c *gin.Context) {
+	req := UsersTagsRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	// Ensure the role of the account on the application allows editing its users
+	_, err := h.applicationSvc.Authorize(claims.UserID, aUUID, applications.PermissionEditAudience)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.deviceSvc.UpdateUsersTags(aUUID, req.Users)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetUser godoc
+// @Summary User details
+// @Description Gets an external user of the given Ratatoskr App with its tags and all of its linked devices
+// @ID handle_get_user
+// @Tags Users
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param external_user_id path string true "External User ID"
+// @Success 200 {object} rest.StandardResponse{data=users.UserModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/users/{external_user_id} [get]
+func (h *YggdrasilHandler) HandleGetUser(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	externalUserID := c.Param("external_user_id")
+	claims := getClaims(c)
+
+	res, err := h.userSvc.Details(claims.UserID, aUUID, externalUserID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+type UsersTagsRequest struct {
+	Users []devices.UserTagsModel `json:"users" binding:"required,min=1"`
+}
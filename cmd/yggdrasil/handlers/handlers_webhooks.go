@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/rest"
+	"net/http"
+)
+
+// HandleGetWebhooks godoc
+// @Summary List webhooks
+// @Description Gets the list of webhooks of the given Ratatoskr App with their delivery state
+// @ID handle_get_webhooks
+// @Tags Webhooks
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Success 200 {object} rest.StandardResponse{data=[]webhooks.WebhookModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks [get]
+func (h *YggdrasilHandler) HandleGetWebhooks(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	claims := getClaims(c)
+
+	res, err := h.webhookSvc.List(claims.UserID, aUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleGetWebhook godoc
+// @Summary Webhook details
+// @Description Gets a webhook of the given Ratatoskr App, paused webhooks have failed too many times in a row
+// @ID handle_get_webhook
+// @Tags Webhooks
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of webhook"
+// @Success 200 {object} rest.StandardResponse{data=webhooks.WebhookModel} "Success Result"
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks/{uuid} [get]
+func (h *YggdrasilHandler) HandleGetWebhook(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	wUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	res, err := h.webhookSvc.Details(claims.UserID, aUUID, wUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleCreateWebhook godoc
+// @Summary Create webhook
+// @Description Subscribes an endpoint to the events of the given Ratatoskr App. The secret signing the deliveries is only returned in this response
+// @ID handle_create_webhook
+// @Tags Webhooks
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param Webhook body WebhookRequest true "Create Webhook Request"
+// @Success 200 {object} rest.StandardResponse{data=webhooks.WebhookModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 422 {object} rest.StandardResponse "Invalid webhook or too many webhooks"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks [post]
+func (h *YggdrasilHandler) HandleCreateWebhook(c *gin.Context) {
+	req := WebhookRequest{}
+	aUUID := c.Param("app_uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	res, err := h.webhookSvc.Create(claims.UserID, aUUID, req.toModel())
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleUpdateWebhook godoc
+// @Summary Update webhook
+// @Description Changes the url, events and activation of a webhook of the given Ratatoskr App, activating a paused webhook resumes its deliveries
+// @ID handle_update_webhook
+// @Tags Webhooks
+// @Security BearerToken
+// @Accept	json
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of webhook"
+// @Param Webhook body WebhookRequest true "Update Webhook Request"
+// @Success 200 {object} rest.StandardResponse{data=webhooks.WebhookModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 422 {object} rest.StandardResponse "Invalid webhook"
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks/{uuid} [put]
+func (h *YggdrasilHandler) HandleUpdateWebhook(c *gin.Context) {
+	req := WebhookRequest{}
+	aUUID := c.Param("app_uuid")
+	wUUID := c.Param("uuid")
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailValidationResponse(err))
+		return
+	}
+	claims := getClaims(c)
+
+	model := req.toModel()
+	model.UUID = wUUID
+	res, err := h.webhookSvc.Update(claims.UserID, aUUID, model)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+// HandleDeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Deletes a webhook of the given Ratatoskr App alongside with its pending deliveries and delivery attempts
+// @ID handle_delete_webhook
+// @Tags Webhooks
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of webhook"
+// @Success 200 {object} rest.StandardResponse{} "Success Result"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks/{uuid} [delete]
+func (h *YggdrasilHandler) HandleDeleteWebhook(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	wUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	err := h.webhookSvc.Delete(claims.UserID, aUUID, wUUID)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(nil))
+}
+
+// HandleGetWebhookAttempts godoc
+// @Summary Webhook delivery attempts
+// @Description Lists the latest delivery attempts of a webhook of the given Ratatoskr App, newest first
+// @ID handle_get_webhook_attempts
+// @Tags Webhooks
+// @Security BearerToken
+// @Produce	json
+// @Param app_uuid path string true "UUID of user-owned application"
+// @Param uuid path string true "UUID of webhook"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} rest.StandardResponse{data=[]webhooks.AttemptModel} "Success Result"
+// @Failure 400 {object} rest.StandardResponse "Validation error"
+// @Failure 403 {object} rest.StandardResponse
+// @Failure 404 {object} rest.StandardResponse
+// @Failure 500 {object} rest.StandardResponse
+// @Router /v1/application/{app_uuid}/webhooks/{uuid}/deliveries [get]
+func (h *YggdrasilHandler) HandleGetWebhookAttempts(c *gin.Context) {
+	aUUID := c.Param("app_uuid")
+	wUUID := c.Param("uuid")
+	claims := getClaims(c)
+
+	paging, err := getPagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	res, err := h.webhookSvc.Attempts(claims.UserID, aUUID, wUUID, paging)
+	if err != nil {
+		kind, _ := errors.AsKindContext(err)
+		c.JSON(kind.GetHttpStatus(), rest.GetFailMessageResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rest.GetSuccessResponse(res))
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url,max=2048" example:"https://myfancywebsite.com/hooks/ratatoskr"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=device.registered device.unsubscribed notification.opened" example:"device.registered,notification.opened"`
+	// Active defaults to true, inactive webhooks are kept without getting any events
+	Active *bool `json:"active" example:"true"`
+}
+
+func (r WebhookRequest) toModel() webhooks.WebhookModel {
+	model := webhooks.WebhookModel{
+		URL:    r.URL,
+		Active: r.Active == nil || *r.Active,
+	}
+	for _, e := range r.Events {
+		model.Events = append(model.Events, webhooks.EventType(e))
+	}
+	return model
+}
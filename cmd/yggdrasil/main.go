@@ -66,6 +66,8 @@ func main() {
 	var configFile string
 	flag.StringVar(&configFile, "c", defaultConfigFile, "The environment configuration file of application")
 	flag.StringVar(&configFile, "config", defaultConfigFile, "The environment configuration file of application")
+	var rekey bool
+	flag.BoolVar(&rekey, "rekey", false, "Re-encrypt the application, two-factor and webhook secrets with the current encryption key and exit")
 	flag.Usage = usage
 	flag.Parse()
 	
@@ -103,6 +105,17 @@ func main() {
 	// Commit, BuildTime
 	logger.Infof("[OK] Commit Number:%s, Build Time: %s", GitCommit, BuildTime)
 	
+	// Re-encrypt the application secrets instead of serving
+	if rekey {
+		result, err := RekeySecrets(cfg)
+		if err != nil {
+			logger.Fatal(errors.Wrapf(err, "failed to rekey secrets: %s", op))
+		}
+		logger.Infof("[OK] Secrets of %d applications, %d accounts and %d webhooks have been re-encrypted",
+			result.Applications, result.Accounts, result.Webhooks)
+		return
+	}
+	
 	// Connect to NATS Streaming Server
 	logger.Infof("[...] Trying to connect to nats urls: %s", cfg.STAN.GenerateURLs())
 	opts := []nats.Option{nats.Name("App Mode, Nats Streaming Connection")}
@@ -159,6 +172,7 @@ func usage() {
 Usage: yggdrasil [options]
 Options:
 	-c,  --config   <config file name>   Path of yaml configuration file
+	     --rekey                         Re-encrypt the application, two-factor and webhook secrets with the current encryption key and exit
 `
 	fmt.Printf("%s\n", usageStr)
 	os.Exit(0)
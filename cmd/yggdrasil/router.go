@@ -63,20 +63,70 @@ func SetupRouter(handler *handlers.YggdrasilHandler, config PrometheusConfig, jw
 		{
 			publicV1.POST("/auth/signup", handler.HandleSignup)
 			publicV1.POST("/auth/login", handler.HandleLogin)
+			publicV1.POST("/auth/refresh", handler.HandleRefreshToken)
+			publicV1.POST("/auth/mfa/verify", handler.HandleVerifyMFA)
+			publicV1.GET("/auth/verify/:token", handler.HandleVerifyEmail)
+			publicV1.POST("/auth/resend_confirmation", handler.HandleResendConfirmation)
+			publicV1.POST("/auth/forgot_password", handler.HandleForgotPassword)
+			publicV1.POST("/auth/reset_password", handler.HandleResetPassword)
 			publicV1.GET("/auth/oauth/:provider", handler.HandleOAuthLoginURL)
 			publicV1.GET("/auth/oauth/callback/:provider", handler.HandleOAuthCallback)
+			publicV1.GET("/exports/:uuid/download", handler.HandleDownloadExport)
+			publicV1.GET("/privacy_requests/:uuid/download", handler.HandleDownloadPrivacyExport)
 		}
 
 		// Private Routes (Logged-in Users)
 		privateV1 := v1.Group("")
 		privateV1.Use(handler.JWTMiddleware(jwtCfg.Secret, []string{constants.Pro.String(), constants.Free.String()}))
+		privateV1.Use(handler.AuditMiddleware())
 		{
+			// Sessions
+			privateV1.POST("/auth/logout", handler.HandleLogout)
+			privateV1.POST("/auth/logout_all", handler.HandleLogoutAll)
+
+			// Two-Factor Authentication
+			privateV1.POST("/auth/mfa/enroll", handler.HandleEnrollMFA)
+			privateV1.POST("/auth/mfa/activate", handler.HandleActivateMFA)
+			privateV1.POST("/auth/mfa/disable", handler.HandleDisableMFA)
+			privateV1.POST("/auth/mfa/recovery_codes", handler.HandleRegenerateRecoveryCodes)
+
+			// Plan Usage
+			privateV1.GET("/usage", handler.HandleGetUsage)
+
 			// Application Management
 			privateV1.POST("/applications", handler.HandleCreateApplication)
 			privateV1.GET("/applications", handler.HandleListMyApplication)
 			privateV1.GET("/applications/:uuid", handler.HandleApplicationDetail)
+			privateV1.PUT("/applications/:uuid", handler.HandleUpdateApplication)
 			privateV1.PATCH("/applications/:uuid", handler.HandleResetAuthToken)
 			privateV1.PUT("/applications/:uuid/:status", handler.HandleUpdateIdentityVerification)
+			privateV1.DELETE("/applications/:uuid", handler.HandleDeleteApplication)
+			privateV1.POST("/applications/:uuid/restore", handler.HandleRestoreApplication)
+			privateV1.GET("/applications/:uuid/audit", handler.HandleGetAuditEntries)
+
+			// Organizations
+			privateV1.POST("/organizations", handler.HandleCreateOrganization)
+			privateV1.GET("/organizations", handler.HandleGetOrganizations)
+			privateV1.GET("/organizations/:uuid", handler.HandleGetOrganization)
+			privateV1.GET("/organizations/:uuid/members", handler.HandleGetOrganizationMembers)
+			privateV1.PUT("/organizations/:uuid/members/:m_uuid", handler.HandleUpdateOrganizationMember)
+			privateV1.DELETE("/organizations/:uuid/members/:m_uuid", handler.HandleRemoveOrganizationMember)
+			privateV1.GET("/organizations/:uuid/invitations", handler.HandleGetInvitations)
+			privateV1.POST("/organizations/:uuid/invitations", handler.HandleCreateInvitation)
+			privateV1.DELETE("/organizations/:uuid/invitations/:i_uuid", handler.HandleRevokeInvitation)
+			privateV1.POST("/organizations/:uuid/applications/:app_uuid", handler.HandleMoveApplication)
+			privateV1.POST("/invitations/accept", handler.HandleAcceptInvitation)
+
+			// Application - Members Roles
+			privateV1.GET("/application/:app_uuid/members", handler.HandleGetApplicationMembers)
+			privateV1.PUT("/application/:app_uuid/members/:uuid", handler.HandleSetApplicationRole)
+			privateV1.DELETE("/application/:app_uuid/members/:uuid", handler.HandleRemoveApplicationRole)
+
+			// API Keys
+			privateV1.GET("/application/:app_uuid/api_keys", handler.HandleGetAPIKeys)
+			privateV1.POST("/application/:app_uuid/api_keys", handler.HandleCreateAPIKey)
+			privateV1.POST("/application/:app_uuid/api_keys/:uuid/rotate", handler.HandleRotateAPIKey)
+			privateV1.DELETE("/application/:app_uuid/api_keys/:uuid", handler.HandleRevokeAPIKey)
 
 			// Application - Android Groups Management
 			privateV1.GET("/application/:app_uuid/android_groups", handler.HandleGetAndroidGroups)
@@ -87,6 +137,73 @@ func SetupRouter(handler *handlers.YggdrasilHandler, config PrometheusConfig, jw
 			privateV1.POST("/application/:app_uuid/android_categories/:g_uuid", handler.HandleCreateAndroidCategory)
 			privateV1.PUT("/application/:app_uuid/android_categories/:g_uuid/:c_uuid", handler.HandleUpdateAndroidCategory)
 			privateV1.DELETE("/application/:app_uuid/android_categories/:g_uuid/:c_uuid", handler.HandleDeleteAndroidCategory)
+
+			// Application - Journeys Management
+			privateV1.GET("/application/:app_uuid/journeys", handler.HandleGetJourneys)
+			privateV1.POST("/application/:app_uuid/journeys", handler.HandleCreateJourney)
+			privateV1.GET("/application/:app_uuid/journeys/:uuid", handler.HandleGetJourney)
+			privateV1.PUT("/application/:app_uuid/journeys/:uuid", handler.HandleUpdateJourney)
+			privateV1.DELETE("/application/:app_uuid/journeys/:uuid", handler.HandleDeleteJourney)
+
+			// Application - Webhooks Management
+			privateV1.GET("/application/:app_uuid/webhooks", handler.HandleGetWebhooks)
+			privateV1.POST("/application/:app_uuid/webhooks", handler.HandleCreateWebhook)
+			privateV1.GET("/application/:app_uuid/webhooks/:uuid", handler.HandleGetWebhook)
+			privateV1.PUT("/application/:app_uuid/webhooks/:uuid", handler.HandleUpdateWebhook)
+			privateV1.DELETE("/application/:app_uuid/webhooks/:uuid", handler.HandleDeleteWebhook)
+			privateV1.GET("/application/:app_uuid/webhooks/:uuid/deliveries", handler.HandleGetWebhookAttempts)
+
+			// Application - Segments Management
+			privateV1.GET("/application/:app_uuid/segments", handler.HandleGetSegments)
+			privateV1.POST("/application/:app_uuid/segments", handler.HandleCreateSegment)
+			privateV1.GET("/application/:app_uuid/segments/:uuid", handler.HandleGetSegment)
+			privateV1.GET("/application/:app_uuid/segments/:uuid/size", handler.HandleGetSegmentSize)
+			privateV1.PUT("/application/:app_uuid/segments/:uuid", handler.HandleUpdateSegment)
+			privateV1.DELETE("/application/:app_uuid/segments/:uuid", handler.HandleDeleteSegment)
+
+			// Application - Tag Keys Schema & Limits
+			privateV1.GET("/application/:app_uuid/tags", handler.HandleGetTagKeys)
+			privateV1.PUT("/application/:app_uuid/tags/:key", handler.HandleDeclareTagKey)
+			privateV1.DELETE("/application/:app_uuid/tags/:key", handler.HandleUndeclareTagKey)
+			privateV1.GET("/application/:app_uuid/tag_limits", handler.HandleGetTagLimits)
+			privateV1.PUT("/application/:app_uuid/tag_limits", handler.HandleUpdateTagLimits)
+
+			// Application - Users
+			privateV1.POST("/application/:app_uuid/users/tags", handler.HandleEditUsersTags)
+			privateV1.GET("/application/:app_uuid/users/:external_user_id", handler.HandleGetUser)
+
+			// Application - Devices Import
+			privateV1.GET("/application/:app_uuid/imports", handler.HandleGetImports)
+			privateV1.POST("/application/:app_uuid/imports", handler.HandleCreateImport)
+			privateV1.GET("/application/:app_uuid/imports/:uuid", handler.HandleGetImport)
+			privateV1.GET("/application/:app_uuid/imports/:uuid/errors", handler.HandleGetImportErrors)
+
+			// Application - Devices Export
+			privateV1.GET("/application/:app_uuid/exports", handler.HandleGetExports)
+			privateV1.POST("/application/:app_uuid/exports", handler.HandleCreateExport)
+			privateV1.GET("/application/:app_uuid/exports/:uuid", handler.HandleGetExport)
+
+			// Application - Data Subject Requests
+			privateV1.GET("/application/:app_uuid/privacy_requests", handler.HandleGetPrivacyRequests)
+			privateV1.POST("/application/:app_uuid/privacy_requests", handler.HandleCreatePrivacyRequest)
+			privateV1.GET("/application/:app_uuid/privacy_requests/:uuid", handler.HandleGetPrivacyRequest)
+		}
+
+		// Admin Routes (Super Users)
+		adminV1 := v1.Group("/admin")
+		adminV1.Use(handler.JWTMiddleware(jwtCfg.Secret, []string{constants.Admin.String()}))
+		adminV1.Use(handler.AuditMiddleware())
+		{
+			// Accounts
+			adminV1.GET("/accounts", handler.HandleAdminSearchAccounts)
+			adminV1.POST("/accounts/:uuid/activate", handler.HandleAdminActivateAccount)
+			adminV1.POST("/accounts/:uuid/deactivate", handler.HandleAdminDeactivateAccount)
+			adminV1.PUT("/accounts/:uuid/plan", handler.HandleAdminUpdateAccountPlan)
+			adminV1.POST("/accounts/:uuid/impersonate", handler.HandleAdminImpersonate)
+			adminV1.GET("/impersonations", handler.HandleAdminGetImpersonations)
+
+			// Applications
+			adminV1.GET("/applications", handler.HandleAdminGetApplications)
 		}
 	}
 
@@ -98,7 +215,7 @@ func SetupRouter(handler *handlers.YggdrasilHandler, config PrometheusConfig, jw
 
 	// Remove parameters to avoid increasing of metrics cardinality
 	paramStripMap := make(map[string]bool, 0)
-	for _, sp := range []string{"app_uuid", "uuid", "id"} {
+	for _, sp := range []string{"app_uuid", "uuid", "id", "key"} {
 		paramStripMap[sp] = true
 	}
 
@@ -7,12 +7,28 @@ import (
 	"github.com/nats-io/stan.go"
 	"github.com/subzerobo/ratatoskr/cmd/yggdrasil/handlers"
 	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/audit"
 	"github.com/subzerobo/ratatoskr/internal/services/authentication"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/exports"
+	"github.com/subzerobo/ratatoskr/internal/services/identity"
+	"github.com/subzerobo/ratatoskr/internal/services/imports"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+	"github.com/subzerobo/ratatoskr/internal/services/organizations"
+	"github.com/subzerobo/ratatoskr/internal/services/privacy"
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/internal/services/users"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
 	"github.com/subzerobo/ratatoskr/internal/storage/postgres"
 	rs "github.com/subzerobo/ratatoskr/internal/storage/redis"
+	"github.com/subzerobo/ratatoskr/internal/storage/streaming"
+	"github.com/subzerobo/ratatoskr/pkg/blob"
+	"github.com/subzerobo/ratatoskr/pkg/currency"
 	"github.com/subzerobo/ratatoskr/pkg/logger"
 	"github.com/subzerobo/ratatoskr/pkg/mailer"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
 	pg "github.com/subzerobo/ratatoskr/platform/postgres"
 	"github.com/subzerobo/ratatoskr/platform/redis"
 	"os"
@@ -26,6 +42,12 @@ type server struct {
 	Logger      *logger.StandardLogger
 	RESTHandler *handlers.YggdrasilHandler
 	NatsHandler *nats.Handler
+	AppSvc      applications.Service
+	JourneySvc  journeys.Service
+	ImportSvc   imports.Service
+	ExportSvc   exports.Service
+	PrivacySvc  privacy.Service
+	WebhookSvc  webhooks.Service
 }
 
 // NewServer Create a new instance of server application
@@ -36,6 +58,28 @@ func NewServer(cfg *Config, stan stan.Conn) *server {
 	}
 }
 
+// RekeySecrets re-encrypts the provider secrets of all applications, the two-factor secrets of all accounts and the
+// secrets of all webhooks with the current encryption key and returns the number of updated rows of each, it is used to encrypt existing plaintext secrets
+// and to retire rotated keys
+func RekeySecrets(cfg *Config) (postgres.RekeyResult, error) {
+	connection := pg.CreateConnection(cfg.Database, "ratatoskr.io")
+	gorm, err := connection.OpenGORM()
+	if err != nil {
+		return postgres.RekeyResult{}, err
+	}
+	
+	keyProvider, err := utils.CreateLocalKeyProvider(cfg.Encryption)
+	if err != nil {
+		return postgres.RekeyResult{}, err
+	}
+	
+	repository, err := postgres.CreateRepository(gorm, utils.CreateEnvelope(keyProvider))
+	if err != nil {
+		return postgres.RekeyResult{}, err
+	}
+	return repository.RekeySecrets(cfg.Workers.GetBatchSize())
+}
+
 // Initialize is responsible for app initialization and wrapping required dependencies
 func (s *server) Initialize(logger *logger.StandardLogger) error {
 	// Initialize Database
@@ -47,8 +91,14 @@ func (s *server) Initialize(logger *logger.StandardLogger) error {
 		return err
 	}
 	
+	// Initialize Secrets Encryption
+	keyProvider, err := utils.CreateLocalKeyProvider(s.Config.Encryption)
+	if err != nil {
+		return err
+	}
+	
 	// Initialize Postgres Backed Repository
-	repository, err := postgres.CreateRepository(gorm)
+	repository, err := postgres.CreateRepository(gorm, utils.CreateEnvelope(keyProvider))
 	if err != nil {
 		return err
 	}
@@ -61,16 +111,49 @@ func (s *server) Initialize(logger *logger.StandardLogger) error {
 	}
 	redisStore := rs.CreateRedisStore(redisClient)
 	
+	// Initialize Streaming Store
+	streamingStore := streaming.CreateStreamingStore(s.Stan)
+	
 	// Create Mailer
 	mailerSvc := mailer.NewSendGrid(s.Config.Mailer.Token, s.Config.Mailer.Name, s.Config.Mailer.Email)
 	
+	// Initialize Blob Store
+	blobStore, err := blob.CreateLocalStore(s.Config.Blob)
+	if err != nil {
+		return err
+	}
+	
+	// Initialize Currency Converter
+	converter := currency.CreateConverter(s.Config.Currency)
+	
 	// Create Services
-	accountService := authentication.CreateService(repository, redisStore, s.Config.Authentication, mailerSvc, s.Config.BasePath)
-	applicationService := applications.CreateService(repository)
-	deviceService := devices.CreateService(repository)
+	accountService, err := authentication.CreateService(repository, redisStore, redisStore, s.Config.Authentication, mailerSvc, s.Config.BasePath)
+	if err != nil {
+		return err
+	}
+	quotaService := quotas.CreateService(repository, s.Config.Quotas)
+	applicationService := applications.CreateService(repository, redisStore, quotaService, s.Config.Applications)
+	journeyService := journeys.CreateService(repository, streamingStore, quotaService, logger)
+	tagService := tags.CreateService(repository, s.Config.Tags)
+	webhookService := webhooks.CreateService(repository, s.Config.Webhooks)
+	verifier := identity.CreateVerifier(s.Config.Identity, logger)
+	deviceService := devices.CreateService(repository, converter, tagService, verifier, quotaService, journeyService, webhookService)
+	segmentService := segments.CreateService(repository)
+	userService := users.CreateService(repository, tagService, verifier, journeyService)
+	importService := imports.CreateService(repository, blobStore, quotaService)
+	exportService, err := exports.CreateService(repository, blobStore, s.Config.Exports, s.Config.BasePath)
+	if err != nil {
+		return err
+	}
+	privacyService, err := privacy.CreateService(repository, redisStore, blobStore, s.Config.Privacy, s.Config.BasePath)
+	if err != nil {
+		return err
+	}
+	auditService := audit.CreateService(repository)
+	organizationService := organizations.CreateService(repository, mailerSvc, s.Config.Organizations, s.Config.BasePath)
 	
 	// REST Handler
-	restHandler := handlers.CreateYggdrasilHandler(accountService, applicationService, deviceService, logger)
+	restHandler := handlers.CreateYggdrasilHandler(accountService, applicationService, deviceService, journeyService, segmentService, importService, exportService, tagService, userService, privacyService, organizationService, quotaService, auditService, webhookService, logger)
 	
 	// Update GitCommit and BuildTime in handler
 	restHandler.HealthCheckInfo.GitCommit = GitCommit
@@ -79,6 +162,12 @@ func (s *server) Initialize(logger *logger.StandardLogger) error {
 	restHandler.HealthCheckInfo.StartTime = StartTime
 	
 	s.RESTHandler = restHandler
+	s.AppSvc = applicationService
+	s.JourneySvc = journeyService
+	s.ImportSvc = importService
+	s.ExportSvc = exportService
+	s.PrivacySvc = privacyService
+	s.WebhookSvc = webhookService
 	s.Logger = logger
 	return nil
 }
@@ -88,6 +177,38 @@ func (s *server) Start(ctx context.Context) {
 	// Create Router for HTTP Server
 	router := SetupRouter(s.RESTHandler, s.Config.Prometheus, s.Config.Authentication.JWT)
 	
+	// Start Background Workers
+	s.runWorker(ctx, "applications", func() error {
+		_, err := s.AppSvc.Purge(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	s.runWorker(ctx, "journeys", func() error {
+		_, err := s.JourneySvc.Advance(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	s.runWorker(ctx, "imports", func() error {
+		_, err := s.ImportSvc.Process(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	s.runWorker(ctx, "exports", func() error {
+		if _, err := s.ExportSvc.Cleanup(s.Config.Workers.GetBatchSize()); err != nil {
+			return err
+		}
+		_, err := s.ExportSvc.Process(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	s.runWorker(ctx, "privacy", func() error {
+		if _, err := s.PrivacySvc.Cleanup(s.Config.Workers.GetBatchSize()); err != nil {
+			return err
+		}
+		_, err := s.PrivacySvc.Process(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	s.runWorker(ctx, "webhooks", func() error {
+		_, err := s.WebhookSvc.Deliver(s.Config.Workers.GetBatchSize())
+		return err
+	})
+	
 	// // Start Nats Worker
 	// err := s.NatsHandler.Start(ctx)
 	// if err != nil {
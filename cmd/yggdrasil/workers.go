@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runWorker calls the job on every worker interval in background until the context is cancelled
+func (s *server) runWorker(ctx context.Context, name string, job func() error) {
+	s.Add(1)
+	go func() {
+		defer s.Done()
+		ticker := time.NewTicker(s.Config.Workers.GetInterval())
+		defer ticker.Stop()
+
+		s.Logger.Infof("[OK] Starting %s worker", name)
+		for {
+			select {
+			case <-ctx.Done():
+				s.Logger.Infof("[OK] %s worker has been stopped", name)
+				return
+			case <-ticker.C:
+				if err := job(); err != nil {
+					s.Logger.WithField("worker", name).Error(err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,174 @@
+package applications
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"time"
+)
+
+const (
+	// apiKeyLength is the length of generated api keys, keys have the same length as the legacy auth keys
+	apiKeyLength = 64
+	// apiKeyPrefixLength is the number of leading characters of a key kept to tell the keys apart
+	apiKeyPrefixLength = 8
+	// lastUsedResolution limits how often the last used timestamp of a key is written
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidScope  = errors.New("api key scope is invalid")
+	ErrInvalidExpiry = errors.New("api key expiry must be in the future")
+	ErrExpiredAPIKey = errors.New("api key has been expired")
+	ErrMissingScope  = errors.New("api key does not have the required scope")
+)
+
+// Scopes lists all of the scopes api keys can be granted
+var Scopes = []Scope{ScopeReadDevices, ScopeWriteTags, ScopeSendNotifications}
+
+// CreateAPIKey generates a new key for the application, the returned model is the only one holding the key itself
+func (s service) CreateAPIKey(accountID uint, aUUID string, model APIKeyModel) (*APIKeyModel, error) {
+	app, err := s.Authorize(accountID, aUUID, PermissionManageKeys)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateScopes(model.Scopes); err != nil {
+		return nil, err
+	}
+	if model.ExpiresAt != nil && !model.ExpiresAt.After(time.Now()) {
+		return nil, errors.WithKindCtx(ErrInvalidExpiry, "", errors.BadRequest, nil)
+	}
+	model.ApplicationID = app.ID
+	return s.createAPIKey(model)
+}
+
+func (s service) ListAPIKeys(accountID uint, aUUID string) ([]*APIKeyModel, error) {
+	app, err := s.Authorize(accountID, aUUID, PermissionManageKeys)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetAPIKeys(app.ID)
+}
+
+// RotateAPIKey replaces the key with a new one with the same name, scopes and lifetime. The old key keeps working
+// for the configured overlap window, so the integrated servers can be moved to the new key without downtime
+func (s service) RotateAPIKey(accountID uint, aUUID string, kUUID string) (*APIKeyModel, error) {
+	app, err := s.Authorize(accountID, aUUID, PermissionManageKeys)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.repository.GetAPIKey(app.ID, kUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	model := APIKeyModel{
+		ApplicationID: app.ID,
+		Name:          old.Name,
+		Scopes:        old.Scopes,
+	}
+	if old.ExpiresAt != nil {
+		expiresAt := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		model.ExpiresAt = &expiresAt
+	}
+	res, err := s.createAPIKey(model)
+	if err != nil {
+		return nil, err
+	}
+
+	overlapEnd := now.Add(s.config.GetKeyRotationOverlap())
+	if old.ExpiresAt == nil || old.ExpiresAt.After(overlapEnd) {
+		err = s.repository.UpdateAPIKeyExpiry(old.ID, overlapEnd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// RevokeAPIKey removes the key, it stops working right away
+func (s service) RevokeAPIKey(accountID uint, aUUID string, kUUID string) error {
+	app, err := s.Authorize(accountID, aUUID, PermissionManageKeys)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteAPIKey(app.ID, kUUID)
+}
+
+// CheckApplicationToken checks the token is a valid key of the application which grants the scope.
+// The legacy auth key of the application grants all of the scopes
+func (s service) CheckApplicationToken(authKey string, UUID string, scope Scope) error {
+	app, err := s.repository.GetApplicationModelByUUID(UUID)
+	if err != nil {
+		return err
+	}
+	if authKey == "" {
+		return errors.WithKindCtx(ErrInvalidApplicationAuthKey, "", errors.Unauthorized, nil)
+	}
+	if subtle.ConstantTimeCompare([]byte(app.AuthKey), []byte(authKey)) == 1 {
+		return nil
+	}
+
+	key, err := s.repository.GetAPIKeyByHash(app.ID, hashAPIKey(authKey))
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return errors.WithKindCtx(ErrInvalidApplicationAuthKey, "", errors.Unauthorized, nil)
+		}
+		return err
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return errors.WithKindCtx(ErrExpiredAPIKey, "", errors.Unauthorized, nil)
+	}
+	if !key.HasScope(scope) {
+		return errors.WithKindCtx(ErrMissingScope, string(scope), errors.Forbidden, nil)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		return s.repository.TouchAPIKey(key.ID, now)
+	}
+	return nil
+}
+
+func (s service) createAPIKey(model APIKeyModel) (*APIKeyModel, error) {
+	key, err := utils.SecureRandomString(apiKeyLength)
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to generate api key", errors.InternalServerError, nil)
+	}
+	model.Prefix = key[:apiKeyPrefixLength]
+	model.Hash = hashAPIKey(key)
+	res, err := s.repository.CreateAPIKey(model)
+	if err != nil {
+		return nil, err
+	}
+	res.Key = key
+	return res, nil
+}
+
+func validateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return errors.WithKindCtx(ErrInvalidScope, "at least one scope is required", errors.BadRequest, nil)
+	}
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range Scopes {
+			if scope == s {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.WithKindCtx(ErrInvalidScope, string(scope), errors.BadRequest, nil)
+		}
+	}
+	return nil
+}
+
+// hashAPIKey hashes the key for storage, keys are random so a plain sha256 is enough to look them up
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,26 @@
+package applications
+
+import "time"
+
+// Config holds the settings of applications, DeletionGracePeriod and KeyRotationOverlap are in seconds
+type Config struct {
+	DeletionGracePeriod int `yaml:"DELETION_GRACE_PERIOD" envconfig:"APPLICATIONS_DELETION_GRACE_PERIOD"`
+	KeyRotationOverlap  int `yaml:"KEY_ROTATION_OVERLAP" envconfig:"APPLICATIONS_KEY_ROTATION_OVERLAP"`
+}
+
+// GetDeletionGracePeriod returns how long a deleted application can be restored before it is purged,
+// it has to be longer than the retention of exports as their files are only removed by the exports cleanup
+func (c Config) GetDeletionGracePeriod() time.Duration {
+	if c.DeletionGracePeriod <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(c.DeletionGracePeriod) * time.Second
+}
+
+// GetKeyRotationOverlap returns how long a rotated api key keeps working next to its replacement
+func (c Config) GetKeyRotationOverlap() time.Duration {
+	if c.KeyRotationOverlap <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.KeyRotationOverlap) * time.Second
+}
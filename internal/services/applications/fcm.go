@@ -0,0 +1,80 @@
+package applications
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// serviceAccountType is the type of the JSON keys of Google service accounts used by the FCM admin API
+const serviceAccountType = "service_account"
+
+// ServiceAccountModel is the JSON key of the Google service account FCM messages are sent with
+type ServiceAccountModel struct {
+	Type                    string `json:"type"`
+	ProjectID               string `json:"project_id"`
+	PrivateKeyID            string `json:"private_key_id"`
+	PrivateKey              string `json:"private_key"`
+	ClientEmail             string `json:"client_email"`
+	ClientID                string `json:"client_id"`
+	AuthURI                 string `json:"auth_uri"`
+	TokenURI                string `json:"token_uri"`
+	AuthProviderX509CertURL string `json:"auth_provider_x509_cert_url"`
+	ClientX509CertURL       string `json:"client_x509_cert_url"`
+}
+
+// ValidateServiceAccount checks the structure of a service account JSON key without contacting Google,
+// the private key has to be a parsable PKCS#8 or PKCS#1 PEM block
+func ValidateServiceAccount(data string) error {
+	var model ServiceAccountModel
+	decoder := json.NewDecoder(strings.NewReader(data))
+	if err := decoder.Decode(&model); err != nil {
+		return invalidServiceAccount("fcm_admin_json is not a valid JSON object")
+	}
+
+	if model.Type != serviceAccountType {
+		return invalidServiceAccount("type must be service_account")
+	}
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"project_id", model.ProjectID},
+		{"private_key_id", model.PrivateKeyID},
+		{"private_key", model.PrivateKey},
+		{"client_email", model.ClientEmail},
+		{"client_id", model.ClientID},
+		{"token_uri", model.TokenURI},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return invalidServiceAccount(field.name + " is required")
+		}
+	}
+
+	if _, err := mail.ParseAddress(model.ClientEmail); err != nil {
+		return invalidServiceAccount("client_email is not a valid email")
+	}
+	if u, err := url.Parse(model.TokenURI); err != nil || u.Scheme != "https" || u.Host == "" {
+		return invalidServiceAccount("token_uri must be an https url")
+	}
+
+	block, _ := pem.Decode([]byte(model.PrivateKey))
+	if block == nil {
+		return invalidServiceAccount("private_key is not a PEM encoded key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if _, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return invalidServiceAccount("private_key can not be parsed")
+		}
+	}
+	return nil
+}
+
+func invalidServiceAccount(reason string) error {
+	return errors.WithKindCtx(ErrInvalidServiceAccount, reason, errors.UnprocessableEntity, nil)
+}
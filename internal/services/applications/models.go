@@ -16,6 +16,52 @@ type ApplicationModel struct {
 	IdentityVerification bool
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
+	DeletedAt            *time.Time
+	PurgeAt              *time.Time
+	// OrganizationID is zero for the personal applications, only the account of a personal application has a role on it
+	OrganizationID uint
+	// Role is the role of the account the application has been got for
+	Role Role
+	// DeviceCount is the number of devices of the application, it is only set on the list of all applications
+	DeviceCount int64
+}
+
+type Scope string
+
+const (
+	// ScopeReadDevices allows reading the devices and users of the application
+	ScopeReadDevices Scope = "devices:read"
+	// ScopeWriteTags allows editing the tags of devices and users
+	ScopeWriteTags Scope = "tags:write"
+	// ScopeSendNotifications allows sending notifications to the devices of the application
+	ScopeSendNotifications Scope = "notifications:send"
+)
+
+// APIKeyModel is a named key used by servers to call the application API, only the hash of the key is stored
+// and the key itself is only known when it is created
+type APIKeyModel struct {
+	ID            uint       `json:"-"`
+	UUID          string     `json:"uuid"`
+	ApplicationID uint       `json:"-"`
+	Name          string     `json:"name"`
+	Key           string     `json:"key,omitempty"`
+	Prefix        string     `json:"prefix"`
+	Hash          string     `json:"-"`
+	Scopes        []Scope    `json:"scopes"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	LastUsedAt    *time.Time `json:"last_used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// HasScope reports whether the key grants the scope
+func (k APIKeyModel) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 type AndroidGroupModel struct {
@@ -0,0 +1,138 @@
+package applications
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+)
+
+// Role is the role an account has on an application, it is either the role of the account in the organization
+// of the application or the role the account has been given on the application itself
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleDeveloper Role = "developer"
+	RoleMarketer  Role = "marketer"
+	RoleReadOnly  Role = "read_only"
+)
+
+// Permission is an action on an application which is granted to accounts by their role
+type Permission string
+
+const (
+	// PermissionView allows reading the application with its journeys, segments, tags, users and imports
+	PermissionView Permission = "application:view"
+	// PermissionEditSettings allows changing the name, url, FCM settings and identity verification of the application
+	PermissionEditSettings Permission = "application:edit"
+	// PermissionConfigure allows managing the android groups and the tag keys schema and limits
+	PermissionConfigure Permission = "application:configure"
+	// PermissionDelete allows deleting and restoring the application and moving it to another organization
+	PermissionDelete Permission = "application:delete"
+	// PermissionManageKeys allows managing the auth key and api keys of the application
+	PermissionManageKeys Permission = "keys:manage"
+	// PermissionManageMembers allows giving and taking the roles of the members on the application
+	PermissionManageMembers Permission = "members:manage"
+	// PermissionEditAudience allows editing the tags of the users of the application
+	PermissionEditAudience Permission = "audience:edit"
+	// PermissionManageSegments allows creating, updating and deleting segments
+	PermissionManageSegments Permission = "segments:manage"
+	// PermissionManageJourneys allows creating, updating and deleting journeys
+	PermissionManageJourneys Permission = "journeys:manage"
+	// PermissionImportDevices allows importing devices
+	PermissionImportDevices Permission = "devices:import"
+	// PermissionExportDevices allows exporting devices and downloading the exports
+	PermissionExportDevices Permission = "devices:export"
+	// PermissionManagePrivacy allows creating data subject requests and downloading their results
+	PermissionManagePrivacy Permission = "privacy:manage"
+	// PermissionViewAudit allows reading the audit log of the changes made to the application
+	PermissionViewAudit Permission = "audit:view"
+	// PermissionManageWebhooks allows managing the webhooks of the application and reading their delivery attempts
+	PermissionManageWebhooks Permission = "webhooks:manage"
+)
+
+var ErrPermissionDenied = errors.New("your role does not have the permission")
+
+// Roles lists all of the roles accounts can be given
+var Roles = []Role{RoleOwner, RoleAdmin, RoleDeveloper, RoleMarketer, RoleReadOnly}
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner: {
+		PermissionView, PermissionEditSettings, PermissionConfigure, PermissionDelete, PermissionManageKeys,
+		PermissionManageMembers, PermissionEditAudience, PermissionManageSegments, PermissionManageJourneys,
+		PermissionImportDevices, PermissionExportDevices, PermissionManagePrivacy, PermissionViewAudit,
+		PermissionManageWebhooks,
+	},
+	RoleAdmin: {
+		PermissionView, PermissionEditSettings, PermissionConfigure, PermissionManageKeys,
+		PermissionManageMembers, PermissionEditAudience, PermissionManageSegments, PermissionManageJourneys,
+		PermissionImportDevices, PermissionExportDevices, PermissionManagePrivacy, PermissionViewAudit,
+		PermissionManageWebhooks,
+	},
+	RoleDeveloper: {
+		PermissionView, PermissionConfigure, PermissionEditAudience, PermissionManageSegments,
+		PermissionImportDevices, PermissionExportDevices, PermissionManageWebhooks,
+	},
+	RoleMarketer: {
+		PermissionView, PermissionEditAudience, PermissionManageSegments, PermissionManageJourneys,
+	},
+	RoleReadOnly: {
+		PermissionView,
+	},
+}
+
+// IsValid reports whether the role is one of the known roles
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole returns the role a member of the organization has on one of its applications. Owners and admins of the
+// organization keep their role on all of the applications, the other members get the role they have been given on
+// the application if there is any
+func EffectiveRole(organizationRole Role, applicationRole Role) Role {
+	if organizationRole == RoleOwner || organizationRole == RoleAdmin || applicationRole == "" {
+		return organizationRole
+	}
+	return applicationRole
+}
+
+// Authorizer finds the application together with the role the account has on it
+type Authorizer interface {
+	// GetApplicationRole returns not found when the account does not have any role on the application
+	GetApplicationRole(accountID uint, UUID string) (*ApplicationModel, Role, error)
+}
+
+// Authorize gets the application when the role of the account on it grants the permission. Accounts without any
+// role on the application get not found, so they can not tell it exists
+func Authorize(r Authorizer, accountID uint, UUID string, permission Permission) (*ApplicationModel, error) {
+	app, role, err := r.GetApplicationRole(accountID, UUID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkPermission(role, permission); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// Authorize gets the application when the account has the permission on it
+func (s service) Authorize(accountID uint, UUID string, permission Permission) (*ApplicationModel, error) {
+	return Authorize(s.repository, accountID, UUID, permission)
+}
+
+func checkPermission(role Role, permission Permission) error {
+	if !role.Can(permission) {
+		return errors.WithKindCtx(ErrPermissionDenied, string(permission), errors.Forbidden, nil)
+	}
+	return nil
+}
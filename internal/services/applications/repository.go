@@ -1,13 +1,39 @@
 package applications
 
+import "time"
+
 type Repository interface {
+	Authorizer
+
 	CreateApplication(model ApplicationModel) (*ApplicationModel, error)
+	// GetApplicationsByAccountID finds the applications the account has a role on, their Role is the role of the account
 	GetApplicationsByAccountID(accountID uint) ([]*ApplicationModel, error)
-	GetAllApplications() ([]*ApplicationModel, error)
-	GetAccountApplicationByUUID(accountID uint, UUID string) (*ApplicationModel, error)
+	// GetAllApplications returns the applications of all accounts with their device counts, newest first
+	GetAllApplications(offset int, limit int) ([]*ApplicationModel, error)
 	GetApplicationModelByUUID(UUID string) (*ApplicationModel, error)
-	UpdateAuthKey(accountID uint, UUID string, AuthKey string) error
-	UpdateIdentityVerification(accountID uint, UUID string, status bool) error
+	// GetApplicationBySenderID finds the application using the sender id including the deleted ones
+	GetApplicationBySenderID(senderID string) (*ApplicationModel, error)
+	UpdateApplication(model ApplicationModel) (*ApplicationModel, error)
+	UpdateAuthKey(ID uint, AuthKey string) error
+	UpdateIdentityVerification(ID uint, status bool) error
+	// DeleteApplication soft deletes the application, deleted applications are hidden from all other queries
+	DeleteApplication(ID uint) (*ApplicationModel, error)
+	// GetDeletedApplicationRole is GetApplicationRole of the deleted applications
+	GetDeletedApplicationRole(accountID uint, UUID string) (*ApplicationModel, Role, error)
+	RestoreApplication(ID uint) error
+	GetPurgeableApplications(deletedBefore time.Time, limit int) ([]*ApplicationModel, error)
+	// PurgeApplication permanently removes the application with all of its devices, tags, users, events,
+	// journeys, segments, android groups and jobs
+	PurgeApplication(ID uint) error
+
+	CreateAPIKey(model APIKeyModel) (*APIKeyModel, error)
+	GetAPIKeys(appID uint) ([]*APIKeyModel, error)
+	GetAPIKey(appID uint, UUID string) (*APIKeyModel, error)
+	// GetAPIKeyByHash finds the key of the application using the hash of the key, expired keys are included
+	GetAPIKeyByHash(appID uint, hash string) (*APIKeyModel, error)
+	UpdateAPIKeyExpiry(ID uint, expiresAt time.Time) error
+	TouchAPIKey(ID uint, usedAt time.Time) error
+	DeleteAPIKey(appID uint, UUID string) error
 
 	GetAndroidGroups(appId uint) ([]*AndroidGroupModel, error)
 	CreateAndroidGroup(model AndroidGroupModel) (*AndroidGroupModel, error)
@@ -22,4 +48,10 @@ type Repository interface {
 type Cache interface {
 	GetApplicationData(appUUID string) (*ApplicationCachedDataModel, error)
 	SetApplicationData(appUUID string, model ApplicationCachedDataModel) error
+	DeleteApplicationData(appUUID string) error
+}
+
+// Quota checks the limits of the plan of the account before an application is created or restored
+type Quota interface {
+	CheckApplications(accountID uint) error
 }
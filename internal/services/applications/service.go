@@ -4,21 +4,34 @@ import (
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/utils"
 	"strconv"
+	"time"
 )
 
 var (
 	ErrInvalidApplicationAuthKey = errors.New("application uuid/auth token is invalid")
+	ErrGracePeriodOver           = errors.New("application deletion grace period is over")
+	ErrInvalidServiceAccount     = errors.New("fcm service account is invalid")
+	ErrDuplicateSenderID         = errors.New("fcm sender id is used by another application")
 )
 
 type Service interface {
 	Create(model ApplicationModel) (*ApplicationModel, error)
 	List(accountID uint) ([]*ApplicationModel, error)
-	ListAll() ([]*ApplicationModel, error)
+	ListAll(paging utils.Paging) ([]*ApplicationModel, error)
+	Update(accountID uint, UUID string, model ApplicationModel) (*ApplicationModel, error)
 	UpdateAuthKey(accountID uint, UUID string) (string, error)
 	UpdateIdentityVerification(accountID uint, UUID string, status bool) error
 	Details(accountID uint, UUID string) (*ApplicationModel, error)
-	Delete(accountID uint, UUID string) error
-	CheckApplicationToken(authKey string, UUID string) error
+	Delete(accountID uint, UUID string) (*ApplicationModel, error)
+	Restore(accountID uint, UUID string) (*ApplicationModel, error)
+	Purge(limit int) (int, error)
+	CheckApplicationToken(authKey string, UUID string, scope Scope) error
+	Authorize(accountID uint, UUID string, permission Permission) (*ApplicationModel, error)
+	
+	CreateAPIKey(accountID uint, aUUID string, model APIKeyModel) (*APIKeyModel, error)
+	ListAPIKeys(accountID uint, aUUID string) ([]*APIKeyModel, error)
+	RotateAPIKey(accountID uint, aUUID string, kUUID string) (*APIKeyModel, error)
+	RevokeAPIKey(accountID uint, aUUID string, kUUID string) error
 	
 	GetAndroidGroups(UUID string) ([]*AndroidGroupModel, error)
 	CreateAndroidGroup(accountID uint, aUUID string, Name string) error
@@ -35,21 +48,37 @@ type Service interface {
 type service struct {
 	repository Repository
 	cache      Cache
+	quota      Quota
+	config     Config
 }
 
-func CreateService(r Repository, c Cache) Service {
+func CreateService(r Repository, c Cache, q Quota, config Config) Service {
 	return &service{
 		repository: r,
 		cache:      c,
+		quota:      q,
+		config:     config,
 	}
 }
 
 func (s service) Create(model ApplicationModel) (*ApplicationModel, error) {
-	model.AuthKey = utils.RandomString(64)
+	if err := ValidateServiceAccount(model.FCMAdminJSON); err != nil {
+		return nil, err
+	}
+	if err := s.quota.CheckApplications(model.AccountID); err != nil {
+		return nil, err
+	}
+	authKey, err := utils.SecureRandomString(apiKeyLength)
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to generate auth key", errors.InternalServerError, nil)
+	}
+	model.AuthKey = authKey
 	res, err := s.repository.CreateApplication(model)
 	if err != nil {
 		return nil, err
 	}
+	// New applications are personal applications of their account
+	res.Role = RoleOwner
 	
 	return res, nil
 	
@@ -66,8 +95,15 @@ func (s service) List(accountID uint) ([]*ApplicationModel, error) {
 	return res, nil
 }
 
-func (s service) ListAll() ([]*ApplicationModel, error) {
-	res, err := s.repository.GetAllApplications()
+// ListAll returns the applications of all accounts for the back-office
+func (s service) ListAll(paging utils.Paging) ([]*ApplicationModel, error) {
+	if paging.Page < 1 {
+		paging.Page = 1
+	}
+	if paging.Size < 1 || paging.Size > 100 {
+		paging.Size = 100
+	}
+	res, err := s.repository.GetAllApplications((paging.Page-1)*paging.Size, paging.Size)
 	if err != nil {
 		if errors.HasKind(err, errors.NotFound) {
 			return nil, nil
@@ -78,13 +114,51 @@ func (s service) ListAll() ([]*ApplicationModel, error) {
 }
 
 func (s service) Details(accountID uint, UUID string) (*ApplicationModel, error) {
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, UUID)
+	res, err := s.Authorize(accountID, UUID, PermissionView)
 	return res, err
 }
 
+// Update replaces the settings of the application, SDKs get the new settings as the cached android params are dropped
+func (s service) Update(accountID uint, UUID string, model ApplicationModel) (*ApplicationModel, error) {
+	app, err := s.Authorize(accountID, UUID, PermissionEditSettings)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateServiceAccount(model.FCMAdminJSON); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repository.GetApplicationBySenderID(model.FCMSenderID)
+	if err != nil && !errors.HasKind(err, errors.NotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.ID != app.ID {
+		return nil, errors.WithKindCtx(ErrDuplicateSenderID, "", errors.Conflict, nil)
+	}
+
+	model.ID = app.ID
+	res, err := s.repository.UpdateApplication(model)
+	if err != nil {
+		return nil, err
+	}
+	res.Role = app.Role
+	err = s.cache.DeleteApplicationData(res.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (s service) UpdateAuthKey(accountID uint, UUID string) (string, error) {
-	newToken := utils.RandomString(64)
-	err := s.repository.UpdateAuthKey(accountID, UUID, newToken)
+	app, err := s.Authorize(accountID, UUID, PermissionManageKeys)
+	if err != nil {
+		return "", err
+	}
+	newToken, err := utils.SecureRandomString(apiKeyLength)
+	if err != nil {
+		return "", errors.WithKindCtx(err, "failed to generate auth key", errors.InternalServerError, nil)
+	}
+	err = s.repository.UpdateAuthKey(app.ID, newToken)
 	if err != nil {
 		return "", err
 	}
@@ -92,22 +166,88 @@ func (s service) UpdateAuthKey(accountID uint, UUID string) (string, error) {
 }
 
 func (s service) UpdateIdentityVerification(accountID uint, UUID string, status bool) error {
-	return s.repository.UpdateIdentityVerification(accountID, UUID, status)
+	app, err := s.Authorize(accountID, UUID, PermissionEditSettings)
+	if err != nil {
+		return err
+	}
+	err = s.repository.UpdateIdentityVerification(app.ID, status)
+	if err != nil {
+		return err
+	}
+	// The flag is part of the cached android params
+	return s.cache.DeleteApplicationData(UUID)
 }
 
-func (s service) Delete(accountID uint, UUID string) error {
-	panic("implement me")
+// Delete soft deletes the application, it stops serving SDK requests right away and is purged after the grace period
+func (s service) Delete(accountID uint, UUID string) (*ApplicationModel, error) {
+	app, err := s.Authorize(accountID, UUID, PermissionDelete)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.repository.DeleteApplication(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.Role = app.Role
+	err = s.cache.DeleteApplicationData(res.UUID)
+	if err != nil {
+		return nil, err
+	}
+	s.setPurgeAt(res)
+	return res, nil
 }
 
-func (s service) CheckApplicationToken(authKey string, UUID string) error {
-	res, err := s.repository.GetApplicationModelByUUID(UUID)
+// Restore brings back a deleted application which has not passed its grace period
+func (s service) Restore(accountID uint, UUID string) (*ApplicationModel, error) {
+	res, role, err := s.repository.GetDeletedApplicationRole(accountID, UUID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err = checkPermission(role, PermissionDelete); err != nil {
+		return nil, err
 	}
-	if res.AuthKey != authKey {
-		return errors.WithKindCtx(ErrInvalidApplicationAuthKey, "", errors.Unauthorized, nil)
+	s.setPurgeAt(res)
+	if time.Now().After(*res.PurgeAt) {
+		return nil, errors.WithKindCtx(ErrGracePeriodOver, "", errors.Gone, nil)
+	}
+	// Restored applications count against the plan of the account which has created them
+	if err = s.quota.CheckApplications(res.AccountID); err != nil {
+		return nil, err
+	}
+
+	err = s.repository.RestoreApplication(res.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.DeletedAt = nil
+	res.PurgeAt = nil
+	res.Role = role
+	return res, nil
+}
+
+// Purge permanently removes the deleted applications which have passed their grace period and returns the number of them
+func (s service) Purge(limit int) (int, error) {
+	items, err := s.repository.GetPurgeableApplications(time.Now().Add(-s.config.GetDeletionGracePeriod()), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if err = s.repository.PurgeApplication(item.ID); err != nil {
+			return 0, err
+		}
+		if err = s.cache.DeleteApplicationData(item.UUID); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+func (s service) setPurgeAt(model *ApplicationModel) {
+	if model.DeletedAt == nil {
+		return
 	}
-	return nil
+	purgeAt := model.DeletedAt.Add(s.config.GetDeletionGracePeriod())
+	model.PurgeAt = &purgeAt
 }
 
 func (s service) GetAndroidGroups(UUID string) ([]*AndroidGroupModel, error) {
@@ -121,8 +261,7 @@ func (s service) GetAndroidGroups(UUID string) ([]*AndroidGroupModel, error) {
 }
 
 func (s service) CreateAndroidGroup(accountID uint, aUUID string, Name string) error {
-	// Get Application By AccountID and UUID
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -136,8 +275,7 @@ func (s service) CreateAndroidGroup(accountID uint, aUUID string, Name string) e
 }
 
 func (s service) UpdateAndroidGroup(accountID uint, aUUID string, gUUID string, Name string) error {
-	// Get Application By AccountID and UUID
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -151,8 +289,7 @@ func (s service) UpdateAndroidGroup(accountID uint, aUUID string, gUUID string,
 }
 
 func (s service) DeleteAndroidGroup(accountID uint, aUUID string, gUUID string) error {
-	// Get Application By AccountID and UUID
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -160,7 +297,7 @@ func (s service) DeleteAndroidGroup(accountID uint, aUUID string, gUUID string)
 }
 
 func (s service) CreateAndroidCategory(accountID uint, aUUID string, gUUID string, model AndroidGroupCategoryModel) error {
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -170,7 +307,7 @@ func (s service) CreateAndroidCategory(accountID uint, aUUID string, gUUID strin
 }
 
 func (s service) UpdateAndroidCategory(accountID uint, aUUID string, gUUID string, model AndroidGroupCategoryModel) error {
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -180,7 +317,7 @@ func (s service) UpdateAndroidCategory(accountID uint, aUUID string, gUUID strin
 }
 
 func (s service) DeleteAndroidCategory(accountID uint, aUUID string, gUUID string, cUUID string) error {
-	res, err := s.repository.GetAccountApplicationByUUID(accountID, aUUID)
+	res, err := s.Authorize(accountID, aUUID, PermissionConfigure)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,78 @@
+package applications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+)
+
+type restoreRepository struct {
+	Repository
+	app      ApplicationModel
+	role     Role
+	restored uint
+}
+
+func (r *restoreRepository) GetDeletedApplicationRole(accountID uint, UUID string) (*ApplicationModel, Role, error) {
+	app := r.app
+	return &app, r.role, nil
+}
+
+func (r *restoreRepository) RestoreApplication(ID uint) error {
+	r.restored = ID
+	return nil
+}
+
+type restoreQuota struct {
+	accountID uint
+	err       error
+}
+
+func (q *restoreQuota) CheckApplications(accountID uint) error {
+	q.accountID = accountID
+	return q.err
+}
+
+func TestRestoreChecksQuotaOfOwningAccount(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Hour)
+	repo := &restoreRepository{
+		app:  ApplicationModel{ID: 3, AccountID: 7, UUID: "app", DeletedAt: &deletedAt, OrganizationID: 1},
+		role: RoleOwner,
+	}
+	quota := &restoreQuota{}
+	svc := CreateService(repo, nil, quota, Config{})
+
+	// Account 9 is an owner of the organization but account 7 has created the application
+	res, err := svc.Restore(9, "app")
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if quota.accountID != 7 {
+		t.Fatalf("quota checked for account %d but expected 7", quota.accountID)
+	}
+	if repo.restored != 3 {
+		t.Fatalf("application %d restored but expected 3", repo.restored)
+	}
+	if res.DeletedAt != nil || res.PurgeAt != nil {
+		t.Fatalf("restored application is still deleted")
+	}
+}
+
+func TestRestoreOverQuota(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Hour)
+	repo := &restoreRepository{
+		app:  ApplicationModel{ID: 3, AccountID: 7, UUID: "app", DeletedAt: &deletedAt},
+		role: RoleOwner,
+	}
+	quota := &restoreQuota{err: errors.WithKindCtx(errors.New("limit"), "", errors.PaymentRequired, nil)}
+	svc := CreateService(repo, nil, quota, Config{})
+
+	_, err := svc.Restore(7, "app")
+	if !errors.HasKind(err, errors.PaymentRequired) {
+		t.Fatalf("got %v but expected payment required", err)
+	}
+	if repo.restored != 0 {
+		t.Fatalf("application restored over the quota")
+	}
+}
@@ -0,0 +1,47 @@
+package audit
+
+import "time"
+
+// EntryModel is a mutating call made to Yggdrasil. ActorID is the account which has made the call and AccountID is the
+// account of the application, it is the actor itself for calls which are not made on an application. Calls made by an
+// admin impersonating the actor have the admin as their impersonator
+type EntryModel struct {
+	ID                uint                   `json:"-"`
+	UUID              string                 `json:"uuid"`
+	ActorID           uint                   `json:"-"`
+	ActorEmail        string                 `json:"actor_email"`
+	ImpersonatorID    uint                   `json:"-"`
+	ImpersonatorEmail string                 `json:"impersonator_email,omitempty"`
+	SessionID         string                 `json:"session_id"`
+	AccountID         uint                   `json:"-"`
+	ApplicationID     uint                   `json:"-"`
+	Action            string                 `json:"action"`
+	Status            int                    `json:"status"`
+	Changes           map[string]ChangeModel `json:"changes"`
+	IP                string                 `json:"ip"`
+	UserAgent         string                 `json:"user_agent"`
+	CreatedAt         time.Time              `json:"created_at"`
+}
+
+// ChangeModel is the value of a setting before and after the call, added settings have no value before
+// and removed settings have no value after
+type ChangeModel struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// SnapshotModel is the state of an application, Values maps the name of each setting to its value. Secrets such as
+// the auth key are only kept as their fingerprints
+type SnapshotModel struct {
+	ApplicationID uint
+	AccountID     uint
+	Values        map[string]interface{}
+}
+
+// FilterModel narrows down the listed entries, zero fields are not filtered on
+type FilterModel struct {
+	Action     string
+	ActorEmail string
+	From       time.Time
+	Until      time.Time
+}
@@ -0,0 +1,13 @@
+package audit
+
+import "github.com/subzerobo/ratatoskr/internal/services/applications"
+
+type Repository interface {
+	applications.Authorizer
+
+	// GetApplicationSnapshot returns the state of the application, deleted applications are included
+	GetApplicationSnapshot(UUID string) (*SnapshotModel, error)
+	CreateEntry(model EntryModel) error
+	// GetEntries returns the entries of the application matching the filter, newest first
+	GetEntries(applicationID uint, filter FilterModel, offset int, limit int) ([]*EntryModel, error)
+}
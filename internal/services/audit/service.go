@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"reflect"
+)
+
+type Service interface {
+	Snapshot(aUUID string) (*SnapshotModel, error)
+	Record(model EntryModel, before *SnapshotModel, after *SnapshotModel) error
+	List(accountID uint, aUUID string, filter FilterModel, paging utils.Paging) ([]*EntryModel, error)
+}
+
+type service struct {
+	repository Repository
+}
+
+func CreateService(r Repository) Service {
+	return &service{
+		repository: r,
+	}
+}
+
+// Snapshot returns the state of the application, it is nil when there is no such application
+func (s service) Snapshot(aUUID string) (*SnapshotModel, error) {
+	if aUUID == "" {
+		return nil, nil
+	}
+	res, err := s.repository.GetApplicationSnapshot(aUUID)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// Record stores the entry with the changes between the snapshots of the application taken before and after the call
+func (s service) Record(model EntryModel, before *SnapshotModel, after *SnapshotModel) error {
+	var beforeValues, afterValues map[string]interface{}
+	if before != nil {
+		model.ApplicationID = before.ApplicationID
+		model.AccountID = before.AccountID
+		beforeValues = before.Values
+	}
+	if after != nil {
+		model.ApplicationID = after.ApplicationID
+		model.AccountID = after.AccountID
+		afterValues = after.Values
+	}
+	if model.AccountID == 0 {
+		model.AccountID = model.ActorID
+	}
+	model.Changes = diff(beforeValues, afterValues)
+	return s.repository.CreateEntry(model)
+}
+
+// List returns the entries of the application, only the owners and admins of the application can see them
+func (s service) List(accountID uint, aUUID string, filter FilterModel, paging utils.Paging) ([]*EntryModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionViewAudit)
+	if err != nil {
+		return nil, err
+	}
+	if paging.Page < 1 {
+		paging.Page = 1
+	}
+	if paging.Size < 1 || paging.Size > 100 {
+		paging.Size = 100
+	}
+	return s.repository.GetEntries(app.ID, filter, (paging.Page-1)*paging.Size, paging.Size)
+}
+
+// diff returns the settings whose values are not the same in both of the snapshots
+func diff(before map[string]interface{}, after map[string]interface{}) map[string]ChangeModel {
+	changes := make(map[string]ChangeModel)
+	for k, v := range before {
+		if a, ok := after[k]; !ok || !reflect.DeepEqual(v, a) {
+			changes[k] = ChangeModel{Before: v, After: after[k]}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = ChangeModel{Before: nil, After: v}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,121 @@
+package authentication
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"strings"
+	"time"
+)
+
+// SearchAccounts finds the accounts by their email or company name, all of the accounts are listed for an empty query
+func (s service) SearchAccounts(query string, paging utils.Paging) ([]*AccountModel, error) {
+	offset, limit := pageBounds(paging)
+	return s.repository.SearchAccounts(strings.TrimSpace(query), offset, limit)
+}
+
+// SetAccountActive activates or deactivates the account, deactivated accounts are logged out of all of their sessions
+func (s service) SetAccountActive(UUID string, active bool) (*AccountModel, error) {
+	account, err := s.repository.GetAccountByUUID(UUID)
+	if err != nil {
+		return nil, err
+	}
+	if !active && account.IsSuperUser {
+		return nil, errors.WithKindCtx(ErrDeactivateSuperUser, "", errors.Forbidden, nil)
+	}
+	if err = s.repository.UpdateAccountActive(account.ID, active); err != nil {
+		return nil, err
+	}
+	if !active {
+		if err = s.LogoutAll(account.ID); err != nil {
+			return nil, err
+		}
+	}
+	account.Active = active
+	return account, nil
+}
+
+// SetAccountPlan changes the plan of the account, the new plan is given to its access tokens once they are refreshed
+func (s service) SetAccountPlan(UUID string, plan Plan) (*AccountModel, error) {
+	if !plan.IsValid() {
+		return nil, errors.WithKindCtx(ErrInvalidPlan, "", errors.BadRequest, nil)
+	}
+	account, err := s.repository.GetAccountByUUID(UUID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.repository.UpdateAccountPlan(account.ID, plan); err != nil {
+		return nil, err
+	}
+	account.Plan = plan
+	return account, nil
+}
+
+// Impersonate lets the super user act as the account. It issues an access token of a new session of the account
+// without a refresh token, so the impersonation ends once the token is expired, and records who has started it and why
+func (s service) Impersonate(adminID uint, UUID string, reason string) (*TokenModel, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.WithKindCtx(ErrImpersonationReason, "", errors.BadRequest, nil)
+	}
+	admin, err := s.repository.GetAccountByID(adminID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.repository.GetAccountByUUID(UUID)
+	if err != nil {
+		return nil, err
+	}
+	if account.IsSuperUser {
+		return nil, errors.WithKindCtx(ErrImpersonateSuperUser, "", errors.Forbidden, nil)
+	}
+	if !account.Active {
+		return nil, errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
+	}
+
+	// Nobody knows the refresh token of the session, it can not be refreshed
+	refreshToken, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate refresh token")
+	}
+	session, err := s.repository.CreateSession(SessionModel{
+		AccountID: account.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.Config.JWT.GetAccessTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.repository.CreateImpersonation(ImpersonationModel{
+		AdminID:      admin.ID,
+		AdminEmail:   admin.Email,
+		AccountID:    account.ID,
+		AccountEmail: account.Email,
+		SessionUUID:  session.UUID,
+		Reason:       reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The admin is named in the token, so the actions taken during the session are not attributed to the account
+	tokens, err := s.sessionTokens(account, session.UUID, "", &ImpersonatorClaims{UserID: admin.ID, Email: admin.Email})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// ListImpersonations returns the audit records of the impersonations
+func (s service) ListImpersonations(paging utils.Paging) ([]*ImpersonationModel, error) {
+	offset, limit := pageBounds(paging)
+	return s.repository.GetImpersonations(offset, limit)
+}
+
+func pageBounds(paging utils.Paging) (int, int) {
+	if paging.Page < 1 {
+		paging.Page = 1
+	}
+	if paging.Size < 1 || paging.Size > 100 {
+		paging.Size = 100
+	}
+	return (paging.Page - 1) * paging.Size, paging.Size
+}
@@ -1,55 +1,114 @@
 package authentication
 
 import (
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/facebook"
-	"golang.org/x/oauth2/google"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"net/http"
+	"time"
 )
 
-// Config Holds required configuration for Authentication
+// Config Holds required configuration for Authentication, ConfirmationTTL, PasswordResetTTL and MFATokenTTL are in seconds.
+// PasswordResetURL is the web panel page password reset links point to, the token is added as the token query parameter.
+// MFAIssuer is the name authenticator apps show for the accounts
 type Config struct {
-	OAuthProviders map[string]OAUTH `yaml:"OAUTH_PROVIDERS"`
-	JWT            JWTConfig        `yaml:"JWT"`
-}
-
-func (c Config) GetOAuthProviders() map[string]oauth2.Config {
-	// TODO: Add other providers
-	out := make(map[string]oauth2.Config)
-	for k, v := range c.OAuthProviders {
-		switch k {
-		case "google":
-			out["google"] = oauth2.Config{
-				ClientID:     v.ClientID,
-				ClientSecret: v.ClientSecret,
-				Endpoint:     google.Endpoint,
-				RedirectURL:  v.RedirectURL,
-				Scopes:       v.Scopes,
-			}
-		case "facebook":
-			out["facebook"] = oauth2.Config{
-				ClientID:     v.ClientID,
-				ClientSecret: v.ClientSecret,
-				Endpoint:     facebook.Endpoint,
-				RedirectURL:  v.RedirectURL,
-				Scopes:       v.Scopes,
-			}
+	OAuthProviders   map[string]OAUTH `yaml:"OAUTH_PROVIDERS"`
+	JWT              JWTConfig        `yaml:"JWT"`
+	ConfirmationTTL  int              `yaml:"CONFIRMATION_TTL" envconfig:"AUTH_CONFIRMATION_TTL"`
+	PasswordResetTTL int              `yaml:"PASSWORD_RESET_TTL" envconfig:"AUTH_PASSWORD_RESET_TTL"`
+	PasswordResetURL string           `yaml:"PASSWORD_RESET_URL" envconfig:"AUTH_PASSWORD_RESET_URL"`
+	MFAIssuer        string           `yaml:"MFA_ISSUER" envconfig:"AUTH_MFA_ISSUER"`
+	MFATokenTTL      int              `yaml:"MFA_TOKEN_TTL" envconfig:"AUTH_MFA_TOKEN_TTL"`
+}
+
+// GetConfirmationTTL returns how long the email confirmation links are valid
+func (c Config) GetConfirmationTTL() time.Duration {
+	if c.ConfirmationTTL <= 0 {
+		return 48 * time.Hour
+	}
+	return time.Duration(c.ConfirmationTTL) * time.Second
+}
+
+// GetPasswordResetTTL returns how long the password reset links are valid
+func (c Config) GetPasswordResetTTL() time.Duration {
+	if c.PasswordResetTTL <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.PasswordResetTTL) * time.Second
+}
+
+// GetMFAIssuer returns the name authenticator apps show for the accounts
+func (c Config) GetMFAIssuer() string {
+	if c.MFAIssuer == "" {
+		return "Ratatoskr"
+	}
+	return c.MFAIssuer
+}
+
+// GetMFATokenTTL returns how long a login can wait for its second factor
+func (c Config) GetMFATokenTTL() time.Duration {
+	if c.MFATokenTTL <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.MFATokenTTL) * time.Second
+}
+
+// GetOAuthProviders creates the configured OAuth providers, the type of a provider defaults to its name
+func (c Config) GetOAuthProviders() (map[string]Provider, error) {
+	client := &http.Client{Timeout: providerTimeout}
+	out := make(map[string]Provider)
+	for name, v := range c.OAuthProviders {
+		providerType := v.Type
+		if providerType == "" {
+			providerType = name
 		}
+		if len(v.Scopes) == 0 {
+			v.Scopes = defaultScopes(providerType)
+		}
+		provider, err := newProvider(providerType, v, client)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create %s oauth provider", name)
+		}
+		out[name] = provider
 	}
-	return out
+	return out, nil
 }
 
+// OAUTH configures an OAuth provider. Type is one of google, facebook, github and oidc, the endpoints of oidc
+// providers are discovered from their Issuer. AuthURL, TokenURL and UserInfoURL override the endpoints of the type
 type OAUTH struct {
+	Type         string   `yaml:"TYPE" envconfig:"TYPE"`
 	ClientID     string   `yaml:"CLIENT_ID" envconfig:"CLIENT_ID"`
 	ClientSecret string   `yaml:"CLIENT_SECRET" envconfig:"CLIENT_SECRET"`
 	RedirectURL  string   `yaml:"REDIRECT_URL" envconfig:"REDIRECT_URL"`
 	Scopes       []string `yaml:"SCOPES" envconfig:"SCOPES"`
+	Issuer       string   `yaml:"ISSUER" envconfig:"ISSUER"`
+	AuthURL      string   `yaml:"AUTH_URL" envconfig:"AUTH_URL"`
+	TokenURL     string   `yaml:"TOKEN_URL" envconfig:"TOKEN_URL"`
+	UserInfoURL  string   `yaml:"USER_INFO_URL" envconfig:"USER_INFO_URL"`
 }
 
-// JWTConfig Stores JWT configurations
+// JWTConfig Stores JWT configurations, AccessTTL is the lifetime of access tokens in seconds and ExpireDays is how
+// long a session can be kept alive using its refresh token
 type JWTConfig struct {
 	Audience   string `yaml:"AUDIENCE" envconfig:"JWT_AUDIENCE"`
 	Issuer     string `yaml:"ISSUER" envconfig:"JWT_ISSUER"`
 	Secret     string `yaml:"SECRET" envconfig:"JWT_SECRET"`
 	Version    string `yaml:"VERSION" envconfig:"JWT_VERSION"`
 	ExpireDays int    `yaml:"EXPIRE" envconfig:"JWT_EXPIRE_DAYS"`
+	AccessTTL  int    `yaml:"ACCESS_TTL" envconfig:"JWT_ACCESS_TTL"`
+}
+
+// GetAccessTTL returns the lifetime of the access tokens
+func (c JWTConfig) GetAccessTTL() time.Duration {
+	if c.AccessTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.AccessTTL) * time.Second
+}
+
+// GetRefreshTTL returns the lifetime of the refresh tokens
+func (c JWTConfig) GetRefreshTTL() time.Duration {
+	if c.ExpireDays <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(24*c.ExpireDays) * time.Hour
 }
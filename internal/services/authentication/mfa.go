@@ -0,0 +1,277 @@
+package authentication
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"strings"
+	"time"
+)
+
+const (
+	// mfaPurpose tells the tokens of logins waiting for their second factor apart from the other tokens
+	mfaPurpose = "mfa_pending"
+	// maxMFAAttempts limits the number of codes an account can try in the attempt window
+	maxMFAAttempts   = 5
+	mfaAttemptWindow = 5 * time.Minute
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// recoveryCodeCharset leaves out the characters which are easy to mistake for others when typed from a printout
+	recoveryCodeCharset = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrInvalidMFAToken    = errors.New("two-factor login token is invalid or has been expired")
+	ErrInvalidMFACode     = errors.New("two-factor code is invalid")
+	ErrTooManyMFAAttempts = errors.New("too many two-factor attempts, please try again later")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled     = errors.New("two-factor authentication has not been enrolled")
+)
+
+// codeNormalizer removes the separators users may type in the codes
+var codeNormalizer = strings.NewReplacer("-", "", " ", "")
+
+// VerifyMFA completes the login of the mfa token using a code of the authenticator app or a recovery code
+func (s service) VerifyMFA(mfaToken string, code string) (*AccountModel, *TokenModel, error) {
+	claims, err := s.parseMFAToken(mfaToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	account, err := s.repository.GetAccountByID(claims.UserID)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, nil, errors.WithKindCtx(ErrInvalidMFAToken, "", errors.Unauthorized, nil)
+		}
+		return nil, nil, err
+	}
+	if !account.Active {
+		return nil, nil, errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
+	}
+	if !account.MFAEnabled {
+		return nil, nil, errors.WithKindCtx(ErrInvalidMFAToken, "", errors.Unauthorized, nil)
+	}
+
+	valid, err := s.checkMFACode(account, code, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		return nil, nil, errors.WithKindCtx(ErrInvalidMFACode, "", errors.Unauthorized, nil)
+	}
+	tokens, err := s.createSession(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, tokens, nil
+}
+
+// EnrollMFA creates a new totp secret for the account, it is not required on login until it is activated by a code
+func (s service) EnrollMFA(accountID uint) (*MFAEnrollmentModel, error) {
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.MFAEnabled {
+		return nil, errors.WithKindCtx(ErrMFAAlreadyEnabled, "", errors.Conflict, nil)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "", errors.InternalServerError, nil)
+	}
+	err = s.repository.UpdateMFASecret(account.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAEnrollmentModel{
+		Secret: secret,
+		URI:    utils.TOTPProvisioningURI(s.Config.GetMFAIssuer(), account.Email, secret),
+	}, nil
+}
+
+// ActivateMFA enables the enrolled secret once the authenticator app has proven to be configured with it and returns
+// the recovery codes of the account, they are only returned once
+func (s service) ActivateMFA(accountID uint, code string) ([]string, error) {
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.MFAEnabled {
+		return nil, errors.WithKindCtx(ErrMFAAlreadyEnabled, "", errors.Conflict, nil)
+	}
+	secret, err := s.repository.GetMFASecret(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, errors.WithKindCtx(ErrMFANotEnrolled, "", errors.BadRequest, nil)
+	}
+
+	valid, err := s.checkMFACode(account, code, false)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.WithKindCtx(ErrInvalidMFACode, "", errors.BadRequest, nil)
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repository.EnableMFA(account.ID, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA removes the totp secret and recovery codes of the account, a valid code is required
+func (s service) DisableMFA(accountID uint, code string) error {
+	account, err := s.enabledMFAAccount(accountID, code)
+	if err != nil {
+		return err
+	}
+	return s.repository.DisableMFA(account.ID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the account, the old ones stop working
+func (s service) RegenerateRecoveryCodes(accountID uint, code string) ([]string, error) {
+	account, err := s.enabledMFAAccount(accountID, code)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repository.ReplaceRecoveryCodes(account.ID, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// startLogin starts a session for the account or asks for the second factor when it is enabled
+func (s service) startLogin(account *AccountModel) (*TokenModel, error) {
+	if !account.MFAEnabled {
+		return s.createSession(account)
+	}
+	token, err := s.generateMFAToken(account)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenModel{MFAToken: token}, nil
+}
+
+// enabledMFAAccount gets the account with enabled two-factor authentication which the code is valid for
+func (s service) enabledMFAAccount(accountID uint, code string) (*AccountModel, error) {
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !account.MFAEnabled {
+		return nil, errors.WithKindCtx(ErrMFANotEnabled, "", errors.BadRequest, nil)
+	}
+	valid, err := s.checkMFACode(account, code, true)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.WithKindCtx(ErrInvalidMFACode, "", errors.BadRequest, nil)
+	}
+	return account, nil
+}
+
+// checkMFACode checks a code of the authenticator app or when allowed a recovery code, both can only be used once.
+// The attempts of the account are limited so the codes can not be guessed
+func (s service) checkMFACode(account *AccountModel, code string, allowRecovery bool) (bool, error) {
+	attempts, err := s.sessions.CountMFAAttempt(account.ID, mfaAttemptWindow)
+	if err != nil {
+		return false, errors.WithKindCtx(err, "failed to count the two-factor attempts", errors.ServiceUnavailable, nil)
+	}
+	if attempts > maxMFAAttempts {
+		return false, errors.WithKindCtx(ErrTooManyMFAAttempts, "", errors.TooManyRequests, nil)
+	}
+
+	code = strings.ToLower(codeNormalizer.Replace(code))
+	valid := false
+	switch {
+	case len(code) == utils.TOTPDigits:
+		secret, err := s.repository.GetMFASecret(account.ID)
+		if err != nil {
+			return false, err
+		}
+		step, ok := utils.CheckTOTP(secret, code, time.Now())
+		if !ok {
+			break
+		}
+		err = s.repository.UpdateMFAStep(account.ID, step)
+		if err != nil && !errors.HasKind(err, errors.NotFound) {
+			return false, err
+		}
+		valid = err == nil
+	case allowRecovery && len(code) == recoveryCodeLength:
+		err = s.repository.UseRecoveryCode(account.ID, hashToken(code))
+		if err != nil && !errors.HasKind(err, errors.NotFound) {
+			return false, err
+		}
+		valid = err == nil
+	}
+
+	if valid {
+		// The code has already been used, failing to reset the attempts only delays the next ones
+		_ = s.sessions.ResetMFAAttempts(account.ID)
+	}
+	return valid, nil
+}
+
+func (s service) generateMFAToken(account *AccountModel) (string, error) {
+	claims := MFAClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  s.Config.JWT.Audience,
+			ExpiresAt: time.Now().Add(s.Config.GetMFATokenTTL()).Unix(),
+			Id:        uuid.NewV4().String(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    s.Config.JWT.Issuer,
+			Subject:   account.UUID,
+		},
+		UserID:  account.ID,
+		Purpose: mfaPurpose,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString([]byte(s.Config.JWT.Secret))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign the two-factor login token")
+	}
+	return signedToken, nil
+}
+
+func (s service) parseMFAToken(mfaToken string) (*MFAClaims, error) {
+	claims := &MFAClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err := p.ParseWithClaims(mfaToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.Config.JWT.Secret), nil
+	})
+	if err != nil || claims.Purpose != mfaPurpose {
+		return nil, errors.WithKindCtx(ErrInvalidMFAToken, "", errors.Unauthorized, nil)
+	}
+	return claims, nil
+}
+
+// generateRecoveryCodes creates the recovery codes shown to the user and their hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.SecureRandomStringWithCharset(recoveryCodeLength, recoveryCodeCharset)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to generate recovery code")
+		}
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
@@ -7,38 +7,101 @@ import (
 )
 
 type AccountModel struct {
-	ID                 uint
-	UUID               string
-	Email              string
-	EncryptedPassword  string
-	OAuthProvider      string
-	OAuthUID           string
-	Picture            string
-	CompanyName        string
-	IsSuperUser        bool
-	LastLoginDate      sql.NullTime
-	Active             bool
-	Confirmed          bool
-	ConfirmationToken  string
-	ConfirmationSentAt sql.NullTime
-	CreatedAt          time.Time `gorm:"default:current_timestamp"`
-	UpdatedAt          time.Time `gorm:"default:current_timestamp"`
-}
-
-// GoogleResponse is model to unmarshal the google oauth login response
-type GoogleResponse struct {
-	ID        string `json:"sub"`
-	Email     string `json:"email"`
-	Picture   string `json:"picture"`
-	Name      string `json:"name"`
-	FirstName string `json:"given_name"`
-	LastName  string `json:"family_name"`
+	ID                  uint
+	UUID                string
+	Email               string
+	EncryptedPassword   string
+	OAuthProvider       string
+	OAuthUID            string
+	Picture             string
+	CompanyName         string
+	IsSuperUser         bool
+	LastLoginDate       sql.NullTime
+	Active              bool
+	Confirmed           bool
+	ConfirmationToken   string
+	ConfirmationSentAt  sql.NullTime
+	PasswordResetSentAt sql.NullTime
+	MFAEnabled          bool
+	MFALastStep         int64
+	Plan                Plan
+	CreatedAt           time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt           time.Time `gorm:"default:current_timestamp"`
 }
 
-type AppClaims struct {
+// Plan is the subscription of an account, it is given to the access tokens as the role of the account
+type Plan string
+
+const (
+	PlanFree Plan = "free"
+	PlanPro  Plan = "pro"
+)
+
+// IsValid reports whether the plan is one of the known plans
+func (p Plan) IsValid() bool {
+	return p == PlanFree || p == PlanPro
+}
+
+// ImpersonationModel records a super user logging in as another account, SessionUUID is the session created for it
+type ImpersonationModel struct {
+	ID           uint      `json:"-"`
+	UUID         string    `json:"uuid"`
+	AdminID      uint      `json:"-"`
+	AdminEmail   string    `json:"admin_email"`
+	AccountID    uint      `json:"-"`
+	AccountEmail string    `json:"account_email"`
+	SessionUUID  string    `json:"session_uuid"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SessionModel is a login of an account, the refresh token of the session is replaced on every refresh
+type SessionModel struct {
+	ID                uint
+	UUID              string
+	AccountID         uint
+	TokenHash         string
+	PreviousTokenHash string
+	ExpiresAt         time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// TokenModel holds the tokens given to the user on login and refresh, ExpiresIn is the lifetime of the access token in seconds.
+// Logins of accounts with two-factor authentication only get the MFAToken, they are completed by verifying a code using it
+type TokenModel struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	MFAToken     string
+}
+
+// MFAEnrollmentModel holds the secret authenticator apps are configured with, URI is the otpauth uri of the QR code
+type MFAEnrollmentModel struct {
+	Secret string
+	URI    string
+}
+
+// MFAClaims are the claims of the short-lived tokens of logins waiting for their second factor
+type MFAClaims struct {
 	jwt.StandardClaims
 	UserID  uint   `json:"user_id"`
-	Version string   `json:"version"`
-	Email   string   `json:"email"`
-	Roles   []string `json:"roles"`
+	Purpose string `json:"purpose"`
+}
+
+type AppClaims struct {
+	jwt.StandardClaims
+	UserID    uint     `json:"user_id"`
+	SessionID string   `json:"sid"`
+	Version   string   `json:"version"`
+	Email     string   `json:"email"`
+	Roles     []string `json:"roles"`
+	// Impersonator is the admin acting as the account, it is only set on the tokens of impersonation sessions
+	Impersonator *ImpersonatorClaims `json:"impersonator,omitempty"`
+}
+
+// ImpersonatorClaims names the admin who has started the impersonation session of the token
+type ImpersonatorClaims struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
 }
@@ -0,0 +1,312 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/facebook"
+	"golang.org/x/oauth2/github"
+	"golang.org/x/oauth2/google"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProviderGoogle   = "google"
+	ProviderFacebook = "facebook"
+	ProviderGitHub   = "github"
+	ProviderOIDC     = "oidc"
+
+	// providerTimeout limits every call made to the OAuth providers
+	providerTimeout = 10 * time.Second
+	// maxProviderResponse limits the size of the responses read from the OAuth providers
+	maxProviderResponse = 1 << 20
+)
+
+var (
+	ErrProviderUnavailable = errors.New("oauth provider is not available")
+	ErrInvalidOAuthCode    = errors.New("oauth code is invalid")
+)
+
+// Identity is the account of the user at the OAuth provider
+type Identity struct {
+	ID            string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Provider signs users in using an OAuth provider
+type Provider interface {
+	// AuthCodeURL returns the consent page url of the provider
+	AuthCodeURL(state string) (string, error)
+	// Identify exchanges the code of the callback and gets the identity of the user from the provider
+	Identify(ctx context.Context, code string) (*Identity, error)
+}
+
+// userInfoMapper gets the identity of the user using an authorized client
+type userInfoMapper func(ctx context.Context, client *http.Client, userInfoURL string) (*Identity, error)
+
+type oauthProvider struct {
+	config OAUTH
+	client *http.Client
+	mapper userInfoMapper
+
+	// endpoints of OIDC providers are discovered on first use
+	mu          sync.Mutex
+	endpoint    oauth2.Endpoint
+	userInfoURL string
+	resolved    bool
+}
+
+// newProvider creates the provider of the given type, configured urls override the ones of the type
+func newProvider(providerType string, cfg OAUTH, client *http.Client) (*oauthProvider, error) {
+	p := &oauthProvider{config: cfg, client: client}
+	switch providerType {
+	case ProviderGoogle:
+		p.endpoint = google.Endpoint
+		p.userInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+		p.mapper = mapOIDCUserInfo
+		p.resolved = true
+	case ProviderFacebook:
+		p.endpoint = facebook.Endpoint
+		p.userInfoURL = "https://graph.facebook.com/me?fields=id,name,email,picture.type(large)"
+		p.mapper = mapFacebookUserInfo
+		p.resolved = true
+	case ProviderGitHub:
+		p.endpoint = github.Endpoint
+		p.userInfoURL = "https://api.github.com/user"
+		p.mapper = mapGitHubUserInfo
+		p.resolved = true
+	case ProviderOIDC:
+		if cfg.Issuer == "" {
+			return nil, errors.New("oidc providers require an issuer")
+		}
+		p.mapper = mapOIDCUserInfo
+	default:
+		return nil, errors.Errorf("oauth provider type %s is not supported", providerType)
+	}
+	return p, nil
+}
+
+func (p *oauthProvider) AuthCodeURL(state string) (string, error) {
+	config, _, err := p.oauth2Config(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state), nil
+}
+
+func (p *oauthProvider) Identify(ctx context.Context, code string) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	config, userInfoURL, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, errors.WithKindCtx(ErrInvalidOAuthCode, err.Error(), errors.Unauthorized, nil)
+	}
+
+	identity, err := p.mapper(ctx, config.Client(ctx, token), userInfoURL)
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to get the user info", errors.BadGateway, nil)
+	}
+	if identity.ID == "" {
+		return nil, errors.WithKindCtx(ErrProviderUnavailable, "user info has no id", errors.BadGateway, nil)
+	}
+	return identity, nil
+}
+
+// oauth2Config builds the client configuration, OIDC discovery is retried until it succeeds once
+func (p *oauthProvider) oauth2Config(ctx context.Context) (*oauth2.Config, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.resolved {
+		if err := p.discover(ctx); err != nil {
+			return nil, "", errors.WithKindCtx(err, "oidc discovery failed", errors.BadGateway, nil)
+		}
+		p.resolved = true
+	}
+
+	endpoint := p.endpoint
+	if p.config.AuthURL != "" {
+		endpoint.AuthURL = p.config.AuthURL
+	}
+	if p.config.TokenURL != "" {
+		endpoint.TokenURL = p.config.TokenURL
+	}
+	userInfoURL := p.userInfoURL
+	if p.config.UserInfoURL != "" {
+		userInfoURL = p.config.UserInfoURL
+	}
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+	}, userInfoURL, nil
+}
+
+func (p *oauthProvider) discover(ctx context.Context) error {
+	issuer := strings.TrimSuffix(p.config.Issuer, "/")
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	err := getJSON(ctx, p.client, issuer+"/.well-known/openid-configuration", &doc)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return errors.Errorf("discovered issuer %s does not match %s", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return errors.New("discovery document misses the required endpoints")
+	}
+	p.endpoint = oauth2.Endpoint{AuthURL: doc.AuthorizationEndpoint, TokenURL: doc.TokenEndpoint}
+	p.userInfoURL = doc.UserInfoEndpoint
+	return nil
+}
+
+// flexBool accepts both booleans and strings, some providers send email_verified as "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*b = flexBool(value)
+	return nil
+}
+
+// mapOIDCUserInfo maps the standard claims of OpenID Connect userinfo endpoints
+func mapOIDCUserInfo(ctx context.Context, client *http.Client, userInfoURL string) (*Identity, error) {
+	var res struct {
+		Sub           string   `json:"sub"`
+		Email         string   `json:"email"`
+		EmailVerified flexBool `json:"email_verified"`
+		Name          string   `json:"name"`
+		Picture       string   `json:"picture"`
+	}
+	if err := getJSON(ctx, client, userInfoURL, &res); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		ID:            res.Sub,
+		Email:         res.Email,
+		EmailVerified: bool(res.EmailVerified),
+		Name:          res.Name,
+		Picture:       res.Picture,
+	}, nil
+}
+
+// mapFacebookUserInfo maps the graph api user, facebook only returns confirmed emails
+func mapFacebookUserInfo(ctx context.Context, client *http.Client, userInfoURL string) (*Identity, error) {
+	var res struct {
+		ID      string `json:"id"`
+		Email   string `json:"email"`
+		Name    string `json:"name"`
+		Picture struct {
+			Data struct {
+				URL string `json:"url"`
+			} `json:"data"`
+		} `json:"picture"`
+	}
+	if err := getJSON(ctx, client, userInfoURL, &res); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		ID:            res.ID,
+		Email:         res.Email,
+		EmailVerified: res.Email != "",
+		Name:          res.Name,
+		Picture:       res.Picture.Data.URL,
+	}, nil
+}
+
+// mapGitHubUserInfo maps the github user, the email is taken from the emails api as the profile email may be
+// hidden and is not known to be verified
+func mapGitHubUserInfo(ctx context.Context, client *http.Client, userInfoURL string) (*Identity, error) {
+	var res struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getJSON(ctx, client, userInfoURL, &res); err != nil {
+		return nil, err
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, strings.TrimSuffix(userInfoURL, "/")+"/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Name:    res.Name,
+		Picture: res.AvatarURL,
+	}
+	if res.ID != 0 {
+		identity.ID = strconv.FormatInt(res.ID, 10)
+	}
+	if identity.Name == "" {
+		identity.Name = res.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+		}
+	}
+	return identity, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %s", req.URL.Host)
+	}
+	defer resp.Body.Close()
+
+	body := io.LimitReader(resp.Body, maxProviderResponse)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(ioutil.Discard, body)
+		return errors.Errorf("%s responded with status %d", req.URL.Host, resp.StatusCode)
+	}
+	if err = json.NewDecoder(body).Decode(out); err != nil {
+		return errors.Wrapf(err, "failed to decode %s response", req.URL.Host)
+	}
+	return nil
+}
+
+// defaultScopes are requested when no scopes are configured for the provider
+func defaultScopes(providerType string) []string {
+	switch providerType {
+	case ProviderFacebook:
+		return []string{"email", "public_profile"}
+	case ProviderGitHub:
+		return []string{"read:user", "user:email"}
+	default:
+		return []string{"openid", "email", "profile"}
+	}
+}
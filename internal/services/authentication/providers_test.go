@@ -0,0 +1,265 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+)
+
+// fakeOAuthServer is a local OIDC provider which accepts the code "valid-code" and returns the configured user info
+func fakeOAuthServer(t *testing.T, userInfo map[string]interface{}) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(userInfo)
+	})
+	t.Cleanup(server.Close)
+	return server
+}
+
+type fakeStateStore map[string]string
+
+func (f fakeStateStore) SetState(key, value string) error {
+	f[key] = value
+	return nil
+}
+
+func (f fakeStateStore) PopState(key string) (string, error) {
+	value := f[key]
+	delete(f, key)
+	return value, nil
+}
+
+type fakeAccounts struct {
+	Repository
+	items []*AccountModel
+}
+
+func (f *fakeAccounts) CreateAccount(model AccountModel) (*AccountModel, error) {
+	model.ID = uint(len(f.items) + 1)
+	f.items = append(f.items, &model)
+	return &model, nil
+}
+
+func (f *fakeAccounts) GetAccountByEmail(email string) (*AccountModel, error) {
+	for _, item := range f.items {
+		if item.Email == email {
+			res := *item
+			return &res, nil
+		}
+	}
+	return nil, errors.WithKindCtx(errors.New("record not found"), "", errors.NotFound, nil)
+}
+
+func (f *fakeAccounts) GetAccountByOAuth(provider string, UID string) (*AccountModel, error) {
+	for _, item := range f.items {
+		if item.OAuthProvider == provider && item.OAuthUID == UID {
+			res := *item
+			return &res, nil
+		}
+	}
+	return nil, errors.WithKindCtx(errors.New("record not found"), "", errors.NotFound, nil)
+}
+
+func (f *fakeAccounts) LinkOAuthAccount(model AccountModel) error {
+	for i, item := range f.items {
+		if item.ID == model.ID {
+			f.items[i] = &model
+		}
+	}
+	return nil
+}
+
+func (f *fakeAccounts) CreateSession(model SessionModel) (*SessionModel, error) {
+	model.UUID = "session"
+	return &model, nil
+}
+
+func (f *fakeAccounts) DeleteExpiredSessions(accountID uint) error {
+	return nil
+}
+
+func createOAuthService(t *testing.T, server *httptest.Server, accounts *fakeAccounts) (Service, fakeStateStore) {
+	states := fakeStateStore{}
+	svc, err := CreateService(accounts, states, nil, Config{
+		OAuthProviders: map[string]OAUTH{
+			"local": {Type: ProviderOIDC, ClientID: "client", ClientSecret: "secret", Issuer: server.URL},
+		},
+		JWT: JWTConfig{Secret: "secret", ExpireDays: 1},
+	}, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return svc, states
+}
+
+// authenticate runs the first step and returns the state of the generated consent url
+func authenticate(t *testing.T, svc Service) string {
+	consentURL, err := svc.OAuthAuthenticate("local")
+	if err != nil {
+		t.Fatalf("failed to get the consent url: %v", err)
+	}
+	u, err := url.Parse(consentURL)
+	if err != nil {
+		t.Fatalf("consent url %s is invalid: %v", consentURL, err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestOAuthCallBackRegistersAccount(t *testing.T) {
+	server := fakeOAuthServer(t, map[string]interface{}{
+		"sub":            "1234",
+		"email":          "user@example.com",
+		"email_verified": "true",
+		"name":           "Example User",
+	})
+	accounts := &fakeAccounts{}
+	svc, _ := createOAuthService(t, server, accounts)
+
+	account, token, err := svc.OAuthCallBack(authenticate(t, svc), "valid-code", "local")
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	if token == nil || token.AccessToken == "" || account.Email != "user@example.com" || account.OAuthUID != "1234" || !account.Confirmed {
+		t.Fatalf("we got %+v as the registered account", account)
+	}
+
+	// The second login finds the account by the identity
+	account, _, err = svc.OAuthCallBack(authenticate(t, svc), "valid-code", "local")
+	if err != nil || account.ID != 1 || len(accounts.items) != 1 {
+		t.Fatalf("we got %+v, %v on the second login and %d accounts", account, err, len(accounts.items))
+	}
+}
+
+func TestOAuthCallBackLinksVerifiedEmail(t *testing.T) {
+	server := fakeOAuthServer(t, map[string]interface{}{
+		"sub":            "1234",
+		"email":          "user@example.com",
+		"email_verified": true,
+	})
+	accounts := &fakeAccounts{items: []*AccountModel{
+		{ID: 1, Email: "user@example.com", EncryptedPassword: "chosen-by-someone", Active: true},
+	}}
+	svc, _ := createOAuthService(t, server, accounts)
+
+	account, _, err := svc.OAuthCallBack(authenticate(t, svc), "valid-code", "local")
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	linked := accounts.items[0]
+	if account.ID != 1 || linked.OAuthProvider != "local" || linked.OAuthUID != "1234" || !linked.Confirmed {
+		t.Fatalf("we got %+v as the linked account", linked)
+	}
+	if linked.EncryptedPassword == "chosen-by-someone" {
+		t.Fatalf("password of the unconfirmed account has not been replaced")
+	}
+}
+
+func TestOAuthCallBackRejectsUnverifiedEmail(t *testing.T) {
+	server := fakeOAuthServer(t, map[string]interface{}{
+		"sub":            "1234",
+		"email":          "user@example.com",
+		"email_verified": false,
+	})
+	accounts := &fakeAccounts{items: []*AccountModel{
+		{ID: 1, Email: "user@example.com", Active: true, Confirmed: true},
+	}}
+	svc, _ := createOAuthService(t, server, accounts)
+
+	_, _, err := svc.OAuthCallBack(authenticate(t, svc), "valid-code", "local")
+	if !errors.HasKind(err, errors.Conflict) {
+		t.Fatalf("we got %v but expected a conflict", err)
+	}
+	if accounts.items[0].OAuthUID != "" {
+		t.Fatalf("unverified identity has been linked")
+	}
+}
+
+func TestOAuthCallBackRejectsInvalidState(t *testing.T) {
+	server := fakeOAuthServer(t, map[string]interface{}{"sub": "1234", "email": "user@example.com"})
+	svc, states := createOAuthService(t, server, &fakeAccounts{})
+
+	_, _, err := svc.OAuthCallBack("unknown", "valid-code", "local")
+	if !errors.HasKind(err, errors.Unauthorized) {
+		t.Fatalf("we got %v for an unknown state but expected unauthorized", err)
+	}
+
+	// States are bound to their provider and can only be used once
+	states["other"] = "google"
+	_, _, err = svc.OAuthCallBack("other", "valid-code", "local")
+	if !errors.HasKind(err, errors.Unauthorized) {
+		t.Fatalf("we got %v for the state of another provider but expected unauthorized", err)
+	}
+	state := authenticate(t, svc)
+	if _, _, err = svc.OAuthCallBack(state, "valid-code", "local"); err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	_, _, err = svc.OAuthCallBack(state, "valid-code", "local")
+	if !errors.HasKind(err, errors.Unauthorized) {
+		t.Fatalf("we got %v for a reused state but expected unauthorized", err)
+	}
+}
+
+func TestOAuthCallBackRejectsInvalidCode(t *testing.T) {
+	server := fakeOAuthServer(t, map[string]interface{}{"sub": "1234", "email": "user@example.com"})
+	svc, _ := createOAuthService(t, server, &fakeAccounts{})
+
+	_, _, err := svc.OAuthCallBack(authenticate(t, svc), "invalid-code", "local")
+	if !errors.HasKind(err, errors.Unauthorized) {
+		t.Fatalf("we got %v but expected unauthorized", err)
+	}
+}
+
+func TestGitHubUserInfo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat", "avatar_url": "https://example.com/a.png"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "octocat@example.com", "primary": true, "verified": true},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	identity, err := mapGitHubUserInfo(context.Background(), &http.Client{Timeout: time.Second}, server.URL+"/user")
+	if err != nil {
+		t.Fatalf("failed to map the user info: %v", err)
+	}
+	if identity.ID != "42" || identity.Name != "octocat" || identity.Email != "octocat@example.com" || !identity.EmailVerified {
+		t.Fatalf("we got %+v as the github identity", identity)
+	}
+}
@@ -1,11 +1,68 @@
 package authentication
 
+import "time"
+
 type Repository interface {
 	CreateAccount(model AccountModel) (*AccountModel, error)
+	GetAccountByID(ID uint) (*AccountModel, error)
 	GetAccountByEmail(email string) (*AccountModel, error)
+	GetAccountByUUID(UUID string) (*AccountModel, error)
+	// SearchAccounts returns the accounts whose email or company name contains the query, newest first
+	SearchAccounts(query string, offset int, limit int) ([]*AccountModel, error)
+	UpdateAccountActive(ID uint, active bool) error
+	UpdateAccountPlan(ID uint, plan Plan) error
+	CreateImpersonation(model ImpersonationModel) (*ImpersonationModel, error)
+	// GetImpersonations returns the impersonations of all accounts, newest first
+	GetImpersonations(offset int, limit int) ([]*ImpersonationModel, error)
+	GetAccountByOAuth(provider string, UID string) (*AccountModel, error)
+	// LinkOAuthAccount stores the oauth identity, picture, confirmation and password of the account
+	LinkOAuthAccount(model AccountModel) error
+	// GetAccountByConfirmationToken finds the unconfirmed account using the hash of its confirmation token
+	GetAccountByConfirmationToken(tokenHash string) (*AccountModel, error)
+	UpdateConfirmationToken(ID uint, tokenHash string, sentAt time.Time) error
+	// ConfirmAccount confirms the account only if it still has the token, so a token can only be used once
+	ConfirmAccount(ID uint, tokenHash string) error
+	// GetAccountByPasswordResetToken finds the account using the hash of its password reset token
+	GetAccountByPasswordResetToken(tokenHash string) (*AccountModel, error)
+	UpdatePasswordResetToken(ID uint, tokenHash string, sentAt time.Time) error
+	// ResetPassword replaces the password only if the account still has the token and clears the token,
+	// so a token can only be used once
+	ResetPassword(ID uint, tokenHash string, encryptedPassword string) error
+	CreateSession(model SessionModel) (*SessionModel, error)
+	// GetSessionByTokenHash finds the session using the hash of its current or previous refresh token
+	GetSessionByTokenHash(tokenHash string) (*SessionModel, error)
+	// RotateSession replaces the refresh token only if the session still has the old one, so a token can only be used once
+	RotateSession(ID uint, oldHash string, newHash string) error
+	DeleteSession(accountID uint, UUID string) error
+	// DeleteAccountSessions removes all of the sessions of the account and returns their uuids
+	DeleteAccountSessions(accountID uint) ([]string, error)
+	DeleteExpiredSessions(accountID uint) error
+	// GetMFASecret returns the totp secret of the account, it is empty when the account has not enrolled
+	GetMFASecret(ID uint) (string, error)
+	// UpdateMFASecret stores a new totp secret which is not enabled until EnableMFA
+	UpdateMFASecret(ID uint, secret string) error
+	// UpdateMFAStep stores the time step of an accepted code only if it is later than the last one,
+	// so a code can only be used once
+	UpdateMFAStep(ID uint, step int64) error
+	// EnableMFA enables the enrolled secret and replaces the recovery codes of the account
+	EnableMFA(ID uint, codeHashes []string) error
+	DisableMFA(ID uint) error
+	ReplaceRecoveryCodes(ID uint, codeHashes []string) error
+	// UseRecoveryCode marks the recovery code as used only if it has not been used, so a code can only be used once
+	UseRecoveryCode(ID uint, codeHash string) error
 }
 
 type StateStore interface {
 	SetState(key, value string) error
-	GetState(key string) (string, error)
+	// PopState gets and removes the state so it can only be used once, missing states are returned as empty
+	PopState(key string) (string, error)
+}
+
+// SessionStore keeps the revoked sessions until their access tokens are expired and counts the two-factor attempts
+type SessionStore interface {
+	RevokeSessions(UUIDs []string, ttl time.Duration) error
+	IsSessionRevoked(UUID string) (bool, error)
+	// CountMFAAttempt counts an attempt of the account and returns the number of attempts in the window
+	CountMFAAttempt(accountID uint, window time.Duration) (int64, error)
+	ResetMFAAttempts(accountID uint) error
 }
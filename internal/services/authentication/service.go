@@ -3,9 +3,10 @@ package authentication
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	uuid "github.com/satori/go.uuid"
@@ -13,11 +14,16 @@ import (
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/mailer"
 	"github.com/subzerobo/ratatoskr/pkg/utils"
-	"io/ioutil"
+	"net/url"
 	"time"
 )
 
-const DefaultStateValue = "1"
+const (
+	// tokenLength is the length of the confirmation and password reset tokens
+	tokenLength = 64
+	// resendInterval is the minimum time between two confirmation or password reset emails of an account
+	resendInterval = time.Minute
+)
 
 var (
 	ErrAlreadyRegisteredEmail  = errors.New("email is already in use")
@@ -25,13 +31,49 @@ var (
 	ErrAccountIsNotActive      = errors.New("account has been disabled by support")
 	ErrUserIsNotConfirmed      = errors.New("user email is not confirmed yet")
 	ErrInvalidLoginCredentials = errors.New("invalid login credentials")
+	ErrInvalidOAuthState       = errors.New("oauth state is invalid or has been expired")
+	ErrOAuthEmailRequired      = errors.New("oauth provider has not shared an email")
+	ErrUnverifiedOAuthEmail    = errors.New("email is already in use and is not verified by the oauth provider")
+	
+	ErrInvalidConfirmationToken = errors.New("confirmation token is invalid")
+	ErrExpiredConfirmationToken = errors.New("confirmation token has been expired")
+	ErrInvalidResetToken        = errors.New("password reset token is invalid")
+	ErrExpiredResetToken        = errors.New("password reset token has been expired")
+	
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or has been expired")
+	ErrReusedRefreshToken  = errors.New("refresh token has already been used, the session has been logged out")
+	ErrRevokedToken        = errors.New("token has been revoked")
+	
+	ErrInvalidPlan          = errors.New("plan is invalid")
+	ErrImpersonationReason  = errors.New("reason of the impersonation is required")
+	ErrImpersonateSuperUser = errors.New("super users can not be impersonated")
+	ErrDeactivateSuperUser  = errors.New("super users can not be deactivated")
 )
 
 type Service interface {
 	Signup(email string, password string, company string) error
-	Login(email string, password string) (*AccountModel, string, error)
+	Login(email string, password string) (*AccountModel, *TokenModel, error)
+	Refresh(refreshToken string) (*TokenModel, error)
+	Logout(accountID uint, sessionUUID string) error
+	LogoutAll(accountID uint) error
+	CheckToken(claims *AppClaims) error
+	Verify(token string) error
+	ResendConfirmation(email string) error
+	ForgotPassword(email string) error
+	ResetPassword(token string, password string) error
 	OAuthAuthenticate(provider string) (string, error)
-	OAuthCallBack(state, code, provider string) (*AccountModel, string, error)
+	OAuthCallBack(state, code, provider string) (*AccountModel, *TokenModel, error)
+	VerifyMFA(mfaToken string, code string) (*AccountModel, *TokenModel, error)
+	EnrollMFA(accountID uint) (*MFAEnrollmentModel, error)
+	ActivateMFA(accountID uint, code string) ([]string, error)
+	DisableMFA(accountID uint, code string) error
+	RegenerateRecoveryCodes(accountID uint, code string) ([]string, error)
+	
+	SearchAccounts(query string, paging utils.Paging) ([]*AccountModel, error)
+	SetAccountActive(UUID string, active bool) (*AccountModel, error)
+	SetAccountPlan(UUID string, plan Plan) (*AccountModel, error)
+	Impersonate(adminID uint, UUID string, reason string) (*TokenModel, error)
+	ListImpersonations(paging utils.Paging) ([]*ImpersonationModel, error)
 }
 
 type service struct {
@@ -40,16 +82,24 @@ type service struct {
 	Config     Config
 	repository Repository
 	stateStore StateStore
+	sessions   SessionStore
+	providers  map[string]Provider
 }
 
-func CreateService(r Repository, stateStore StateStore, config Config, mailer mailer.Service, basePath string) Service {
+func CreateService(r Repository, stateStore StateStore, sessions SessionStore, config Config, mailer mailer.Service, basePath string) (Service, error) {
+	providers, err := config.GetOAuthProviders()
+	if err != nil {
+		return nil, err
+	}
 	return &service{
 		repository: r,
 		stateStore: stateStore,
+		sessions:   sessions,
 		Config:     config,
 		Mailer:     mailer,
 		BasePath:   basePath,
-	}
+		providers:  providers,
+	}, nil
 }
 
 func (s service) Signup(email string, password string, company string) error {
@@ -67,7 +117,10 @@ func (s service) Signup(email string, password string, company string) error {
 	
 	// We can create the account
 	hashedPass, _ := utils.HashPassword(password)
-	confirmationToken := utils.RandomString(64)
+	confirmationToken, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate confirmation token")
+	}
 	model := AccountModel{
 		Email:             email,
 		EncryptedPassword: hashedPass,
@@ -75,7 +128,7 @@ func (s service) Signup(email string, password string, company string) error {
 		IsSuperUser:       false,
 		Active:            true,
 		Confirmed:         false,
-		ConfirmationToken: confirmationToken,
+		ConfirmationToken: hashToken(confirmationToken),
 		ConfirmationSentAt: sql.NullTime{
 			Time:  time.Now(),
 			Valid: true,
@@ -87,166 +140,281 @@ func (s service) Signup(email string, password string, company string) error {
 	}
 	
 	// Send Confirmation Email
-	subject := "Ratatoskr Signup Confirmation"
-	confirmUrl := fmt.Sprintf("%s/v1/auth/verify/%s", s.BasePath, confirmationToken)
-	plainTextContent := fmt.Sprintf("Thanks for verifying you %s account!, Please visit this link to verify your registration: %s", email, confirmUrl)
-	htmlContent := fmt.Sprintf(`Thanks for verifying you %[1]s account <br> Please visit this <a href="%[2]s">link</a> to verify your registration or copy this url and visit it using your browser <br> URL: %[2]s`, email, confirmUrl)
-	err = s.Mailer.SendEmail(email, "", subject, plainTextContent, htmlContent)
-	return err
+	return s.sendConfirmationEmail(email, confirmationToken)
 }
 
-func (s service) Login(email string, password string) (*AccountModel, string, error) {
+func (s service) Login(email string, password string) (*AccountModel, *TokenModel, error) {
 	account, err := s.repository.GetAccountByEmail(email)
-	if err != nil && !errors.HasKind(err, errors.NotFound) {
-		return nil, "", err
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, nil, errors.WithKindCtx(ErrInvalidLoginCredentials, "", errors.Unauthorized, nil)
+		}
+		return nil, nil, err
 	}
 	
 	if !utils.CheckPasswordHash(password, account.EncryptedPassword) {
-		return nil, "", errors.WithKindCtx(ErrInvalidLoginCredentials, "", errors.Unauthorized, nil)
+		return nil, nil, errors.WithKindCtx(ErrInvalidLoginCredentials, "", errors.Unauthorized, nil)
 	}
 	
 	if !account.Active {
-		return nil, "", errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
+		return nil, nil, errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
 	}
 	
 	if !account.Confirmed {
-		return nil, "", errors.WithKindCtx(ErrUserIsNotConfirmed, "", errors.Forbidden, nil)
+		return nil, nil, errors.WithKindCtx(ErrUserIsNotConfirmed, "", errors.Forbidden, nil)
+	}
+	
+	tokens, err := s.startLogin(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, tokens, nil
+}
+
+// Verify confirms the email of the account the confirmation token has been sent to
+func (s service) Verify(token string) error {
+	if token == "" {
+		return errors.WithKindCtx(ErrInvalidConfirmationToken, "", errors.NotFound, nil)
+	}
+	tokenHash := hashToken(token)
+	account, err := s.repository.GetAccountByConfirmationToken(tokenHash)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return errors.WithKindCtx(ErrInvalidConfirmationToken, "", errors.NotFound, nil)
+		}
+		return err
+	}
+	
+	if !account.ConfirmationSentAt.Valid || time.Since(account.ConfirmationSentAt.Time) > s.Config.GetConfirmationTTL() {
+		return errors.WithKindCtx(ErrExpiredConfirmationToken, "please request a new confirmation email", errors.Gone, nil)
+	}
+	
+	err = s.repository.ConfirmAccount(account.ID, tokenHash)
+	if err != nil && errors.HasKind(err, errors.NotFound) {
+		return errors.WithKindCtx(ErrInvalidConfirmationToken, "", errors.NotFound, nil)
+	}
+	return err
+}
+
+// ResendConfirmation sends a new confirmation link to an unconfirmed account, the previous links stop working.
+// Unknown and already confirmed emails are not reported so the registered emails can not be discovered
+func (s service) ResendConfirmation(email string) error {
+	account, err := s.repository.GetAccountByEmail(email)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil
+		}
+		return err
+	}
+	if account.Confirmed || !account.Active || recentlySent(account.ConfirmationSentAt) {
+		return nil
+	}
+	
+	token, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate confirmation token")
+	}
+	err = s.repository.UpdateConfirmationToken(account.ID, hashToken(token), time.Now())
+	if err != nil {
+		return err
+	}
+	return s.sendConfirmationEmail(account.Email, token)
+}
+
+// ForgotPassword sends a single use password reset link to the account, unknown emails are not reported
+func (s service) ForgotPassword(email string) error {
+	account, err := s.repository.GetAccountByEmail(email)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil
+		}
+		return err
+	}
+	if !account.Active || recentlySent(account.PasswordResetSentAt) {
+		return nil
+	}
+	
+	token, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate password reset token")
+	}
+	// Only the hash of the token is stored, so a leaked database can not be used to take over the accounts
+	err = s.repository.UpdatePasswordResetToken(account.ID, hashToken(token), time.Now())
+	if err != nil {
+		return err
 	}
 	
-	var roles []constants.JWTRole
-	switch {
-	case account.IsSuperUser:
-		roles = []constants.JWTRole{constants.Admin, constants.Free}
-	default:
-		roles = []constants.JWTRole{constants.Free}
+	resetURL := s.Config.PasswordResetURL
+	if resetURL == "" {
+		resetURL = fmt.Sprintf("%s/reset_password", s.BasePath)
+	}
+	resetURL = fmt.Sprintf("%s?token=%s", resetURL, url.QueryEscape(token))
+	subject := "Ratatoskr Password Reset"
+	plainTextContent := fmt.Sprintf("A password reset has been requested for your %s account, Please visit this link to choose a new password: %s . The link expires in %s, ignore this email if you have not requested it", email, resetURL, s.Config.GetPasswordResetTTL())
+	htmlContent := fmt.Sprintf(`A password reset has been requested for your %[1]s account <br> Please visit this <a href="%[2]s">link</a> to choose a new password or copy this url and visit it using your browser <br> URL: %[2]s <br> The link expires in %[3]s, ignore this email if you have not requested it`, email, resetURL, s.Config.GetPasswordResetTTL())
+	return s.Mailer.SendEmail(account.Email, "", subject, plainTextContent, htmlContent)
+}
+
+// ResetPassword replaces the password of the account the reset token has been sent to, the token can only be used once.
+// Following the link proves the ownership of the email, so unconfirmed accounts are confirmed as well, and all of the
+// sessions of the account are logged out
+func (s service) ResetPassword(token string, password string) error {
+	tokenHash := hashToken(token)
+	account, err := s.repository.GetAccountByPasswordResetToken(tokenHash)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return errors.WithKindCtx(ErrInvalidResetToken, "", errors.BadRequest, nil)
+		}
+		return err
+	}
+	
+	if !account.PasswordResetSentAt.Valid || time.Since(account.PasswordResetSentAt.Time) > s.Config.GetPasswordResetTTL() {
+		return errors.WithKindCtx(ErrExpiredResetToken, "please request a new password reset email", errors.Gone, nil)
+	}
+	
+	hashedPass, err := utils.HashPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash the password")
+	}
+	err = s.repository.ResetPassword(account.ID, tokenHash, hashedPass)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return errors.WithKindCtx(ErrInvalidResetToken, "", errors.BadRequest, nil)
+		}
+		return err
 	}
 	
-	token, err := s.generateJWTToken(account, roles)
-	return account, token, err
+	// Whoever knew the old password should not stay logged in
+	return s.LogoutAll(account.ID)
 }
 
 func (s service) OAuthAuthenticate(provider string) (string, error) {
-	providers := s.Config.GetOAuthProviders()
-	providerConfig, ok := providers[provider]
+	p, ok := s.providers[provider]
 	if !ok {
-		return "", ErrInvalidOauthProvider
+		return "", errors.WithKindCtx(ErrInvalidOauthProvider, provider, errors.NotFound, nil)
 	}
 	
-	// Create State
+	// Create State, it is bound to the provider and can only be used once
 	b := make([]byte, 32)
-	rand.Read(b)
-	state := base64.StdEncoding.EncodeToString(b)
-	err := s.stateStore.SetState(state, DefaultStateValue)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate state")
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+	err := s.stateStore.SetState(state, provider)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to store state")
 	}
 	
-	u := providerConfig.AuthCodeURL(state)
-	return u, nil
+	return p.AuthCodeURL(state)
 }
 
-func (s service) OAuthCallBack(state, code, provider string) (*AccountModel, string, error) {
-	providers := s.Config.GetOAuthProviders()
-	providerConfig, ok := providers[provider]
+// OAuthCallBack signs the user in with the identity given by the provider. Identities are linked to the account
+// with the same email when the provider has verified the email, otherwise a new account is registered
+func (s service) OAuthCallBack(state, code, provider string) (*AccountModel, *TokenModel, error) {
+	p, ok := s.providers[provider]
 	if !ok {
-		return nil, "", ErrInvalidOauthProvider
-	}
-	
-	var OpenID struct {
-		ID           string
-		ProfilePhoto string
-		Email        string
-		FirstName    string
-		LastName     string
-		FullName     string
+		return nil, nil, errors.WithKindCtx(ErrInvalidOauthProvider, provider, errors.NotFound, nil)
 	}
 	
 	// Check State
-	state, err := s.stateStore.GetState(state)
-	if err != nil || state != DefaultStateValue {
-		return nil, "", errors.Wrap(err, "failed to validate the state")
+	if state == "" {
+		return nil, nil, errors.WithKindCtx(ErrInvalidOAuthState, "", errors.Unauthorized, nil)
+	}
+	value, err := s.stateStore.PopState(state)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to validate the state")
+	}
+	if value != provider {
+		return nil, nil, errors.WithKindCtx(ErrInvalidOAuthState, "", errors.Unauthorized, nil)
 	}
 	
-	token, err := providerConfig.Exchange(context.Background(), code)
+	identity, err := p.Identify(context.Background(), code)
 	if err != nil {
-		return nil, "", errors.WithKindCtx(err, "code exchange error", errors.Unauthorized, nil)
+		return nil, nil, err
 	}
 	
-	// TODO: Replace hard-code url with config : https://www.googleapis.com/oauth2/v3/userinfo
-	client := providerConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v3/userinfo")
+	account, err := s.oauthAccount(provider, identity)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "failed to call googleapis.com")
+		return nil, nil, err
+	}
+	if !account.Active {
+		return nil, nil, errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
 	}
 	
-	defer resp.Body.Close()
-	content, err := ioutil.ReadAll(resp.Body)
+	tokens, err := s.startLogin(account)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "failed to read googleapis.com response body")
+		return nil, nil, err
+	}
+	return account, tokens, nil
+}
+
+// oauthAccount finds the account of the identity, links it to the account with the same email or registers a new account
+func (s service) oauthAccount(provider string, identity *Identity) (*AccountModel, error) {
+	account, err := s.repository.GetAccountByOAuth(provider, identity.ID)
+	if err == nil {
+		return account, nil
 	}
-	var googleDTO GoogleResponse
-	if err = json.Unmarshal(content, &googleDTO); err != nil {
-		return nil, "", errors.Wrap(err, "failed to unmarshal googleapis.com response")
+	if !errors.HasKind(err, errors.NotFound) {
+		return nil, err
 	}
 	
-	OpenID.ID = googleDTO.ID
-	OpenID.FirstName = googleDTO.FirstName
-	OpenID.LastName = googleDTO.LastName
-	OpenID.Email = googleDTO.Email
-	OpenID.FullName = googleDTO.Name
-	OpenID.ProfilePhoto = googleDTO.Picture
+	if identity.Email == "" {
+		return nil, errors.WithKindCtx(ErrOAuthEmailRequired, "", errors.BadRequest, nil)
+	}
 	
-	user, err := s.repository.GetAccountByEmail(OpenID.Email)
-	if err != nil {
-		if errors.HasKind(err, errors.NotFound) { // Register User
-			// Generate Random Password
-			hashedPassword, _ := utils.HashPassword(utils.RandomString(15))
-			newUser := AccountModel{
-				Email:             OpenID.Email,
-				EncryptedPassword: hashedPassword,
-				OAuthProvider:     provider,
-				OAuthUID:          OpenID.ID,
-				Picture:           OpenID.ProfilePhoto,
-				CompanyName:       OpenID.FullName,
-				Confirmed:         true,
-				Active:            true,
-			}
-			
-			user, err := s.repository.CreateAccount(newUser)
+	account, err = s.repository.GetAccountByEmail(identity.Email)
+	if err != nil && !errors.HasKind(err, errors.NotFound) {
+		return nil, err
+	}
+	if account != nil {
+		// Unverified emails could be used to take over the accounts of others
+		if !identity.EmailVerified {
+			return nil, errors.WithKindCtx(ErrUnverifiedOAuthEmail, "", errors.Conflict, nil)
+		}
+		account.OAuthProvider = provider
+		account.OAuthUID = identity.ID
+		if account.Picture == "" {
+			account.Picture = identity.Picture
+		}
+		// The password of an unconfirmed account may have been chosen by someone else who registered the email first
+		if !account.Confirmed {
+			account.EncryptedPassword, err = randomPasswordHash()
 			if err != nil {
-				return nil, "", errors.Wrap(err, "failed to retrieve the registered user")
+				return nil, err
 			}
-			var roles []constants.JWTRole
-			switch {
-			case user.IsSuperUser:
-				roles = []constants.JWTRole{constants.Admin, constants.Free}
-			default:
-				roles = []constants.JWTRole{constants.Free}
-			}
-			token, err := s.generateJWTToken(user, roles)
-			return user, token, err
-		} else {
-			return nil, "", errors.Wrapf(err, "Cannot retrieve user with email: %s", OpenID.Email)
-		}
-	} else {
-		// Found User AppLogin the User
-		if !user.Active {
-			return nil, "", errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
+			account.Confirmed = true
 		}
-		var roles []constants.JWTRole
-		switch {
-		case user.IsSuperUser:
-			roles = []constants.JWTRole{constants.Admin, constants.Free}
-		default:
-			roles = []constants.JWTRole{constants.Free}
+		err = s.repository.LinkOAuthAccount(*account)
+		if err != nil {
+			return nil, err
 		}
-		token, err := s.generateJWTToken(user, roles)
-		return user, token, err
+		return account, nil
 	}
+	
+	// Register User with a random password, it can be replaced using the password reset
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	account, err = s.repository.CreateAccount(AccountModel{
+		Email:             identity.Email,
+		EncryptedPassword: hashedPassword,
+		OAuthProvider:     provider,
+		OAuthUID:          identity.ID,
+		Picture:           identity.Picture,
+		CompanyName:       identity.Name,
+		Confirmed:         identity.EmailVerified,
+		Active:            true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register the user")
+	}
+	return account, nil
 }
 
-// generateJWTToken creates new JWTToken using user object
-func (s service) generateJWTToken(user *AccountModel, Roles []constants.JWTRole) (string, error) {
+// generateJWTToken creates new short-lived JWTToken of the session using user object, impersonator is only
+// given for impersonation sessions
+func (s service) generateJWTToken(user *AccountModel, Roles []constants.JWTRole, sessionUUID string, impersonator *ImpersonatorClaims) (string, error) {
 	// Create JWT Token
 	roles := make([]string, 0)
 	for _, r := range Roles {
@@ -255,18 +423,58 @@ func (s service) generateJWTToken(user *AccountModel, Roles []constants.JWTRole)
 	claims := AppClaims{
 		StandardClaims: jwt.StandardClaims{
 			Audience:  s.Config.JWT.Audience,
-			ExpiresAt: time.Now().Add(time.Duration(24*s.Config.JWT.ExpireDays) * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(s.Config.JWT.GetAccessTTL()).Unix(),
 			Id:        uuid.NewV4().String(),
 			IssuedAt:  time.Now().Unix(),
 			Issuer:    s.Config.JWT.Issuer,
 			Subject:   user.UUID,
 		},
-		UserID:  user.ID,
-		Version: s.Config.JWT.Version,
-		Email:   user.Email,
-		Roles:   roles,
+		UserID:       user.ID,
+		SessionID:    sessionUUID,
+		Version:      s.Config.JWT.Version,
+		Email:        user.Email,
+		Roles:        roles,
+		Impersonator: impersonator,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, _ := token.SignedString([]byte(s.Config.JWT.Secret))
 	return signedToken, nil
 }
+
+func (s service) sendConfirmationEmail(email string, token string) error {
+	subject := "Ratatoskr Signup Confirmation"
+	confirmUrl := fmt.Sprintf("%s/v1/auth/verify/%s", s.BasePath, token)
+	plainTextContent := fmt.Sprintf("Thanks for verifying you %s account!, Please visit this link to verify your registration: %s", email, confirmUrl)
+	htmlContent := fmt.Sprintf(`Thanks for verifying you %[1]s account <br> Please visit this <a href="%[2]s">link</a> to verify your registration or copy this url and visit it using your browser <br> URL: %[2]s`, email, confirmUrl)
+	return s.Mailer.SendEmail(email, "", subject, plainTextContent, htmlContent)
+}
+
+// recentlySent reports whether an email has been sent within the resend interval
+func recentlySent(sentAt sql.NullTime) bool {
+	return sentAt.Valid && time.Since(sentAt.Time) < resendInterval
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func accountRoles(account *AccountModel) []constants.JWTRole {
+	role := constants.Free
+	if account.Plan == PlanPro {
+		role = constants.Pro
+	}
+	if account.IsSuperUser {
+		return []constants.JWTRole{constants.Admin, role}
+	}
+	return []constants.JWTRole{role}
+}
+
+// randomPasswordHash creates the password of accounts registered by OAuth, nobody knows the password
+func randomPasswordHash() (string, error) {
+	password, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate password")
+	}
+	return utils.HashPassword(password)
+}
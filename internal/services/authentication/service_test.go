@@ -0,0 +1,102 @@
+package authentication
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+)
+
+type confirmationRepository struct {
+	Repository
+	account   AccountModel
+	confirmed string
+}
+
+func (r *confirmationRepository) GetAccountByConfirmationToken(tokenHash string) (*AccountModel, error) {
+	if tokenHash != r.account.ConfirmationToken {
+		return nil, errors.WithKindCtx(errors.New("record not found"), "", errors.NotFound, nil)
+	}
+	account := r.account
+	return &account, nil
+}
+
+func (r *confirmationRepository) ConfirmAccount(ID uint, tokenHash string) error {
+	r.confirmed = tokenHash
+	return nil
+}
+
+func TestVerifyLooksUpConfirmationTokenHash(t *testing.T) {
+	repo := &confirmationRepository{account: AccountModel{
+		ID:                 1,
+		ConfirmationToken:  hashToken("token"),
+		ConfirmationSentAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}}
+	svc := service{repository: repo}
+
+	if err := svc.Verify("token"); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if repo.confirmed != hashToken("token") {
+		t.Fatalf("account confirmed with %q but expected the token hash", repo.confirmed)
+	}
+	// The stored hash itself is not a valid token
+	if err := svc.Verify(hashToken("token")); !errors.HasKind(err, errors.NotFound) {
+		t.Fatalf("we got %v but expected the stored hash to be rejected", err)
+	}
+}
+
+type impersonationRepository struct {
+	Repository
+	accounts map[uint]*AccountModel
+}
+
+func (r *impersonationRepository) GetAccountByID(ID uint) (*AccountModel, error) {
+	return r.accounts[ID], nil
+}
+
+func (r *impersonationRepository) GetAccountByUUID(UUID string) (*AccountModel, error) {
+	for _, account := range r.accounts {
+		if account.UUID == UUID {
+			return account, nil
+		}
+	}
+	return nil, errors.WithKindCtx(errors.New("record not found"), "", errors.NotFound, nil)
+}
+
+func (r *impersonationRepository) CreateSession(model SessionModel) (*SessionModel, error) {
+	model.UUID = "session"
+	return &model, nil
+}
+
+func (r *impersonationRepository) CreateImpersonation(model ImpersonationModel) (*ImpersonationModel, error) {
+	return &model, nil
+}
+
+func TestImpersonationTokenNamesTheAdmin(t *testing.T) {
+	repo := &impersonationRepository{accounts: map[uint]*AccountModel{
+		1: {ID: 1, UUID: "admin", Email: "admin@example.com", IsSuperUser: true, Active: true},
+		2: {ID: 2, UUID: "customer", Email: "customer@example.com", Active: true},
+	}}
+	svc := service{repository: repo, Config: Config{JWT: JWTConfig{Secret: "secret"}}}
+
+	tokens, err := svc.Impersonate(1, "customer", "support ticket")
+	if err != nil {
+		t.Fatalf("impersonate failed: %v", err)
+	}
+	claims := &AppClaims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to parse the access token: %v", err)
+	}
+	if claims.UserID != 2 || claims.SessionID != "session" {
+		t.Fatalf("we got user %d and session %q but expected the session of the customer", claims.UserID, claims.SessionID)
+	}
+	if claims.Impersonator == nil || claims.Impersonator.UserID != 1 || claims.Impersonator.Email != "admin@example.com" {
+		t.Fatalf("we got impersonator %+v but expected the admin", claims.Impersonator)
+	}
+}
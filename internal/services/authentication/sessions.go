@@ -0,0 +1,132 @@
+package authentication
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"time"
+)
+
+// Refresh replaces the refresh token of the session with a new one and issues a new access token. Refresh tokens can
+// only be used once, using an already replaced token means it has leaked, so the whole session is logged out
+func (s service) Refresh(refreshToken string) (*TokenModel, error) {
+	if refreshToken == "" {
+		return nil, errors.WithKindCtx(ErrInvalidRefreshToken, "", errors.Unauthorized, nil)
+	}
+	tokenHash := hashToken(refreshToken)
+	session, err := s.repository.GetSessionByTokenHash(tokenHash)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, errors.WithKindCtx(ErrInvalidRefreshToken, "", errors.Unauthorized, nil)
+		}
+		return nil, err
+	}
+	if session.TokenHash != tokenHash {
+		if err = s.Logout(session.AccountID, session.UUID); err != nil {
+			return nil, err
+		}
+		return nil, errors.WithKindCtx(ErrReusedRefreshToken, "", errors.Unauthorized, nil)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, errors.WithKindCtx(ErrInvalidRefreshToken, "", errors.Unauthorized, nil)
+	}
+
+	account, err := s.repository.GetAccountByID(session.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !account.Active {
+		return nil, errors.WithKindCtx(ErrAccountIsNotActive, "", errors.Forbidden, nil)
+	}
+
+	newToken, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate refresh token")
+	}
+	err = s.repository.RotateSession(session.ID, tokenHash, hashToken(newToken))
+	if err != nil {
+		// Another request has refreshed the session with the same token
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, errors.WithKindCtx(ErrInvalidRefreshToken, "", errors.Unauthorized, nil)
+		}
+		return nil, err
+	}
+	return s.sessionTokens(account, session.UUID, newToken, nil)
+}
+
+// Logout removes the session and revokes its access tokens
+func (s service) Logout(accountID uint, sessionUUID string) error {
+	if sessionUUID == "" {
+		return errors.WithKindCtx(ErrRevokedToken, "", errors.Unauthorized, nil)
+	}
+	err := s.repository.DeleteSession(accountID, sessionUUID)
+	if err != nil && !errors.HasKind(err, errors.NotFound) {
+		return err
+	}
+	err = s.sessions.RevokeSessions([]string{sessionUUID}, s.Config.JWT.GetAccessTTL())
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to revoke the session", errors.InternalServerError, nil)
+	}
+	return nil
+}
+
+// LogoutAll removes all of the sessions of the account and revokes their access tokens
+func (s service) LogoutAll(accountID uint) error {
+	UUIDs, err := s.repository.DeleteAccountSessions(accountID)
+	if err != nil {
+		return err
+	}
+	err = s.sessions.RevokeSessions(UUIDs, s.Config.JWT.GetAccessTTL())
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to revoke the sessions", errors.InternalServerError, nil)
+	}
+	return nil
+}
+
+// CheckToken checks the access token has not been logged out. Tokens without a session have been issued before
+// sessions existed and can not be logged out, so they are not accepted either
+func (s service) CheckToken(claims *AppClaims) error {
+	if claims == nil || claims.SessionID == "" {
+		return errors.WithKindCtx(ErrRevokedToken, "", errors.Unauthorized, nil)
+	}
+	revoked, err := s.sessions.IsSessionRevoked(claims.SessionID)
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to check the token revocation", errors.ServiceUnavailable, nil)
+	}
+	if revoked {
+		return errors.WithKindCtx(ErrRevokedToken, "", errors.Unauthorized, nil)
+	}
+	return nil
+}
+
+// createSession starts a new session of the account and issues its tokens
+func (s service) createSession(account *AccountModel) (*TokenModel, error) {
+	err := s.repository.DeleteExpiredSessions(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate refresh token")
+	}
+	session, err := s.repository.CreateSession(SessionModel{
+		AccountID: account.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.Config.JWT.GetRefreshTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.sessionTokens(account, session.UUID, refreshToken, nil)
+}
+
+func (s service) sessionTokens(account *AccountModel, sessionUUID string, refreshToken string, impersonator *ImpersonatorClaims) (*TokenModel, error) {
+	accessToken, err := s.generateJWTToken(account, accountRoles(account), sessionUUID, impersonator)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenModel{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.Config.JWT.GetAccessTTL().Seconds()),
+	}, nil
+}
@@ -29,6 +29,66 @@ type DeviceModel struct {
 	Tags               map[string]string
 	BadgeCount         *int
 	AmountSpent        *float32
+	LastActiveAt       time.Time
+	TotalUsageTime     int64
+}
+
+// SessionModel holds the device attributes which are refreshed on each new session
+type SessionModel struct {
+	AppVersion *string
+	Language   *string
+}
+
+// PurchaseModel is a single in-app purchase of a device, Amount is in the purchase Currency
+// while AmountSpent is the same amount converted to the reporting currency
+type PurchaseModel struct {
+	ID            uint
+	DeviceID      uint
+	ApplicationID uint
+	SKU           string
+	Amount        float64
+	Currency      string
+	AmountSpent   float64
+	CreatedAt     time.Time
+}
+
+// UserTagsModel is a single entry of a batch tags update, empty tag values remove the tag
+type UserTagsModel struct {
+	ExternalUserID string            `json:"external_user_id"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type UserTagsStatus string
+
+const (
+	UserTagsUpdated  UserTagsStatus = "updated"
+	UserTagsNotFound UserTagsStatus = "not_found"
+	UserTagsInvalid  UserTagsStatus = "invalid"
+)
+
+// UserTagsResultModel is the outcome of a single entry of a batch tags update
+type UserTagsResultModel struct {
+	ExternalUserID string         `json:"external_user_id"`
+	Status         UserTagsStatus `json:"status"`
+	Devices        int            `json:"devices"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// DeviceSelectorModel selects devices either by UUID, by Identifier and ADID or by the external user ids of an application
+type DeviceSelectorModel struct {
+	ApplicationID   uint
+	UUID            string
+	Identifier      string
+	ADID            string
+	ExternalUserIDs []string
+}
+
+// DeviceTagKeysModel holds the keys of the tags a device currently has
+type DeviceTagKeysModel struct {
+	DeviceID       uint
+	ApplicationID  uint
+	ExternalUserID string
+	Keys           []string
 }
 
 type DeviceApplicationModel struct {
@@ -38,3 +98,23 @@ type DeviceApplicationModel struct {
 	IdentityVerification bool
 	AccountID            uint `gorm:"index"`
 }
+
+type DeviceEventType string
+
+const (
+	DeviceRegistered   DeviceEventType = "device_registered"
+	DeviceTagsChanged  DeviceEventType = "device_tags_changed"
+	DeviceUnsubscribed DeviceEventType = "device_unsubscribed"
+)
+
+// NotificationTypesUnsubscribed is reported by the SDKs as the notification types of devices whose users have
+// opted out of notifications
+const NotificationTypesUnsubscribed = -2
+
+// DeviceEventModel describes a change on a device which is delivered to the service listeners
+type DeviceEventModel struct {
+	Type          DeviceEventType
+	DeviceID      uint
+	ApplicationID uint
+	Tags          map[string]string
+}
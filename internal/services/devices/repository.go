@@ -1,10 +1,46 @@
 package devices
 
 type Repository interface {
-	UpsertDevice(model DeviceModel) (*DeviceModel, error)
+	UpsertDevice(model DeviceModel) (*DeviceModel, bool, error)
+	// DeviceExists reports whether the device of the identifier and advertising id has already been registered
+	DeviceExists(identifier string, ADID string) (bool, error)
 	UpdatePartial(model DeviceModel) (*DeviceModel, error)
 	GetDevice(uuid string, applicationID uint) (*DeviceModel, error)
 	GetDevices(applicationID uint, lastID uint, limit int) ([]*DeviceModel, error)
 	GetApplicationByUUID(uuid string) (*DeviceApplicationModel, error)
-	UpdateDeviceTagsByUser(applicationID uint, externalUserID string, Tags map[string]string) error
+	GetDeviceApplication(uuid string) (*DeviceApplicationModel, error)
+	UpdateDeviceTagsByUser(applicationID uint, externalUserID string, Tags map[string]string) ([]uint, error)
+	// UpdateDeviceTagsByUsers applies the tags of all entries at once and returns the updated device ids per external user id
+	UpdateDeviceTagsByUsers(applicationID uint, items []UserTagsModel) (map[string][]uint, error)
+	IncrementSession(uuid string, applicationID uint, model SessionModel) error
+	IncrementUsageTime(uuid string, applicationID uint, seconds int) error
+	CreatePurchase(uuid string, model PurchaseModel) error
+	GetDeviceTagKeys(selector DeviceSelectorModel) ([]DeviceTagKeysModel, error)
+}
+
+// Converter converts purchase amounts to the reporting currency
+type Converter interface {
+	Convert(amount float64, currency string) (float64, error)
+}
+
+// TagValidator checks the tags written to a device against the tag limits of the application,
+// existing are the keys of the tags the device already has
+type TagValidator interface {
+	ValidateTags(applicationID uint, values map[string]string, existing []string) error
+}
+
+// IdentityVerifier checks the external user id hash of user-scoped requests when the application has identity
+// verification enabled, operation names the request in the logged failures
+type IdentityVerifier interface {
+	Verify(app DeviceApplicationModel, externalUserID string, hash string, operation string) error
+}
+
+// Quota checks the limits of the plan of the application before a new device is registered to it
+type Quota interface {
+	CheckDevices(applicationID uint) error
+}
+
+// Listener gets notified about device lifecycle events (registration, tag changes, ...)
+type Listener interface {
+	OnDeviceEvent(event DeviceEventModel) error
 }
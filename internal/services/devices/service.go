@@ -1,29 +1,50 @@
 package devices
 
 import (
+	"fmt"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"strings"
+)
+
+const (
+	MaxUserTagsBatchSize = 10000
+	maxTagSize           = 255
 )
 
 var (
-	ErrInvalidHash = errors.New("invalid external user id hash")
+	ErrBatchTooLarge = errors.New("too many entries in a single batch")
 )
 
 type Service interface {
 	Upsert(model DeviceModel, AppUUID string) (*DeviceModel, error)
 	Update(model DeviceModel) (*DeviceModel, error)
-	UpdateUserTags(AppUUID string, externalUserID string, tags map[string]string) error
+	UpdateUserTags(AppUUID string, externalUserID string, externalUserIDHash string, tags map[string]string) error
+	UpdateUsersTags(AppUUID string, items []UserTagsModel) ([]UserTagsResultModel, error)
 	Get(UUID string, AppUUID string) (*DeviceModel, error)
 	GetList(AppUUID string, paging utils.MorePaging) ([]*DeviceModel, error)
+	TrackSession(UUID string, AppUUID string, model SessionModel) error
+	TrackFocus(UUID string, AppUUID string, activeTime int) error
+	TrackPurchase(UUID string, AppUUID string, model PurchaseModel) error
 }
 
 type service struct {
 	repository Repository
+	converter  Converter
+	validator  TagValidator
+	verifier   IdentityVerifier
+	quota      Quota
+	listeners  []Listener
 }
 
-func CreateService(r Repository) Service {
+func CreateService(r Repository, c Converter, v TagValidator, i IdentityVerifier, q Quota, listeners ...Listener) Service {
 	return &service{
 		repository: r,
+		converter:  c,
+		validator:  v,
+		verifier:   i,
+		quota:      q,
+		listeners:  listeners,
 	}
 }
 
@@ -35,9 +56,26 @@ func (s service) Upsert(model DeviceModel, AppUUID string) (*DeviceModel, error)
 	}
 
 	// Check if Identity Check is enabled
-	if app.IdentityVerification && model.ExternalUserID != nil {
-		if !utils.CheckHMACHash(*model.ExternalUserID, *model.ExternalUserIDHash, app.AuthKey) {
-			return nil, errors.WithKindCtx(ErrInvalidHash, "", errors.Unauthorized, nil)
+	err = s.verifier.Verify(*app, stringValue(model.ExternalUserID), stringValue(model.ExternalUserIDHash), "register")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(model.Tags) > 0 {
+		err = s.validateTags(app.ID, model.Tags, DeviceSelectorModel{Identifier: *model.Identifier, ADID: *model.ADID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only new devices count against the devices limit, registered ones can always be updated
+	exists, err := s.repository.DeviceExists(*model.Identifier, *model.ADID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = s.quota.CheckDevices(app.ID); err != nil {
+			return nil, err
 		}
 	}
 
@@ -45,8 +83,24 @@ func (s service) Upsert(model DeviceModel, AppUUID string) (*DeviceModel, error)
 	model.ApplicationID = &app.ID
 
 	// Add device record
-	res, err := s.repository.UpsertDevice(model)
-	return res, err
+	res, created, err := s.repository.UpsertDevice(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		err = s.notify(DeviceEventModel{Type: DeviceRegistered, DeviceID: res.ID, ApplicationID: app.ID, Tags: model.Tags})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(model.Tags) > 0 {
+		err = s.notify(DeviceEventModel{Type: DeviceTagsChanged, DeviceID: res.ID, ApplicationID: app.ID, Tags: model.Tags})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
 func (s service) Get(UUID string, AppUUID string) (*DeviceModel, error) {
@@ -66,14 +120,280 @@ func (s service) GetList(AppUUID string, paging utils.MorePaging) ([]*DeviceMode
 }
 
 func (s service) Update(model DeviceModel) (*DeviceModel, error) {
+	// Linking the device to an external user needs the proof of the user identity
+	if stringValue(model.ExternalUserID) != "" && model.UUID != nil {
+		app, err := s.repository.GetDeviceApplication(*model.UUID)
+		if err != nil {
+			return nil, err
+		}
+		err = s.verifier.Verify(*app, *model.ExternalUserID, stringValue(model.ExternalUserIDHash), "update")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(model.Tags) > 0 && model.UUID != nil {
+		existing, err := s.repository.GetDeviceTagKeys(DeviceSelectorModel{UUID: *model.UUID})
+		if err != nil {
+			return nil, err
+		}
+		// Unknown devices are reported by the update itself
+		for _, item := range existing {
+			if err = s.validator.ValidateTags(item.ApplicationID, model.Tags, item.Keys); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// SDKs keep reporting the notification types, the unsubscription is only announced when the device opts out
+	unsubscribed := false
+	if intValue(model.NotificationTypes) == NotificationTypesUnsubscribed && model.UUID != nil {
+		app, err := s.repository.GetDeviceApplication(*model.UUID)
+		if err != nil {
+			return nil, err
+		}
+		current, err := s.repository.GetDevice(*model.UUID, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		unsubscribed = intValue(current.NotificationTypes) != NotificationTypesUnsubscribed
+	}
+
 	res, err := s.repository.UpdatePartial(model)
-	return res, err
+	if err != nil {
+		return nil, err
+	}
+
+	if len(model.Tags) > 0 {
+		err = s.notify(DeviceEventModel{Type: DeviceTagsChanged, DeviceID: res.ID, ApplicationID: *res.ApplicationID, Tags: model.Tags})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if unsubscribed {
+		err = s.notify(DeviceEventModel{Type: DeviceUnsubscribed, DeviceID: res.ID, ApplicationID: *res.ApplicationID})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
-func (s service) UpdateUserTags(AppUUID string, externalUserID string, tags map[string]string) error {
+func (s service) UpdateUserTags(AppUUID string, externalUserID string, externalUserIDHash string, tags map[string]string) error {
 	app, err := s.repository.GetApplicationByUUID(AppUUID)
 	if err != nil {
-		return  err
+		return err
 	}
-	return s.repository.UpdateDeviceTagsByUser(app.ID, externalUserID, tags)
-}
\ No newline at end of file
+	err = s.verifier.Verify(*app, externalUserID, externalUserIDHash, "user_tags")
+	if err != nil {
+		return err
+	}
+	err = s.validateTags(app.ID, tags, DeviceSelectorModel{ApplicationID: app.ID, ExternalUserIDs: []string{externalUserID}})
+	if err != nil {
+		return err
+	}
+	deviceIDs, err := s.repository.UpdateDeviceTagsByUser(app.ID, externalUserID, tags)
+	if err != nil {
+		return err
+	}
+
+	for _, deviceID := range deviceIDs {
+		err = s.notify(DeviceEventModel{Type: DeviceTagsChanged, DeviceID: deviceID, ApplicationID: app.ID, Tags: tags})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateUsersTags updates the tags of the devices of many external users at once, the result has an entry
+// for every given entry in the same order
+func (s service) UpdateUsersTags(AppUUID string, items []UserTagsModel) ([]UserTagsResultModel, error) {
+	if len(items) > MaxUserTagsBatchSize {
+		return nil, errors.WithKindCtx(ErrBatchTooLarge, "", errors.RequestEntityTooLarge, map[string]interface{}{"max": MaxUserTagsBatchSize})
+	}
+
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]UserTagsResultModel, len(items))
+	// Entries of the same user are merged, later entries win on conflicting keys
+	merged := make(map[string]map[string]string)
+	order := make([]string, 0, len(items))
+	for i, item := range items {
+		results[i] = UserTagsResultModel{ExternalUserID: item.ExternalUserID}
+		if msg := validateUserTags(item); msg != "" {
+			results[i].Status = UserTagsInvalid
+			results[i].Error = msg
+			continue
+		}
+		tags, ok := merged[item.ExternalUserID]
+		if !ok {
+			tags = make(map[string]string, len(item.Tags))
+			merged[item.ExternalUserID] = tags
+			order = append(order, item.ExternalUserID)
+		}
+		for k, v := range item.Tags {
+			tags[k] = v
+		}
+	}
+
+	// Tag limits are checked on the merged tags of each user against every device of the user
+	existing := make(map[string][]DeviceTagKeysModel)
+	if len(order) > 0 {
+		items, err := s.repository.GetDeviceTagKeys(DeviceSelectorModel{ApplicationID: app.ID, ExternalUserIDs: order})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			existing[item.ExternalUserID] = append(existing[item.ExternalUserID], item)
+		}
+	}
+	rejected := make(map[string]string)
+	entries := make([]UserTagsModel, 0, len(order))
+	for _, externalUserID := range order {
+		if err = s.checkTags(app.ID, merged[externalUserID], existing[externalUserID]); err != nil {
+			rejected[externalUserID] = err.Error()
+			continue
+		}
+		entries = append(entries, UserTagsModel{ExternalUserID: externalUserID, Tags: merged[externalUserID]})
+	}
+
+	var deviceIDs map[string][]uint
+	if len(entries) > 0 {
+		deviceIDs, err = s.repository.UpdateDeviceTagsByUsers(app.ID, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range results {
+		if results[i].Status == UserTagsInvalid {
+			continue
+		}
+		if msg, ok := rejected[results[i].ExternalUserID]; ok {
+			results[i].Status = UserTagsInvalid
+			results[i].Error = msg
+			continue
+		}
+		ids := deviceIDs[results[i].ExternalUserID]
+		results[i].Devices = len(ids)
+		results[i].Status = UserTagsUpdated
+		if len(ids) == 0 {
+			results[i].Status = UserTagsNotFound
+		}
+	}
+
+	for _, entry := range entries {
+		for _, deviceID := range deviceIDs[entry.ExternalUserID] {
+			err = s.notify(DeviceEventModel{Type: DeviceTagsChanged, DeviceID: deviceID, ApplicationID: app.ID, Tags: entry.Tags})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// TrackSession counts a new session of the device and marks it as active
+func (s service) TrackSession(UUID string, AppUUID string, model SessionModel) error {
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return err
+	}
+	return s.repository.IncrementSession(UUID, app.ID, model)
+}
+
+// TrackFocus accumulates the time in seconds the application has been used on the device
+func (s service) TrackFocus(UUID string, AppUUID string, activeTime int) error {
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return err
+	}
+	return s.repository.IncrementUsageTime(UUID, app.ID, activeTime)
+}
+
+// TrackPurchase records the purchase of the device and adds its amount in reporting currency to the device total
+func (s service) TrackPurchase(UUID string, AppUUID string, model PurchaseModel) error {
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return err
+	}
+
+	model.Currency = strings.ToUpper(model.Currency)
+	model.AmountSpent, err = s.converter.Convert(model.Amount, model.Currency)
+	if err != nil {
+		return err
+	}
+
+	model.ApplicationID = app.ID
+	return s.repository.CreatePurchase(UUID, model)
+}
+
+// validateUserTags returns the reason of rejecting the entry of a batch tags update or an empty string
+func validateUserTags(item UserTagsModel) string {
+	if item.ExternalUserID == "" {
+		return "external_user_id is required"
+	}
+	if len(item.Tags) == 0 {
+		return "tags are required"
+	}
+	for k, v := range item.Tags {
+		if k == "" || len(k) > maxTagSize {
+			return fmt.Sprintf("tag key %q is invalid", k)
+		}
+		if len(v) > maxTagSize {
+			return fmt.Sprintf("value of tag %q is too long", k)
+		}
+	}
+	return ""
+}
+
+// validateTags checks the tags against the tag limits of the application for every device matching the selector
+func (s service) validateTags(applicationID uint, tags map[string]string, selector DeviceSelectorModel) error {
+	existing, err := s.repository.GetDeviceTagKeys(selector)
+	if err != nil {
+		return err
+	}
+	return s.checkTags(applicationID, tags, existing)
+}
+
+// checkTags checks the tags against the tag limits of the application for each of the given devices,
+// without any device only the keys and values are checked
+func (s service) checkTags(applicationID uint, tags map[string]string, items []DeviceTagKeysModel) error {
+	if len(items) == 0 {
+		return s.validator.ValidateTags(applicationID, tags, nil)
+	}
+	for _, item := range items {
+		if err := s.validator.ValidateTags(applicationID, tags, item.Keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func intValue(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// notify delivers the event to all registered listeners
+func (s service) notify(event DeviceEventModel) error {
+	for _, listener := range s.listeners {
+		if err := listener.OnDeviceEvent(event); err != nil {
+			return errors.Wrapf(err, "failed to deliver %s event of device %d", event.Type, event.DeviceID)
+		}
+	}
+	return nil
+}
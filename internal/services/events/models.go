@@ -0,0 +1,21 @@
+package events
+
+import "time"
+
+// NotificationOpened is the name of the event tracked by the SDKs when a notification is opened, its properties
+// identify the notification
+const NotificationOpened = "notification_opened"
+
+type EventModel struct {
+	ID             uint
+	ApplicationID  uint
+	DeviceID       uint
+	DeviceUUID     string
+	ExternalUserID string
+	// ExternalUserIDHash proves the external user id of events without device when identity verification is enabled
+	ExternalUserIDHash string
+	Name               string
+	Properties         map[string]interface{}
+	OccurredAt         time.Time
+	CreatedAt          time.Time
+}
@@ -0,0 +1,15 @@
+package events
+
+import "github.com/subzerobo/ratatoskr/internal/services/devices"
+
+type Repository interface {
+	GetApplicationByUUID(uuid string) (*devices.DeviceApplicationModel, error)
+	GetDevice(uuid string, applicationID uint) (*devices.DeviceModel, error)
+	GetDeviceIDsByExternalUserID(applicationID uint, externalUserID string) ([]uint, error)
+	CreateEvents(models []EventModel) error
+}
+
+// Listener gets notified about every tracked event once per device which performed it
+type Listener interface {
+	OnEvent(event EventModel) error
+}
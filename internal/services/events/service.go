@@ -0,0 +1,117 @@
+package events
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"time"
+)
+
+const (
+	MaxBatchSize     = 1000
+	MaxEventNameSize = 128
+	// maxEventAge is the oldest event accepted by the service, older events would hit dropped partitions
+	maxEventAge = 365 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidEvent  = errors.New("event is invalid")
+	ErrBatchTooLarge = errors.New("too many events in a single batch")
+)
+
+type Service interface {
+	Track(AppUUID string, items []EventModel) (int, error)
+}
+
+type service struct {
+	repository Repository
+	verifier   devices.IdentityVerifier
+	listeners  []Listener
+}
+
+func CreateService(r Repository, i devices.IdentityVerifier, listeners ...Listener) Service {
+	return &service{
+		repository: r,
+		verifier:   i,
+		listeners:  listeners,
+	}
+}
+
+// Track stores the events of an application and notifies the listeners for each device which performed them
+func (s service) Track(AppUUID string, items []EventModel) (int, error) {
+	if len(items) > MaxBatchSize {
+		return 0, errors.WithKindCtx(ErrBatchTooLarge, "", errors.RequestEntityTooLarge, map[string]interface{}{"max": MaxBatchSize})
+	}
+
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	deviceIDs := make([][]uint, len(items))
+	for i := range items {
+		item := &items[i]
+		if item.Name == "" || len(item.Name) > MaxEventNameSize {
+			return 0, errors.WithKindCtx(ErrInvalidEvent, "event name is required and limited to 128 characters", errors.UnprocessableEntity, map[string]interface{}{"index": i})
+		}
+		if item.OccurredAt.IsZero() || item.OccurredAt.After(now) {
+			item.OccurredAt = now
+		}
+		if now.Sub(item.OccurredAt) > maxEventAge {
+			return 0, errors.WithKindCtx(ErrInvalidEvent, "event is too old", errors.UnprocessableEntity, map[string]interface{}{"index": i})
+		}
+		item.ApplicationID = app.ID
+
+		switch {
+		case item.DeviceUUID != "":
+			device, err := s.repository.GetDevice(item.DeviceUUID, app.ID)
+			if err != nil {
+				return 0, err
+			}
+			item.DeviceID = device.ID
+			if item.ExternalUserID == "" {
+				item.ExternalUserID = *device.ExternalUserID
+			} else if item.ExternalUserID != *device.ExternalUserID {
+				if err = s.verifier.Verify(*app, item.ExternalUserID, item.ExternalUserIDHash, "track_event"); err != nil {
+					return 0, err
+				}
+			}
+			deviceIDs[i] = []uint{device.ID}
+		case item.ExternalUserID != "":
+			// Events of external users are attributed to all of their devices, so the user has to prove its identity
+			if err = s.verifier.Verify(*app, item.ExternalUserID, item.ExternalUserIDHash, "track_event"); err != nil {
+				return 0, err
+			}
+			deviceIDs[i], err = s.repository.GetDeviceIDsByExternalUserID(app.ID, item.ExternalUserID)
+			if err != nil {
+				return 0, err
+			}
+		default:
+			return 0, errors.WithKindCtx(ErrInvalidEvent, "either device uuid or external user id is required", errors.UnprocessableEntity, map[string]interface{}{"index": i})
+		}
+	}
+
+	if err = s.repository.CreateEvents(items); err != nil {
+		return 0, err
+	}
+
+	for i, item := range items {
+		for _, deviceID := range deviceIDs[i] {
+			item.DeviceID = deviceID
+			if err = s.notify(item); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(items), nil
+}
+
+// notify delivers the event to all registered listeners
+func (s service) notify(event EventModel) error {
+	for _, listener := range s.listeners {
+		if err := listener.OnEvent(event); err != nil {
+			return errors.Wrapf(err, "failed to deliver %s event of device %d", event.Name, event.DeviceID)
+		}
+	}
+	return nil
+}
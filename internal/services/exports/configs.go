@@ -0,0 +1,27 @@
+package exports
+
+import "time"
+
+// Config holds the settings of device exports, LinkTTL and Retention are in seconds. SigningKey signs the download
+// links and is required
+type Config struct {
+	SigningKey string `yaml:"SIGNING_KEY" envconfig:"EXPORTS_SIGNING_KEY"`
+	LinkTTL    int    `yaml:"LINK_TTL" envconfig:"EXPORTS_LINK_TTL"`
+	Retention  int    `yaml:"RETENTION" envconfig:"EXPORTS_RETENTION"`
+}
+
+// GetLinkTTL returns how long a generated download link is valid
+func (c Config) GetLinkTTL() time.Duration {
+	if c.LinkTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.LinkTTL) * time.Second
+}
+
+// GetRetention returns how long the exported file is kept after the export is finished
+func (c Config) GetRetention() time.Duration {
+	if c.Retention <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.Retention) * time.Second
+}
@@ -0,0 +1,80 @@
+package exports
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusExpired   Status = "expired"
+)
+
+// ExportModel is an asynchronous export of the devices of an application, Filters is a snapshot
+// of the segment filters taken when the export has been requested
+type ExportModel struct {
+	ID            uint                   `json:"-"`
+	UUID          string                 `json:"uuid"`
+	ApplicationID uint                   `json:"-"`
+	Format        Format                 `json:"format"`
+	SegmentUUID   string                 `json:"segment_uuid,omitempty"`
+	Filters       []segments.FilterModel `json:"-"`
+	Status        Status                 `json:"status"`
+	Rows          int                    `json:"rows"`
+	Size          int64                  `json:"size"`
+	BlobKey       string                 `json:"-"`
+	Error         string                 `json:"error,omitempty"`
+	DownloadURL   string                 `json:"download_url,omitempty"`
+	ExpiresAt     *time.Time             `json:"expires_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	FinishedAt    *time.Time             `json:"finished_at,omitempty"`
+}
+
+// DeviceRowModel is a single exported device, CSV files carry the same fields as columns
+// with tags encoded as a JSON object
+type DeviceRowModel struct {
+	ID                uint              `json:"-"`
+	UUID              string            `json:"uuid"`
+	Identifier        string            `json:"identifier"`
+	DeviceType        string            `json:"device_type"`
+	ADID              string            `json:"adid"`
+	Language          string            `json:"language"`
+	Timezone          int               `json:"timezone"`
+	AppVersion        string            `json:"app_version"`
+	DeviceVendor      string            `json:"device_vendor"`
+	DeviceModel       string            `json:"device_model"`
+	DeviceOS          string            `json:"device_os"`
+	DeviceOSVersion   string            `json:"device_os_version"`
+	SDK               string            `json:"sdk"`
+	SessionCount      int               `json:"session_count"`
+	NotificationTypes int               `json:"notification_types"`
+	Country           string            `json:"country"`
+	ExternalUserID    string            `json:"external_user_id"`
+	AmountSpent       float32           `json:"amount_spent"`
+	TotalUsageTime    int64             `json:"total_usage_time"`
+	Tags              map[string]string `json:"tags"`
+	CreatedAt         time.Time         `json:"created_at"`
+	LastActiveAt      time.Time         `json:"last_active_at"`
+}
+
+// ResultModel is the outcome of a processed export
+type ResultModel struct {
+	Status    Status
+	Rows      int
+	Size      int64
+	Error     string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,24 @@
+package exports
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"time"
+)
+
+type Repository interface {
+	applications.Authorizer
+	GetSegment(applicationID uint, UUID string) (*segments.SegmentModel, error)
+
+	CreateExport(model ExportModel) (*ExportModel, error)
+	GetExports(applicationID uint) ([]*ExportModel, error)
+	GetExport(applicationID uint, UUID string) (*ExportModel, error)
+	GetExportByUUID(UUID string) (*ExportModel, error)
+	ClaimDueExport(lease time.Duration) (*ExportModel, error)
+	FinishExport(ID uint, result ResultModel) error
+	GetExpiredExports(limit int) ([]*ExportModel, error)
+	ExpireExport(ID uint) error
+
+	// GetExportDevices returns the next page of devices matching the filters with an id greater than lastID
+	GetExportDevices(applicationID uint, filters []segments.FilterModel, lastID uint, limit int) ([]*DeviceRowModel, error)
+}
@@ -0,0 +1,255 @@
+package exports
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/blob"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"io"
+	"net/url"
+	"time"
+)
+
+const (
+	// exportLease is the time a claimed export is hidden from other workers while it is being written
+	exportLease = 30 * time.Minute
+)
+
+var (
+	ErrInvalidFormat     = errors.New("export format is invalid")
+	ErrInvalidSignature  = errors.New("download link is invalid")
+	ErrExpiredLink       = errors.New("download link has been expired")
+	ErrExportUnavailable = errors.New("export file is not available")
+	ErrMissingSigningKey = errors.New("exports signing key is not configured")
+)
+
+type Service interface {
+	Create(accountID uint, aUUID string, format Format, segmentUUID string) (*ExportModel, error)
+	List(accountID uint, aUUID string) ([]*ExportModel, error)
+	Details(accountID uint, aUUID string, eUUID string) (*ExportModel, error)
+	Download(eUUID string, expires int64, signature string) (*ExportModel, io.ReadCloser, error)
+
+	Process(batchSize int) (int, error)
+	Cleanup(limit int) (int, error)
+}
+
+type service struct {
+	repository Repository
+	store      blob.Store
+	config     Config
+	basePath   string
+}
+
+// CreateService fails without a signing key, download links have to stay valid across restarts and replicas
+func CreateService(r Repository, s blob.Store, config Config, basePath string) (Service, error) {
+	if config.SigningKey == "" {
+		return nil, ErrMissingSigningKey
+	}
+	return &service{
+		repository: r,
+		store:      s,
+		config:     config,
+		basePath:   basePath,
+	}, nil
+}
+
+func (s service) Create(accountID uint, aUUID string, format Format, segmentUUID string) (*ExportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionExportDevices)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = FormatCSV
+	}
+	if format != FormatCSV && format != FormatNDJSON {
+		return nil, errors.WithKindCtx(ErrInvalidFormat, "supported formats are csv and ndjson", errors.BadRequest, nil)
+	}
+
+	model := ExportModel{
+		ApplicationID: app.ID,
+		Format:        format,
+		Status:        StatusPending,
+		BlobKey:       fmt.Sprintf("exports/%d/%s.%s.gz", app.ID, utils.RandomString(32), format),
+	}
+	if segmentUUID != "" {
+		segment, err := s.repository.GetSegment(app.ID, segmentUUID)
+		if err != nil {
+			return nil, err
+		}
+		model.SegmentUUID = segment.UUID
+		model.Filters = segment.Filters
+	}
+	return s.repository.CreateExport(model)
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*ExportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionExportDevices)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repository.GetExports(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		s.sign(item)
+	}
+	return items, nil
+}
+
+func (s service) Details(accountID uint, aUUID string, eUUID string) (*ExportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionExportDevices)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.repository.GetExport(app.ID, eUUID)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(item)
+	return item, nil
+}
+
+// Download checks the signed link and opens the export file, the caller has to close the reader
+func (s service) Download(eUUID string, expires int64, signature string) (*ExportModel, io.ReadCloser, error) {
+	if !utils.CheckHMACHash(signaturePayload(eUUID, expires), signature, s.config.SigningKey) {
+		return nil, nil, errors.WithKindCtx(ErrInvalidSignature, "", errors.Forbidden, nil)
+	}
+	if time.Now().Unix() > expires {
+		return nil, nil, errors.WithKindCtx(ErrExpiredLink, "", errors.Gone, nil)
+	}
+
+	item, err := s.repository.GetExportByUUID(eUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if item.Status != StatusCompleted {
+		return nil, nil, errors.WithKindCtx(ErrExportUnavailable, string(item.Status), errors.Gone, nil)
+	}
+
+	file, err := s.store.Get(item.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, file, nil
+}
+
+// Process claims a single due export and writes the matching devices as a gzipped file to the blob store.
+// It returns the number of exported devices
+func (s service) Process(batchSize int) (int, error) {
+	item, err := s.repository.ClaimDueExport(exportLease)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	rows, size, err := s.write(item, batchSize)
+	if err != nil {
+		_ = s.store.Delete(item.BlobKey)
+		if finishErr := s.repository.FinishExport(item.ID, ResultModel{Status: StatusFailed, Error: err.Error()}); finishErr != nil {
+			return 0, finishErr
+		}
+		return 0, errors.Wrapf(err, "export %s has been failed", item.UUID)
+	}
+
+	return rows, s.repository.FinishExport(item.ID, ResultModel{
+		Status:    StatusCompleted,
+		Rows:      rows,
+		Size:      size,
+		ExpiresAt: time.Now().Add(s.config.GetRetention()),
+	})
+}
+
+// Cleanup removes the files of the exports which have passed their retention and returns the number of them
+func (s service) Cleanup(limit int) (int, error) {
+	items, err := s.repository.GetExpiredExports(limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if err = s.store.Delete(item.BlobKey); err != nil {
+			return 0, err
+		}
+		if err = s.repository.ExpireExport(item.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// write streams the devices page by page through gzip into the blob store without buffering the whole file
+func (s service) write(item *ExportModel, batchSize int) (int, int64, error) {
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	rows := 0
+	go func() {
+		var err error
+		rows, err = s.encode(item, batchSize, writer)
+		_ = writer.CloseWithError(err)
+		done <- err
+	}()
+
+	size, err := s.store.Put(item.BlobKey, reader)
+	// Unblocks the encoder when the store gave up before reading the whole stream
+	_ = reader.CloseWithError(err)
+	if encodeErr := <-done; encodeErr != nil {
+		return 0, 0, encodeErr
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return rows, size, nil
+}
+
+func (s service) encode(item *ExportModel, batchSize int, w io.Writer) (int, error) {
+	gz := gzip.NewWriter(w)
+	encoder, err := createWriter(item.Format, gz)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	lastID := uint(0)
+	for {
+		items, err := s.repository.GetExportDevices(item.ApplicationID, item.Filters, lastID, batchSize)
+		if err != nil {
+			return rows, err
+		}
+		for _, row := range items {
+			if err = encoder.Write(row); err != nil {
+				return rows, errors.Wrap(err, "failed to encode exported device")
+			}
+			lastID = row.ID
+		}
+		rows += len(items)
+		if len(items) < batchSize {
+			break
+		}
+	}
+
+	if err = encoder.Flush(); err != nil {
+		return rows, errors.Wrap(err, "failed to encode exported devices")
+	}
+	return rows, gz.Close()
+}
+
+// sign adds a download link which expires after the configured link ttl to completed exports
+func (s service) sign(item *ExportModel) {
+	if item.Status != StatusCompleted {
+		return
+	}
+	expires := time.Now().Add(s.config.GetLinkTTL()).Unix()
+	query := url.Values{}
+	query.Set("expires", fmt.Sprint(expires))
+	query.Set("signature", utils.GenerateHMACHash(signaturePayload(item.UUID, expires), s.config.SigningKey))
+	item.DownloadURL = fmt.Sprintf("%s/v1/exports/%s/download?%s", s.basePath, item.UUID, query.Encode())
+}
+
+func signaturePayload(eUUID string, expires int64) string {
+	return fmt.Sprintf("%s:%d", eUUID, expires)
+}
@@ -0,0 +1,95 @@
+package exports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the list of columns of CSV exports
+var csvHeader = []string{
+	"uuid", "identifier", "device_type", "adid", "language", "timezone", "app_version", "device_vendor",
+	"device_model", "device_os", "device_os_version", "sdk", "session_count", "notification_types", "country",
+	"external_user_id", "amount_spent", "total_usage_time", "tags", "created_at", "last_active_at",
+}
+
+// rowWriter encodes the exported devices into the export file
+type rowWriter interface {
+	Write(row *DeviceRowModel) error
+	Flush() error
+}
+
+func createWriter(format Format, w io.Writer) (rowWriter, error) {
+	if format == FormatNDJSON {
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(row *DeviceRowModel) error {
+	return n.encoder.Encode(row)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) Write(row *DeviceRowModel) error {
+	tags := ""
+	if len(row.Tags) > 0 {
+		encoded, err := json.Marshal(row.Tags)
+		if err != nil {
+			return err
+		}
+		tags = string(encoded)
+	}
+	return c.writer.Write([]string{
+		row.UUID,
+		row.Identifier,
+		row.DeviceType,
+		row.ADID,
+		row.Language,
+		strconv.Itoa(row.Timezone),
+		row.AppVersion,
+		row.DeviceVendor,
+		row.DeviceModel,
+		row.DeviceOS,
+		row.DeviceOSVersion,
+		row.SDK,
+		strconv.Itoa(row.SessionCount),
+		strconv.Itoa(row.NotificationTypes),
+		row.Country,
+		row.ExternalUserID,
+		strconv.FormatFloat(float64(row.AmountSpent), 'f', -1, 32),
+		strconv.FormatInt(row.TotalUsageTime, 10),
+		tags,
+		formatTime(row.CreatedAt),
+		formatTime(row.LastActiveAt),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
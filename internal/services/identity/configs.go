@@ -0,0 +1,16 @@
+package identity
+
+import "time"
+
+// Config holds the settings of identity verification, LogInterval is in seconds
+type Config struct {
+	LogInterval int `yaml:"LOG_INTERVAL" envconfig:"IDENTITY_LOG_INTERVAL"`
+}
+
+// GetLogInterval returns the minimum time between two logged verification failures of an application
+func (c Config) GetLogInterval() time.Duration {
+	if c.LogInterval <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.LogInterval) * time.Second
+}
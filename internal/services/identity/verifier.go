@@ -0,0 +1,74 @@
+package identity
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/logger"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidHash = errors.New("invalid external user id hash")
+)
+
+// Verifier checks the external user id hash of user-scoped SDK requests of applications with identity verification
+// enabled. Failures are logged at most once per log interval for each application, the skipped ones are counted
+type Verifier struct {
+	logger   *logger.StandardLogger
+	interval time.Duration
+	// failures keeps the *failureWindow of each application by its id
+	failures sync.Map
+}
+
+type failureWindow struct {
+	sync.Mutex
+	loggedAt   time.Time
+	suppressed int
+}
+
+func CreateVerifier(cfg Config, logger *logger.StandardLogger) *Verifier {
+	return &Verifier{
+		logger:   logger,
+		interval: cfg.GetLogInterval(),
+	}
+}
+
+// Verify checks the hash to be the HMAC of the external user id signed by the auth key of the application,
+// requests without an external user id and applications without identity verification always pass
+func (v *Verifier) Verify(app devices.DeviceApplicationModel, externalUserID string, hash string, operation string) error {
+	if !app.IdentityVerification || externalUserID == "" {
+		return nil
+	}
+	if hash != "" && utils.CheckHMACHash(externalUserID, hash, app.AuthKey) {
+		return nil
+	}
+	v.logFailure(app, externalUserID, operation)
+	return errors.WithKindCtx(ErrInvalidHash, "", errors.Unauthorized, map[string]interface{}{"operation": operation})
+}
+
+func (v *Verifier) logFailure(app devices.DeviceApplicationModel, externalUserID string, operation string) {
+	value, _ := v.failures.LoadOrStore(app.ID, &failureWindow{})
+	window := value.(*failureWindow)
+
+	window.Lock()
+	if time.Since(window.loggedAt) < v.interval {
+		window.suppressed++
+		window.Unlock()
+		return
+	}
+	suppressed := window.suppressed
+	window.loggedAt = time.Now()
+	window.suppressed = 0
+	window.Unlock()
+
+	v.logger.WithFields(logrus.Fields{
+		"operation":        "identity.verify",
+		"app_uuid":         app.UUID,
+		"request":          operation,
+		"external_user_id": externalUserID,
+		"suppressed":       suppressed,
+	}).Warn("identity verification failed")
+}
@@ -0,0 +1,82 @@
+package imports
+
+import (
+	"time"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// ImportModel is an asynchronous device import job, rows are processed in batches and
+// ProcessedRows is the checkpoint an interrupted job resumes from
+type ImportModel struct {
+	ID            uint       `json:"-"`
+	UUID          string     `json:"uuid"`
+	ApplicationID uint       `json:"-"`
+	FileName      string     `json:"file_name"`
+	Format        Format     `json:"format"`
+	Checksum      string     `json:"checksum"`
+	BlobKey       string     `json:"-"`
+	Size          int64      `json:"size"`
+	Status        Status     `json:"status"`
+	ProcessedRows int        `json:"processed_rows"`
+	ImportedRows  int        `json:"imported_rows"`
+	FailedRows    int        `json:"failed_rows"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// RowErrorModel describes why a single row of the import file has been rejected,
+// Row is the 1-based position of the row in the file without counting the CSV header
+type RowErrorModel struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// DeviceRowModel is a single device of the import file, CSV files carry the same fields as columns
+// with tags encoded as a JSON object
+type DeviceRowModel struct {
+	Identifier        string            `json:"identifier"`
+	DeviceType        string            `json:"device_type"`
+	ADID              string            `json:"adid"`
+	Language          string            `json:"language"`
+	Timezone          int               `json:"timezone"`
+	AppVersion        string            `json:"app_version"`
+	DeviceVendor      string            `json:"device_vendor"`
+	DeviceModel       string            `json:"device_model"`
+	DeviceOS          string            `json:"device_os"`
+	DeviceOSVersion   string            `json:"device_os_version"`
+	SDK               string            `json:"sdk"`
+	SessionCount      int               `json:"session_count"`
+	NotificationTypes int               `json:"notification_types"`
+	Country           string            `json:"country"`
+	ExternalUserID    string            `json:"external_user_id"`
+	AmountSpent       float32           `json:"amount_spent"`
+	Tags              map[string]string `json:"tags"`
+}
+
+// BatchModel is the outcome of a single processed batch which is persisted atomically with the devices
+type BatchModel struct {
+	ImportID      uint
+	ProcessedRows int
+	ImportedRows  int
+	FailedRows    int
+	Errors        []RowErrorModel
+	// NextRunAt renews the lease of the import
+	NextRunAt time.Time
+}
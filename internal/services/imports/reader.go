@@ -0,0 +1,209 @@
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLineSize is the longest NDJSON line accepted by the reader
+	maxLineSize = 1024 * 1024
+)
+
+var (
+	ErrInvalidHeader = errors.New("import file header is invalid")
+)
+
+// rowError is a problem of a single row, the reader can continue with the next rows
+type rowError struct {
+	message string
+}
+
+func (e rowError) Error() string {
+	return e.message
+}
+
+// rowReader reads devices from the import file one by one and returns io.EOF at the end of the file
+type rowReader interface {
+	Next() (DeviceRowModel, error)
+}
+
+func createReader(format Format, r io.Reader) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return createCSVReader(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		return &ndjsonReader{scanner: scanner}, nil
+	}
+	return nil, errors.WithKindCtx(ErrInvalidFormat, string(format), errors.BadRequest, nil)
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+}
+
+func (n *ndjsonReader) Next() (DeviceRowModel, error) {
+	for n.scanner.Scan() {
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row DeviceRowModel
+		if err := json.Unmarshal(line, &row); err != nil {
+			return row, rowError{message: fmt.Sprintf("invalid json: %s", err.Error())}
+		}
+		return row, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return DeviceRowModel{}, errors.WithKindCtx(err, fmt.Sprintf("lines are limited to %d bytes", maxLineSize), errors.UnprocessableEntity, nil)
+		}
+		return DeviceRowModel{}, errors.Wrap(err, "failed to read import file")
+	}
+	return DeviceRowModel{}, io.EOF
+}
+
+// csvColumns maps the supported CSV columns to their setters
+var csvColumns = map[string]func(row *DeviceRowModel, value string) error{
+	"identifier":         func(row *DeviceRowModel, v string) error { row.Identifier = v; return nil },
+	"device_type":        func(row *DeviceRowModel, v string) error { row.DeviceType = v; return nil },
+	"adid":               func(row *DeviceRowModel, v string) error { row.ADID = v; return nil },
+	"language":           func(row *DeviceRowModel, v string) error { row.Language = v; return nil },
+	"timezone":           func(row *DeviceRowModel, v string) error { return parseInt(v, &row.Timezone) },
+	"app_version":        func(row *DeviceRowModel, v string) error { row.AppVersion = v; return nil },
+	"device_vendor":      func(row *DeviceRowModel, v string) error { row.DeviceVendor = v; return nil },
+	"device_model":       func(row *DeviceRowModel, v string) error { row.DeviceModel = v; return nil },
+	"device_os":          func(row *DeviceRowModel, v string) error { row.DeviceOS = v; return nil },
+	"device_os_version":  func(row *DeviceRowModel, v string) error { row.DeviceOSVersion = v; return nil },
+	"sdk":                func(row *DeviceRowModel, v string) error { row.SDK = v; return nil },
+	"session_count":      func(row *DeviceRowModel, v string) error { return parseInt(v, &row.SessionCount) },
+	"notification_types": func(row *DeviceRowModel, v string) error { return parseInt(v, &row.NotificationTypes) },
+	"country":            func(row *DeviceRowModel, v string) error { row.Country = v; return nil },
+	"external_user_id":   func(row *DeviceRowModel, v string) error { row.ExternalUserID = v; return nil },
+	"amount_spent": func(row *DeviceRowModel, v string) error {
+		if v == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(v, 32)
+		row.AmountSpent = float32(f)
+		return err
+	},
+	"tags": func(row *DeviceRowModel, v string) error {
+		if v == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(v), &row.Tags)
+	},
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func createCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.WithKindCtx(ErrInvalidHeader, "file is empty", errors.UnprocessableEntity, nil)
+	}
+	if err != nil {
+		return nil, errors.WithKindCtx(ErrInvalidHeader, err.Error(), errors.UnprocessableEntity, nil)
+	}
+
+	columns := make([]string, len(header))
+	found := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := csvColumns[name]; !ok {
+			return nil, errors.WithKindCtx(ErrInvalidHeader, fmt.Sprintf("unknown column %q", name), errors.UnprocessableEntity, nil)
+		}
+		columns[i] = name
+		found[name] = true
+	}
+	for _, name := range []string{"identifier", "device_type"} {
+		if !found[name] {
+			return nil, errors.WithKindCtx(ErrInvalidHeader, fmt.Sprintf("missing column %q", name), errors.UnprocessableEntity, nil)
+		}
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (DeviceRowModel, error) {
+	var row DeviceRowModel
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return row, io.EOF
+	}
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return row, rowError{message: parseErr.Err.Error()}
+		}
+		return row, errors.Wrap(err, "failed to read import file")
+	}
+	if len(record) != len(c.columns) {
+		return row, rowError{message: fmt.Sprintf("expected %d columns but got %d", len(c.columns), len(record))}
+	}
+	for i, value := range record {
+		if err = csvColumns[c.columns[i]](&row, strings.TrimSpace(value)); err != nil {
+			return row, rowError{message: fmt.Sprintf("invalid %s: %s", c.columns[i], err.Error())}
+		}
+	}
+	return row, nil
+}
+
+func parseInt(value string, target *int) error {
+	if value == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(value)
+	*target = v
+	return err
+}
+
+// validateRow checks the row against the limits of the devices table
+func validateRow(row DeviceRowModel) error {
+	switch {
+	case row.Identifier == "":
+		return rowError{message: "identifier is required"}
+	case len(row.Identifier) > 512:
+		return rowError{message: "identifier is longer than 512 characters"}
+	case row.DeviceType == "":
+		return rowError{message: "device_type is required"}
+	case len(row.Language) > 7:
+		return rowError{message: "language is longer than 7 characters"}
+	case len(row.AppVersion) > 32:
+		return rowError{message: "app_version is longer than 32 characters"}
+	case len(row.Country) > 2:
+		return rowError{message: "country must be a two letters code"}
+	}
+	for k, v := range row.Tags {
+		if k == "" || len(k) > 255 || len(v) > 255 {
+			return rowError{message: fmt.Sprintf("tag %q is invalid", k)}
+		}
+	}
+	return nil
+}
+
+// checkTagTypes checks the tags of the row against the declared tag types of the application
+func checkTagTypes(row DeviceRowModel, types map[string]tags.TagType) error {
+	for k, v := range row.Tags {
+		if t, ok := types[k]; ok && v != "" && !t.Matches(v) {
+			return rowError{message: fmt.Sprintf("tag %q must be a %s", k, t)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package imports
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"time"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	CreateImport(model ImportModel) (*ImportModel, error)
+	GetImports(applicationID uint) ([]*ImportModel, error)
+	GetImport(applicationID uint, UUID string) (*ImportModel, error)
+	GetImportByChecksum(applicationID uint, checksum string) (*ImportModel, error)
+	GetImportErrors(importID uint, offset int, limit int) ([]*RowErrorModel, error)
+	RetryImport(model ImportModel) (*ImportModel, error)
+	ClaimDueImport(lease time.Duration) (*ImportModel, error)
+	FinishImport(ID uint, status Status, message string) error
+	// GetDeclaredTagKeyTypes returns the types of the declared tag keys of the application by their key
+	GetDeclaredTagKeyTypes(applicationID uint) (map[string]tags.TagType, error)
+
+	// ImportDevices upserts the devices of the batch and moves the import checkpoint forward in a single transaction
+	ImportDevices(applicationID uint, rows []DeviceRowModel, batch BatchModel) error
+}
+
+// Quota checks the limits of the plan of the application before devices are imported to it
+type Quota interface {
+	CheckDevices(applicationID uint) error
+}
@@ -0,0 +1,253 @@
+package imports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/blob"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// importLease is the time a claimed import is hidden from other workers, it is renewed on every batch
+	importLease = 5 * time.Minute
+	// maxStoredErrors limits the number of row errors kept per import, rejected rows are still counted
+	maxStoredErrors = 1000
+)
+
+var (
+	ErrInvalidFormat = errors.New("import file format is invalid")
+)
+
+type Service interface {
+	Upload(accountID uint, aUUID string, fileName string, format Format, r io.Reader) (*ImportModel, error)
+	List(accountID uint, aUUID string) ([]*ImportModel, error)
+	Details(accountID uint, aUUID string, iUUID string) (*ImportModel, error)
+	Errors(accountID uint, aUUID string, iUUID string, paging utils.Paging) ([]*RowErrorModel, error)
+
+	Process(batchSize int) (int, error)
+}
+
+type service struct {
+	repository Repository
+	store      blob.Store
+	quota      Quota
+}
+
+func CreateService(r Repository, s blob.Store, q Quota) Service {
+	return &service{
+		repository: r,
+		store:      s,
+		quota:      q,
+	}
+}
+
+// Upload spools the file to the blob store and queues it for import. Uploading the same file again
+// returns the existing import and resumes it when it has been failed before
+func (s service) Upload(accountID uint, aUUID string, fileName string, format Format, r io.Reader) (*ImportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionImportDevices)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), "."))
+	}
+	if format != FormatCSV && format != FormatNDJSON {
+		return nil, errors.WithKindCtx(ErrInvalidFormat, "supported formats are csv and ndjson", errors.BadRequest, nil)
+	}
+	if err = s.quota.CheckDevices(app.ID); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	key := fmt.Sprintf("imports/%d/%s.%s", app.ID, utils.RandomString(32), format)
+	size, err := s.store.Put(key, io.TeeReader(r, hash))
+	if err != nil {
+		return nil, err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	existing, err := s.repository.GetImportByChecksum(app.ID, checksum)
+	if err != nil && !errors.HasKind(err, errors.NotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Status != StatusFailed {
+			_ = s.store.Delete(key)
+			return existing, nil
+		}
+		// Failed imports have lost their file on failure, so the new upload takes its place
+		_ = s.store.Delete(existing.BlobKey)
+		existing.BlobKey = key
+		return s.repository.RetryImport(*existing)
+	}
+
+	return s.repository.CreateImport(ImportModel{
+		ApplicationID: app.ID,
+		FileName:      filepath.Base(fileName),
+		Format:        format,
+		Checksum:      checksum,
+		BlobKey:       key,
+		Size:          size,
+		Status:        StatusPending,
+	})
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*ImportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetImports(app.ID)
+}
+
+func (s service) Details(accountID uint, aUUID string, iUUID string) (*ImportModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetImport(app.ID, iUUID)
+}
+
+func (s service) Errors(accountID uint, aUUID string, iUUID string, paging utils.Paging) ([]*RowErrorModel, error) {
+	item, err := s.Details(accountID, aUUID, iUUID)
+	if err != nil {
+		return nil, err
+	}
+	if paging.Page < 1 {
+		paging.Page = 1
+	}
+	if paging.Size < 1 || paging.Size > 100 {
+		paging.Size = 100
+	}
+	return s.repository.GetImportErrors(item.ID, (paging.Page-1)*paging.Size, paging.Size)
+}
+
+// Process claims a single due import and runs it to the end in batches of batchSize rows.
+// It returns the number of processed rows, interrupted imports continue from their last batch
+func (s service) Process(batchSize int) (int, error) {
+	item, err := s.repository.ClaimDueImport(importLease)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	processed, err := s.process(item, batchSize)
+	if err != nil {
+		// Only problems of the file itself and reaching the devices limit fail the import, others are retried after the lease
+		if !errors.HasKind(err, errors.UnprocessableEntity) && !errors.HasKind(err, errors.NotFound) &&
+			!errors.HasKind(err, errors.PaymentRequired) {
+			return processed, err
+		}
+		_ = s.store.Delete(item.BlobKey)
+		return processed, s.repository.FinishImport(item.ID, StatusFailed, err.Error())
+	}
+
+	_ = s.store.Delete(item.BlobKey)
+	return processed, s.repository.FinishImport(item.ID, StatusCompleted, "")
+}
+
+func (s service) process(item *ImportModel, batchSize int) (int, error) {
+	file, err := s.store.Get(item.BlobKey)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader, err := createReader(item.Format, file)
+	if err != nil {
+		return 0, err
+	}
+
+	types, err := s.repository.GetDeclaredTagKeyTypes(item.ApplicationID)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	rowNumber := 0
+	failed := item.FailedRows
+	rows := make([]DeviceRowModel, 0, batchSize)
+	batch := BatchModel{ImportID: item.ID}
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(rowError); !ok && err != nil {
+			return processed, err
+		}
+		rowNumber++
+		// Rows before the checkpoint have already been imported by a previous run
+		if rowNumber <= item.ProcessedRows {
+			continue
+		}
+		if err == nil {
+			err = validateRow(row)
+		}
+		if err == nil {
+			err = checkTagTypes(row, types)
+		}
+
+		batch.ProcessedRows++
+		if err != nil {
+			batch.FailedRows++
+			failed++
+			if failed <= maxStoredErrors {
+				batch.Errors = append(batch.Errors, RowErrorModel{Row: rowNumber, Message: err.Error()})
+			}
+		} else {
+			rows = append(rows, row)
+		}
+
+		if batch.ProcessedRows >= batchSize {
+			if err = s.flush(item.ApplicationID, rows, &batch); err != nil {
+				return processed, err
+			}
+			processed += batch.ProcessedRows
+			rows = rows[:0]
+			batch = BatchModel{ImportID: item.ID}
+		}
+	}
+
+	if batch.ProcessedRows > 0 {
+		if err = s.flush(item.ApplicationID, rows, &batch); err != nil {
+			return processed, err
+		}
+		processed += batch.ProcessedRows
+	}
+	return processed, nil
+}
+
+// flush writes the valid rows of the batch to the database alongside with the import progress. The devices limit is
+// checked before every batch, so an import stops at the first batch after the application has reached it
+func (s service) flush(applicationID uint, rows []DeviceRowModel, batch *BatchModel) error {
+	if len(rows) > 0 {
+		if err := s.quota.CheckDevices(applicationID); err != nil {
+			return err
+		}
+	}
+	// A device may appear several times in a file, the last row wins
+	unique := make(map[string]int, len(rows))
+	deduplicated := make([]DeviceRowModel, 0, len(rows))
+	for _, row := range rows {
+		if i, ok := unique[row.Identifier]; ok {
+			deduplicated[i] = row
+			continue
+		}
+		unique[row.Identifier] = len(deduplicated)
+		deduplicated = append(deduplicated, row)
+	}
+	batch.ImportedRows = len(rows)
+	batch.NextRunAt = time.Now().Add(importLease)
+	return s.repository.ImportDevices(applicationID, deduplicated, *batch)
+}
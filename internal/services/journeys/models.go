@@ -0,0 +1,154 @@
+package journeys
+
+import (
+	"time"
+)
+
+type TriggerType string
+
+const (
+	TriggerDeviceRegistered TriggerType = "device_registered"
+	TriggerTagChanged       TriggerType = "tag_changed"
+	TriggerEvent            TriggerType = "event"
+)
+
+type StepType string
+
+const (
+	StepWait         StepType = "wait"
+	StepBranch       StepType = "branch"
+	StepNotification StepType = "notification"
+	StepExit         StepType = "exit"
+)
+
+type Relation string
+
+const (
+	RelationEqual     Relation = "="
+	RelationNotEqual  Relation = "!="
+	RelationExists    Relation = "exists"
+	RelationNotExists Relation = "not_exists"
+)
+
+type ProgressStatus string
+
+const (
+	ProgressActive    ProgressStatus = "active"
+	ProgressCompleted ProgressStatus = "completed"
+	ProgressExited    ProgressStatus = "exited"
+)
+
+type JourneyModel struct {
+	ID            uint             `json:"-"`
+	UUID          string           `json:"uuid"`
+	ApplicationID uint             `json:"-"`
+	Name          string           `json:"name"`
+	Active        bool             `json:"active"`
+	Trigger       TriggerModel     `json:"trigger"`
+	Steps         []StepModel      `json:"steps"`
+	ExitRules     []ConditionModel `json:"exit_rules"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// TriggerModel describes the entry point of a journey, Key is the tag key or event name of tag and event triggers,
+// Value is only used by tag triggers
+type TriggerModel struct {
+	Type  TriggerType `json:"type"`
+	Key   string      `json:"key,omitempty"`
+	Value string      `json:"value,omitempty"`
+}
+
+// StepModel is a single node of the journey, steps run in order unless Next/Else points to another step key
+type StepModel struct {
+	Key          string             `json:"key"`
+	Type         StepType           `json:"type"`
+	Next         string             `json:"next,omitempty"`
+	WaitSeconds  int                `json:"wait_seconds,omitempty"`
+	Conditions   []ConditionModel   `json:"conditions,omitempty"`
+	Else         string             `json:"else,omitempty"`
+	Notification *NotificationModel `json:"notification,omitempty"`
+}
+
+// ConditionModel is a tag based condition used in branch steps and exit rules
+type ConditionModel struct {
+	Key      string   `json:"key"`
+	Relation Relation `json:"relation"`
+	Value    string   `json:"value,omitempty"`
+}
+
+type NotificationModel struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// ProgressModel holds the position of a single device inside a journey
+type ProgressModel struct {
+	ID            uint
+	JourneyID     uint
+	DeviceID      uint
+	ApplicationID uint
+	StepKey       string
+	Status        ProgressStatus
+	Waiting       bool
+	NextRunAt     time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// DispatchModel is the message handed over to the notification pipeline by notification steps
+type DispatchModel struct {
+	ApplicationID uint              `json:"application_id"`
+	DeviceID      uint              `json:"device_id"`
+	JourneyUUID   string            `json:"journey_uuid"`
+	StepKey       string            `json:"step_key"`
+	Title         string            `json:"title"`
+	Body          string            `json:"body"`
+	Data          map[string]string `json:"data,omitempty"`
+}
+
+// IsValid checks the relation to be a known one
+func (r Relation) IsValid() bool {
+	switch r {
+	case RelationEqual, RelationNotEqual, RelationExists, RelationNotExists:
+		return true
+	}
+	return false
+}
+
+// Match checks the condition against the tags of a device
+func (c ConditionModel) Match(tags map[string]string) bool {
+	value, ok := tags[c.Key]
+	switch c.Relation {
+	case RelationEqual:
+		return ok && value == c.Value
+	case RelationNotEqual:
+		return !ok || value != c.Value
+	case RelationExists:
+		return ok
+	case RelationNotExists:
+		return !ok
+	}
+	return false
+}
+
+// matchAll returns true when all conditions are matching the tags
+func matchAll(conditions []ConditionModel, tags map[string]string) bool {
+	for _, c := range conditions {
+		if !c.Match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns true when at least one of the conditions is matching the tags
+func matchAny(conditions []ConditionModel, tags map[string]string) bool {
+	for _, c := range conditions {
+		if c.Match(tags) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package journeys
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"time"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	CreateJourney(model JourneyModel) (*JourneyModel, error)
+	UpdateJourney(model JourneyModel) (*JourneyModel, error)
+	GetJourneys(applicationID uint) ([]*JourneyModel, error)
+	GetJourney(applicationID uint, UUID string) (*JourneyModel, error)
+	GetJourneyByID(ID uint) (*JourneyModel, error)
+	GetActiveJourneysByTrigger(applicationID uint, trigger TriggerType) ([]*JourneyModel, error)
+	DeleteJourney(applicationID uint, UUID string) error
+
+	EnrollDevice(model ProgressModel) error
+	ClaimDueProgresses(limit int, lease time.Duration) ([]*ProgressModel, error)
+	UpdateProgress(model ProgressModel) error
+	GetDeviceTags(deviceID uint) (map[string]string, error)
+}
+
+// Dispatcher hands over the notifications created by journeys to the notification pipeline
+type Dispatcher interface {
+	Dispatch(model DispatchModel) error
+}
+
+// Quota counts the notifications sent by journeys against the monthly limit of the plan of the application
+type Quota interface {
+	UseNotifications(applicationID uint, count int) error
+}
@@ -0,0 +1,387 @@
+package journeys
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/logger"
+	"time"
+)
+
+const (
+	// progressLease is the time a claimed progress is hidden from other workers while it is being processed
+	progressLease = 5 * time.Minute
+)
+
+var (
+	ErrInvalidJourney  = errors.New("journey definition is invalid")
+	ErrInvalidStepType = errors.New("journey step type is invalid")
+	ErrUnknownStepKey  = errors.New("journey step points to an unknown step key")
+	ErrInvalidRelation = errors.New("journey condition relation is invalid")
+)
+
+type Service interface {
+	Create(accountID uint, aUUID string, model JourneyModel) (*JourneyModel, error)
+	Update(accountID uint, aUUID string, model JourneyModel) (*JourneyModel, error)
+	List(accountID uint, aUUID string) ([]*JourneyModel, error)
+	Details(accountID uint, aUUID string, jUUID string) (*JourneyModel, error)
+	Delete(accountID uint, aUUID string, jUUID string) error
+
+	OnDeviceEvent(event devices.DeviceEventModel) error
+	OnEvent(event events.EventModel) error
+	Advance(limit int) (int, error)
+}
+
+type service struct {
+	repository Repository
+	dispatcher Dispatcher
+	quota      Quota
+	logger     *logger.StandardLogger
+}
+
+func CreateService(r Repository, d Dispatcher, q Quota, logger *logger.StandardLogger) Service {
+	return &service{
+		repository: r,
+		dispatcher: d,
+		quota:      q,
+		logger:     logger,
+	}
+}
+
+func (s service) Create(accountID uint, aUUID string, model JourneyModel) (*JourneyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageJourneys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validate(model); err != nil {
+		return nil, err
+	}
+
+	model.ApplicationID = app.ID
+	return s.repository.CreateJourney(model)
+}
+
+func (s service) Update(accountID uint, aUUID string, model JourneyModel) (*JourneyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageJourneys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validate(model); err != nil {
+		return nil, err
+	}
+
+	model.ApplicationID = app.ID
+	return s.repository.UpdateJourney(model)
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*JourneyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetJourneys(app.ID)
+}
+
+func (s service) Details(accountID uint, aUUID string, jUUID string) (*JourneyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetJourney(app.ID, jUUID)
+}
+
+func (s service) Delete(accountID uint, aUUID string, jUUID string) error {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageJourneys)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteJourney(app.ID, jUUID)
+}
+
+// OnDeviceEvent enrolls the device into the active journeys whose entry trigger matches the event
+func (s service) OnDeviceEvent(event devices.DeviceEventModel) error {
+	var trigger TriggerType
+	switch event.Type {
+	case devices.DeviceRegistered:
+		trigger = TriggerDeviceRegistered
+	case devices.DeviceTagsChanged:
+		trigger = TriggerTagChanged
+	default:
+		return nil
+	}
+
+	items, err := s.repository.GetActiveJourneysByTrigger(event.ApplicationID, trigger)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if trigger == TriggerTagChanged {
+			value, ok := event.Tags[item.Trigger.Key]
+			if !ok || (item.Trigger.Value != "" && item.Trigger.Value != value) {
+				continue
+			}
+		}
+		if err = s.enroll(item, event.DeviceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnEvent enrolls the device into the active journeys which are triggered by the performed event
+func (s service) OnEvent(event events.EventModel) error {
+	items, err := s.repository.GetActiveJourneysByTrigger(event.ApplicationID, TriggerEvent)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.Trigger.Key != event.Name {
+			continue
+		}
+		if err = s.enroll(item, event.DeviceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enroll puts the device on the first step of the journey
+func (s service) enroll(journey *JourneyModel, deviceID uint) error {
+	err := s.repository.EnrollDevice(ProgressModel{
+		JourneyID:     journey.ID,
+		DeviceID:      deviceID,
+		ApplicationID: journey.ApplicationID,
+		StepKey:       journey.Steps[0].Key,
+		Status:        ProgressActive,
+		NextRunAt:     time.Now(),
+	})
+	return errors.Wrapf(err, "failed to enroll device %d into journey %s", deviceID, journey.UUID)
+}
+
+// Advance moves the due devices forward in their journeys and returns the number of processed devices. Devices
+// failing to advance are logged and retried after their lease, they do not hold back the rest of the batch
+func (s service) Advance(limit int) (int, error) {
+	items, err := s.repository.ClaimDueProgresses(limit, progressLease)
+	if err != nil {
+		return 0, err
+	}
+
+	// Journeys are cached during a single run since many devices share the same journey
+	journeys := make(map[uint]*JourneyModel)
+	processed := 0
+	for _, item := range items {
+		journey, ok := journeys[item.JourneyID]
+		if !ok {
+			journey, err = s.repository.GetJourneyByID(item.JourneyID)
+			if err != nil && !errors.HasKind(err, errors.NotFound) {
+				s.logFailure(item, err)
+				continue
+			}
+			journeys[item.JourneyID] = journey
+		}
+
+		if err = s.advance(journey, item); err == nil {
+			err = s.repository.UpdateProgress(*item)
+		}
+		if err != nil {
+			s.logFailure(item, err)
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (s service) logFailure(progress *ProgressModel, err error) {
+	s.logger.WithFields(logrus.Fields{
+		"operation":  "journeys.advance",
+		"journey_id": progress.JourneyID,
+		"device_id":  progress.DeviceID,
+		"step":       progress.StepKey,
+	}).Error(err.Error())
+}
+
+// advance runs the steps of the journey for a single device until it has to wait or leaves the journey
+func (s service) advance(journey *JourneyModel, progress *ProgressModel) error {
+	// Journey has been removed or paused meanwhile
+	if journey == nil || !journey.Active {
+		progress.Status = ProgressExited
+		return nil
+	}
+
+	tags, err := s.repository.GetDeviceTags(progress.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	// Guard against loops in the journey definition, every step is executed at most once per run
+	for i := 0; i < len(journey.Steps); i++ {
+		if matchAny(journey.ExitRules, tags) {
+			progress.Status = ProgressExited
+			return nil
+		}
+
+		index := stepIndex(journey.Steps, progress.StepKey)
+		if index < 0 {
+			progress.Status = ProgressExited
+			return nil
+		}
+		step := journey.Steps[index]
+		next := step.Next
+		if next == "" && index+1 < len(journey.Steps) {
+			next = journey.Steps[index+1].Key
+		}
+
+		switch step.Type {
+		case StepWait:
+			// Waiting is over once the progress becomes due again
+			if !progress.Waiting {
+				progress.Waiting = true
+				progress.NextRunAt = time.Now().Add(time.Duration(step.WaitSeconds) * time.Second)
+				return nil
+			}
+			progress.Waiting = false
+		case StepBranch:
+			if !matchAll(step.Conditions, tags) {
+				next = step.Else
+			}
+		case StepNotification:
+			// Devices keep going through the journey without the notification once the monthly limit is reached
+			err = s.quota.UseNotifications(progress.ApplicationID, 1)
+			if errors.HasKind(err, errors.PaymentRequired) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			// The device is moved past the step before the notification is dispatched, so a run failing
+			// afterwards never sends the same notification twice
+			moveTo(progress, next)
+			if err = s.repository.UpdateProgress(*progress); err != nil {
+				return err
+			}
+			err = s.dispatcher.Dispatch(DispatchModel{
+				ApplicationID: progress.ApplicationID,
+				DeviceID:      progress.DeviceID,
+				JourneyUUID:   journey.UUID,
+				StepKey:       step.Key,
+				Title:         step.Notification.Title,
+				Body:          step.Notification.Body,
+				Data:          step.Notification.Data,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to dispatch notification of journey %s", journey.UUID)
+			}
+			if progress.Status != ProgressActive {
+				return nil
+			}
+			continue
+		case StepExit:
+			progress.Status = ProgressExited
+			return nil
+		}
+
+		moveTo(progress, next)
+		if progress.Status != ProgressActive {
+			return nil
+		}
+	}
+	return nil
+}
+
+// moveTo puts the device on the next step, devices without a next step have completed the journey
+func moveTo(progress *ProgressModel, next string) {
+	if next == "" {
+		progress.Status = ProgressCompleted
+		return
+	}
+	progress.StepKey = next
+	progress.NextRunAt = time.Now()
+}
+
+// validate checks the journey definition to be executable by the worker
+func validate(model JourneyModel) error {
+	if len(model.Steps) == 0 {
+		return errors.WithKindCtx(ErrInvalidJourney, "journey needs at least one step", errors.UnprocessableEntity, nil)
+	}
+
+	switch model.Trigger.Type {
+	case TriggerDeviceRegistered:
+	case TriggerTagChanged, TriggerEvent:
+		if model.Trigger.Key == "" {
+			return errors.WithKindCtx(ErrInvalidJourney, "tag and event triggers need a key", errors.UnprocessableEntity, nil)
+		}
+	default:
+		return errors.WithKindCtx(ErrInvalidJourney, "unknown trigger type", errors.UnprocessableEntity, nil)
+	}
+
+	if err := validateConditions(model.ExitRules, ""); err != nil {
+		return err
+	}
+	keys := make(map[string]bool, len(model.Steps))
+	for _, step := range model.Steps {
+		if step.Key == "" {
+			return errors.WithKindCtx(ErrInvalidJourney, "every step needs a key", errors.UnprocessableEntity, nil)
+		}
+		// Progresses point at their step by its key, so the keys must be unique
+		if keys[step.Key] {
+			return errors.WithKindCtx(ErrInvalidJourney, "step keys must be unique", errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+		}
+		keys[step.Key] = true
+		switch step.Type {
+		case StepWait:
+			if step.WaitSeconds <= 0 {
+				return errors.WithKindCtx(ErrInvalidJourney, "wait step needs a positive duration", errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+			}
+		case StepBranch:
+			if len(step.Conditions) == 0 {
+				return errors.WithKindCtx(ErrInvalidJourney, "branch step needs conditions", errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+			}
+			if err := validateConditions(step.Conditions, step.Key); err != nil {
+				return err
+			}
+		case StepNotification:
+			if step.Notification == nil {
+				return errors.WithKindCtx(ErrInvalidJourney, "notification step needs a notification", errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+			}
+		case StepExit:
+		default:
+			return errors.WithKindCtx(ErrInvalidStepType, "", errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+		}
+		for _, key := range []string{step.Next, step.Else} {
+			if key != "" && stepIndex(model.Steps, key) < 0 {
+				return errors.WithKindCtx(ErrUnknownStepKey, key, errors.UnprocessableEntity, map[string]interface{}{"step": step.Key})
+			}
+		}
+	}
+	return nil
+}
+
+// validateConditions checks the conditions of the step with the given key, exit rules have no step key
+func validateConditions(conditions []ConditionModel, stepKey string) error {
+	for _, condition := range conditions {
+		if condition.Key == "" {
+			return errors.WithKindCtx(ErrInvalidJourney, "every condition needs a key", errors.UnprocessableEntity, map[string]interface{}{"step": stepKey})
+		}
+		if !condition.Relation.IsValid() {
+			return errors.WithKindCtx(ErrInvalidRelation, string(condition.Relation), errors.UnprocessableEntity, map[string]interface{}{"step": stepKey, "key": condition.Key})
+		}
+	}
+	return nil
+}
+
+// stepIndex returns the index of the step with the given key or -1
+func stepIndex(steps []StepModel, key string) int {
+	for i, step := range steps {
+		if step.Key == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+package journeys
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/logger"
+)
+
+type advanceRepository struct {
+	Repository
+	journey    JourneyModel
+	progresses []*ProgressModel
+	// failing are the devices whose tags can not be loaded
+	failing map[uint]bool
+	updates []ProgressModel
+}
+
+func (r *advanceRepository) ClaimDueProgresses(limit int, lease time.Duration) ([]*ProgressModel, error) {
+	return r.progresses, nil
+}
+
+func (r *advanceRepository) GetJourneyByID(ID uint) (*JourneyModel, error) {
+	journey := r.journey
+	return &journey, nil
+}
+
+func (r *advanceRepository) GetDeviceTags(deviceID uint) (map[string]string, error) {
+	if r.failing[deviceID] {
+		return nil, errors.New("connection reset")
+	}
+	return map[string]string{}, nil
+}
+
+func (r *advanceRepository) UpdateProgress(model ProgressModel) error {
+	r.updates = append(r.updates, model)
+	return nil
+}
+
+type advanceDispatcher struct {
+	repository *advanceRepository
+	// persisted is the number of progress updates made before each dispatch
+	persisted []int
+	err       error
+}
+
+func (d *advanceDispatcher) Dispatch(model DispatchModel) error {
+	d.persisted = append(d.persisted, len(d.repository.updates))
+	return d.err
+}
+
+type advanceQuota struct{}
+
+func (advanceQuota) UseNotifications(applicationID uint, count int) error {
+	return nil
+}
+
+func createAdvanceService(repo *advanceRepository, dispatcher *advanceDispatcher) Service {
+	log := logger.CreateLogger(logger.Config{LogLevel: "error"})
+	log.Out = ioutil.Discard
+	return CreateService(repo, dispatcher, advanceQuota{}, log)
+}
+
+func notificationJourney() JourneyModel {
+	return JourneyModel{
+		ID:     1,
+		UUID:   "journey",
+		Active: true,
+		Steps: []StepModel{
+			{Key: "welcome", Type: StepNotification, Notification: &NotificationModel{Title: "Hi"}},
+			{Key: "end", Type: StepExit},
+		},
+	}
+}
+
+func TestAdvanceContinuesAfterFailingDevice(t *testing.T) {
+	repo := &advanceRepository{
+		journey: notificationJourney(),
+		progresses: []*ProgressModel{
+			{ID: 1, JourneyID: 1, DeviceID: 1, StepKey: "welcome", Status: ProgressActive},
+			{ID: 2, JourneyID: 1, DeviceID: 2, StepKey: "welcome", Status: ProgressActive},
+		},
+		failing: map[uint]bool{1: true},
+	}
+	dispatcher := &advanceDispatcher{repository: repo}
+	processed, err := createAdvanceService(repo, dispatcher).Advance(10)
+	if err != nil {
+		t.Fatalf("advance failed: %v", err)
+	}
+	if processed != 1 {
+		t.Fatalf("we got %d processed devices but expected 1", processed)
+	}
+	if len(dispatcher.persisted) != 1 {
+		t.Fatalf("we got %d notifications but expected 1", len(dispatcher.persisted))
+	}
+	last := repo.updates[len(repo.updates)-1]
+	if last.ID != 2 || last.Status != ProgressExited {
+		t.Fatalf("we got progress %d with status %s but expected 2 to have exited", last.ID, last.Status)
+	}
+}
+
+func TestAdvancePersistsStepBeforeDispatching(t *testing.T) {
+	repo := &advanceRepository{
+		journey:    notificationJourney(),
+		progresses: []*ProgressModel{{ID: 1, JourneyID: 1, DeviceID: 1, StepKey: "welcome", Status: ProgressActive}},
+	}
+	dispatcher := &advanceDispatcher{repository: repo, err: errors.New("stream is down")}
+	processed, err := createAdvanceService(repo, dispatcher).Advance(10)
+	if err != nil || processed != 0 {
+		t.Fatalf("we got %d, %v but expected 0 processed devices without an error", processed, err)
+	}
+	if len(dispatcher.persisted) != 1 || dispatcher.persisted[0] != 1 {
+		t.Fatalf("notification has been dispatched before the progress was saved")
+	}
+	if repo.updates[0].StepKey != "end" {
+		t.Fatalf("we got step %s but expected the device to be past the notification", repo.updates[0].StepKey)
+	}
+}
+
+func TestValidateRejectsUnknownRelations(t *testing.T) {
+	model := JourneyModel{
+		Trigger: TriggerModel{Type: TriggerDeviceRegistered},
+		Steps: []StepModel{
+			{Key: "check", Type: StepBranch, Conditions: []ConditionModel{{Key: "plan", Relation: RelationEqual, Value: "pro"}}},
+		},
+	}
+	if err := validate(model); err != nil {
+		t.Fatalf("valid journey has been rejected: %v", err)
+	}
+
+	branch := model
+	branch.Steps = []StepModel{{Key: "check", Type: StepBranch, Conditions: []ConditionModel{{Key: "plan", Relation: ">"}}}}
+	if err := validate(branch); !errors.Is(err, ErrInvalidRelation) {
+		t.Fatalf("we got %v but expected an invalid relation error for the branch condition", err)
+	}
+
+	exit := model
+	exit.ExitRules = []ConditionModel{{Key: "plan", Relation: "equals"}}
+	if err := validate(exit); !errors.Is(err, ErrInvalidRelation) {
+		t.Fatalf("we got %v but expected an invalid relation error for the exit rule", err)
+	}
+}
+
+func TestValidateRejectsDuplicateStepKeys(t *testing.T) {
+	model := JourneyModel{
+		Trigger: TriggerModel{Type: TriggerDeviceRegistered},
+		Steps: []StepModel{
+			{Key: "wait", Type: StepWait, WaitSeconds: 60, Next: "end"},
+			{Key: "end", Type: StepExit},
+			{Key: "wait", Type: StepExit},
+		},
+	}
+	if err := validate(model); !errors.Is(err, ErrInvalidJourney) {
+		t.Fatalf("we got %v but expected an invalid journey error for the duplicate step key", err)
+	}
+}
@@ -0,0 +1,18 @@
+package organizations
+
+import "time"
+
+// Config holds the settings of organizations, InvitationTTL is in seconds. InvitationURL is the web panel page
+// invitation links point to, the token is added as the token query parameter
+type Config struct {
+	InvitationTTL int    `yaml:"INVITATION_TTL" envconfig:"ORGANIZATIONS_INVITATION_TTL"`
+	InvitationURL string `yaml:"INVITATION_URL" envconfig:"ORGANIZATIONS_INVITATION_URL"`
+}
+
+// GetInvitationTTL returns how long an invitation can be accepted after it has been sent
+func (c Config) GetInvitationTTL() time.Duration {
+	if c.InvitationTTL <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.InvitationTTL) * time.Second
+}
@@ -0,0 +1,52 @@
+package organizations
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"time"
+)
+
+// OrganizationModel is a team of accounts sharing applications, Role is the role of the account it has been got for
+type OrganizationModel struct {
+	ID        uint              `json:"-"`
+	UUID      string            `json:"uuid"`
+	Name      string            `json:"name"`
+	Role      applications.Role `json:"role"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// MemberModel is an account of the organization, its role applies to all of the applications of the organization
+// unless the member has been given another role on an application
+type MemberModel struct {
+	ID             uint              `json:"-"`
+	UUID           string            `json:"uuid"`
+	OrganizationID uint              `json:"-"`
+	AccountID      uint              `json:"-"`
+	AccountUUID    string            `json:"account_uuid"`
+	Email          string            `json:"email"`
+	Role           applications.Role `json:"role"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// InvitationModel is an invitation emailed to join the organization, only the hash of its token is stored
+type InvitationModel struct {
+	ID             uint              `json:"-"`
+	UUID           string            `json:"uuid"`
+	OrganizationID uint              `json:"-"`
+	Email          string            `json:"email"`
+	Role           applications.Role `json:"role"`
+	TokenHash      string            `json:"-"`
+	InvitedByID    uint              `json:"-"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// ApplicationMemberModel is the role a member of the organization has been given on one of its applications
+type ApplicationMemberModel struct {
+	MemberUUID  string            `json:"member_uuid"`
+	AccountID   uint              `json:"-"`
+	AccountUUID string            `json:"account_uuid"`
+	Email       string            `json:"email"`
+	Role        applications.Role `json:"role"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
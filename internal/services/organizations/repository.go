@@ -0,0 +1,39 @@
+package organizations
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/authentication"
+)
+
+type Repository interface {
+	applications.Authorizer
+	GetAccountByID(ID uint) (*authentication.AccountModel, error)
+
+	// CreateOrganization creates the organization with the account as its owner
+	CreateOrganization(model OrganizationModel, ownerID uint) (*OrganizationModel, error)
+	GetAccountOrganizations(accountID uint) ([]*OrganizationModel, error)
+	// GetAccountOrganization returns not found when the account is not a member of the organization
+	GetAccountOrganization(accountID uint, UUID string) (*OrganizationModel, error)
+
+	GetMembers(organizationID uint) ([]*MemberModel, error)
+	GetMember(organizationID uint, UUID string) (*MemberModel, error)
+	CountOwners(organizationID uint) (int64, error)
+	UpdateMemberRole(ID uint, role applications.Role) error
+	// DeleteMember removes the member with the roles it has been given on the applications of the organization
+	DeleteMember(ID uint) error
+
+	// SaveInvitation creates the invitation, it replaces the pending invitation of the email to the organization
+	SaveInvitation(model InvitationModel) (*InvitationModel, error)
+	GetInvitations(organizationID uint) ([]*InvitationModel, error)
+	GetInvitationByTokenHash(tokenHash string) (*InvitationModel, error)
+	DeleteInvitation(organizationID uint, UUID string) error
+	// AcceptInvitation adds the account to the organization with the role of the invitation and removes the invitation,
+	// it returns the organization or conflict when the account is already a member
+	AcceptInvitation(invitation InvitationModel, accountID uint) (*OrganizationModel, error)
+
+	// MoveApplication makes the application part of the organization, the roles given on it are removed
+	MoveApplication(applicationID uint, organizationID uint) error
+	GetApplicationMembers(applicationID uint) ([]*ApplicationMemberModel, error)
+	SetApplicationRole(applicationID uint, accountID uint, role applications.Role) error
+	DeleteApplicationRole(applicationID uint, accountID uint) error
+}
@@ -0,0 +1,365 @@
+package organizations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/mailer"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tokenLength is the length of invitation tokens
+const tokenLength = 64
+
+var (
+	ErrInvalidRole           = errors.New("role is invalid")
+	ErrNotAllowed            = errors.New("your role in the organization does not allow this action")
+	ErrOwnerRequired         = errors.New("only owners can give, change or take the owner role")
+	ErrLastOwner             = errors.New("organization must keep at least one owner")
+	ErrAlreadyMember         = errors.New("account is already a member of the organization")
+	ErrInvalidInvitation     = errors.New("invitation is invalid")
+	ErrInvitationExpired     = errors.New("invitation has been expired")
+	ErrInvitationEmail       = errors.New("invitation has been sent to another email")
+	ErrUnconfirmedAccount    = errors.New("email of the account has to be confirmed to accept invitations")
+	ErrPersonalApplication   = errors.New("roles can only be given on the applications of organizations")
+	ErrAlreadyInOrganization = errors.New("application is already part of the organization")
+)
+
+type Service interface {
+	Create(accountID uint, name string) (*OrganizationModel, error)
+	List(accountID uint) ([]*OrganizationModel, error)
+	Details(accountID uint, UUID string) (*OrganizationModel, error)
+
+	ListMembers(accountID uint, oUUID string) ([]*MemberModel, error)
+	UpdateMember(accountID uint, oUUID string, mUUID string, role applications.Role) (*MemberModel, error)
+	RemoveMember(accountID uint, oUUID string, mUUID string) error
+
+	Invite(accountID uint, oUUID string, email string, role applications.Role) (*InvitationModel, error)
+	ListInvitations(accountID uint, oUUID string) ([]*InvitationModel, error)
+	RevokeInvitation(accountID uint, oUUID string, iUUID string) error
+	AcceptInvitation(accountID uint, token string) (*OrganizationModel, error)
+
+	MoveApplication(accountID uint, oUUID string, aUUID string) error
+	ListApplicationMembers(accountID uint, aUUID string) ([]*ApplicationMemberModel, error)
+	SetApplicationRole(accountID uint, aUUID string, mUUID string, role applications.Role) error
+	RemoveApplicationRole(accountID uint, aUUID string, mUUID string) error
+}
+
+type service struct {
+	repository Repository
+	mailer     mailer.Service
+	config     Config
+	basePath   string
+}
+
+func CreateService(r Repository, mailer mailer.Service, config Config, basePath string) Service {
+	return &service{
+		repository: r,
+		mailer:     mailer,
+		config:     config,
+		basePath:   basePath,
+	}
+}
+
+// Create creates a new organization with the account as its owner
+func (s service) Create(accountID uint, name string) (*OrganizationModel, error) {
+	return s.repository.CreateOrganization(OrganizationModel{Name: name}, accountID)
+}
+
+func (s service) List(accountID uint) ([]*OrganizationModel, error) {
+	res, err := s.repository.GetAccountOrganizations(accountID)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s service) Details(accountID uint, UUID string) (*OrganizationModel, error) {
+	return s.repository.GetAccountOrganization(accountID, UUID)
+}
+
+func (s service) ListMembers(accountID uint, oUUID string) ([]*MemberModel, error) {
+	org, err := s.repository.GetAccountOrganization(accountID, oUUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetMembers(org.ID)
+}
+
+// UpdateMember changes the role of the member in the organization, owners and admins can change the roles
+// but only owners can give or take the owner role
+func (s service) UpdateMember(accountID uint, oUUID string, mUUID string, role applications.Role) (*MemberModel, error) {
+	if !role.IsValid() {
+		return nil, errors.WithKindCtx(ErrInvalidRole, string(role), errors.BadRequest, nil)
+	}
+	org, err := s.managedOrganization(accountID, oUUID)
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.repository.GetMember(org.ID, mUUID)
+	if err != nil {
+		return nil, err
+	}
+	if (role == applications.RoleOwner || member.Role == applications.RoleOwner) && org.Role != applications.RoleOwner {
+		return nil, errors.WithKindCtx(ErrOwnerRequired, "", errors.Forbidden, nil)
+	}
+	if member.Role == applications.RoleOwner && role != applications.RoleOwner {
+		if err = s.checkOtherOwners(org.ID); err != nil {
+			return nil, err
+		}
+	}
+	err = s.repository.UpdateMemberRole(member.ID, role)
+	if err != nil {
+		return nil, err
+	}
+	member.Role = role
+	return member, nil
+}
+
+// RemoveMember removes the member from the organization, members can always leave the organization themselves
+// unless they are its last owner
+func (s service) RemoveMember(accountID uint, oUUID string, mUUID string) error {
+	org, err := s.repository.GetAccountOrganization(accountID, oUUID)
+	if err != nil {
+		return err
+	}
+	member, err := s.repository.GetMember(org.ID, mUUID)
+	if err != nil {
+		return err
+	}
+	if member.AccountID != accountID {
+		if !canManage(org.Role) {
+			return errors.WithKindCtx(ErrNotAllowed, "", errors.Forbidden, nil)
+		}
+		if member.Role == applications.RoleOwner && org.Role != applications.RoleOwner {
+			return errors.WithKindCtx(ErrOwnerRequired, "", errors.Forbidden, nil)
+		}
+	}
+	if member.Role == applications.RoleOwner {
+		if err = s.checkOtherOwners(org.ID); err != nil {
+			return err
+		}
+	}
+	return s.repository.DeleteMember(member.ID)
+}
+
+// Invite emails a single use link to join the organization with the role, inviting an email again replaces
+// its pending invitation
+func (s service) Invite(accountID uint, oUUID string, email string, role applications.Role) (*InvitationModel, error) {
+	if !role.IsValid() {
+		return nil, errors.WithKindCtx(ErrInvalidRole, string(role), errors.BadRequest, nil)
+	}
+	org, err := s.managedOrganization(accountID, oUUID)
+	if err != nil {
+		return nil, err
+	}
+	if role == applications.RoleOwner && org.Role != applications.RoleOwner {
+		return nil, errors.WithKindCtx(ErrOwnerRequired, "", errors.Forbidden, nil)
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	members, err := s.repository.GetMembers(org.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, email) {
+			return nil, errors.WithKindCtx(ErrAlreadyMember, "", errors.Conflict, nil)
+		}
+	}
+
+	token, err := utils.SecureRandomString(tokenLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate invitation token")
+	}
+	// Only the hash of the token is stored, so a leaked database can not be used to join the organizations
+	res, err := s.repository.SaveInvitation(InvitationModel{
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      hashToken(token),
+		InvitedByID:    accountID,
+		ExpiresAt:      time.Now().Add(s.config.GetInvitationTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.sendInvitationEmail(org, email, token)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s service) ListInvitations(accountID uint, oUUID string) ([]*InvitationModel, error) {
+	org, err := s.managedOrganization(accountID, oUUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetInvitations(org.ID)
+}
+
+func (s service) RevokeInvitation(accountID uint, oUUID string, iUUID string) error {
+	org, err := s.managedOrganization(accountID, oUUID)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteInvitation(org.ID, iUUID)
+}
+
+// AcceptInvitation adds the account to the organization of the invitation, the invitation can only be accepted by
+// the account with the confirmed email it has been sent to
+func (s service) AcceptInvitation(accountID uint, token string) (*OrganizationModel, error) {
+	invitation, err := s.repository.GetInvitationByTokenHash(hashToken(token))
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return nil, errors.WithKindCtx(ErrInvalidInvitation, "", errors.NotFound, nil)
+		}
+		return nil, err
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, errors.WithKindCtx(ErrInvitationExpired, "", errors.Gone, nil)
+	}
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(account.Email, invitation.Email) {
+		return nil, errors.WithKindCtx(ErrInvitationEmail, "", errors.Forbidden, nil)
+	}
+	if !account.Confirmed {
+		return nil, errors.WithKindCtx(ErrUnconfirmedAccount, "", errors.Forbidden, nil)
+	}
+
+	res, err := s.repository.AcceptInvitation(*invitation, accountID)
+	if err != nil {
+		if errors.HasKind(err, errors.Conflict) {
+			return nil, errors.WithKindCtx(ErrAlreadyMember, "", errors.Conflict, nil)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// MoveApplication makes the application part of the organization, the account has to be an owner of the application
+// and an owner or admin of the organization. Personal applications are moved into organizations this way
+func (s service) MoveApplication(accountID uint, oUUID string, aUUID string) error {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionDelete)
+	if err != nil {
+		return err
+	}
+	org, err := s.managedOrganization(accountID, oUUID)
+	if err != nil {
+		return err
+	}
+	if app.OrganizationID == org.ID {
+		return errors.WithKindCtx(ErrAlreadyInOrganization, "", errors.Conflict, nil)
+	}
+	return s.repository.MoveApplication(app.ID, org.ID)
+}
+
+// ListApplicationMembers lists the members which have been given a role on the application
+func (s service) ListApplicationMembers(accountID uint, aUUID string) ([]*ApplicationMemberModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	if app.OrganizationID == 0 {
+		return []*ApplicationMemberModel{}, nil
+	}
+	return s.repository.GetApplicationMembers(app.ID)
+}
+
+// SetApplicationRole gives the member of the organization a role on one of its applications which replaces the role
+// of the member in the organization on that application. Owners and admins of the organization keep their role
+func (s service) SetApplicationRole(accountID uint, aUUID string, mUUID string, role applications.Role) error {
+	if !role.IsValid() {
+		return errors.WithKindCtx(ErrInvalidRole, string(role), errors.BadRequest, nil)
+	}
+	app, member, err := s.applicationMember(accountID, aUUID, mUUID)
+	if err != nil {
+		return err
+	}
+	if role == applications.RoleOwner && app.Role != applications.RoleOwner {
+		return errors.WithKindCtx(ErrOwnerRequired, "", errors.Forbidden, nil)
+	}
+	return s.repository.SetApplicationRole(app.ID, member.AccountID, role)
+}
+
+// RemoveApplicationRole takes the role given on the application, the member gets its role in the organization back
+func (s service) RemoveApplicationRole(accountID uint, aUUID string, mUUID string) error {
+	app, member, err := s.applicationMember(accountID, aUUID, mUUID)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteApplicationRole(app.ID, member.AccountID)
+}
+
+// managedOrganization gets the organization when the account is one of its owners or admins
+func (s service) managedOrganization(accountID uint, UUID string) (*OrganizationModel, error) {
+	org, err := s.repository.GetAccountOrganization(accountID, UUID)
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(org.Role) {
+		return nil, errors.WithKindCtx(ErrNotAllowed, "", errors.Forbidden, nil)
+	}
+	return org, nil
+}
+
+// applicationMember gets the application the account can manage the members of and the member of its organization
+func (s service) applicationMember(accountID uint, aUUID string, mUUID string) (*applications.ApplicationModel, *MemberModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageMembers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if app.OrganizationID == 0 {
+		return nil, nil, errors.WithKindCtx(ErrPersonalApplication, "", errors.BadRequest, nil)
+	}
+	member, err := s.repository.GetMember(app.OrganizationID, mUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, member, nil
+}
+
+func (s service) checkOtherOwners(organizationID uint) error {
+	owners, err := s.repository.CountOwners(organizationID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return errors.WithKindCtx(ErrLastOwner, "", errors.Conflict, nil)
+	}
+	return nil
+}
+
+func (s service) sendInvitationEmail(org *OrganizationModel, email string, token string) error {
+	inviteURL := s.config.InvitationURL
+	if inviteURL == "" {
+		inviteURL = fmt.Sprintf("%s/accept_invitation", s.basePath)
+	}
+	inviteURL = fmt.Sprintf("%s?token=%s", inviteURL, url.QueryEscape(token))
+	subject := fmt.Sprintf("Ratatoskr Invitation to %s", org.Name)
+	plainTextContent := fmt.Sprintf("You have been invited to join the %s organization on Ratatoskr, Please visit this link to accept the invitation: %s . The link expires in %s", org.Name, inviteURL, s.config.GetInvitationTTL())
+	htmlContent := fmt.Sprintf(`You have been invited to join the %[1]s organization on Ratatoskr <br> Please visit this <a href="%[2]s">link</a> to accept the invitation or copy this url and visit it using your browser <br> URL: %[2]s <br> The link expires in %[3]s`, org.Name, inviteURL, s.config.GetInvitationTTL())
+	return s.mailer.SendEmail(email, "", subject, plainTextContent, htmlContent)
+}
+
+// canManage reports whether the role in the organization allows managing its members and invitations
+func canManage(role applications.Role) bool {
+	return role == applications.RoleOwner || role == applications.RoleAdmin
+}
+
+// hashToken hashes the invitation token for storage, tokens are random so a plain sha256 is enough to look them up
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package privacy
+
+import "time"
+
+const (
+	minSigningKeyLength = 32
+	// maxBackoff is the longest wait between two tries of an erasure
+	maxBackoff = 6 * time.Hour
+)
+
+// Config holds the settings of data subject requests, LinkTTL, Retention and BackoffBase are in seconds. SigningKey
+// signs the download links of the exported personal data, it is required and must be at least minSigningKeyLength
+// characters. Failed erasures are retried until MaxAttempts
+type Config struct {
+	SigningKey  string `yaml:"SIGNING_KEY" envconfig:"PRIVACY_SIGNING_KEY"`
+	LinkTTL     int    `yaml:"LINK_TTL" envconfig:"PRIVACY_LINK_TTL"`
+	Retention   int    `yaml:"RETENTION" envconfig:"PRIVACY_RETENTION"`
+	MaxAttempts int    `yaml:"MAX_ATTEMPTS" envconfig:"PRIVACY_MAX_ATTEMPTS"`
+	BackoffBase int    `yaml:"BACKOFF_BASE" envconfig:"PRIVACY_BACKOFF_BASE"`
+}
+
+// GetLinkTTL returns how long a generated download link is valid
+func (c Config) GetLinkTTL() time.Duration {
+	if c.LinkTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.LinkTTL) * time.Second
+}
+
+// GetRetention returns how long the exported subject data is kept after the export is finished
+func (c Config) GetRetention() time.Duration {
+	if c.Retention <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.Retention) * time.Second
+}
+
+func (c Config) GetMaxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 10
+	}
+	return c.MaxAttempts
+}
+
+// GetBackoff returns the wait before the next try of an erasure which has failed attempts times, it is doubled
+// on every failure up to maxBackoff
+func (c Config) GetBackoff(attempts int) time.Duration {
+	base := time.Duration(c.BackoffBase) * time.Second
+	if base <= 0 {
+		base = time.Minute
+	}
+	backoff := base
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,173 @@
+package privacy
+
+import (
+	"time"
+)
+
+type RequestType string
+
+const (
+	// TypeExport collects all the data about the subject into a downloadable JSON document
+	TypeExport RequestType = "export"
+	// TypeErase permanently removes all the data about the subject
+	TypeErase RequestType = "erase"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusExpired   Status = "expired"
+)
+
+// SubjectModel identifies the data subject of a request, either an external user with all of its
+// devices or a single device
+type SubjectModel struct {
+	ExternalUserID string `json:"external_user_id,omitempty"`
+	DeviceUUID     string `json:"device_uuid,omitempty"`
+}
+
+// RequestModel is an asynchronous data subject request, requests are never removed and act as the audit
+// record of what has been done about the subject. The subject of completed erasures is only kept as SubjectHash.
+// ErasedDeviceUUIDs are the devices a failed erasure has removed from the database, their cached data is removed
+// by the next attempt
+type RequestModel struct {
+	ID                uint         `json:"-"`
+	UUID              string       `json:"uuid"`
+	ApplicationID     uint         `json:"-"`
+	ApplicationUUID   string       `json:"-"`
+	AccountID         uint         `json:"requested_by"`
+	Type              RequestType  `json:"type"`
+	Subject           SubjectModel `json:"subject"`
+	SubjectHash       string       `json:"subject_hash"`
+	Status            Status       `json:"status"`
+	Summary           SummaryModel `json:"summary"`
+	BlobKey           string       `json:"-"`
+	Size              int64        `json:"size"`
+	Error             string       `json:"error,omitempty"`
+	Attempts          int          `json:"attempts"`
+	ErasedDeviceUUIDs []string     `json:"-"`
+	DownloadURL       string       `json:"download_url,omitempty"`
+	ExpiresAt         *time.Time   `json:"expires_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	FinishedAt        *time.Time   `json:"finished_at,omitempty"`
+}
+
+// SummaryModel counts the records a request has exported or erased
+type SummaryModel struct {
+	Users     int64 `json:"users"`
+	Devices   int64 `json:"devices"`
+	Tags      int64 `json:"tags"`
+	Events    int64 `json:"events"`
+	Purchases int64 `json:"purchases"`
+	Journeys  int64 `json:"journeys"`
+	CacheKeys int64 `json:"cache_keys"`
+	// WebhookDeliveries counts the webhook deliveries about the devices, erasures count the queued deliveries and
+	// their logged attempts
+	WebhookDeliveries int64 `json:"webhook_deliveries"`
+}
+
+// ResultModel is the outcome of a processed request
+type ResultModel struct {
+	Status    Status
+	Summary   SummaryModel
+	Size      int64
+	Error     string
+	ExpiresAt time.Time
+}
+
+// add counts the records of another attempt of the request
+func (s *SummaryModel) add(other SummaryModel) {
+	s.Users += other.Users
+	s.Devices += other.Devices
+	s.Tags += other.Tags
+	s.Events += other.Events
+	s.Purchases += other.Purchases
+	s.Journeys += other.Journeys
+	s.CacheKeys += other.CacheKeys
+	s.WebhookDeliveries += other.WebhookDeliveries
+}
+
+// UserDataModel is the user level data of the subject
+type UserDataModel struct {
+	ExternalUserID string            `json:"external_user_id"`
+	Tags           map[string]string `json:"tags"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// DeviceDataModel is a device of the subject with everything stored about it
+type DeviceDataModel struct {
+	ID                uint                `json:"-"`
+	UUID              string              `json:"uuid"`
+	Identifier        string              `json:"identifier"`
+	DeviceType        string              `json:"device_type"`
+	ADID              string              `json:"adid"`
+	Language          string              `json:"language"`
+	Timezone          int                 `json:"timezone"`
+	AppVersion        string              `json:"app_version"`
+	DeviceVendor      string              `json:"device_vendor"`
+	DeviceModel       string              `json:"device_model"`
+	DeviceOS          string              `json:"device_os"`
+	DeviceOSVersion   string              `json:"device_os_version"`
+	SDK               string              `json:"sdk"`
+	SessionCount      int                 `json:"session_count"`
+	NotificationTypes int                 `json:"notification_types"`
+	Long              float32             `json:"long"`
+	Lat               float32             `json:"lat"`
+	Country           string              `json:"country"`
+	ExternalUserID    string              `json:"external_user_id"`
+	BadgeCount        int                 `json:"badge_count"`
+	AmountSpent       float32             `json:"amount_spent"`
+	TotalUsageTime    int64               `json:"total_usage_time"`
+	Tags              map[string]string   `json:"tags"`
+	Purchases         []PurchaseDataModel `json:"purchases"`
+	Journeys          []JourneyDataModel  `json:"journeys"`
+	WebhookDeliveries []WebhookDataModel  `json:"webhook_deliveries"`
+	CreatedAt         time.Time           `json:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at"`
+	LastActiveAt      *time.Time          `json:"last_active_at"`
+}
+
+type PurchaseDataModel struct {
+	SKU         string    `json:"sku"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	AmountSpent float64   `json:"amount_spent"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// JourneyDataModel is the progress of the device in a journey, it is the record of the notifications
+// the journey has sent to the device
+type JourneyDataModel struct {
+	JourneyUUID string    `json:"journey_uuid"`
+	JourneyName string    `json:"journey_name"`
+	StepKey     string    `json:"step_key"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDataModel is an event about the device which is queued for or has been delivered to a webhook of the
+// application, Payload is only kept until the event is delivered
+type WebhookDataModel struct {
+	DeliveryUUID string                 `json:"delivery_uuid"`
+	EventType    string                 `json:"event_type"`
+	Payload      map[string]interface{} `json:"payload,omitempty"`
+	Attempts     int                    `json:"attempts"`
+	Delivered    bool                   `json:"delivered"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+type EventDataModel struct {
+	ID             uint                   `json:"-"`
+	DeviceUUID     string                 `json:"device_uuid,omitempty"`
+	ExternalUserID string                 `json:"external_user_id,omitempty"`
+	Name           string                 `json:"name"`
+	Properties     map[string]interface{} `json:"properties"`
+	OccurredAt     time.Time              `json:"occurred_at"`
+}
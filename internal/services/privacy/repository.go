@@ -0,0 +1,36 @@
+package privacy
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"time"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	CreatePrivacyRequest(model RequestModel) (*RequestModel, error)
+	GetPrivacyRequests(applicationID uint) ([]*RequestModel, error)
+	GetPrivacyRequest(applicationID uint, UUID string) (*RequestModel, error)
+	GetPrivacyRequestByUUID(UUID string) (*RequestModel, error)
+	ClaimDuePrivacyRequest(lease time.Duration) (*RequestModel, error)
+	// FinishPrivacyRequest stores the result of the request, the subject is replaced by its hash for completed erasures
+	FinishPrivacyRequest(ID uint, result ResultModel) error
+	// RetryPrivacyRequest puts a failed erasure back to pending until nextRunAt with the devices it has already erased
+	RetryPrivacyRequest(ID uint, result ResultModel, erasedDeviceUUIDs []string, nextRunAt time.Time) error
+	GetExpiredPrivacyRequests(limit int) ([]*RequestModel, error)
+	ExpirePrivacyRequest(ID uint) error
+
+	// GetSubjectUser returns the user level data of the subject, NotFound when the subject has no user
+	GetSubjectUser(applicationID uint, subject SubjectModel) (*UserDataModel, error)
+	GetSubjectDevices(applicationID uint, subject SubjectModel) ([]*DeviceDataModel, error)
+	// GetSubjectEvents returns the next page of events of the subject with an id greater than lastID
+	GetSubjectEvents(applicationID uint, subject SubjectModel, lastID uint, limit int) ([]*EventDataModel, error)
+	// EraseSubject removes the user, devices, tags, events, purchases, journey progress and webhook deliveries of the
+	// subject in a single transaction and returns the UUIDs of the erased devices
+	EraseSubject(applicationID uint, subject SubjectModel) (*SummaryModel, []string, error)
+}
+
+// Cache removes the keys cached about the subject
+type Cache interface {
+	DeleteSubjectKeys(appUUID string, externalUserID string, deviceUUIDs []string) (int64, error)
+}
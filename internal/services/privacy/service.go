@@ -0,0 +1,332 @@
+package privacy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/blob"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"io"
+	"net/url"
+	"time"
+)
+
+const (
+	// requestLease is the time a claimed request is hidden from other workers while it is being processed
+	requestLease = 30 * time.Minute
+)
+
+var (
+	ErrInvalidType       = errors.New("request type is invalid")
+	ErrInvalidSubject    = errors.New("request subject is invalid")
+	ErrInvalidSignature  = errors.New("download link is invalid")
+	ErrExpiredLink       = errors.New("download link has been expired")
+	ErrExportUnavailable = errors.New("exported data is not available")
+	ErrWeakSigningKey    = errors.New("privacy signing key must be at least 32 characters")
+)
+
+type Service interface {
+	Create(accountID uint, aUUID string, requestType RequestType, subject SubjectModel) (*RequestModel, error)
+	List(accountID uint, aUUID string) ([]*RequestModel, error)
+	Details(accountID uint, aUUID string, rUUID string) (*RequestModel, error)
+	Download(rUUID string, expires int64, signature string) (*RequestModel, io.ReadCloser, error)
+
+	Process(batchSize int) (int, error)
+	Cleanup(limit int) (int, error)
+}
+
+type service struct {
+	repository Repository
+	cache      Cache
+	store      blob.Store
+	config     Config
+	basePath   string
+}
+
+// CreateService fails without a strong signing key, as the signed links download the personal data of the subjects
+func CreateService(r Repository, c Cache, s blob.Store, config Config, basePath string) (Service, error) {
+	if len(config.SigningKey) < minSigningKeyLength {
+		return nil, ErrWeakSigningKey
+	}
+	return &service{
+		repository: r,
+		cache:      c,
+		store:      s,
+		config:     config,
+		basePath:   basePath,
+	}, nil
+}
+
+func (s service) Create(accountID uint, aUUID string, requestType RequestType, subject SubjectModel) (*RequestModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManagePrivacy)
+	if err != nil {
+		return nil, err
+	}
+
+	if requestType != TypeExport && requestType != TypeErase {
+		return nil, errors.WithKindCtx(ErrInvalidType, "supported types are export and erase", errors.BadRequest, nil)
+	}
+	if (subject.ExternalUserID == "") == (subject.DeviceUUID == "") {
+		return nil, errors.WithKindCtx(ErrInvalidSubject, "exactly one of external_user_id and device_uuid is required", errors.BadRequest, nil)
+	}
+
+	model := RequestModel{
+		ApplicationID: app.ID,
+		AccountID:     accountID,
+		Type:          requestType,
+		Subject:       subject,
+		SubjectHash:   subjectHash(subject),
+		Status:        StatusPending,
+	}
+	if requestType == TypeExport {
+		name, err := utils.SecureRandomString(32)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate export name")
+		}
+		model.BlobKey = fmt.Sprintf("privacy/%d/%s.json", app.ID, name)
+	}
+	return s.repository.CreatePrivacyRequest(model)
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*RequestModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManagePrivacy)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repository.GetPrivacyRequests(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		s.sign(item)
+	}
+	return items, nil
+}
+
+func (s service) Details(accountID uint, aUUID string, rUUID string) (*RequestModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManagePrivacy)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.repository.GetPrivacyRequest(app.ID, rUUID)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(item)
+	return item, nil
+}
+
+// Download checks the signed link and opens the exported data, the caller has to close the reader
+func (s service) Download(rUUID string, expires int64, signature string) (*RequestModel, io.ReadCloser, error) {
+	if !utils.CheckHMACHash(signaturePayload(rUUID, expires), signature, s.config.SigningKey) {
+		return nil, nil, errors.WithKindCtx(ErrInvalidSignature, "", errors.Forbidden, nil)
+	}
+	if time.Now().Unix() > expires {
+		return nil, nil, errors.WithKindCtx(ErrExpiredLink, "", errors.Gone, nil)
+	}
+
+	item, err := s.repository.GetPrivacyRequestByUUID(rUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if item.Type != TypeExport || item.Status != StatusCompleted {
+		return nil, nil, errors.WithKindCtx(ErrExportUnavailable, string(item.Status), errors.Gone, nil)
+	}
+
+	file, err := s.store.Get(item.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, file, nil
+}
+
+// Process claims a single due request and either exports or erases the data of its subject.
+// It returns the number of devices of the subject
+func (s service) Process(batchSize int) (int, error) {
+	item, err := s.repository.ClaimDuePrivacyRequest(requestLease)
+	if err != nil {
+		if errors.HasKind(err, errors.NotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var result ResultModel
+	if item.Type == TypeErase {
+		var erased []string
+		result, erased, err = s.erase(item)
+		// Erasures are retried with a backoff, the personal data would stay around otherwise
+		if err != nil && item.Attempts+1 < s.config.GetMaxAttempts() {
+			result.Error = err.Error()
+			nextRunAt := time.Now().Add(s.config.GetBackoff(item.Attempts + 1))
+			if retryErr := s.repository.RetryPrivacyRequest(item.ID, result, erased, nextRunAt); retryErr != nil {
+				return 0, retryErr
+			}
+			return 0, errors.Wrapf(err, "privacy request %s will be retried", item.UUID)
+		}
+	} else {
+		result, err = s.export(item, batchSize)
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		if finishErr := s.repository.FinishPrivacyRequest(item.ID, result); finishErr != nil {
+			return 0, finishErr
+		}
+		return 0, errors.Wrapf(err, "privacy request %s has been failed", item.UUID)
+	}
+
+	result.Status = StatusCompleted
+	return int(result.Summary.Devices), s.repository.FinishPrivacyRequest(item.ID, result)
+}
+
+// Cleanup removes the exported data of the requests which have passed their retention and returns the number of them
+func (s service) Cleanup(limit int) (int, error) {
+	items, err := s.repository.GetExpiredPrivacyRequests(limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if err = s.store.Delete(item.BlobKey); err != nil {
+			return 0, err
+		}
+		if err = s.repository.ExpirePrivacyRequest(item.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// erase removes the subject from the database first, so a failing cache never leaves the subject in the database.
+// It returns the devices erased by this and the previous attempts, their cached data is removed again on retries
+func (s service) erase(item *RequestModel) (ResultModel, []string, error) {
+	// Records erased by the previous attempts are not found again, so their counts are kept
+	result := ResultModel{Summary: item.Summary}
+	summary, deviceUUIDs, err := s.repository.EraseSubject(item.ApplicationID, item.Subject)
+	if err != nil {
+		return result, item.ErasedDeviceUUIDs, err
+	}
+	result.Summary.add(*summary)
+	deviceUUIDs = append(deviceUUIDs, item.ErasedDeviceUUIDs...)
+
+	keys, err := s.cache.DeleteSubjectKeys(item.ApplicationUUID, item.Subject.ExternalUserID, deviceUUIDs)
+	if err != nil {
+		return result, deviceUUIDs, errors.Wrap(err, "failed to erase cached data")
+	}
+	result.Summary.CacheKeys += keys
+	return result, deviceUUIDs, nil
+}
+
+func (s service) export(item *RequestModel, batchSize int) (ResultModel, error) {
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	var summary SummaryModel
+	go func() {
+		var err error
+		summary, err = s.encode(item, batchSize, writer)
+		_ = writer.CloseWithError(err)
+		done <- err
+	}()
+
+	size, err := s.store.Put(item.BlobKey, reader)
+	// Unblocks the encoder when the store gave up before reading the whole stream
+	_ = reader.CloseWithError(err)
+	if encodeErr := <-done; encodeErr != nil {
+		err = encodeErr
+	}
+	if err != nil {
+		_ = s.store.Delete(item.BlobKey)
+		return ResultModel{}, err
+	}
+	return ResultModel{
+		Summary:   summary,
+		Size:      size,
+		ExpiresAt: time.Now().Add(s.config.GetRetention()),
+	}, nil
+}
+
+// encode writes the subject data as a single JSON document, events are written page by page as they may be many
+func (s service) encode(item *RequestModel, batchSize int, w io.Writer) (SummaryModel, error) {
+	summary := SummaryModel{}
+	doc := newDocumentWriter(w)
+
+	doc.Field("request", map[string]interface{}{
+		"uuid":         item.UUID,
+		"subject":      item.Subject,
+		"generated_at": time.Now().UTC(),
+	})
+
+	user, err := s.repository.GetSubjectUser(item.ApplicationID, item.Subject)
+	if err != nil && !errors.HasKind(err, errors.NotFound) {
+		return summary, err
+	}
+	if user != nil {
+		summary.Users = 1
+		summary.Tags += int64(len(user.Tags))
+	}
+	doc.Field("user", user)
+
+	devices, err := s.repository.GetSubjectDevices(item.ApplicationID, item.Subject)
+	if err != nil {
+		return summary, err
+	}
+	for _, d := range devices {
+		summary.Devices++
+		summary.Tags += int64(len(d.Tags))
+		summary.Purchases += int64(len(d.Purchases))
+		summary.Journeys += int64(len(d.Journeys))
+		summary.WebhookDeliveries += int64(len(d.WebhookDeliveries))
+	}
+	doc.Field("devices", devices)
+
+	doc.OpenList("events")
+	lastID := uint(0)
+	for {
+		items, err := s.repository.GetSubjectEvents(item.ApplicationID, item.Subject, lastID, batchSize)
+		if err != nil {
+			return summary, err
+		}
+		for _, e := range items {
+			doc.Item(e)
+			lastID = e.ID
+		}
+		summary.Events += int64(len(items))
+		if doc.Err() != nil {
+			return summary, doc.Err()
+		}
+		if len(items) < batchSize {
+			break
+		}
+	}
+	doc.CloseList()
+
+	return summary, doc.Close()
+}
+
+// sign adds a download link which expires after the configured link ttl to completed exports
+func (s service) sign(item *RequestModel) {
+	if item.Type != TypeExport || item.Status != StatusCompleted {
+		return
+	}
+	expires := time.Now().Add(s.config.GetLinkTTL()).Unix()
+	query := url.Values{}
+	query.Set("expires", fmt.Sprint(expires))
+	query.Set("signature", utils.GenerateHMACHash(signaturePayload(item.UUID, expires), s.config.SigningKey))
+	item.DownloadURL = fmt.Sprintf("%s/v1/privacy_requests/%s/download?%s", s.basePath, item.UUID, query.Encode())
+}
+
+func signaturePayload(rUUID string, expires int64) string {
+	return fmt.Sprintf("privacy:%s:%d", rUUID, expires)
+}
+
+// subjectHash identifies the subject in the audit record without keeping the identifier itself
+func subjectHash(subject SubjectModel) string {
+	value := "device:" + subject.DeviceUUID
+	if subject.ExternalUserID != "" {
+		value = "external_user_id:" + subject.ExternalUserID
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
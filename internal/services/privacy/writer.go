@@ -0,0 +1,84 @@
+package privacy
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// documentWriter writes a JSON object field by field, so lists can be streamed without holding them in memory.
+// The first error is kept and returned by Close
+type documentWriter struct {
+	w      io.Writer
+	err    error
+	fields int
+	items  int
+}
+
+func newDocumentWriter(w io.Writer) *documentWriter {
+	d := &documentWriter{w: w}
+	d.write([]byte("{"))
+	return d
+}
+
+// Field writes a complete field of the object
+func (d *documentWriter) Field(name string, value interface{}) {
+	d.key(name)
+	d.encode(value)
+}
+
+// OpenList starts a list field, its items are written by Item
+func (d *documentWriter) OpenList(name string) {
+	d.key(name)
+	d.items = 0
+	d.write([]byte("["))
+}
+
+func (d *documentWriter) Item(value interface{}) {
+	if d.items > 0 {
+		d.write([]byte(","))
+	}
+	d.items++
+	d.encode(value)
+}
+
+func (d *documentWriter) CloseList() {
+	d.write([]byte("]"))
+}
+
+// Err returns the first error the writer has run into
+func (d *documentWriter) Err() error {
+	return d.err
+}
+
+func (d *documentWriter) Close() error {
+	d.write([]byte("}\n"))
+	return d.err
+}
+
+func (d *documentWriter) key(name string) {
+	if d.fields > 0 {
+		d.write([]byte(","))
+	}
+	d.fields++
+	d.encode(name)
+	d.write([]byte(":"))
+}
+
+func (d *documentWriter) encode(value interface{}) {
+	if d.err != nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.write(data)
+}
+
+func (d *documentWriter) write(data []byte) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = d.w.Write(data)
+}
@@ -0,0 +1,37 @@
+package quotas
+
+import "github.com/subzerobo/ratatoskr/internal/services/authentication"
+
+// Config holds the limits of the plans, Applications are per account, Devices per application and
+// Notifications per account per month
+type Config struct {
+	FreeApplications  int64 `yaml:"FREE_APPLICATIONS" envconfig:"QUOTAS_FREE_APPLICATIONS"`
+	FreeDevices       int64 `yaml:"FREE_DEVICES" envconfig:"QUOTAS_FREE_DEVICES"`
+	FreeNotifications int64 `yaml:"FREE_NOTIFICATIONS" envconfig:"QUOTAS_FREE_NOTIFICATIONS"`
+	ProApplications   int64 `yaml:"PRO_APPLICATIONS" envconfig:"QUOTAS_PRO_APPLICATIONS"`
+	ProDevices        int64 `yaml:"PRO_DEVICES" envconfig:"QUOTAS_PRO_DEVICES"`
+	ProNotifications  int64 `yaml:"PRO_NOTIFICATIONS" envconfig:"QUOTAS_PRO_NOTIFICATIONS"`
+}
+
+// GetLimits returns the limits of the plan, accounts without a known plan get the limits of the free plan
+func (c Config) GetLimits(plan authentication.Plan) LimitsModel {
+	if plan == authentication.PlanPro {
+		return LimitsModel{
+			Applications:  valueOrDefault(c.ProApplications, 100),
+			Devices:       valueOrDefault(c.ProDevices, 1000000),
+			Notifications: valueOrDefault(c.ProNotifications, 5000000),
+		}
+	}
+	return LimitsModel{
+		Applications:  valueOrDefault(c.FreeApplications, 3),
+		Devices:       valueOrDefault(c.FreeDevices, 10000),
+		Notifications: valueOrDefault(c.FreeNotifications, 10000),
+	}
+}
+
+func valueOrDefault(value int64, def int64) int64 {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
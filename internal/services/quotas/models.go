@@ -0,0 +1,35 @@
+package quotas
+
+import "github.com/subzerobo/ratatoskr/internal/services/authentication"
+
+// LimitsModel holds the limits of a plan, Devices is per application and Notifications is per month
+type LimitsModel struct {
+	Applications  int64 `json:"applications"`
+	Devices       int64 `json:"devices"`
+	Notifications int64 `json:"notifications"`
+}
+
+// UsageModel is the consumption of an account in the current period against the limits of its plan,
+// Period is the month of the counters formatted as 2006-01
+type UsageModel struct {
+	Plan          authentication.Plan      `json:"plan"`
+	Period        string                   `json:"period"`
+	Limits        LimitsModel              `json:"limits"`
+	Applications  int64                    `json:"applications"`
+	Notifications int64                    `json:"notifications"`
+	Devices       []*ApplicationUsageModel `json:"devices"`
+}
+
+// ApplicationUsageModel is the number of devices of an application of the account
+type ApplicationUsageModel struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	Devices int64  `json:"devices"`
+}
+
+// CounterModel holds the metered usage of an account in a period
+type CounterModel struct {
+	AccountID     uint
+	Period        string
+	Notifications int64
+}
@@ -0,0 +1,18 @@
+package quotas
+
+import "github.com/subzerobo/ratatoskr/internal/services/authentication"
+
+type Repository interface {
+	GetAccountByID(ID uint) (*authentication.AccountModel, error)
+	// GetApplicationAccountID returns the account which has created the application, its plan applies to the application
+	GetApplicationAccountID(applicationID uint) (uint, error)
+	CountAccountApplications(accountID uint) (int64, error)
+	CountApplicationDevices(applicationID uint) (int64, error)
+	GetAccountApplicationsUsage(accountID uint) ([]*ApplicationUsageModel, error)
+
+	// GetCounter returns the counters of the account in the period, they are zero when nothing has been used yet
+	GetCounter(accountID uint, period string) (*CounterModel, error)
+	// IncrementNotifications adds count to the notifications of the account in the period only if they stay within
+	// the limit, it reports whether they have been added
+	IncrementNotifications(accountID uint, period string, count int64, limit int64) (bool, error)
+}
@@ -0,0 +1,126 @@
+package quotas
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"time"
+)
+
+var (
+	ErrApplicationsLimit  = errors.New("applications limit of the plan has been reached")
+	ErrDevicesLimit       = errors.New("devices limit of the plan has been reached")
+	ErrNotificationsLimit = errors.New("monthly notifications limit of the plan has been reached")
+)
+
+type Service interface {
+	CheckApplications(accountID uint) error
+	CheckDevices(applicationID uint) error
+	UseNotifications(applicationID uint, count int) error
+	Usage(accountID uint) (*UsageModel, error)
+}
+
+type service struct {
+	repository Repository
+	config     Config
+}
+
+func CreateService(r Repository, config Config) Service {
+	return &service{
+		repository: r,
+		config:     config,
+	}
+}
+
+// CheckApplications returns payment required when the account can not create another application
+func (s service) CheckApplications(accountID uint) error {
+	limits, err := s.accountLimits(accountID)
+	if err != nil {
+		return err
+	}
+	count, err := s.repository.CountAccountApplications(accountID)
+	if err != nil {
+		return err
+	}
+	if count >= limits.Applications {
+		return errors.WithKindCtx(ErrApplicationsLimit, "", errors.PaymentRequired, map[string]interface{}{"limit": limits.Applications})
+	}
+	return nil
+}
+
+// CheckDevices returns payment required when another device can not be registered to the application
+func (s service) CheckDevices(applicationID uint) error {
+	accountID, err := s.repository.GetApplicationAccountID(applicationID)
+	if err != nil {
+		return err
+	}
+	limits, err := s.accountLimits(accountID)
+	if err != nil {
+		return err
+	}
+	count, err := s.repository.CountApplicationDevices(applicationID)
+	if err != nil {
+		return err
+	}
+	if count >= limits.Devices {
+		return errors.WithKindCtx(ErrDevicesLimit, "", errors.PaymentRequired, map[string]interface{}{"limit": limits.Devices})
+	}
+	return nil
+}
+
+// UseNotifications counts the notifications sent by the application in the current month against the account,
+// nothing is counted and payment required is returned when they exceed the monthly limit
+func (s service) UseNotifications(applicationID uint, count int) error {
+	accountID, err := s.repository.GetApplicationAccountID(applicationID)
+	if err != nil {
+		return err
+	}
+	limits, err := s.accountLimits(accountID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.repository.IncrementNotifications(accountID, currentPeriod(), int64(count), limits.Notifications)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.WithKindCtx(ErrNotificationsLimit, "", errors.PaymentRequired, map[string]interface{}{"limit": limits.Notifications})
+	}
+	return nil
+}
+
+// Usage returns the consumption of the account in the current month
+func (s service) Usage(accountID uint) (*UsageModel, error) {
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	period := currentPeriod()
+	counter, err := s.repository.GetCounter(accountID, period)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.repository.GetAccountApplicationsUsage(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &UsageModel{
+		Plan:          account.Plan,
+		Period:        period,
+		Limits:        s.config.GetLimits(account.Plan),
+		Applications:  int64(len(devices)),
+		Notifications: counter.Notifications,
+		Devices:       devices,
+	}, nil
+}
+
+func (s service) accountLimits(accountID uint) (LimitsModel, error) {
+	account, err := s.repository.GetAccountByID(accountID)
+	if err != nil {
+		return LimitsModel{}, err
+	}
+	return s.config.GetLimits(account.Plan), nil
+}
+
+// currentPeriod returns the month the usage is counted in
+func currentPeriod() string {
+	return time.Now().UTC().Format("2006-01")
+}
@@ -0,0 +1,51 @@
+package segments
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"time"
+)
+
+type FilterField string
+
+const (
+	FieldTag   FilterField = "tag"
+	FieldEvent FilterField = "event"
+	// FieldAmountSpent is the total amount of purchases of the device in reporting currency
+	FieldAmountSpent FilterField = "amount_spent"
+)
+
+type Relation string
+
+const (
+	RelationEqual        Relation = "="
+	RelationNotEqual     Relation = "!="
+	RelationExists       Relation = "exists"
+	RelationNotExists    Relation = "not_exists"
+	RelationPerformed    Relation = "performed"
+	RelationNotPerformed Relation = "not_performed"
+	RelationGreater      Relation = ">"
+	RelationLess         Relation = "<"
+)
+
+type SegmentModel struct {
+	ID            uint          `json:"-"`
+	UUID          string        `json:"uuid"`
+	ApplicationID uint          `json:"-"`
+	Name          string        `json:"name"`
+	Filters       []FilterModel `json:"filters"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// FilterModel is a single condition of a segment, all filters of a segment must match a device.
+// Tag filters compare the tag Key with Value, event filters check whether the event named Key
+// has been performed in the last Days days and amount spent filters compare the total spent of the device with Value.
+// ValueType is the type tag values are compared as, it defaults to the type of the key in the tag keys schema
+type FilterModel struct {
+	Field     FilterField  `json:"field"`
+	Key       string       `json:"key,omitempty"`
+	Relation  Relation     `json:"relation"`
+	Value     string       `json:"value,omitempty"`
+	ValueType tags.TagType `json:"value_type,omitempty"`
+	Days      int          `json:"days,omitempty"`
+}
@@ -0,0 +1,18 @@
+package segments
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	CreateSegment(model SegmentModel) (*SegmentModel, error)
+	UpdateSegment(model SegmentModel) (*SegmentModel, error)
+	GetSegments(applicationID uint) ([]*SegmentModel, error)
+	GetSegment(applicationID uint, UUID string) (*SegmentModel, error)
+	DeleteSegment(applicationID uint, UUID string) error
+	CountSegmentDevices(applicationID uint, filters []FilterModel) (int64, error)
+	GetTagKeyTypes(applicationID uint) (map[string]tags.TagType, error)
+}
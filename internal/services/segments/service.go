@@ -0,0 +1,203 @@
+package segments
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"strconv"
+)
+
+var (
+	ErrInvalidFilter = errors.New("segment filter is invalid")
+)
+
+type Service interface {
+	Create(accountID uint, aUUID string, model SegmentModel) (*SegmentModel, error)
+	Update(accountID uint, aUUID string, model SegmentModel) (*SegmentModel, error)
+	List(accountID uint, aUUID string) ([]*SegmentModel, error)
+	Details(accountID uint, aUUID string, sUUID string) (*SegmentModel, error)
+	Delete(accountID uint, aUUID string, sUUID string) error
+	Size(accountID uint, aUUID string, sUUID string) (int64, error)
+}
+
+type service struct {
+	repository Repository
+}
+
+func CreateService(r Repository) Service {
+	return &service{
+		repository: r,
+	}
+}
+
+func (s service) Create(accountID uint, aUUID string, model SegmentModel) (*SegmentModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageSegments)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.resolveValueTypes(app.ID, model.Filters); err != nil {
+		return nil, err
+	}
+	if err = ValidateFilters(model.Filters); err != nil {
+		return nil, err
+	}
+
+	model.ApplicationID = app.ID
+	return s.repository.CreateSegment(model)
+}
+
+func (s service) Update(accountID uint, aUUID string, model SegmentModel) (*SegmentModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageSegments)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.resolveValueTypes(app.ID, model.Filters); err != nil {
+		return nil, err
+	}
+	if err = ValidateFilters(model.Filters); err != nil {
+		return nil, err
+	}
+
+	model.ApplicationID = app.ID
+	return s.repository.UpdateSegment(model)
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*SegmentModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetSegments(app.ID)
+}
+
+func (s service) Details(accountID uint, aUUID string, sUUID string) (*SegmentModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetSegment(app.ID, sUUID)
+}
+
+func (s service) Delete(accountID uint, aUUID string, sUUID string) error {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageSegments)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteSegment(app.ID, sUUID)
+}
+
+// Size returns the number of devices which are currently matching the segment
+func (s service) Size(accountID uint, aUUID string, sUUID string) (int64, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return 0, err
+	}
+	segment, err := s.repository.GetSegment(app.ID, sUUID)
+	if err != nil {
+		return 0, err
+	}
+	return s.repository.CountSegmentDevices(app.ID, segment.Filters)
+}
+
+// ValidateFilters checks the filters to be supported by the segment query builder
+func ValidateFilters(filters []FilterModel) error {
+	for i, f := range filters {
+		ctx := map[string]interface{}{"index": i}
+		if f.Key == "" && f.Field != FieldAmountSpent {
+			return errors.WithKindCtx(ErrInvalidFilter, "filter key is required", errors.UnprocessableEntity, ctx)
+		}
+		switch f.Field {
+		case FieldTag:
+			switch f.Relation {
+			case RelationExists, RelationNotExists:
+			case RelationEqual, RelationNotEqual:
+				if err := validateTagValue(f); err != nil {
+					return errors.WithKindCtx(ErrInvalidFilter, err.Error(), errors.UnprocessableEntity, ctx)
+				}
+			case RelationGreater, RelationLess:
+				if f.ValueType != tags.TypeNumber && f.ValueType != tags.TypeTime {
+					return errors.WithKindCtx(ErrInvalidFilter, "only number and time tags can be compared", errors.UnprocessableEntity, ctx)
+				}
+				if err := validateTagValue(f); err != nil {
+					return errors.WithKindCtx(ErrInvalidFilter, err.Error(), errors.UnprocessableEntity, ctx)
+				}
+			default:
+				return errors.WithKindCtx(ErrInvalidFilter, "unsupported tag relation", errors.UnprocessableEntity, ctx)
+			}
+		case FieldEvent:
+			switch f.Relation {
+			case RelationPerformed, RelationNotPerformed:
+			default:
+				return errors.WithKindCtx(ErrInvalidFilter, "unsupported event relation", errors.UnprocessableEntity, ctx)
+			}
+			if f.Days <= 0 {
+				return errors.WithKindCtx(ErrInvalidFilter, "event filter needs a positive number of days", errors.UnprocessableEntity, ctx)
+			}
+		case FieldAmountSpent:
+			switch f.Relation {
+			case RelationEqual, RelationNotEqual, RelationGreater, RelationLess:
+			default:
+				return errors.WithKindCtx(ErrInvalidFilter, "unsupported amount spent relation", errors.UnprocessableEntity, ctx)
+			}
+			if _, err := strconv.ParseFloat(f.Value, 64); err != nil {
+				return errors.WithKindCtx(ErrInvalidFilter, "amount spent filter needs a numeric value", errors.UnprocessableEntity, ctx)
+			}
+		default:
+			return errors.WithKindCtx(ErrInvalidFilter, "unsupported filter field", errors.UnprocessableEntity, ctx)
+		}
+	}
+	return nil
+}
+
+// validateTagValue checks the value of a tag filter to be of its value type
+func validateTagValue(f FilterModel) error {
+	switch f.ValueType {
+	case "", tags.TypeString:
+		return nil
+	case tags.TypeNumber:
+		if _, ok := tags.ParseNumber(f.Value); !ok {
+			return errors.New("tag filter needs a numeric value")
+		}
+	case tags.TypeBoolean:
+		if _, ok := tags.ParseBool(f.Value); !ok {
+			return errors.New("tag filter needs a boolean value")
+		}
+	case tags.TypeTime:
+		if _, ok := tags.ParseTime(f.Value); !ok {
+			return errors.New("tag filter needs a RFC3339 timestamp or date value")
+		}
+	default:
+		return errors.New("unsupported tag value type")
+	}
+	return nil
+}
+
+// resolveValueTypes sets the value type of the tag filters without one to the type of their key in the
+// tag keys schema, greater and less comparisons of unknown keys use the type of the filter value
+func (s service) resolveValueTypes(applicationID uint, filters []FilterModel) error {
+	var types map[string]tags.TagType
+	for i, f := range filters {
+		if f.Field != FieldTag || f.ValueType != "" || f.Relation == RelationExists || f.Relation == RelationNotExists {
+			continue
+		}
+		if types == nil {
+			var err error
+			if types, err = s.repository.GetTagKeyTypes(applicationID); err != nil {
+				return err
+			}
+		}
+		typed := f
+		typed.ValueType = types[f.Key]
+		compare := f.Relation == RelationGreater || f.Relation == RelationLess
+		switch {
+		case typed.ValueType != "" && (compare || validateTagValue(typed) == nil):
+			// Equality of values which are not of the key type falls back to plain text comparison
+			filters[i].ValueType = typed.ValueType
+		case compare:
+			filters[i].ValueType = tags.Infer(f.Value)
+		}
+	}
+	return nil
+}
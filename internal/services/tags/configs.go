@@ -0,0 +1,29 @@
+package tags
+
+// Config holds the default tag limits of applications without their own limits
+type Config struct {
+	MaxKeys          int      `yaml:"MAX_KEYS" envconfig:"TAGS_MAX_KEYS"`
+	MaxValueLength   int      `yaml:"MAX_VALUE_LENGTH" envconfig:"TAGS_MAX_VALUE_LENGTH"`
+	KeyPattern       string   `yaml:"KEY_PATTERN" envconfig:"TAGS_KEY_PATTERN"`
+	ReservedPrefixes []string `yaml:"RESERVED_PREFIXES" envconfig:"TAGS_RESERVED_PREFIXES"`
+}
+
+// GetLimits returns the default tag limits
+func (c Config) GetLimits() LimitsModel {
+	limits := LimitsModel{
+		MaxKeys:          c.MaxKeys,
+		MaxValueLength:   c.MaxValueLength,
+		KeyPattern:       c.KeyPattern,
+		ReservedPrefixes: c.ReservedPrefixes,
+	}
+	if limits.MaxKeys <= 0 {
+		limits.MaxKeys = 100
+	}
+	if limits.MaxValueLength <= 0 || limits.MaxValueLength > MaxValueSize {
+		limits.MaxValueLength = MaxValueSize
+	}
+	if limits.ReservedPrefixes == nil {
+		limits.ReservedPrefixes = []string{}
+	}
+	return limits
+}
@@ -0,0 +1,98 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// limitsCacheTTL is how long the limits of an application are cached, changed limits apply after it at the latest
+const limitsCacheTTL = time.Minute
+
+type compiledLimits struct {
+	LimitsModel
+	pattern *regexp.Regexp
+	// types are the declared types of the tag keys of the application
+	types   map[string]TagType
+	expires time.Time
+}
+
+func compileLimits(model LimitsModel) (*compiledLimits, error) {
+	limits := &compiledLimits{LimitsModel: model, expires: time.Now().Add(limitsCacheTTL)}
+	if model.KeyPattern != "" {
+		pattern, err := regexp.Compile(model.KeyPattern)
+		if err != nil {
+			return nil, err
+		}
+		limits.pattern = pattern
+	}
+	return limits, nil
+}
+
+// check returns the reason of rejecting each of the rejected tags, existing are the keys the device already has.
+// Tags with empty value are removals and only their key is checked
+func (l compiledLimits) check(values map[string]string, existing []string) map[string]string {
+	rejected := make(map[string]string)
+	for k, v := range values {
+		if reason := l.checkKey(k); reason != "" {
+			rejected[k] = reason
+			continue
+		}
+		if len(v) > l.MaxValueLength {
+			rejected[k] = fmt.Sprintf("value is longer than %d characters", l.MaxValueLength)
+		} else if t, ok := l.types[k]; ok && v != "" && !t.Matches(v) {
+			rejected[k] = fmt.Sprintf("value must be a %s", t)
+		}
+	}
+
+	keys := make(map[string]bool, len(existing)+len(values))
+	for _, k := range existing {
+		keys[k] = true
+	}
+	var added []string
+	for k, v := range values {
+		if _, ok := rejected[k]; ok {
+			continue
+		}
+		if v == "" {
+			delete(keys, k)
+		} else if !keys[k] {
+			keys[k] = true
+			added = append(added, k)
+		}
+	}
+	// Devices which are already over the limit can still change or remove their tags
+	if len(keys) > l.MaxKeys && len(added) > 0 {
+		for _, k := range added {
+			rejected[k] = fmt.Sprintf("device can not have more than %d tags", l.MaxKeys)
+		}
+	}
+	return rejected
+}
+
+func (l compiledLimits) checkKey(key string) string {
+	if key == "" || len(key) > MaxKeySize {
+		return fmt.Sprintf("key must have 1 to %d characters", MaxKeySize)
+	}
+	for _, prefix := range l.ReservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return fmt.Sprintf("key prefix %q is reserved", prefix)
+		}
+	}
+	if l.pattern != nil && !l.pattern.MatchString(key) {
+		return fmt.Sprintf("key does not match %s", l.KeyPattern)
+	}
+	return ""
+}
+
+// rejectionList formats the rejected tags as "key: reason" sorted by key
+func rejectionList(rejected map[string]string) []string {
+	list := make([]string, 0, len(rejected))
+	for k, reason := range rejected {
+		list = append(list, fmt.Sprintf("%s: %s", k, reason))
+	}
+	sort.Strings(list)
+	return list
+}
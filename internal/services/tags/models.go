@@ -0,0 +1,38 @@
+package tags
+
+import (
+	"time"
+)
+
+type TagType string
+
+const (
+	TypeString  TagType = "string"
+	TypeNumber  TagType = "number"
+	TypeBoolean TagType = "boolean"
+	TypeTime    TagType = "time"
+)
+
+// TagKeyModel is the schema of a tag key of an application alongside with its usage, the type of
+// undeclared keys is inferred from the first value written to the key
+type TagKeyModel struct {
+	ApplicationID  uint      `json:"-"`
+	Key            string    `json:"key"`
+	Type           TagType   `json:"type"`
+	Declared       bool      `json:"declared"`
+	Devices        int64     `json:"devices"`
+	DistinctValues int64     `json:"distinct_values"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LimitsModel restricts the tags devices of an application can have. MaxKeys is the number of tags per device,
+// KeyPattern is a regular expression keys have to match when it is set and keys starting with a reserved
+// prefix can not be written by devices
+type LimitsModel struct {
+	MaxKeys          int      `json:"max_keys"`
+	MaxValueLength   int      `json:"max_value_length"`
+	KeyPattern       string   `json:"key_pattern"`
+	ReservedPrefixes []string `json:"reserved_prefixes"`
+	Default          bool     `json:"default"`
+}
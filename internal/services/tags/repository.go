@@ -0,0 +1,17 @@
+package tags
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	GetTagKeys(applicationID uint) ([]*TagKeyModel, error)
+	// GetDeclaredTagKeyTypes returns the types of the declared tag keys of the application by their key
+	GetDeclaredTagKeyTypes(applicationID uint) (map[string]TagType, error)
+	DeclareTagKey(applicationID uint, key string, tagType TagType) (*TagKeyModel, error)
+	UndeclareTagKey(applicationID uint, key string) error
+	GetTagLimits(applicationID uint) (*LimitsModel, error)
+	SaveTagLimits(applicationID uint, model LimitsModel) (*LimitsModel, error)
+}
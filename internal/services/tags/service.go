@@ -0,0 +1,182 @@
+package tags
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MaxKeySize   = 255
+	MaxValueSize = 255
+	// maxKeysLimit is the highest number of tags per device an application can allow
+	maxKeysLimit = 1000
+)
+
+var (
+	ErrInvalidTagType  = errors.New("tag type is invalid")
+	ErrInvalidTagKey   = errors.New("tag key is invalid")
+	ErrInvalidLimits   = errors.New("tag limits are invalid")
+	ErrTagsRejected    = errors.New("tags are rejected")
+	ErrTagTypeMismatch = errors.New("tag value does not match the declared type")
+)
+
+type Service interface {
+	List(accountID uint, aUUID string) ([]*TagKeyModel, error)
+	Declare(accountID uint, aUUID string, key string, tagType TagType) (*TagKeyModel, error)
+	Undeclare(accountID uint, aUUID string, key string) error
+	GetLimits(accountID uint, aUUID string) (*LimitsModel, error)
+	UpdateLimits(accountID uint, aUUID string, model LimitsModel) (*LimitsModel, error)
+
+	ValidateTags(applicationID uint, values map[string]string, existing []string) error
+}
+
+type service struct {
+	repository Repository
+	config     Config
+	// limits caches the compiled limits of applications by their id
+	limits *sync.Map
+}
+
+func CreateService(r Repository, config Config) Service {
+	return &service{
+		repository: r,
+		config:     config,
+		limits:     &sync.Map{},
+	}
+}
+
+// List returns the tag keys schema of the application with the number of devices and distinct values of each key
+func (s service) List(accountID uint, aUUID string) ([]*TagKeyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetTagKeys(app.ID)
+}
+
+// Declare fixes the type of the tag key, declared types are not changed by inference anymore
+func (s service) Declare(accountID uint, aUUID string, key string, tagType TagType) (*TagKeyModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionConfigure)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" || len(key) > MaxKeySize {
+		return nil, errors.WithKindCtx(ErrInvalidTagKey, key, errors.UnprocessableEntity, nil)
+	}
+	if !tagType.IsValid() {
+		return nil, errors.WithKindCtx(ErrInvalidTagType, string(tagType), errors.UnprocessableEntity, nil)
+	}
+	res, err := s.repository.DeclareTagKey(app.ID, key, tagType)
+	if err != nil {
+		return nil, err
+	}
+	s.limits.Delete(app.ID)
+	return res, nil
+}
+
+// Undeclare removes the declared type of the tag key, the key falls back to its inferred type
+func (s service) Undeclare(accountID uint, aUUID string, key string) error {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionConfigure)
+	if err != nil {
+		return err
+	}
+	if err = s.repository.UndeclareTagKey(app.ID, key); err != nil {
+		return err
+	}
+	s.limits.Delete(app.ID)
+	return nil
+}
+
+// GetLimits returns the tag limits of the application, the defaults are returned when it has none of its own
+func (s service) GetLimits(accountID uint, aUUID string) (*LimitsModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.getLimits(app.ID)
+}
+
+// UpdateLimits replaces the tag limits of the application, devices get the new limits within a minute
+func (s service) UpdateLimits(accountID uint, aUUID string, model LimitsModel) (*LimitsModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionConfigure)
+	if err != nil {
+		return nil, err
+	}
+
+	if model.MaxKeys < 1 || model.MaxKeys > maxKeysLimit {
+		return nil, errors.WithKindCtx(ErrInvalidLimits, "max_keys is out of range", errors.UnprocessableEntity, map[string]interface{}{"max": maxKeysLimit})
+	}
+	if model.MaxValueLength < 1 || model.MaxValueLength > MaxValueSize {
+		return nil, errors.WithKindCtx(ErrInvalidLimits, "max_value_length is out of range", errors.UnprocessableEntity, map[string]interface{}{"max": MaxValueSize})
+	}
+	if _, err = compileLimits(model); err != nil {
+		return nil, errors.WithKindCtx(ErrInvalidLimits, "key_pattern is not a valid regular expression", errors.UnprocessableEntity, nil)
+	}
+	prefixes := make([]string, 0, len(model.ReservedPrefixes))
+	for _, prefix := range model.ReservedPrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	model.ReservedPrefixes = prefixes
+
+	res, err := s.repository.SaveTagLimits(app.ID, model)
+	if err != nil {
+		return nil, err
+	}
+	s.limits.Delete(app.ID)
+	return res, nil
+}
+
+// ValidateTags checks the tags written to a device against the limits and declared tag types of the application, existing are the keys
+// the device already has. The error lists every rejected key with the reason of rejecting it
+func (s service) ValidateTags(applicationID uint, values map[string]string, existing []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	limits, err := s.getCompiledLimits(applicationID)
+	if err != nil {
+		return err
+	}
+	rejected := limits.check(values, existing)
+	if len(rejected) == 0 {
+		return nil
+	}
+	list := rejectionList(rejected)
+	return errors.WithKindCtx(ErrTagsRejected, strings.Join(list, "; "), errors.UnprocessableEntity, map[string]interface{}{"rejected": list})
+}
+
+func (s service) getLimits(applicationID uint) (*LimitsModel, error) {
+	res, err := s.repository.GetTagLimits(applicationID)
+	if err != nil {
+		if !errors.HasKind(err, errors.NotFound) {
+			return nil, err
+		}
+		limits := s.config.GetLimits()
+		limits.Default = true
+		return &limits, nil
+	}
+	return res, nil
+}
+
+func (s service) getCompiledLimits(applicationID uint) (*compiledLimits, error) {
+	if cached, ok := s.limits.Load(applicationID); ok && time.Now().Before(cached.(*compiledLimits).expires) {
+		return cached.(*compiledLimits), nil
+	}
+	model, err := s.getLimits(applicationID)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := compileLimits(*model)
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to compile tag key pattern", errors.InternalServerError, nil)
+	}
+	if limits.types, err = s.repository.GetDeclaredTagKeyTypes(applicationID); err != nil {
+		return nil, err
+	}
+	s.limits.Store(applicationID, limits)
+	return limits, nil
+}
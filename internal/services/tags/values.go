@@ -0,0 +1,91 @@
+package tags
+
+import (
+	"fmt"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the accepted formats of time tag values
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// IsValid checks the tag type to be a known one
+func (t TagType) IsValid() bool {
+	switch t {
+	case TypeString, TypeNumber, TypeBoolean, TypeTime:
+		return true
+	}
+	return false
+}
+
+// Matches checks the value to be of the type, every value is a string
+func (t TagType) Matches(value string) bool {
+	var ok bool
+	switch t {
+	case TypeNumber:
+		_, ok = ParseNumber(value)
+	case TypeBoolean:
+		_, ok = ParseBool(value)
+	case TypeTime:
+		_, ok = ParseTime(value)
+	default:
+		ok = true
+	}
+	return ok
+}
+
+// CheckType checks the value of the tag against the declared type of its key, keys without a declared
+// type accept any value and empty values are removals
+func CheckType(key string, value string, declared TagType) error {
+	if declared == "" || value == "" || declared.Matches(value) {
+		return nil
+	}
+	return errors.WithKindCtx(ErrTagTypeMismatch, fmt.Sprintf("%s must be a %s", key, declared), errors.UnprocessableEntity, map[string]interface{}{"key": key, "type": declared})
+}
+
+// Infer detects the type of a tag value
+func Infer(value string) TagType {
+	if _, ok := ParseNumber(value); ok {
+		return TypeNumber
+	}
+	if _, ok := ParseBool(value); ok {
+		return TypeBoolean
+	}
+	if _, ok := ParseTime(value); ok {
+		return TypeTime
+	}
+	return TypeString
+}
+
+// ParseNumber parses finite decimal numbers
+func ParseNumber(value string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// ParseBool parses true and false regardless of their case
+func ParseBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// ParseTime parses RFC3339 timestamps and dates
+func ParseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
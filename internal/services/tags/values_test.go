@@ -0,0 +1,91 @@
+package tags
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"testing"
+	"time"
+)
+
+func TestInfer(t *testing.T) {
+	values := map[string]TagType{
+		"42":                   TypeNumber,
+		"-1.5":                 TypeNumber,
+		" 7 ":                  TypeNumber,
+		"01234":                TypeNumber,
+		"TRUE":                 TypeBoolean,
+		"false":                TypeBoolean,
+		"2021-03-04":           TypeTime,
+		"2021-03-04T05:06:07Z": TypeTime,
+		"Inf":                  TypeString,
+		"NaN":                  TypeString,
+		"yes":                  TypeString,
+		"2021-13-01":           TypeString,
+	}
+	for value, expected := range values {
+		if res := Infer(value); res != expected {
+			t.Fatalf("we got %s for %q but expected %s", res, value, expected)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	if f, ok := ParseNumber(" 12.5 "); !ok || f != 12.5 {
+		t.Fatalf("we got %v, %v but expected 12.5, true", f, ok)
+	}
+	for _, value := range []string{"", "abc", "1e400", "Inf", "-Inf", "NaN", "1,5"} {
+		if _, ok := ParseNumber(value); ok {
+			t.Fatalf("%q has been parsed as a number", value)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	res, ok := ParseTime("2021-03-04T05:06:07.5+02:00")
+	expected := time.Date(2021, 3, 4, 3, 6, 7, 500000000, time.UTC)
+	if !ok || !res.Equal(expected) {
+		t.Fatalf("we got %v, %v but expected %v, true", res, ok, expected)
+	}
+	res, ok = ParseTime("2021-03-04")
+	if !ok || !res.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("we got %v, %v for a date", res, ok)
+	}
+	for _, value := range []string{"", "04/03/2021", "2021-03-04 05:06:07", "1614834367"} {
+		if _, ok = ParseTime(value); ok {
+			t.Fatalf("%q has been parsed as a time", value)
+		}
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	if err := CheckType("age", "abc", ""); err != nil {
+		t.Fatalf("undeclared key rejected a value: %v", err)
+	}
+	if err := CheckType("age", "", TypeNumber); err != nil {
+		t.Fatalf("removal of a declared key has been rejected: %v", err)
+	}
+	if err := CheckType("zip", "01234", TypeString); err != nil {
+		t.Fatalf("numeric value of a string key has been rejected: %v", err)
+	}
+	err := CheckType("age", "abc", TypeNumber)
+	if !errors.HasKind(err, errors.UnprocessableEntity) || !errors.Is(err, ErrTagTypeMismatch) {
+		t.Fatalf("we got %v but expected a type mismatch", err)
+	}
+	if err = CheckType("paid", "yes", TypeBoolean); err == nil {
+		t.Fatalf("non boolean value of a boolean key has been accepted")
+	}
+}
+
+func TestCheckRejectsMismatchingTypes(t *testing.T) {
+	limits, err := compileLimits(LimitsModel{MaxKeys: 10, MaxValueLength: 20})
+	if err != nil {
+		t.Fatalf("failed to compile limits: %v", err)
+	}
+	limits.types = map[string]TagType{"age": TypeNumber, "zip": TypeString}
+	rejected := limits.check(map[string]string{"age": "old", "zip": "01234", "name": "x"}, nil)
+	if len(rejected) != 1 || rejected["age"] != "value must be a number" {
+		t.Fatalf("we got %v but expected only age to be rejected", rejected)
+	}
+	if rejected = limits.check(map[string]string{"age": ""}, []string{"age"}); len(rejected) != 0 {
+		t.Fatalf("we got %v but expected the removal to be accepted", rejected)
+	}
+}
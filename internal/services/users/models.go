@@ -0,0 +1,34 @@
+package users
+
+import (
+	"time"
+)
+
+// UserModel is an external user of an application with the tags merged onto all of its devices
+type UserModel struct {
+	ID             uint              `json:"-"`
+	ApplicationID  uint              `json:"-"`
+	ExternalUserID string            `json:"external_user_id"`
+	Tags           map[string]string `json:"tags"`
+	Devices        []UserDeviceModel `json:"devices"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// UserDeviceModel is a device linked to an external user
+type UserDeviceModel struct {
+	UUID         string     `json:"uuid"`
+	DeviceType   string     `json:"device_type"`
+	DeviceModel  string     `json:"device_model"`
+	DeviceOS     string     `json:"device_os"`
+	AppVersion   string     `json:"app_version"`
+	LastActiveAt *time.Time `json:"last_active_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// LinkModel is the outcome of linking or unlinking a device, Tags are the user tags merged onto or removed from the device
+type LinkModel struct {
+	DeviceID       uint
+	ExternalUserID string
+	Tags           map[string]string
+}
@@ -0,0 +1,20 @@
+package users
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+)
+
+type Repository interface {
+	GetApplicationByUUID(uuid string) (*devices.DeviceApplicationModel, error)
+	applications.Authorizer
+
+	GetDeviceTagKeys(selector devices.DeviceSelectorModel) ([]devices.DeviceTagKeysModel, error)
+	// GetUserTags returns the user level tags of the external user, users without any tag have an empty map
+	GetUserTags(applicationID uint, externalUserID string) (map[string]string, error)
+	// LinkDevice links the device to the external user and merges the user tags onto the device
+	LinkDevice(applicationID uint, deviceUUID string, externalUserID string) (*LinkModel, error)
+	// UnlinkDevice removes the link of the device to its external user and the user tags from the device
+	UnlinkDevice(applicationID uint, deviceUUID string) (*LinkModel, error)
+	GetUser(applicationID uint, externalUserID string) (*UserModel, error)
+}
@@ -0,0 +1,144 @@
+package users
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+)
+
+var (
+	ErrInvalidExternalUserID = errors.New("external user id is invalid")
+)
+
+const (
+	MaxExternalUserIDSize = 255
+)
+
+type Service interface {
+	Login(AppUUID string, deviceUUID string, externalUserID string, externalUserIDHash string) (*UserModel, error)
+	Logout(AppUUID string, deviceUUID string) error
+	Get(AppUUID string, externalUserID string) (*UserModel, error)
+	Details(accountID uint, aUUID string, externalUserID string) (*UserModel, error)
+}
+
+type service struct {
+	repository Repository
+	validator  devices.TagValidator
+	verifier   devices.IdentityVerifier
+	listeners  []devices.Listener
+}
+
+func CreateService(r Repository, v devices.TagValidator, i devices.IdentityVerifier, listeners ...devices.Listener) Service {
+	return &service{
+		repository: r,
+		validator:  v,
+		verifier:   i,
+		listeners:  listeners,
+	}
+}
+
+// Login links the device to the external user, the device gets the tags of the user and the notifications
+// sent to the user from now on
+func (s service) Login(AppUUID string, deviceUUID string, externalUserID string, externalUserIDHash string) (*UserModel, error) {
+	if externalUserID == "" || len(externalUserID) > MaxExternalUserIDSize {
+		return nil, errors.WithKindCtx(ErrInvalidExternalUserID, "", errors.UnprocessableEntity, nil)
+	}
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.verifier.Verify(*app, externalUserID, externalUserIDHash, "login")
+	if err != nil {
+		return nil, err
+	}
+	if err = s.validateLink(app.ID, deviceUUID, externalUserID); err != nil {
+		return nil, err
+	}
+
+	link, err := s.repository.LinkDevice(app.ID, deviceUUID, externalUserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(link.Tags) > 0 {
+		err = s.notify(devices.DeviceEventModel{Type: devices.DeviceTagsChanged, DeviceID: link.DeviceID, ApplicationID: app.ID, Tags: link.Tags})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.repository.GetUser(app.ID, externalUserID)
+}
+
+// validateLink checks the user tags merged onto the device against the tag limits of the application, the tags of
+// the previous user of the device are removed from it in the same way as LinkDevice does
+func (s service) validateLink(applicationID uint, deviceUUID string, externalUserID string) error {
+	items, err := s.repository.GetDeviceTagKeys(devices.DeviceSelectorModel{ApplicationID: applicationID, UUID: deviceUUID})
+	if err != nil || len(items) == 0 {
+		// Unknown devices are reported by LinkDevice
+		return err
+	}
+	item := items[0]
+
+	tags := map[string]string{}
+	if item.ExternalUserID != "" && item.ExternalUserID != externalUserID {
+		previous, err := s.repository.GetUserTags(applicationID, item.ExternalUserID)
+		if err != nil {
+			return err
+		}
+		for k := range previous {
+			tags[k] = ""
+		}
+	}
+	current, err := s.repository.GetUserTags(applicationID, externalUserID)
+	if err != nil {
+		return err
+	}
+	for k, v := range current {
+		tags[k] = v
+	}
+	return s.validator.ValidateTags(applicationID, tags, item.Keys)
+}
+
+// Logout unlinks the device from its external user, the user tags are removed from the device
+func (s service) Logout(AppUUID string, deviceUUID string) error {
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return err
+	}
+
+	link, err := s.repository.UnlinkDevice(app.ID, deviceUUID)
+	if err != nil {
+		return err
+	}
+	if len(link.Tags) > 0 {
+		return s.notify(devices.DeviceEventModel{Type: devices.DeviceTagsChanged, DeviceID: link.DeviceID, ApplicationID: app.ID, Tags: link.Tags})
+	}
+	return nil
+}
+
+// Get returns the external user with its tags and linked devices
+func (s service) Get(AppUUID string, externalUserID string) (*UserModel, error) {
+	app, err := s.repository.GetApplicationByUUID(AppUUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetUser(app.ID, externalUserID)
+}
+
+// Details returns the external user of the user-owned application with its tags and linked devices
+func (s service) Details(accountID uint, aUUID string, externalUserID string) (*UserModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetUser(app.ID, externalUserID)
+}
+
+// notify delivers the event to all registered listeners
+func (s service) notify(event devices.DeviceEventModel) error {
+	for _, listener := range s.listeners {
+		if err := listener.OnDeviceEvent(event); err != nil {
+			return errors.Wrapf(err, "failed to deliver %s event of device %d", event.Type, event.DeviceID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package webhooks
+
+import "time"
+
+// maxBackoff is the longest wait between two tries of a delivery
+const maxBackoff = 6 * time.Hour
+
+// Config holds the delivery settings of webhooks, Timeout and BackoffBase are in seconds. A delivery is given up after
+// MaxAttempts, a webhook is paused after FailureThreshold failed attempts in a row and the last LogSize attempts of each
+// webhook are kept
+type Config struct {
+	Timeout          int `yaml:"TIMEOUT" envconfig:"WEBHOOKS_TIMEOUT"`
+	MaxAttempts      int `yaml:"MAX_ATTEMPTS" envconfig:"WEBHOOKS_MAX_ATTEMPTS"`
+	BackoffBase      int `yaml:"BACKOFF_BASE" envconfig:"WEBHOOKS_BACKOFF_BASE"`
+	FailureThreshold int `yaml:"FAILURE_THRESHOLD" envconfig:"WEBHOOKS_FAILURE_THRESHOLD"`
+	LogSize          int `yaml:"LOG_SIZE" envconfig:"WEBHOOKS_LOG_SIZE"`
+}
+
+func (c Config) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+func (c Config) GetMaxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 8
+	}
+	return c.MaxAttempts
+}
+
+// GetBackoff returns the wait before the next try of a delivery which has failed attempts times, it is doubled
+// on every failure up to maxBackoff
+func (c Config) GetBackoff(attempts int) time.Duration {
+	base := time.Duration(c.BackoffBase) * time.Second
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	backoff := base
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (c Config) GetFailureThreshold() int {
+	if c.FailureThreshold <= 0 {
+		return 25
+	}
+	return c.FailureThreshold
+}
+
+func (c Config) GetLogSize() int {
+	if c.LogSize <= 0 {
+		return 100
+	}
+	return c.LogSize
+}
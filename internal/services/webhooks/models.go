@@ -0,0 +1,99 @@
+package webhooks
+
+import "time"
+
+// EventType is an event of an application which can be delivered to webhooks
+type EventType string
+
+const (
+	EventDeviceRegistered   EventType = "device.registered"
+	EventDeviceUnsubscribed EventType = "device.unsubscribed"
+	EventNotificationOpened EventType = "notification.opened"
+)
+
+// EventTypes lists all of the events webhooks can subscribe to
+var EventTypes = []EventType{EventDeviceRegistered, EventDeviceUnsubscribed, EventNotificationOpened}
+
+// IsValid reports whether the event is one of the known events
+func (e EventType) IsValid() bool {
+	for _, t := range EventTypes {
+		if t == e {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookModel is an endpoint of an application which gets the events it has subscribed to. The secret signing
+// the deliveries is only returned when the webhook is created. Webhooks failing too many times in a row are paused
+// until they are activated again
+type WebhookModel struct {
+	ID                  uint        `json:"-"`
+	UUID                string      `json:"uuid"`
+	ApplicationID       uint        `json:"-"`
+	URL                 string      `json:"url"`
+	Secret              string      `json:"secret,omitempty"`
+	Events              []EventType `json:"events"`
+	Active              bool        `json:"active"`
+	Paused              bool        `json:"paused"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	PausedAt            *time.Time  `json:"paused_at"`
+	CreatedAt           time.Time   `json:"created_at"`
+	UpdatedAt           time.Time   `json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook gets the event
+func (w WebhookModel) Subscribes(event EventType) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryModel is an event waiting to be delivered to a webhook, Payload is the JSON body posted to it. DeviceID is
+// the device the event is about, so the deliveries can be erased with the data of the device
+type DeliveryModel struct {
+	ID            uint
+	UUID          string
+	WebhookID     uint
+	DeviceID      uint
+	EventType     EventType
+	Payload       string
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+// AttemptModel is a single try of delivering an event to a webhook, Error is set when no response has been received
+// and Duration is in milliseconds
+type AttemptModel struct {
+	ID           uint      `json:"-"`
+	WebhookID    uint      `json:"-"`
+	DeviceID     uint      `json:"-"`
+	DeliveryUUID string    `json:"delivery_uuid"`
+	EventType    EventType `json:"event_type"`
+	Attempt      int       `json:"attempt"`
+	Success      bool      `json:"success"`
+	StatusCode   int       `json:"status_code"`
+	Error        string    `json:"error,omitempty"`
+	Duration     int64     `json:"duration"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PayloadModel is the body posted to webhooks, ID is the same for the deliveries of an event to all of the webhooks
+type PayloadModel struct {
+	ID              string                 `json:"id"`
+	Type            EventType              `json:"type"`
+	ApplicationUUID string                 `json:"application_uuid"`
+	OccurredAt      time.Time              `json:"occurred_at"`
+	Data            map[string]interface{} `json:"data"`
+}
+
+// DeviceDataModel holds the fields of a device which are sent with its events
+type DeviceDataModel struct {
+	UUID           string
+	DeviceType     string
+	ExternalUserID string
+}
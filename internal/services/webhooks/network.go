@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// forbiddenNetworks are the ranges webhooks can not be delivered to, so application members can not reach the
+// internal network of the servers through them
+var forbiddenNetworks = parseNetworks(
+	"0.0.0.0/8",      // Unspecified
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"127.0.0.0/8",    // Loopback
+	"169.254.0.0/16", // Link-local, cloud metadata endpoints
+	"172.16.0.0/12",  // Private
+	"192.168.0.0/16", // Private
+	"::/128",         // Unspecified
+	"::1/128",        // Loopback
+	"fc00::/7",       // Unique local
+	"fe80::/10",      // Link-local
+)
+
+// lookupIP resolves the host names of webhooks
+var lookupIP = net.LookupIP
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+// isForbiddenIP reports whether the address is a loopback, link-local, private, unspecified or multicast address
+func isForbiddenIP(ip net.IP) bool {
+	if ip == nil || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range forbiddenNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost rejects the hosts which are or resolve to forbidden addresses
+func checkHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if isForbiddenIP(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	ips, err := lookupIP(host)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %s", host)
+	}
+	for _, ip := range ips {
+		if isForbiddenIP(ip) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// controlDial checks the address right before connecting, since host names may resolve to other addresses than
+// they did when the webhook was saved
+func controlDial(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if isForbiddenIP(net.ParseIP(host)) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// newClient creates the client delivering the webhooks. It never uses proxies, which would hide the dialed addresses,
+// and does not follow redirects, so the redirected responses are failed attempts
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: controlDial,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
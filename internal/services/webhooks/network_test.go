@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsForbiddenIP(t *testing.T) {
+	forbidden := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0",
+		"100.64.0.1", "::1", "::", "fd00::1", "fe80::1", "::ffff:127.0.0.1", "224.0.0.1"}
+	for _, item := range forbidden {
+		if !isForbiddenIP(net.ParseIP(item)) {
+			t.Fatalf("%s should be forbidden", item)
+		}
+	}
+	allowed := []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"}
+	for _, item := range allowed {
+		if isForbiddenIP(net.ParseIP(item)) {
+			t.Fatalf("%s should be allowed", item)
+		}
+	}
+}
+
+func TestValidateRejectsInternalHosts(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "internal.example.com" {
+			return []net.IP{net.ParseIP("10.0.0.5")}, nil
+		}
+		return []net.IP{net.ParseIP("93.184.216.34")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	events := []EventType{EventDeviceRegistered}
+	rejected := []string{"http://127.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "https://[::1]:8443/",
+		"https://internal.example.com/hook", "ftp://example.com/hook"}
+	for _, item := range rejected {
+		if err := validate(WebhookModel{URL: item, Events: events}); err == nil {
+			t.Fatalf("%s should be rejected", item)
+		}
+	}
+	if err := validate(WebhookModel{URL: "https://example.com/hook", Events: events}); err != nil {
+		t.Fatalf("public url rejected: %v", err)
+	}
+}
+
+func TestClientDoesNotDialInternalAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	_, err := newClient(Config{}.GetTimeout()).Get(srv.URL)
+	if err == nil || called {
+		t.Fatalf("client has reached the loopback server")
+	}
+}
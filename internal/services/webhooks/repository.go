@@ -0,0 +1,38 @@
+package webhooks
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"time"
+)
+
+type Repository interface {
+	applications.Authorizer
+
+	CreateWebhook(model WebhookModel) (*WebhookModel, error)
+	GetWebhooks(applicationID uint) ([]*WebhookModel, error)
+	GetWebhook(applicationID uint, UUID string) (*WebhookModel, error)
+	// GetWebhookByID returns the webhook with its secret
+	GetWebhookByID(ID uint) (*WebhookModel, error)
+	CountWebhooks(applicationID uint) (int64, error)
+	// UpdateWebhook stores the url, events, activation and failures of the webhook
+	UpdateWebhook(model WebhookModel) (*WebhookModel, error)
+	// DeleteWebhook removes the webhook with its pending deliveries and attempts
+	DeleteWebhook(applicationID uint, UUID string) error
+	// GetActiveWebhooks returns the webhooks of the application which are active and not paused
+	GetActiveWebhooks(applicationID uint) ([]*WebhookModel, error)
+	GetApplicationUUID(ID uint) (string, error)
+	GetDeviceData(deviceID uint) (*DeviceDataModel, error)
+
+	CreateDeliveries(items []DeliveryModel) error
+	// ClaimDueDeliveries hides the due deliveries of active webhooks from other workers for the lease
+	ClaimDueDeliveries(limit int, lease time.Duration) ([]*DeliveryModel, error)
+	RescheduleDelivery(ID uint, attempts int, nextAttemptAt time.Time) error
+	DeleteDelivery(ID uint) error
+	// CreateAttempt stores the attempt and only keeps the last keep attempts of the webhook
+	CreateAttempt(model AttemptModel, keep int) error
+	GetAttempts(webhookID uint, offset int, limit int) ([]*AttemptModel, error)
+	// RecordFailure counts a failed attempt of the webhook and pauses it once it has failed threshold times in a row,
+	// it reports whether the webhook is paused
+	RecordFailure(ID uint, threshold int) (bool, error)
+	ResetFailures(ID uint) error
+}
@@ -0,0 +1,401 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxWebhooks is the number of webhooks an application can have
+	MaxWebhooks = 10
+	// secretPrefix tells the webhook secrets apart from the other keys
+	secretPrefix = "whsec_"
+	secretLength = 32
+	// maxErrorLength limits the stored transport errors of the attempts
+	maxErrorLength = 1024
+
+	SignatureHeader = "X-Ratatoskr-Signature"
+	EventHeader     = "X-Ratatoskr-Event"
+	DeliveryHeader  = "X-Ratatoskr-Delivery"
+)
+
+var (
+	ErrInvalidWebhookURL = errors.New("webhook url is invalid")
+	ErrInvalidEventType  = errors.New("webhook event type is invalid")
+	ErrNoEventTypes      = errors.New("webhook needs at least one event type")
+	ErrTooManyWebhooks   = errors.New("application has reached the maximum number of webhooks")
+)
+
+type Service interface {
+	Create(accountID uint, aUUID string, model WebhookModel) (*WebhookModel, error)
+	Update(accountID uint, aUUID string, model WebhookModel) (*WebhookModel, error)
+	List(accountID uint, aUUID string) ([]*WebhookModel, error)
+	Details(accountID uint, aUUID string, wUUID string) (*WebhookModel, error)
+	Delete(accountID uint, aUUID string, wUUID string) error
+	Attempts(accountID uint, aUUID string, wUUID string, paging utils.Paging) ([]*AttemptModel, error)
+
+	OnDeviceEvent(event devices.DeviceEventModel) error
+	OnEvent(event events.EventModel) error
+	Deliver(limit int) (int, error)
+}
+
+type service struct {
+	repository Repository
+	config     Config
+	client     *http.Client
+}
+
+func CreateService(r Repository, config Config) Service {
+	return &service{
+		repository: r,
+		config:     config,
+		client:     newClient(config.GetTimeout()),
+	}
+}
+
+// Create adds the webhook to the application, the returned webhook holds the secret signing its deliveries
+func (s service) Create(accountID uint, aUUID string, model WebhookModel) (*WebhookModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	if err = validate(model); err != nil {
+		return nil, err
+	}
+
+	count, err := s.repository.CountWebhooks(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxWebhooks {
+		return nil, errors.WithKindCtx(ErrTooManyWebhooks, "", errors.UnprocessableEntity, map[string]interface{}{"max": MaxWebhooks})
+	}
+
+	secret, err := utils.SecureRandomString(secretLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate webhook secret")
+	}
+	model.ApplicationID = app.ID
+	model.Secret = secretPrefix + secret
+	model.Paused = false
+	model.ConsecutiveFailures = 0
+	model.PausedAt = nil
+
+	res, err := s.repository.CreateWebhook(model)
+	if err != nil {
+		return nil, err
+	}
+	res.Secret = model.Secret
+	return res, nil
+}
+
+// Update changes the url, events and activation of the webhook, activating a paused webhook resumes its deliveries
+func (s service) Update(accountID uint, aUUID string, model WebhookModel) (*WebhookModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	if err = validate(model); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repository.GetWebhook(app.ID, model.UUID)
+	if err != nil {
+		return nil, err
+	}
+	current.URL = model.URL
+	current.Events = model.Events
+	current.Active = model.Active
+	if model.Active {
+		current.Paused = false
+		current.ConsecutiveFailures = 0
+		current.PausedAt = nil
+	}
+	return s.repository.UpdateWebhook(*current)
+}
+
+func (s service) List(accountID uint, aUUID string) ([]*WebhookModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetWebhooks(app.ID)
+}
+
+func (s service) Details(accountID uint, aUUID string, wUUID string) (*WebhookModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.GetWebhook(app.ID, wUUID)
+}
+
+func (s service) Delete(accountID uint, aUUID string, wUUID string) error {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageWebhooks)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeleteWebhook(app.ID, wUUID)
+}
+
+// Attempts returns the latest delivery attempts of the webhook, newest first
+func (s service) Attempts(accountID uint, aUUID string, wUUID string, paging utils.Paging) ([]*AttemptModel, error) {
+	app, err := applications.Authorize(s.repository, accountID, aUUID, applications.PermissionManageWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := s.repository.GetWebhook(app.ID, wUUID)
+	if err != nil {
+		return nil, err
+	}
+	if paging.Page < 1 {
+		paging.Page = 1
+	}
+	if paging.Size < 1 || paging.Size > 100 {
+		paging.Size = 100
+	}
+	return s.repository.GetAttempts(webhook.ID, (paging.Page-1)*paging.Size, paging.Size)
+}
+
+// OnDeviceEvent queues the registrations and unsubscriptions of devices for the webhooks subscribed to them
+func (s service) OnDeviceEvent(event devices.DeviceEventModel) error {
+	var eventType EventType
+	switch event.Type {
+	case devices.DeviceRegistered:
+		eventType = EventDeviceRegistered
+	case devices.DeviceUnsubscribed:
+		eventType = EventDeviceUnsubscribed
+	default:
+		return nil
+	}
+	return s.enqueue(event.ApplicationID, eventType, event.DeviceID, nil, time.Now())
+}
+
+// OnEvent queues the opened notifications for the webhooks subscribed to them
+func (s service) OnEvent(event events.EventModel) error {
+	if event.Name != events.NotificationOpened {
+		return nil
+	}
+	return s.enqueue(event.ApplicationID, EventNotificationOpened, event.DeviceID, event.Properties, event.OccurredAt)
+}
+
+// enqueue stores a delivery of the event for every webhook of the application which is subscribed to it
+func (s service) enqueue(applicationID uint, eventType EventType, deviceID uint, properties map[string]interface{}, occurredAt time.Time) error {
+	items, err := s.repository.GetActiveWebhooks(applicationID)
+	if err != nil {
+		return err
+	}
+	subscribed := make([]*WebhookModel, 0, len(items))
+	for _, item := range items {
+		if item.Subscribes(eventType) {
+			subscribed = append(subscribed, item)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	appUUID, err := s.repository.GetApplicationUUID(applicationID)
+	if err != nil {
+		return err
+	}
+	device, err := s.repository.GetDeviceData(deviceID)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"device_uuid":      device.UUID,
+		"device_type":      device.DeviceType,
+		"external_user_id": device.ExternalUserID,
+	}
+	if properties != nil {
+		data["properties"] = properties
+	}
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	body, err := json.Marshal(PayloadModel{
+		ID:              uuid.NewV4().String(),
+		Type:            eventType,
+		ApplicationUUID: appUUID,
+		OccurredAt:      occurredAt.UTC(),
+		Data:            data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook payload")
+	}
+
+	deliveries := make([]DeliveryModel, 0, len(subscribed))
+	for _, item := range subscribed {
+		deliveries = append(deliveries, DeliveryModel{
+			WebhookID:     item.ID,
+			DeviceID:      deviceID,
+			EventType:     eventType,
+			Payload:       string(body),
+			NextAttemptAt: time.Now(),
+		})
+	}
+	return s.repository.CreateDeliveries(deliveries)
+}
+
+// Deliver posts the due deliveries to their webhooks. Failed deliveries are retried with an exponential backoff
+// until they run out of attempts, and webhooks failing too many times in a row are paused
+func (s service) Deliver(limit int) (int, error) {
+	// Deliveries are sent one by one, the lease covers the whole batch timing out
+	lease := s.config.GetTimeout()*time.Duration(limit) + time.Minute
+	items, err := s.repository.ClaimDueDeliveries(limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// Webhooks are cached during a single run since many deliveries share the same webhook
+	webhooks := make(map[uint]*WebhookModel)
+	for _, item := range items {
+		webhook, ok := webhooks[item.WebhookID]
+		if !ok {
+			webhook, err = s.repository.GetWebhookByID(item.WebhookID)
+			if err != nil && !errors.HasKind(err, errors.NotFound) {
+				return 0, err
+			}
+			webhooks[item.WebhookID] = webhook
+		}
+		// Webhook has been removed meanwhile
+		if webhook == nil {
+			if err = s.repository.DeleteDelivery(item.ID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// Deliveries of webhooks paused during the run are kept until the webhooks are resumed
+		if webhook.Paused || !webhook.Active {
+			continue
+		}
+
+		if err = s.deliver(webhook, item); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// deliver makes a single attempt of the delivery and schedules its next try when it fails
+func (s service) deliver(webhook *WebhookModel, delivery *DeliveryModel) error {
+	delivery.Attempts++
+	attempt := s.send(webhook, delivery)
+	if err := s.repository.CreateAttempt(attempt, s.config.GetLogSize()); err != nil {
+		return err
+	}
+
+	if attempt.Success {
+		if webhook.ConsecutiveFailures > 0 {
+			if err := s.repository.ResetFailures(webhook.ID); err != nil {
+				return err
+			}
+			webhook.ConsecutiveFailures = 0
+		}
+		return s.repository.DeleteDelivery(delivery.ID)
+	}
+
+	paused, err := s.repository.RecordFailure(webhook.ID, s.config.GetFailureThreshold())
+	if err != nil {
+		return err
+	}
+	webhook.ConsecutiveFailures++
+	webhook.Paused = paused
+	if delivery.Attempts >= s.config.GetMaxAttempts() {
+		return s.repository.DeleteDelivery(delivery.ID)
+	}
+	return s.repository.RescheduleDelivery(delivery.ID, delivery.Attempts, time.Now().Add(s.config.GetBackoff(delivery.Attempts)))
+}
+
+// send posts the payload of the delivery to the webhook, any response other than 2xx is a failure
+func (s service) send(webhook *WebhookModel, delivery *DeliveryModel) (attempt AttemptModel) {
+	attempt = AttemptModel{
+		WebhookID:    webhook.ID,
+		DeviceID:     delivery.DeviceID,
+		DeliveryUUID: delivery.UUID,
+		EventType:    delivery.EventType,
+		Attempt:      delivery.Attempts,
+	}
+	started := time.Now()
+	defer func() {
+		attempt.Duration = time.Since(started).Milliseconds()
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = truncate(err.Error())
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Ratatoskr-Webhooks/1.0")
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, delivery.UUID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, started, []byte(delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		attempt.Error = truncate(err.Error())
+		return attempt
+	}
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	attempt.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	return attempt
+}
+
+// Sign returns the signature header of the body sent at the time. The signature is the hex encoded HMAC-SHA256 of
+// the unix timestamp and the body joined by a dot, the timestamp lets receivers reject replayed deliveries
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(h.Sum(nil)))
+}
+
+func validate(model WebhookModel) error {
+	u, err := url.Parse(model.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.WithKindCtx(ErrInvalidWebhookURL, "", errors.UnprocessableEntity, nil)
+	}
+	if err = checkHost(u.Hostname()); err != nil {
+		return errors.WithKindCtx(ErrInvalidWebhookURL, err.Error(), errors.UnprocessableEntity, nil)
+	}
+	if len(model.Events) == 0 {
+		return errors.WithKindCtx(ErrNoEventTypes, "", errors.UnprocessableEntity, nil)
+	}
+	for _, e := range model.Events {
+		if !e.IsValid() {
+			return errors.WithKindCtx(ErrInvalidEventType, string(e), errors.UnprocessableEntity, nil)
+		}
+	}
+	return nil
+}
+
+func truncate(value string) string {
+	if len(value) > maxErrorLength {
+		return value[:maxErrorLength]
+	}
+	return value
+}
@@ -4,46 +4,58 @@ import (
 	"database/sql"
 	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
 type account struct {
-	ID                 uint   `gorm:"primary_key"`
-	UUID               string `gorm:"type:uuid; not null;default:uuid_generate_v4()"`
-	Email              string `gorm:"uniqueIndex;size:50"`
-	EncryptedPassword  string `gorm:"size:255"`
-	OAuthProvider      string `gorm:"size:255"`
-	OAuthUID           string `gorm:"size:255"`
-	Picture            string `gorm:"size:255"`
-	CompanyName        string `gorm:"size:255"`
-	IsSuperUser        bool   `gorm:"not null;default:false"`
-	LastLoginDate      sql.NullTime
-	Active             bool `gorm:"not null;default:true"`
-	Confirmed          bool `gorm:"not null;default:false"`
-	ConfirmationToken  string
-	ConfirmationSentAt sql.NullTime
-	CreatedAt          time.Time `gorm:"default:current_timestamp"`
-	UpdatedAt          time.Time `gorm:"default:current_timestamp"`
+	ID                  uint   `gorm:"primary_key"`
+	UUID                string `gorm:"type:uuid; not null;default:uuid_generate_v4()"`
+	Email               string `gorm:"uniqueIndex;size:50"`
+	EncryptedPassword   string `gorm:"size:255"`
+	OAuthProvider       string `gorm:"size:255;index:idx_account_oauth"`
+	OAuthUID            string `gorm:"size:255;index:idx_account_oauth"`
+	Picture             string `gorm:"size:255"`
+	CompanyName         string `gorm:"size:255"`
+	IsSuperUser         bool   `gorm:"not null;default:false"`
+	LastLoginDate       sql.NullTime
+	Active              bool   `gorm:"not null;default:true"`
+	Confirmed           bool   `gorm:"not null;default:false"`
+	ConfirmationToken   string `gorm:"index"` // sha256 hash of the token sent in the confirmation email
+	ConfirmationSentAt  sql.NullTime
+	PasswordResetToken  string `gorm:"size:64;index"` // sha256 hash of the token sent in the password reset email
+	PasswordResetSentAt sql.NullTime
+	MFASecret           string    `gorm:"type:text"` // encrypted totp secret, it is only required on login once MFAEnabled
+	MFAEnabled          bool      `gorm:"not null;default:false"`
+	MFALastStep         int64     `gorm:"not null;default:0"` // time step of the last accepted totp code
+	Plan                string    `gorm:"size:20;not null;default:free"`
+	CreatedAt           time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt           time.Time `gorm:"default:current_timestamp"`
 }
 
 func (a account) ToServiceModel() *authentication2.AccountModel {
 	return &authentication2.AccountModel{
-		ID:                 a.ID,
-		UUID:               a.UUID,
-		Email:              a.Email,
-		EncryptedPassword:  a.EncryptedPassword,
-		OAuthProvider:      a.OAuthProvider,
-		OAuthUID:           a.OAuthUID,
-		Picture:            a.Picture,
-		CompanyName:        a.CompanyName,
-		IsSuperUser:        a.IsSuperUser,
-		LastLoginDate:      a.LastLoginDate,
-		Active:             a.Active,
-		Confirmed:          a.Confirmed,
-		ConfirmationToken:  a.ConfirmationToken,
-		ConfirmationSentAt: a.ConfirmationSentAt,
-		CreatedAt:          a.CreatedAt,
-		UpdatedAt:          a.UpdatedAt,
+		ID:                  a.ID,
+		UUID:                a.UUID,
+		Email:               a.Email,
+		EncryptedPassword:   a.EncryptedPassword,
+		OAuthProvider:       a.OAuthProvider,
+		OAuthUID:            a.OAuthUID,
+		Picture:             a.Picture,
+		CompanyName:         a.CompanyName,
+		IsSuperUser:         a.IsSuperUser,
+		LastLoginDate:       a.LastLoginDate,
+		Active:              a.Active,
+		Confirmed:           a.Confirmed,
+		ConfirmationToken:   a.ConfirmationToken,
+		ConfirmationSentAt:  a.ConfirmationSentAt,
+		PasswordResetSentAt: a.PasswordResetSentAt,
+		MFAEnabled:          a.MFAEnabled,
+		MFALastStep:         a.MFALastStep,
+		Plan:                authentication2.Plan(a.Plan),
+		CreatedAt:           a.CreatedAt,
+		UpdatedAt:           a.UpdatedAt,
 	}
 }
 
@@ -69,6 +81,15 @@ func (r *repository) CreateAccount(model authentication2.AccountModel) (*authent
 	return acc.ToServiceModel(), nil
 }
 
+func (r *repository) GetAccountByID(ID uint) (*authentication2.AccountModel, error) {
+	var acc account
+	err := r.db.Where("id = ?", ID).First(&acc).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return acc.ToServiceModel(), nil
+}
+
 func (r *repository) GetAccountByEmail(email string) (*authentication2.AccountModel, error) {
 	var acc account
 	err := r.db.Where("email = ?", email).First(&acc).Error
@@ -77,3 +98,141 @@ func (r *repository) GetAccountByEmail(email string) (*authentication2.AccountMo
 	}
 	return acc.ToServiceModel(), nil
 }
+
+func (r *repository) GetAccountByUUID(UUID string) (*authentication2.AccountModel, error) {
+	var acc account
+	err := r.db.Where("uuid = ?", UUID).First(&acc).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return acc.ToServiceModel(), nil
+}
+
+func (r *repository) SearchAccounts(query string, offset int, limit int) ([]*authentication2.AccountModel, error) {
+	var items []account
+	db := r.db.Order("id desc").Offset(offset).Limit(limit)
+	if query != "" {
+		pattern := "%" + strings.ToLower(query) + "%"
+		db = db.Where("LOWER(email) LIKE ? OR LOWER(company_name) LIKE ?", pattern, pattern)
+	}
+	err := db.Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*authentication2.AccountModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) UpdateAccountActive(ID uint, active bool) error {
+	return r.updateAccount(ID, map[string]interface{}{
+		"active":     active,
+		"updated_at": time.Now(),
+	})
+}
+
+func (r *repository) UpdateAccountPlan(ID uint, plan authentication2.Plan) error {
+	return r.updateAccount(ID, map[string]interface{}{
+		"plan":       string(plan),
+		"updated_at": time.Now(),
+	})
+}
+
+func (r *repository) updateAccount(ID uint, values map[string]interface{}) error {
+	res := r.db.Model(&account{}).Where("id = ?", ID).Updates(values)
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) GetAccountByConfirmationToken(tokenHash string) (*authentication2.AccountModel, error) {
+	var acc account
+	err := r.db.Where("confirmation_token = ? AND confirmed = ?", tokenHash, false).First(&acc).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return acc.ToServiceModel(), nil
+}
+
+func (r *repository) UpdateConfirmationToken(ID uint, tokenHash string, sentAt time.Time) error {
+	return r.db.Model(&account{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"confirmation_token":   tokenHash,
+		"confirmation_sent_at": sentAt,
+		"updated_at":           time.Now(),
+	}).Error
+}
+
+func (r *repository) ConfirmAccount(ID uint, tokenHash string) error {
+	res := r.db.Model(&account{}).Where("id = ? AND confirmation_token = ?", ID, tokenHash).Updates(map[string]interface{}{
+		"confirmed":          true,
+		"confirmation_token": "",
+		"updated_at":         time.Now(),
+	})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) GetAccountByPasswordResetToken(tokenHash string) (*authentication2.AccountModel, error) {
+	var acc account
+	err := r.db.Where("password_reset_token = ?", tokenHash).First(&acc).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return acc.ToServiceModel(), nil
+}
+
+func (r *repository) UpdatePasswordResetToken(ID uint, tokenHash string, sentAt time.Time) error {
+	return r.db.Model(&account{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"password_reset_token":   tokenHash,
+		"password_reset_sent_at": sentAt,
+		"updated_at":             time.Now(),
+	}).Error
+}
+
+func (r *repository) ResetPassword(ID uint, tokenHash string, encryptedPassword string) error {
+	res := r.db.Model(&account{}).Where("id = ? AND password_reset_token = ?", ID, tokenHash).Updates(map[string]interface{}{
+		"encrypted_password":   encryptedPassword,
+		"password_reset_token": "",
+		"confirmed":            true,
+		"confirmation_token":   "",
+		"updated_at":           time.Now(),
+	})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) GetAccountByOAuth(provider string, UID string) (*authentication2.AccountModel, error) {
+	var acc account
+	err := r.db.Where("o_auth_provider = ? AND o_auth_uid = ?", provider, UID).First(&acc).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return acc.ToServiceModel(), nil
+}
+
+func (r *repository) LinkOAuthAccount(model authentication2.AccountModel) error {
+	return r.db.Model(&account{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
+		"o_auth_provider":    model.OAuthProvider,
+		"o_auth_uid":         model.OAuthUID,
+		"picture":            model.Picture,
+		"confirmed":          model.Confirmed,
+		"encrypted_password": model.EncryptedPassword,
+		"updated_at":         time.Now(),
+	}).Error
+}
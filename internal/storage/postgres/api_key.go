@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type apiKey struct {
+	ID            uint         `gorm:"primary_key"`
+	UUID          string       `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	Name          string       `gorm:"size:255"`
+	Prefix        string       `gorm:"size:16"`
+	Hash          string       `gorm:"size:64;uniqueIndex"`
+	Scopes        string       `gorm:"type:text"` // JSON encoded []applications.Scope
+	ExpiresAt     sql.NullTime `gorm:"index"`
+	LastUsedAt    sql.NullTime
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"index"`
+	Application   application
+}
+
+func (k apiKey) ToServiceModel() *applications.APIKeyModel {
+	res := &applications.APIKeyModel{
+		ID:            k.ID,
+		UUID:          k.UUID,
+		ApplicationID: k.ApplicationID,
+		Name:          k.Name,
+		Prefix:        k.Prefix,
+		Hash:          k.Hash,
+		CreatedAt:     k.CreatedAt,
+		UpdatedAt:     k.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(k.Scopes), &res.Scopes)
+	if k.ExpiresAt.Valid {
+		res.ExpiresAt = &k.ExpiresAt.Time
+	}
+	if k.LastUsedAt.Valid {
+		res.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return res
+}
+
+func (r *repository) CreateAPIKey(model applications.APIKeyModel) (*applications.APIKeyModel, error) {
+	scopes, err := json.Marshal(model.Scopes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode api key scopes")
+	}
+	item := apiKey{
+		Name:          model.Name,
+		Prefix:        model.Prefix,
+		Hash:          model.Hash,
+		Scopes:        string(scopes),
+		ApplicationID: model.ApplicationID,
+	}
+	if model.ExpiresAt != nil {
+		item.ExpiresAt = sql.NullTime{Time: *model.ExpiresAt, Valid: true}
+	}
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetAPIKeys(appID uint) ([]*applications.APIKeyModel, error) {
+	var items []apiKey
+	err := r.db.Where("application_id = ?", appID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*applications.APIKeyModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetAPIKey(appID uint, UUID string) (*applications.APIKeyModel, error) {
+	var item apiKey
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, appID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetAPIKeyByHash(appID uint, hash string) (*applications.APIKeyModel, error) {
+	var item apiKey
+	err := r.db.Where("hash = ? AND application_id = ?", hash, appID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) UpdateAPIKeyExpiry(ID uint, expiresAt time.Time) error {
+	return r.db.Model(&apiKey{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"expires_at": expiresAt,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// TouchAPIKey only writes the last used timestamp, so it does not count as a change of the key
+func (r *repository) TouchAPIKey(ID uint, usedAt time.Time) error {
+	return r.db.Model(&apiKey{}).Where("id = ?", ID).UpdateColumn("last_used_at", usedAt).Error
+}
+
+func (r *repository) DeleteAPIKey(appID uint, UUID string) error {
+	res := r.db.Where("uuid = ? AND application_id = ?", UUID, appID).Delete(&apiKey{})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
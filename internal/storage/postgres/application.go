@@ -1,30 +1,40 @@
 package postgres
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/subzerobo/ratatoskr/internal/services/applications"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
+// authKeyBackfillBatch is the number of applications whose auth keys are hashed per query while migrating
+const authKeyBackfillBatch = 1000
+
 type application struct {
-	ID                   uint      `gorm:"primary_key"`
-	UUID                 string    `gorm:"type:uuid; not null;default:uuid_generate_v4()"`
-	Name                 string    `gorm:"size:255"`
-	FCMSenderID          string    `gorm:"uniqueIndex;size:255"`
-	FCMAdminJSON         string    `gorm:"size:5000"`
-	URL                  string    `gorm:"size:255"`
-	AuthKey              string    `gorm:"uniqueIndex;size:64"`
-	IdentityVerification bool      `gorm:"default:false"`
-	CreatedAt            time.Time `gorm:"default:current_timestamp"`
-	UpdatedAt            time.Time `gorm:"default:current_timestamp"`
-	AccountID            uint      `gorm:"index"`
+	ID                   uint           `gorm:"primary_key"`
+	UUID                 string         `gorm:"type:uuid; not null;default:uuid_generate_v4()"`
+	Name                 string         `gorm:"size:255"`
+	FCMSenderID          string         `gorm:"uniqueIndex;size:255"`
+	FCMAdminJSON         string         `gorm:"type:text"`
+	URL                  string         `gorm:"size:255"`
+	AuthKey              string         `gorm:"size:512"`
+	AuthKeyHash          *string        `gorm:"size:64;uniqueIndex"` // Keeps auth keys unique since their encrypted values never match
+	IdentityVerification bool           `gorm:"default:false"`
+	CreatedAt            time.Time      `gorm:"default:current_timestamp"`
+	UpdatedAt            time.Time      `gorm:"default:current_timestamp"`
+	DeletedAt            gorm.DeletedAt `gorm:"index"`
+	AccountID            uint           `gorm:"index"`
 	Account              account
+	OrganizationID       *uint `gorm:"index"` // applications without an organization are the personal applications of their account
+	Organization         *organization
 }
 
 func (a application) ToServiceModel() *applications.ApplicationModel {
-	return &applications.ApplicationModel{
+	res := &applications.ApplicationModel{
 		ID:                   a.ID,
 		UUID:                 a.UUID,
 		Name:                 a.Name,
@@ -35,8 +45,15 @@ func (a application) ToServiceModel() *applications.ApplicationModel {
 		IdentityVerification: a.IdentityVerification,
 		CreatedAt:            a.CreatedAt,
 		UpdatedAt:            a.UpdatedAt,
-		AccountID:            0,
+		AccountID:            a.AccountID,
+	}
+	if a.OrganizationID != nil {
+		res.OrganizationID = *a.OrganizationID
+	}
+	if a.DeletedAt.Valid {
+		res.DeletedAt = &a.DeletedAt.Time
 	}
+	return res
 }
 
 type androidGroup struct {
@@ -107,66 +124,169 @@ func (a androidGroupCategory) ToServiceModel() *applications.AndroidGroupCategor
 }
 
 func (r *repository) CreateApplication(model applications.ApplicationModel) (*applications.ApplicationModel, error) {
+	fcmAdminJSON, err := r.encryptSecret(model.FCMAdminJSON)
+	if err != nil {
+		return nil, err
+	}
+	authKey, err := r.encryptSecret(model.AuthKey)
+	if err != nil {
+		return nil, err
+	}
 	app := application{
 		Name:         model.Name,
 		FCMSenderID:  model.FCMSenderID,
-		FCMAdminJSON: model.FCMAdminJSON,
+		FCMAdminJSON: fcmAdminJSON,
 		URL:          model.URL,
+		AuthKey:      authKey,
+		AuthKeyHash:  hashAuthKey(model.AuthKey),
 		AccountID:    model.AccountID,
 	}
 
-	err := r.db.Create(&app).Error
+	err = r.db.Create(&app).Error
 	if err != nil {
 		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
 	}
-	return app.ToServiceModel(), nil
+	return r.applicationModel(app)
 }
 
 func (r *repository) GetApplicationsByAccountID(accountID uint) ([]*applications.ApplicationModel, error) {
+	var members []organizationMember
+	err := r.db.Where("account_id = ?", accountID).Find(&members).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	organizationRoles := make(map[uint]applications.Role, len(members))
+	organizationIDs := make([]uint, 0, len(members))
+	for _, member := range members {
+		organizationRoles[member.OrganizationID] = applications.Role(member.Role)
+		organizationIDs = append(organizationIDs, member.OrganizationID)
+	}
+
 	var items []application
-	err := r.db.Where("account_id = ?", accountID).Find(&items).Error
+	query := r.db.Where("organization_id IS NULL AND account_id = ?", accountID)
+	if len(organizationIDs) > 0 {
+		query = r.db.Where("(organization_id IS NULL AND account_id = ?) OR organization_id IN ?", accountID, organizationIDs)
+	}
+	err = query.Find(&items).Error
 	if err != nil {
 		return nil, getProcessedDBError(err)
 	}
-	var result []*applications.ApplicationModel
-	for _, item := range items {
-		result = append(result, item.ToServiceModel())
+
+	var given []applicationMember
+	err = r.db.Where("account_id = ?", accountID).Find(&given).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	givenRoles := make(map[uint]applications.Role, len(given))
+	for _, item := range given {
+		givenRoles[item.ApplicationID] = applications.Role(item.Role)
+	}
+
+	result, err := r.applicationModels(items)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if item.OrganizationID == nil {
+			result[i].Role = applications.RoleOwner
+			continue
+		}
+		result[i].Role = applications.EffectiveRole(organizationRoles[*item.OrganizationID], givenRoles[item.ID])
 	}
 	return result, nil
 }
 
-func (r *repository) GetAllApplications() ([]*applications.ApplicationModel, error) {
+func (r *repository) GetAllApplications(offset int, limit int) ([]*applications.ApplicationModel, error) {
 	var items []application
-	err := r.db.Find(&items).Error
+	err := r.db.Order("id desc").Offset(offset).Limit(limit).Find(&items).Error
 	if err != nil {
 		return nil, getProcessedDBError(err)
 	}
-	var result []*applications.ApplicationModel
+	result, err := r.applicationModels(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return result, nil
+	}
+	IDs := make([]uint, 0, len(items))
 	for _, item := range items {
-		result = append(result, item.ToServiceModel())
+		IDs = append(IDs, item.ID)
+	}
+	var counts []struct {
+		ApplicationID uint
+		Count         int64
+	}
+	err = r.db.Model(&device{}).Select("application_id, count(*) AS count").
+		Where("application_id IN ?", IDs).Group("application_id").Scan(&counts).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	deviceCounts := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		deviceCounts[c.ApplicationID] = c.Count
+	}
+	for _, model := range result {
+		model.DeviceCount = deviceCounts[model.ID]
 	}
 	return result, nil
 }
 
-func (r *repository) GetAccountApplicationByUUID(accountID uint, UUID string) (*applications.ApplicationModel, error) {
+func (r *repository) GetApplicationRole(accountID uint, UUID string) (*applications.ApplicationModel, applications.Role, error) {
+	var item application
+	err := r.db.Where("uuid = ?", UUID).First(&item).Error
+	if err != nil {
+		return nil, "", getProcessedDBError(err)
+	}
+	return r.applicationRoleModel(item, accountID)
+}
+
+func (r *repository) GetApplicationBySenderID(senderID string) (*applications.ApplicationModel, error) {
 	var item application
-	err := r.db.Where("uuid = ? AND account_id = ?", UUID, accountID).First(&item).Error
+	// Deleted applications keep their sender id until they are purged
+	err := r.db.Unscoped().Where("fcm_sender_id = ?", senderID).First(&item).Error
 	if err != nil {
 		return nil, getProcessedDBError(err)
 	}
+	return r.applicationModel(item)
+}
 
-	return item.ToServiceModel(), nil
+func (r *repository) UpdateApplication(model applications.ApplicationModel) (*applications.ApplicationModel, error) {
+	var item application
+	err := r.db.First(&item, model.ID).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	fcmAdminJSON, err := r.encryptSecret(model.FCMAdminJSON)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Model(&item).Updates(map[string]interface{}{
+		"name":           model.Name,
+		"url":            model.URL,
+		"fcm_sender_id":  model.FCMSenderID,
+		"fcm_admin_json": fcmAdminJSON,
+		"updated_at":     time.Now(),
+	}).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to update record in database", errors.InternalServerError, nil)
+	}
+	return r.applicationModel(item)
 }
 
-func (r *repository) UpdateAuthKey(accountID uint, UUID string, AuthKey string) error {
+func (r *repository) UpdateAuthKey(ID uint, AuthKey string) error {
+	authKey, err := r.encryptSecret(AuthKey)
+	if err != nil {
+		return err
+	}
 	return r.db.Model(&application{}).
-		Where("account_id = ? AND uuid = ?", accountID, UUID).
-		Update("auth_key", AuthKey).Error
+		Where("id = ?", ID).
+		Updates(map[string]interface{}{"auth_key": authKey, "auth_key_hash": hashAuthKey(AuthKey)}).Error
 }
 
-func (r *repository) UpdateIdentityVerification(accountID uint, UUID string, status bool) error {
+func (r *repository) UpdateIdentityVerification(ID uint, status bool) error {
 	return r.db.Model(&application{}).
-		Where("account_id = ? AND uuid = ?", accountID, UUID).
+		Where("id = ?", ID).
 		Update("identity_verification", status).Error
 }
 
@@ -177,13 +297,18 @@ func (r *repository) GetApplicationByUUID(UUID string) (*devices.DeviceApplicati
 		return nil, getProcessedDBError(err)
 	}
 
-	return &devices.DeviceApplicationModel{
-		ID:                   item.ID,
-		UUID:                 item.UUID,
-		AuthKey:              item.AuthKey,
-		IdentityVerification: item.IdentityVerification,
-		AccountID:            item.AccountID,
-	}, nil
+	return r.deviceApplicationModel(item)
+}
+
+func (r *repository) GetDeviceApplication(deviceUUID string) (*devices.DeviceApplicationModel, error) {
+	var item application
+	err := r.db.Joins("JOIN devices ON devices.application_id = applications.id").
+		Where("devices.uuid = ?", deviceUUID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+
+	return r.deviceApplicationModel(item)
 }
 
 func (r *repository) GetApplicationModelByUUID(UUID string) (*applications.ApplicationModel, error) {
@@ -193,7 +318,7 @@ func (r *repository) GetApplicationModelByUUID(UUID string) (*applications.Appli
 		return nil, getProcessedDBError(err)
 	}
 
-	return item.ToServiceModel(), nil
+	return r.applicationModel(item)
 }
 
 func (r *repository) GetAndroidGroups(appId uint) ([]*applications.AndroidGroupModel, error) {
@@ -307,3 +432,292 @@ func (r *repository) DeleteAndroidCategory(appID uint, groupUUID string, categor
 
 	return r.db.Where("category_uuid = ? and android_group_id = ?", categoryUUID, agp.ID).Delete(androidGroupCategory{}).Error
 }
+
+func (r *repository) DeleteApplication(ID uint) (*applications.ApplicationModel, error) {
+	var item application
+	err := r.db.First(&item, ID).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	err = r.db.Delete(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	err = r.db.Unscoped().First(&item, item.ID).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return r.applicationModel(item)
+}
+
+func (r *repository) GetDeletedApplicationRole(accountID uint, UUID string) (*applications.ApplicationModel, applications.Role, error) {
+	var item application
+	err := r.db.Unscoped().Where("uuid = ? AND deleted_at IS NOT NULL", UUID).First(&item).Error
+	if err != nil {
+		return nil, "", getProcessedDBError(err)
+	}
+	return r.applicationRoleModel(item, accountID)
+}
+
+func (r *repository) RestoreApplication(ID uint) error {
+	return r.db.Unscoped().Model(&application{}).Where("id = ?", ID).Update("deleted_at", nil).Error
+}
+
+func (r *repository) GetPurgeableApplications(deletedBefore time.Time, limit int) ([]*applications.ApplicationModel, error) {
+	var items []application
+	err := r.db.Unscoped().Where("deleted_at <= ?", deletedBefore).Order("deleted_at").Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return r.applicationModels(items)
+}
+
+func (r *repository) PurgeApplication(ID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		deviceIDs := tx.Model(&device{}).Select("id").Where("application_id = ?", ID)
+		userIDs := tx.Model(&user{}).Select("id").Where("application_id = ?", ID)
+		groupIDs := tx.Model(&androidGroup{}).Select("id").Where("application_id = ?", ID)
+		importIDs := tx.Model(&deviceImport{}).Select("id").Where("application_id = ?", ID)
+		webhookIDs := tx.Model(&webhook{}).Select("id").Where("application_id = ?", ID)
+
+		// Children go first as not all of the foreign keys cascade
+		steps := []struct {
+			name  string
+			query *gorm.DB
+			model interface{}
+		}{
+			{"events", tx.Where("application_id = ?", ID), &event{}},
+			{"journey progresses", tx.Where("application_id = ?", ID), &journeyProgress{}},
+			{"journeys", tx.Where("application_id = ?", ID), &journey{}},
+			{"purchases", tx.Where("application_id = ?", ID), &purchase{}},
+			{"tags", tx.Where("device_id IN (?)", deviceIDs), &tag{}},
+			{"devices", tx.Where("application_id = ?", ID), &device{}},
+			{"user tags", tx.Where("user_id IN (?)", userIDs), &userTag{}},
+			{"users", tx.Where("application_id = ?", ID), &user{}},
+			{"tag keys", tx.Where("application_id = ?", ID), &tagKey{}},
+			{"tag limits", tx.Where("application_id = ?", ID), &tagLimit{}},
+			{"segments", tx.Where("application_id = ?", ID), &segment{}},
+			{"import errors", tx.Where("device_import_id IN (?)", importIDs), &deviceImportError{}},
+			{"imports", tx.Where("application_id = ?", ID), &deviceImport{}},
+			{"exports", tx.Where("application_id = ?", ID), &deviceExport{}},
+			{"privacy requests", tx.Where("application_id = ?", ID), &privacyRequest{}},
+			{"api keys", tx.Where("application_id = ?", ID), &apiKey{}},
+			{"application members", tx.Where("application_id = ?", ID), &applicationMember{}},
+			{"audit entries", tx.Where("application_id = ?", ID), &auditEntry{}},
+			{"webhook attempts", tx.Where("webhook_id IN (?)", webhookIDs), &webhookAttempt{}},
+			{"webhook deliveries", tx.Where("webhook_id IN (?)", webhookIDs), &webhookDelivery{}},
+			{"webhooks", tx.Where("application_id = ?", ID), &webhook{}},
+			{"android categories", tx.Where("android_group_id IN (?)", groupIDs), &androidGroupCategory{}},
+			{"android groups", tx.Where("application_id = ?", ID), &androidGroup{}},
+		}
+		for _, step := range steps {
+			err := step.query.Delete(step.model).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to purge application %s", step.name)
+			}
+		}
+
+		err := tx.Unscoped().Delete(&application{}, ID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to purge application")
+		}
+		return nil
+	})
+}
+
+// RekeyResult is the number of rows whose secrets have been re-encrypted by RekeySecrets
+type RekeyResult struct {
+	Applications int
+	Accounts     int
+	Webhooks     int
+}
+
+// RekeySecrets encrypts the provider secrets which are still plaintext or encrypted with a retired key with the
+// current key, the two-factor secrets of the accounts and the webhook secrets are rekeyed as well. Rows are walked
+// in batches of batchSize, it returns the number of updated rows of each kind
+func (r *repository) RekeySecrets(batchSize int) (RekeyResult, error) {
+	var result RekeyResult
+	var err error
+	if result.Applications, err = r.rekeyApplicationSecrets(batchSize); err != nil {
+		return result, err
+	}
+	if result.Accounts, err = r.rekeyMFASecrets(batchSize); err != nil {
+		return result, err
+	}
+	result.Webhooks, err = r.rekeyWebhookSecrets(batchSize)
+	return result, err
+}
+
+// rekeyApplicationSecrets re-encrypts the provider secrets of the applications, see RekeySecrets
+func (r *repository) rekeyApplicationSecrets(batchSize int) (int, error) {
+	updated := 0
+	lastID := uint(0)
+	for {
+		var items []application
+		err := r.db.Unscoped().Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&items).Error
+		if err != nil {
+			return updated, getProcessedDBError(err)
+		}
+		for _, item := range items {
+			lastID = item.ID
+			if !r.secrets.NeedsRekey(item.FCMAdminJSON) && !r.secrets.NeedsRekey(item.AuthKey) {
+				continue
+			}
+			err = r.db.Transaction(func(tx *gorm.DB) error {
+				// The row is locked and read again so concurrent updates are not overwritten with stale secrets
+				var locked application
+				err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, item.ID).Error
+				if err != nil {
+					return getProcessedDBError(err)
+				}
+				fcmAdminJSON, err := r.rekeySecret(locked.FCMAdminJSON)
+				if err != nil {
+					return err
+				}
+				authKey, err := r.rekeySecret(locked.AuthKey)
+				if err != nil {
+					return err
+				}
+				return tx.Unscoped().Model(&locked).UpdateColumns(map[string]interface{}{
+					"fcm_admin_json": fcmAdminJSON,
+					"auth_key":       authKey,
+				}).Error
+			})
+			if err != nil {
+				return updated, errors.Wrapf(err, "failed to rekey secrets of application %s", item.UUID)
+			}
+			updated++
+		}
+		if len(items) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+// migrateAuthKeys replaces the unique index of the auth keys, which can not be compared since they are encrypted,
+// with the unique index of their hashes and fills the hashes of the existing applications
+func (r *repository) migrateAuthKeys() error {
+	if r.db.Migrator().HasIndex(&application{}, "idx_applications_auth_key") {
+		if err := r.db.Migrator().DropIndex(&application{}, "idx_applications_auth_key"); err != nil {
+			return errors.Wrap(err, "failed to drop auth key index")
+		}
+	}
+	lastID := uint(0)
+	for {
+		var items []application
+		err := r.db.Unscoped().Select("id", "uuid", "auth_key").Where("id > ?", lastID).
+			Order("id").Limit(authKeyBackfillBatch).Find(&items).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to load applications")
+		}
+		for _, item := range items {
+			lastID = item.ID
+			authKey, err := r.decryptSecret(item.AuthKey)
+			if err != nil {
+				return errors.Wrapf(err, "failed to decrypt auth key of application %s", item.UUID)
+			}
+			// Applications sharing an auth key fail the migration, their keys have to be rotated by hand first
+			err = r.db.Unscoped().Model(&application{}).Where("id = ?", item.ID).
+				UpdateColumn("auth_key_hash", hashAuthKey(authKey)).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to hash auth key of application %s", item.UUID)
+			}
+		}
+		if len(items) < authKeyBackfillBatch {
+			return nil
+		}
+	}
+}
+
+// hashAuthKey returns the hex encoded SHA-256 of the auth key, applications without an auth key have no hash
+func hashAuthKey(authKey string) *string {
+	if authKey == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(authKey))
+	hash := hex.EncodeToString(sum[:])
+	return &hash
+}
+
+// applicationModel converts the application to its service model with its provider secrets decrypted
+func (r *repository) applicationModel(item application) (*applications.ApplicationModel, error) {
+	res := item.ToServiceModel()
+	var err error
+	res.FCMAdminJSON, err = r.decryptSecret(item.FCMAdminJSON)
+	if err != nil {
+		return nil, err
+	}
+	res.AuthKey, err = r.decryptSecret(item.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// applicationRoleModel converts the application to its service model with the role of the account on it
+func (r *repository) applicationRoleModel(item application, accountID uint) (*applications.ApplicationModel, applications.Role, error) {
+	role, err := r.accountApplicationRole(item, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := r.applicationModel(item)
+	if err != nil {
+		return nil, "", err
+	}
+	res.Role = role
+	return res, role, nil
+}
+
+func (r *repository) applicationModels(items []application) ([]*applications.ApplicationModel, error) {
+	var result []*applications.ApplicationModel
+	for _, item := range items {
+		model, err := r.applicationModel(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, model)
+	}
+	return result, nil
+}
+
+func (r *repository) deviceApplicationModel(item application) (*devices.DeviceApplicationModel, error) {
+	authKey, err := r.decryptSecret(item.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+	return &devices.DeviceApplicationModel{
+		ID:                   item.ID,
+		UUID:                 item.UUID,
+		AuthKey:              authKey,
+		IdentityVerification: item.IdentityVerification,
+		AccountID:            item.AccountID,
+	}, nil
+}
+
+func (r *repository) encryptSecret(value string) (string, error) {
+	res, err := r.secrets.Encrypt(value)
+	if err != nil {
+		return "", errors.WithKindCtx(err, "failed to encrypt secret", errors.InternalServerError, nil)
+	}
+	return res, nil
+}
+
+func (r *repository) decryptSecret(value string) (string, error) {
+	res, err := r.secrets.Decrypt(value)
+	if err != nil {
+		return "", errors.WithKindCtx(err, "failed to decrypt secret", errors.InternalServerError, nil)
+	}
+	return res, nil
+}
+
+// rekeySecret re-encrypts the value with the current key, values already encrypted with it are kept as they are
+func (r *repository) rekeySecret(value string) (string, error) {
+	if !r.secrets.NeedsRekey(value) {
+		return value, nil
+	}
+	plaintext, err := r.decryptSecret(value)
+	if err != nil {
+		return "", err
+	}
+	return r.encryptSecret(plaintext)
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import "testing"
+
+func TestApplicationToServiceModelKeepsAccount(t *testing.T) {
+	res := application{ID: 3, AccountID: 7}.ToServiceModel()
+	if res.AccountID != 7 {
+		t.Fatalf("we got account %d but expected 7", res.AccountID)
+	}
+}
+
+func TestHashAuthKey(t *testing.T) {
+	if hashAuthKey("") != nil {
+		t.Fatalf("empty auth key got a hash")
+	}
+	first, second := hashAuthKey("key"), hashAuthKey("key")
+	if first == nil || len(*first) != 64 || *first != *second {
+		t.Fatalf("we got %v and %v but expected the same hex encoded SHA-256", first, second)
+	}
+	if *hashAuthKey("other") == *first {
+		t.Fatalf("different auth keys got the same hash")
+	}
+}
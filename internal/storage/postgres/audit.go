@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/audit"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"time"
+)
+
+type auditEntry struct {
+	ID                uint   `gorm:"primary_key"`
+	UUID              string `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	ActorID           uint   `gorm:"index"`
+	ActorEmail        string `gorm:"size:50;index"`
+	ImpersonatorID    *uint  `gorm:"index"` // Admin who has made the call while impersonating the actor
+	ImpersonatorEmail string `gorm:"size:50"`
+	SessionID         string `gorm:"size:36"`
+	AccountID         uint   `gorm:"index"`
+	ApplicationID     uint   `gorm:"index:idx_audit_application,priority:1"`
+	Action            string `gorm:"size:255"`
+	Status            int
+	Changes           string    `gorm:"type:text"` // JSON encoded map[string]audit.ChangeModel
+	IP                string    `gorm:"size:45"`
+	UserAgent         string    `gorm:"size:512"`
+	CreatedAt         time.Time `gorm:"default:current_timestamp;index:idx_audit_application,priority:2"`
+}
+
+func (a auditEntry) ToServiceModel() *audit.EntryModel {
+	res := &audit.EntryModel{
+		ID:                a.ID,
+		UUID:              a.UUID,
+		ActorID:           a.ActorID,
+		ActorEmail:        a.ActorEmail,
+		ImpersonatorEmail: a.ImpersonatorEmail,
+		SessionID:         a.SessionID,
+		AccountID:         a.AccountID,
+		ApplicationID:     a.ApplicationID,
+		Action:            a.Action,
+		Status:            a.Status,
+		IP:                a.IP,
+		UserAgent:         a.UserAgent,
+		CreatedAt:         a.CreatedAt,
+	}
+	if a.ImpersonatorID != nil {
+		res.ImpersonatorID = *a.ImpersonatorID
+	}
+	_ = json.Unmarshal([]byte(a.Changes), &res.Changes)
+	return res
+}
+
+func (r *repository) GetApplicationSnapshot(UUID string) (*audit.SnapshotModel, error) {
+	var item application
+	err := r.db.Unscoped().Where("uuid = ?", UUID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	// Secrets are encrypted with a new data key on every write, so they are fingerprinted by their plaintext
+	fcmAdminJSON, err := r.decryptSecret(item.FCMAdminJSON)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{
+		"name":                  item.Name,
+		"url":                   item.URL,
+		"fcm_sender_id":         item.FCMSenderID,
+		"fcm_admin_json":        fingerprint(fcmAdminJSON),
+		"auth_key":              hashFingerprint(item.AuthKeyHash),
+		"identity_verification": item.IdentityVerification,
+		"deleted":               item.DeletedAt.Valid,
+	}
+	if item.OrganizationID != nil {
+		values["organization_id"] = *item.OrganizationID
+	}
+
+	var groups []androidGroup
+	err = r.db.Preload("Categories").Where("application_id = ?", item.ID).Find(&groups).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	for _, group := range groups {
+		values["android_groups."+group.GroupUUID] = group.GroupName
+		for _, category := range group.Categories {
+			values["android_categories."+category.CategoryUUID] = map[string]interface{}{
+				"group":             group.GroupUUID,
+				"name":              category.CategoryName,
+				"description":       category.CategoryDescription,
+				"priority":          category.Priority,
+				"sound":             category.Sound,
+				"sound_name":        category.SoundName,
+				"vibration":         category.Vibration,
+				"vibration_pattern": category.VibrationPattern,
+				"led":               category.Led,
+				"led_color":         category.LedColor,
+				"enable_badge":      category.EnableBadge,
+				"lock_screen":       category.LockScreen,
+			}
+		}
+	}
+
+	var keys []apiKey
+	err = r.db.Where("application_id = ?", item.ID).Find(&keys).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	for _, key := range keys {
+		value := map[string]interface{}{
+			"name":   key.Name,
+			"prefix": key.Prefix,
+			"scopes": key.Scopes,
+			"key":    fingerprint(key.Hash),
+		}
+		if key.ExpiresAt.Valid {
+			value["expires_at"] = key.ExpiresAt.Time.UTC().Format(time.RFC3339)
+		}
+		values["api_keys."+key.UUID] = value
+	}
+
+	return &audit.SnapshotModel{
+		ApplicationID: item.ID,
+		AccountID:     item.AccountID,
+		Values:        values,
+	}, nil
+}
+
+func (r *repository) CreateEntry(model audit.EntryModel) error {
+	changes, err := json.Marshal(model.Changes)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit changes")
+	}
+	item := auditEntry{
+		ActorID:           model.ActorID,
+		ActorEmail:        model.ActorEmail,
+		ImpersonatorEmail: model.ImpersonatorEmail,
+		SessionID:         model.SessionID,
+		AccountID:         model.AccountID,
+		ApplicationID:     model.ApplicationID,
+		Action:            model.Action,
+		Status:            model.Status,
+		Changes:           string(changes),
+		IP:                model.IP,
+		UserAgent:         model.UserAgent,
+	}
+	if model.ImpersonatorID != 0 {
+		item.ImpersonatorID = &model.ImpersonatorID
+	}
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return nil
+}
+
+func (r *repository) GetEntries(applicationID uint, filter audit.FilterModel, offset int, limit int) ([]*audit.EntryModel, error) {
+	query := r.db.Where("application_id = ?", applicationID)
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorEmail != "" {
+		query = query.Where("actor_email = ?", filter.ActorEmail)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	var items []auditEntry
+	err := query.Order("created_at desc, id desc").Offset(offset).Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*audit.EntryModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+// fingerprint identifies a secret without revealing it, so its changes can be audited
+func fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// hashFingerprint is the fingerprint of a secret from its hex encoded SHA-256, it matches the fingerprint of the secret
+func hashFingerprint(hash *string) string {
+	if hash == nil || len(*hash) < 16 {
+		return ""
+	}
+	return "sha256:" + (*hash)[:16]
+}
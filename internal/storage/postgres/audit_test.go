@@ -0,0 +1,12 @@
+package postgres
+
+import "testing"
+
+func TestHashFingerprintMatchesFingerprint(t *testing.T) {
+	if res := hashFingerprint(hashAuthKey("key")); res != fingerprint("key") {
+		t.Fatalf("we got %s but expected %s", res, fingerprint("key"))
+	}
+	if res := hashFingerprint(nil); res != "" {
+		t.Fatalf("we got %s for an application without auth key", res)
+	}
+}
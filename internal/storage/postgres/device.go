@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"database/sql"
+	"encoding/json"
 	"github.com/subzerobo/ratatoskr/internal/services/devices"
 	"github.com/subzerobo/ratatoskr/pkg/errors"
 	"gorm.io/gorm"
@@ -38,13 +40,17 @@ type device struct {
 	Tags              []tag `gorm:"foreignKey:DeviceID"`
 	BadgeCount        int
 	AmountSpent       float32
+	LastActiveAt      sql.NullTime
+	TotalUsageTime    int64 `gorm:"not null;default:0"`
 }
 
 type tag struct {
-	DeviceID uint   `gorm:"index;uniqueIndex:idx_mix"`
-	Key      string `gorm:"size:255;index;uniqueIndex:idx_mix"`
-	Value    string `gorm:"size:255;index"`
-	Device   device
+	DeviceID    uint            `gorm:"index;uniqueIndex:idx_mix"`
+	Key         string          `gorm:"size:255;index;uniqueIndex:idx_mix;index:idx_tag_number,priority:1;index:idx_tag_time,priority:1"`
+	Value       string          `gorm:"size:255;index"`
+	NumberValue sql.NullFloat64 `gorm:"index:idx_tag_number,priority:2"` // Set when Value is numeric
+	TimeValue   sql.NullTime    `gorm:"index:idx_tag_time,priority:2"`   // Set when Value is a timestamp or date
+	Device      device
 }
 
 func (d device) ToServiceModel() *devices.DeviceModel {
@@ -73,6 +79,8 @@ func (d device) ToServiceModel() *devices.DeviceModel {
 		ApplicationID:     &d.ApplicationID,
 		BadgeCount:        &d.BadgeCount,
 		AmountSpent:       &d.AmountSpent,
+		LastActiveAt:      d.LastActiveAt.Time,
+		TotalUsageTime:    d.TotalUsageTime,
 	}
 	dm.Tags = make(map[string]string)
 	for _, t := range d.Tags {
@@ -81,7 +89,7 @@ func (d device) ToServiceModel() *devices.DeviceModel {
 	return &dm
 }
 
-func (r *repository) UpsertDevice(model devices.DeviceModel) (*devices.DeviceModel, error) {
+func (r *repository) UpsertDevice(model devices.DeviceModel) (*devices.DeviceModel, bool, error) {
 	dev := device{
 		DeviceType:        *model.DeviceType,
 		Identifier:        *model.Identifier,
@@ -101,10 +109,20 @@ func (r *repository) UpsertDevice(model devices.DeviceModel) (*devices.DeviceMod
 		Country:           *model.Country,
 		ExternalUserID:    *model.ExternalUserID,
 		ApplicationID:     *model.ApplicationID,
+		LastActiveAt:      sql.NullTime{Time: time.Now(), Valid: true},
 	}
 
+	created := false
 	err := r.db.Transaction(func(tx *gorm.DB) error {
-		err := tx.Clauses(clause.OnConflict{
+		// Check whether the device is a new registration or a re-registration
+		var existing int64
+		err := tx.Model(&device{}).Where("identifier = ? AND ad_id = ?", dev.Identifier, dev.ADID).Count(&existing).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to check existing device record")
+		}
+		created = existing == 0
+
+		err = tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "identifier"}, {Name: "ad_id"}},
 			DoUpdates: clause.Assignments(map[string]interface{}{
 				"language":           dev.Language,
@@ -121,42 +139,30 @@ func (r *repository) UpsertDevice(model devices.DeviceModel) (*devices.DeviceMod
 				"lat":                dev.Lat,
 				"country":            dev.Country,
 				"external_user_id":   dev.ExternalUserID,
+				"last_active_at":     dev.LastActiveAt,
 			}),
 		}).Create(&dev).Error
 		if err != nil {
 			return errors.Wrapf(err, "failed to insert device record %v", dev)
 		}
 
-		for k, v := range model.Tags {
-			tagM := tag{
-				DeviceID: dev.ID,
-				Key:      k,
-				Value:    v,
-			}
-			if v == "" {
-				// Remove tag if value is empty
-				err = tx.Where("device_id = ? AND key = ?", tagM.DeviceID, tagM.Key).Delete(tag{}).Error
-			} else {
-				// Upsert tag if value is not empty
-				err = tx.Clauses(clause.OnConflict{
-					Columns: []clause.Column{{Name: "device_id"}, {Name: "key"}},
-					DoUpdates: clause.Assignments(map[string]interface{}{
-						"value": tagM.Value,
-					}),
-				}).Create(&tagM).Error
-			}
-			if err != nil {
-				return errors.Wrapf(err, "failed to insert tag record %v", tagM)
-			}
+		err = saveTags(tx, dev.ApplicationID, dev.ID, model.Tags)
+		if err != nil {
+			return err
+		}
+
+		err = ensureUsers(tx, dev.ApplicationID, dev.ExternalUserID)
+		if err != nil {
+			return err
 		}
 		return nil
 	})
 
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to commit changes")
+		return nil, false, errors.Wrap(err, "failed to commit changes")
 	}
 
-	return dev.ToServiceModel(), nil
+	return dev.ToServiceModel(), created, nil
 }
 
 func (r *repository) GetDevice(uuid string, applicationID uint) (*devices.DeviceModel, error) {
@@ -250,27 +256,14 @@ func (r *repository) UpdatePartial(model devices.DeviceModel) (*devices.DeviceMo
 			dev.AmountSpent = *model.AmountSpent
 		}
 
-		for k, v := range model.Tags {
-			tagM := tag{
-				DeviceID: dev.ID,
-				Key:      k,
-				Value:    v,
-			}
-			if v == "" {
-				// Remove tag if value is empty
-				err = tx.Where("device_id = ? AND key = ?", tagM.DeviceID, tagM.Key).Delete(tag{}).Error
-			} else {
-				// Upsert tag if value is not empty
-				err = tx.Clauses(clause.OnConflict{
-					Columns: []clause.Column{{Name: "device_id"}, {Name: "key"}},
-					DoUpdates: clause.Assignments(map[string]interface{}{
-						"value": tagM.Value,
-					}),
-				}).Create(&tagM).Error
-			}
-			if err != nil {
-				return errors.Wrapf(err, "failed to insert tag record %v", tagM)
-			}
+		err = saveTags(tx, dev.ApplicationID, dev.ID, model.Tags)
+		if err != nil {
+			return err
+		}
+
+		err = ensureUsers(tx, dev.ApplicationID, dev.ExternalUserID)
+		if err != nil {
+			return err
 		}
 
 		err = tx.Save(dev).Error
@@ -283,41 +276,237 @@ func (r *repository) UpdatePartial(model devices.DeviceModel) (*devices.DeviceMo
 	return dev.ToServiceModel(), nil
 }
 
-func (r *repository) UpdateDeviceTagsByUser(applicationID uint, externalUserID string, Tags map[string]string) error {
+func (r *repository) UpdateDeviceTagsByUser(applicationID uint, externalUserID string, Tags map[string]string) ([]uint, error) {
 	var items []device
 	err := r.db.Where("application_id = ? AND external_user_id = ? ", applicationID, externalUserID).Find(&items).Error
 	if err != nil {
-		return getProcessedDBError(err)
+		return nil, getProcessedDBError(err)
 	}
 
 	err = r.db.Transaction(func(tx *gorm.DB) error {
+		// Tags are kept on the user too, so devices linked later get them as well
+		err = saveUsersTags(tx, applicationID, []devices.UserTagsModel{{ExternalUserID: externalUserID, Tags: Tags}})
+		if err != nil {
+			return err
+		}
 		for _, item := range items {
-			for k, v := range Tags {
-				tagM := tag{
-					DeviceID: item.ID,
-					Key:      k,
-					Value:    v,
-				}
-				if v == "" {
-					// Remove tag if value is empty
-					err = tx.Where("device_id = ? AND key = ?", tagM.DeviceID, tagM.Key).Delete(tag{}).Error
-				} else {
-					// Upsert tag if value is not empty
-					err = tx.Clauses(clause.OnConflict{
-						Columns: []clause.Column{{Name: "device_id"}, {Name: "key"}},
-						DoUpdates: clause.Assignments(map[string]interface{}{
-							"value": tagM.Value,
-						}),
-					}).Create(&tagM).Error
-				}
-				if err != nil {
-					return errors.Wrapf(err, "failed to insert tag record %v", tagM)
-				}
+			err = saveTags(tx, applicationID, item.ID, Tags)
+			if err != nil {
+				return err
 			}
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
 
+	deviceIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		deviceIDs = append(deviceIDs, item.ID)
+	}
+	return deviceIDs, nil
+}
+
+// userTagRow is a single tag change of a batch tags update, it is passed to postgres as a JSON record set
+type userTagRow struct {
+	ExternalUserID string     `json:"external_user_id"`
+	Key            string     `json:"key"`
+	Value          string     `json:"value"`
+	NumberValue    *float64   `json:"number_value"`
+	TimeValue      *time.Time `json:"time_value"`
+}
+
+func (r *repository) UpdateDeviceTagsByUsers(applicationID uint, items []devices.UserTagsModel) (map[string][]uint, error) {
+	upserts := make([]userTagRow, 0, len(items))
+	deletes := make([]userTagRow, 0)
+	users := make([]string, 0, len(items))
+	keys := make(map[string]string)
+	values := make(map[string]string)
+	for _, item := range items {
+		for k, v := range item.Tags {
+			values[k] = v
+		}
+	}
+	types, err := declaredTagTypes(r.db, applicationID, values)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		users = append(users, item.ExternalUserID)
+		for k, v := range item.Tags {
+			row := userTagRow{ExternalUserID: item.ExternalUserID, Key: k, Value: v}
+			if v == "" {
+				deletes = append(deletes, row)
+				continue
+			}
+			typed, err := newTag(0, k, v, types[k])
+			if err != nil {
+				return nil, err
+			}
+			if typed.NumberValue.Valid {
+				row.NumberValue = &typed.NumberValue.Float64
+			}
+			if typed.TimeValue.Valid {
+				row.TimeValue = &typed.TimeValue.Time
+			}
+			upserts = append(upserts, row)
+			keys[k] = v
+		}
+	}
+
+	var matched []device
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		// Tags are kept on the users too, so devices linked later get them as well
+		if err := saveUsersTags(tx, applicationID, items); err != nil {
+			return err
+		}
+
+		if len(upserts) > 0 {
+			payload, err := json.Marshal(upserts)
+			if err != nil {
+				return errors.Wrap(err, "failed to encode tags")
+			}
+			err = tx.Exec(`INSERT INTO tags (device_id, key, value, number_value, time_value)
+				SELECT devices.id, t.key, t.value, t.number_value, t.time_value
+				FROM jsonb_to_recordset(?::jsonb) AS t(external_user_id text, key text, value text, number_value float8, time_value timestamptz)
+				JOIN devices ON devices.external_user_id = t.external_user_id AND devices.application_id = ?
+				ON CONFLICT (device_id, key) DO UPDATE SET value = excluded.value, number_value = excluded.number_value,
+				time_value = excluded.time_value`, string(payload), applicationID).Error
+			if err != nil {
+				return errors.Wrap(err, "failed to upsert tags")
+			}
+			if err = recordTagKeys(tx, applicationID, keys); err != nil {
+				return err
+			}
+		}
+
+		if len(deletes) > 0 {
+			payload, err := json.Marshal(deletes)
+			if err != nil {
+				return errors.Wrap(err, "failed to encode tags")
+			}
+			err = tx.Exec(`DELETE FROM tags
+				USING devices, jsonb_to_recordset(?::jsonb) AS t(external_user_id text, key text)
+				WHERE tags.device_id = devices.id AND devices.application_id = ?
+				AND devices.external_user_id = t.external_user_id AND tags.key = t.key`, string(payload), applicationID).Error
+			if err != nil {
+				return errors.Wrap(err, "failed to delete tags")
+			}
+		}
+
+		return tx.Select("id", "external_user_id").
+			Where("application_id = ? AND external_user_id IN ?", applicationID, users).Find(&matched).Error
+	})
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+
+	result := make(map[string][]uint)
+	for _, item := range matched {
+		result[item.ExternalUserID] = append(result[item.ExternalUserID], item.ID)
+	}
+	return result, nil
+}
+
+func (r *repository) GetDeviceIDsByExternalUserID(applicationID uint, externalUserID string) ([]uint, error) {
+	var deviceIDs []uint
+	err := r.db.Model(&device{}).Where("application_id = ? AND external_user_id = ?", applicationID, externalUserID).Pluck("id", &deviceIDs).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return deviceIDs, nil
+}
+
+func (r *repository) IncrementSession(uuid string, applicationID uint, model devices.SessionModel) error {
+	changes := map[string]interface{}{
+		"session_count":  gorm.Expr("session_count + 1"),
+		"last_active_at": time.Now(),
+	}
+	if model.AppVersion != nil {
+		changes["app_version"] = *model.AppVersion
+	}
+	if model.Language != nil {
+		changes["language"] = *model.Language
+	}
+
+	res := r.db.Model(&device{}).Where("uuid = ? AND application_id = ?", uuid, applicationID).Updates(changes)
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) IncrementUsageTime(uuid string, applicationID uint, seconds int) error {
+	res := r.db.Model(&device{}).Where("uuid = ? AND application_id = ?", uuid, applicationID).Updates(map[string]interface{}{
+		"total_usage_time": gorm.Expr("total_usage_time + ?", seconds),
+		"last_active_at":   time.Now(),
+	})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
 	return nil
 }
+
+func (r *repository) DeviceExists(identifier string, ADID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&device{}).Where("identifier = ? AND ad_id = ?", identifier, ADID).Count(&count).Error
+	if err != nil {
+		return false, getProcessedDBError(err)
+	}
+	return count > 0, nil
+}
+
+func (r *repository) GetDeviceTagKeys(selector devices.DeviceSelectorModel) ([]devices.DeviceTagKeysModel, error) {
+	query := r.db.Select("id", "application_id", "external_user_id")
+	switch {
+	case selector.UUID != "":
+		query = query.Where("uuid = ?", selector.UUID)
+	case len(selector.ExternalUserIDs) > 0:
+		query = query.Where("external_user_id IN ?", selector.ExternalUserIDs)
+	default:
+		query = query.Where("identifier = ? AND ad_id = ?", selector.Identifier, selector.ADID)
+	}
+	if selector.ApplicationID != 0 {
+		query = query.Where("application_id = ?", selector.ApplicationID)
+	}
+	var items []device
+	err := query.Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	var tagItems []tag
+	err = r.db.Select("device_id", "key").Where("device_id IN ?", ids).Find(&tagItems).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	keys := make(map[uint][]string, len(items))
+	for _, item := range tagItems {
+		keys[item.DeviceID] = append(keys[item.DeviceID], item.Key)
+	}
+
+	result := make([]devices.DeviceTagKeysModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, devices.DeviceTagKeysModel{
+			DeviceID:       item.ID,
+			ApplicationID:  item.ApplicationID,
+			ExternalUserID: item.ExternalUserID,
+			Keys:           keys[item.ID],
+		})
+	}
+	return result, nil
+}
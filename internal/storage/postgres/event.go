@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/subzerobo/ratatoskr/internal/services/events"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// event is stored in a table partitioned by month of occurred_at, so the table is created by migrateEvents
+// instead of AutoMigrate which doesn't support partitioned tables
+type event struct {
+	ID             uint `gorm:"primary_key"`
+	ApplicationID  uint
+	DeviceID       *uint
+	ExternalUserID string
+	Name           string
+	Properties     string
+	OccurredAt     time.Time
+	CreatedAt      time.Time
+}
+
+const eventsTableDDL = `
+CREATE TABLE IF NOT EXISTS events (
+	id               bigserial,
+	application_id   bigint       NOT NULL,
+	device_id        bigint,
+	external_user_id varchar(255) NOT NULL DEFAULT '',
+	name             varchar(128) NOT NULL,
+	properties       jsonb,
+	occurred_at      timestamptz  NOT NULL,
+	created_at       timestamptz  NOT NULL DEFAULT current_timestamp,
+	PRIMARY KEY (id, occurred_at)
+) PARTITION BY RANGE (occurred_at);
+CREATE INDEX IF NOT EXISTS idx_events_device ON events (device_id, name, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_events_user ON events (application_id, external_user_id, name, occurred_at);
+`
+
+// migrateEvents creates the partitioned events table alongside with partitions of the current and next month
+func (r *repository) migrateEvents() error {
+	err := r.db.Exec(eventsTableDDL).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate events table")
+	}
+	now := time.Now()
+	return r.ensureEventPartitions(now, now.AddDate(0, 1, 0))
+}
+
+// ensureEventPartitions creates the monthly partitions of given times if they are not created yet
+func (r *repository) ensureEventPartitions(times ...time.Time) error {
+	for _, t := range times {
+		from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		name := fmt.Sprintf("events_y%04dm%02d", from.Year(), from.Month())
+		if _, ok := r.eventPartitions.Load(name); ok {
+			continue
+		}
+		err := r.db.Exec(fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF events FOR VALUES FROM ('%s') TO ('%s')`,
+			name, from.Format(time.RFC3339), from.AddDate(0, 1, 0).Format(time.RFC3339),
+		)).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to create events partition %s", name)
+		}
+		r.eventPartitions.Store(name, true)
+	}
+	return nil
+}
+
+func (r *repository) CreateEvents(models []events.EventModel) error {
+	items := make([]event, 0, len(models))
+	times := make([]time.Time, 0, len(models))
+	for _, model := range models {
+		properties, err := json.Marshal(model.Properties)
+		if err != nil {
+			return errors.WithKindCtx(err, "failed to encode event properties", errors.UnprocessableEntity, nil)
+		}
+		item := event{
+			ApplicationID:  model.ApplicationID,
+			ExternalUserID: model.ExternalUserID,
+			Name:           model.Name,
+			Properties:     string(properties),
+			OccurredAt:     model.OccurredAt.UTC(),
+		}
+		if model.DeviceID != 0 {
+			deviceID := model.DeviceID
+			item.DeviceID = &deviceID
+		}
+		items = append(items, item)
+		times = append(times, item.OccurredAt)
+	}
+
+	if err := r.ensureEventPartitions(times...); err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("ID", "CreatedAt").CreateInBatches(&items, 100).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to insert event records")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/exports"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type deviceExport struct {
+	ID            uint         `gorm:"primary_key"`
+	UUID          string       `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	Format        string       `gorm:"size:10"`
+	SegmentUUID   string       `gorm:"size:36"`
+	Filters       string       `gorm:"type:text"` // JSON encoded []segments.FilterModel
+	Status        string       `gorm:"size:20;index:idx_export_due,priority:1"`
+	Rows          int          `gorm:"not null;default:0"`
+	Size          int64        `gorm:"not null;default:0"`
+	BlobKey       string       `gorm:"size:512"`
+	Error         string       `gorm:"type:text"`
+	NextRunAt     time.Time    `gorm:"index:idx_export_due,priority:2"`
+	ExpiresAt     sql.NullTime `gorm:"index"`
+	FinishedAt    sql.NullTime
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"index"`
+	Application   application
+}
+
+func (e deviceExport) ToServiceModel() *exports.ExportModel {
+	res := &exports.ExportModel{
+		ID:            e.ID,
+		UUID:          e.UUID,
+		ApplicationID: e.ApplicationID,
+		Format:        exports.Format(e.Format),
+		SegmentUUID:   e.SegmentUUID,
+		Status:        exports.Status(e.Status),
+		Rows:          e.Rows,
+		Size:          e.Size,
+		BlobKey:       e.BlobKey,
+		Error:         e.Error,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(e.Filters), &res.Filters)
+	if e.ExpiresAt.Valid {
+		res.ExpiresAt = &e.ExpiresAt.Time
+	}
+	if e.FinishedAt.Valid {
+		res.FinishedAt = &e.FinishedAt.Time
+	}
+	return res
+}
+
+func (r *repository) CreateExport(model exports.ExportModel) (*exports.ExportModel, error) {
+	if model.Filters == nil {
+		model.Filters = []segments.FilterModel{}
+	}
+	filters, err := json.Marshal(model.Filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode export filters")
+	}
+	item := deviceExport{
+		Format:        string(model.Format),
+		SegmentUUID:   model.SegmentUUID,
+		Filters:       string(filters),
+		Status:        string(model.Status),
+		BlobKey:       model.BlobKey,
+		NextRunAt:     time.Now(),
+		ApplicationID: model.ApplicationID,
+	}
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetExports(applicationID uint) ([]*exports.ExportModel, error) {
+	var items []deviceExport
+	err := r.db.Where("application_id = ?", applicationID).Order("id DESC").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*exports.ExportModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetExport(applicationID uint, UUID string) (*exports.ExportModel, error) {
+	var item deviceExport
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetExportByUUID(UUID string) (*exports.ExportModel, error) {
+	var item deviceExport
+	err := r.db.Where("uuid = ?", UUID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) ClaimDueExport(lease time.Duration) (*exports.ExportModel, error) {
+	var items []deviceExport
+	err := r.db.Raw(`UPDATE device_exports SET status = ?, next_run_at = ?
+		WHERE id IN (
+			SELECT id FROM device_exports
+			WHERE status IN (?, ?) AND next_run_at <= ?
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) RETURNING *`, string(exports.StatusRunning), time.Now().Add(lease),
+		string(exports.StatusPending), string(exports.StatusRunning), time.Now()).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(items) == 0 {
+		return nil, getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return items[0].ToServiceModel(), nil
+}
+
+func (r *repository) FinishExport(ID uint, result exports.ResultModel) error {
+	changes := map[string]interface{}{
+		"status":      string(result.Status),
+		"rows":        result.Rows,
+		"size":        result.Size,
+		"error":       result.Error,
+		"finished_at": time.Now(),
+	}
+	if !result.ExpiresAt.IsZero() {
+		changes["expires_at"] = result.ExpiresAt
+	}
+	return r.db.Model(&deviceExport{}).Where("id = ?", ID).Updates(changes).Error
+}
+
+func (r *repository) GetExpiredExports(limit int) ([]*exports.ExportModel, error) {
+	var items []deviceExport
+	err := r.db.Where("status = ? AND expires_at <= ?", string(exports.StatusCompleted), time.Now()).
+		Order("expires_at").Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*exports.ExportModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) ExpireExport(ID uint) error {
+	return r.db.Model(&deviceExport{}).Where("id = ?", ID).Update("status", string(exports.StatusExpired)).Error
+}
+
+func (r *repository) GetExportDevices(applicationID uint, filters []segments.FilterModel, lastID uint, limit int) ([]*exports.DeviceRowModel, error) {
+	var items []device
+	// Keyset pagination keeps every page equally cheap regardless of the export size
+	err := r.segmentQuery(applicationID, filters).Preload("Tags").
+		Where("devices.id > ?", lastID).Order("devices.id").Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*exports.DeviceRowModel, 0, len(items))
+	for _, d := range items {
+		row := &exports.DeviceRowModel{
+			ID:                d.ID,
+			UUID:              d.UUID,
+			Identifier:        d.Identifier,
+			DeviceType:        d.DeviceType,
+			ADID:              d.ADID,
+			Language:          d.Language,
+			Timezone:          d.Timezone,
+			AppVersion:        d.AppVersion,
+			DeviceVendor:      d.DeviceVendor,
+			DeviceModel:       d.DeviceModel,
+			DeviceOS:          d.DeviceOS,
+			DeviceOSVersion:   d.DeviceOSVersion,
+			SDK:               d.SDK,
+			SessionCount:      d.SessionCount,
+			NotificationTypes: d.NotificationTypes,
+			Country:           d.Country,
+			ExternalUserID:    d.ExternalUserID,
+			AmountSpent:       d.AmountSpent,
+			TotalUsageTime:    d.TotalUsageTime,
+			Tags:              make(map[string]string, len(d.Tags)),
+			CreatedAt:         d.CreatedAt,
+			LastActiveAt:      d.LastActiveAt.Time,
+		}
+		for _, t := range d.Tags {
+			row.Tags[t.Key] = t.Value
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"time"
+)
+
+// impersonation is the audit record of a super user logging in as another account, the emails are kept as they were
+// at the time of the impersonation
+type impersonation struct {
+	ID           uint      `gorm:"primary_key"`
+	UUID         string    `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	AdminID      uint      `gorm:"index"`
+	AdminEmail   string    `gorm:"size:50"`
+	AccountID    uint      `gorm:"index"`
+	AccountEmail string    `gorm:"size:50"`
+	SessionUUID  string    `gorm:"type:uuid;index"`
+	Reason       string    `gorm:"type:text"`
+	CreatedAt    time.Time `gorm:"default:current_timestamp;index"`
+}
+
+func (i impersonation) ToServiceModel() *authentication2.ImpersonationModel {
+	return &authentication2.ImpersonationModel{
+		ID:           i.ID,
+		UUID:         i.UUID,
+		AdminID:      i.AdminID,
+		AdminEmail:   i.AdminEmail,
+		AccountID:    i.AccountID,
+		AccountEmail: i.AccountEmail,
+		SessionUUID:  i.SessionUUID,
+		Reason:       i.Reason,
+		CreatedAt:    i.CreatedAt,
+	}
+}
+
+func (r *repository) CreateImpersonation(model authentication2.ImpersonationModel) (*authentication2.ImpersonationModel, error) {
+	item := impersonation{
+		AdminID:      model.AdminID,
+		AdminEmail:   model.AdminEmail,
+		AccountID:    model.AccountID,
+		AccountEmail: model.AccountEmail,
+		SessionUUID:  model.SessionUUID,
+		Reason:       model.Reason,
+	}
+	err := r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetImpersonations(offset int, limit int) ([]*authentication2.ImpersonationModel, error) {
+	var items []impersonation
+	err := r.db.Order("id desc").Offset(offset).Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*authentication2.ImpersonationModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
@@ -0,0 +1,309 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/subzerobo/ratatoskr/internal/services/imports"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// importInsertBatch keeps multi-row inserts below the bind parameter limit of postgres
+const importInsertBatch = 1000
+
+type deviceImport struct {
+	ID            uint   `gorm:"primary_key"`
+	UUID          string `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	FileName      string `gorm:"size:255"`
+	Format        string `gorm:"size:10"`
+	Checksum      string `gorm:"size:64;uniqueIndex:idx_import_checksum"`
+	BlobKey       string `gorm:"size:512"`
+	Size          int64
+	Status        string    `gorm:"size:20;index:idx_import_due,priority:1"`
+	ProcessedRows int       `gorm:"not null;default:0"`
+	ImportedRows  int       `gorm:"not null;default:0"`
+	FailedRows    int       `gorm:"not null;default:0"`
+	Error         string    `gorm:"type:text"`
+	NextRunAt     time.Time `gorm:"index:idx_import_due,priority:2"`
+	FinishedAt    sql.NullTime
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"index;uniqueIndex:idx_import_checksum"`
+	Application   application
+}
+
+type deviceImportError struct {
+	ID             uint `gorm:"primary_key"`
+	DeviceImportID uint `gorm:"index"`
+	Row            int
+	Message        string       `gorm:"type:text"`
+	DeviceImport   deviceImport `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (i deviceImport) ToServiceModel() *imports.ImportModel {
+	res := &imports.ImportModel{
+		ID:            i.ID,
+		UUID:          i.UUID,
+		ApplicationID: i.ApplicationID,
+		FileName:      i.FileName,
+		Format:        imports.Format(i.Format),
+		Checksum:      i.Checksum,
+		BlobKey:       i.BlobKey,
+		Size:          i.Size,
+		Status:        imports.Status(i.Status),
+		ProcessedRows: i.ProcessedRows,
+		ImportedRows:  i.ImportedRows,
+		FailedRows:    i.FailedRows,
+		Error:         i.Error,
+		CreatedAt:     i.CreatedAt,
+		UpdatedAt:     i.UpdatedAt,
+	}
+	if i.FinishedAt.Valid {
+		res.FinishedAt = &i.FinishedAt.Time
+	}
+	return res
+}
+
+func (r *repository) CreateImport(model imports.ImportModel) (*imports.ImportModel, error) {
+	item := deviceImport{
+		FileName:      model.FileName,
+		Format:        string(model.Format),
+		Checksum:      model.Checksum,
+		BlobKey:       model.BlobKey,
+		Size:          model.Size,
+		Status:        string(model.Status),
+		NextRunAt:     time.Now(),
+		ApplicationID: model.ApplicationID,
+	}
+	err := r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetImports(applicationID uint) ([]*imports.ImportModel, error) {
+	var items []deviceImport
+	err := r.db.Where("application_id = ?", applicationID).Order("id DESC").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*imports.ImportModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetImport(applicationID uint, UUID string) (*imports.ImportModel, error) {
+	var item deviceImport
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetImportByChecksum(applicationID uint, checksum string) (*imports.ImportModel, error) {
+	var item deviceImport
+	err := r.db.Where("checksum = ? AND application_id = ?", checksum, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetImportErrors(importID uint, offset int, limit int) ([]*imports.RowErrorModel, error) {
+	var items []deviceImportError
+	err := r.db.Where("device_import_id = ?", importID).Order("row").Offset(offset).Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*imports.RowErrorModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, &imports.RowErrorModel{Row: item.Row, Message: item.Message})
+	}
+	return result, nil
+}
+
+func (r *repository) RetryImport(model imports.ImportModel) (*imports.ImportModel, error) {
+	var item deviceImport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&deviceImport{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
+			"status":      string(imports.StatusPending),
+			"blob_key":    model.BlobKey,
+			"error":       "",
+			"next_run_at": time.Now(),
+			"finished_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", model.ID).First(&item).Error
+	})
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) ClaimDueImport(lease time.Duration) (*imports.ImportModel, error) {
+	var items []deviceImport
+	// Same lease based claiming as journey progresses, an import stays running until it is finished
+	err := r.db.Raw(`UPDATE device_imports SET status = ?, next_run_at = ?
+		WHERE id IN (
+			SELECT id FROM device_imports
+			WHERE status IN (?, ?) AND next_run_at <= ?
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) RETURNING *`, string(imports.StatusRunning), time.Now().Add(lease),
+		string(imports.StatusPending), string(imports.StatusRunning), time.Now()).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(items) == 0 {
+		return nil, getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return items[0].ToServiceModel(), nil
+}
+
+func (r *repository) FinishImport(ID uint, status imports.Status, message string) error {
+	return r.db.Model(&deviceImport{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"status":      string(status),
+		"error":       message,
+		"finished_at": time.Now(),
+	}).Error
+}
+
+func (r *repository) ImportDevices(applicationID uint, rows []imports.DeviceRowModel, batch imports.BatchModel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(rows) > 0 {
+			if err := importDevices(tx, applicationID, rows); err != nil {
+				return err
+			}
+		}
+
+		if len(batch.Errors) > 0 {
+			items := make([]deviceImportError, 0, len(batch.Errors))
+			for _, e := range batch.Errors {
+				items = append(items, deviceImportError{DeviceImportID: batch.ImportID, Row: e.Row, Message: e.Message})
+			}
+			if err := tx.Omit("DeviceImport").CreateInBatches(items, importInsertBatch).Error; err != nil {
+				return errors.Wrap(err, "failed to insert import errors")
+			}
+		}
+
+		// Checkpoint is moved in the same transaction, so a crashed worker never imports a batch twice
+		return tx.Model(&deviceImport{}).Where("id = ?", batch.ImportID).Updates(map[string]interface{}{
+			"processed_rows": gorm.Expr("processed_rows + ?", batch.ProcessedRows),
+			"imported_rows":  gorm.Expr("imported_rows + ?", batch.ImportedRows),
+			"failed_rows":    gorm.Expr("failed_rows + ?", batch.FailedRows),
+			"next_run_at":    batch.NextRunAt,
+		}).Error
+	})
+}
+
+// importDevices upserts the devices and their tags with multi-row statements
+func importDevices(tx *gorm.DB, applicationID uint, rows []imports.DeviceRowModel) error {
+	items := make([]device, 0, len(rows))
+	identifiers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, device{
+			Identifier:        row.Identifier,
+			DeviceType:        row.DeviceType,
+			ADID:              row.ADID,
+			Language:          row.Language,
+			Timezone:          row.Timezone,
+			AppVersion:        row.AppVersion,
+			DeviceVendor:      row.DeviceVendor,
+			DeviceModel:       row.DeviceModel,
+			DeviceOS:          row.DeviceOS,
+			DeviceOSVersion:   row.DeviceOSVersion,
+			SDK:               row.SDK,
+			SessionCount:      row.SessionCount,
+			NotificationTypes: row.NotificationTypes,
+			Country:           row.Country,
+			ExternalUserID:    row.ExternalUserID,
+			AmountSpent:       row.AmountSpent,
+			ApplicationID:     applicationID,
+		})
+		identifiers = append(identifiers, row.Identifier)
+	}
+
+	// Devices registered by other applications with the same identifier are left untouched
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "identifier"}},
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "devices.application_id = excluded.application_id"},
+		}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"device_type", "ad_id", "language", "timezone", "app_version", "device_vendor", "device_model", "device_os",
+			"device_os_version", "sdk", "session_count", "notification_types", "country", "external_user_id", "amount_spent",
+		}),
+	}).Omit("Tags", "Application").CreateInBatches(items, importInsertBatch).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to upsert imported devices")
+	}
+
+	externalUserIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		externalUserIDs = append(externalUserIDs, row.ExternalUserID)
+	}
+	if err = ensureUsers(tx, applicationID, externalUserIDs...); err != nil {
+		return err
+	}
+
+	var existing []device
+	err = tx.Select("id", "identifier").Where("application_id = ? AND identifier IN ?", applicationID, identifiers).Find(&existing).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to load imported devices")
+	}
+	deviceIDs := make(map[string]uint, len(existing))
+	for _, item := range existing {
+		deviceIDs[item.Identifier] = item.ID
+	}
+
+	keys := make(map[string]string)
+	for _, row := range rows {
+		for k, v := range row.Tags {
+			if v != "" {
+				keys[k] = v
+			}
+		}
+	}
+	types, err := declaredTagTypes(tx, applicationID, keys)
+	if err != nil {
+		return err
+	}
+
+	var tagItems []tag
+	for _, row := range rows {
+		deviceID, ok := deviceIDs[row.Identifier]
+		if !ok {
+			continue
+		}
+		for k, v := range row.Tags {
+			if v == "" {
+				continue
+			}
+			item, err := newTag(deviceID, k, v, types[k])
+			if err != nil {
+				return err
+			}
+			tagItems = append(tagItems, item)
+		}
+	}
+	if len(tagItems) == 0 {
+		return nil
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "number_value", "time_value"}),
+	}).Omit("Device").CreateInBatches(tagItems, importInsertBatch).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to upsert imported tags")
+	}
+	return recordTagKeys(tx, applicationID, keys)
+}
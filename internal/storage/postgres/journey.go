@@ -0,0 +1,259 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type journey struct {
+	ID            uint      `gorm:"primary_key"`
+	UUID          string    `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	Name          string    `gorm:"size:255"`
+	Active        bool      `gorm:"not null;default:false"`
+	TriggerType   string    `gorm:"size:50;index"`
+	TriggerKey    string    `gorm:"size:255"`
+	TriggerValue  string    `gorm:"size:255"`
+	Steps         string    `gorm:"type:text"` // JSON encoded []journeys.StepModel
+	ExitRules     string    `gorm:"type:text"` // JSON encoded []journeys.ConditionModel
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"index"`
+	Application   application
+}
+
+type journeyProgress struct {
+	ID            uint      `gorm:"primary_key"`
+	JourneyID     uint      `gorm:"uniqueIndex:idx_journey_device"`
+	DeviceID      uint      `gorm:"uniqueIndex:idx_journey_device;index"`
+	ApplicationID uint      `gorm:"index"`
+	StepKey       string    `gorm:"size:255"`
+	Status        string    `gorm:"size:20;index:idx_journey_due,priority:1"`
+	Waiting       bool      `gorm:"not null;default:false"`
+	NextRunAt     time.Time `gorm:"index:idx_journey_due,priority:2"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	Journey       journey   `gorm:"constraint:OnDelete:CASCADE;"`
+	Device        device    `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (j journey) ToServiceModel() *journeys.JourneyModel {
+	res := &journeys.JourneyModel{
+		ID:            j.ID,
+		UUID:          j.UUID,
+		ApplicationID: j.ApplicationID,
+		Name:          j.Name,
+		Active:        j.Active,
+		Trigger: journeys.TriggerModel{
+			Type:  journeys.TriggerType(j.TriggerType),
+			Key:   j.TriggerKey,
+			Value: j.TriggerValue,
+		},
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+	// Definitions are always written by fromJourneyModel, decoding errors would mean manual changes
+	_ = json.Unmarshal([]byte(j.Steps), &res.Steps)
+	_ = json.Unmarshal([]byte(j.ExitRules), &res.ExitRules)
+	return res
+}
+
+func (p journeyProgress) ToServiceModel() *journeys.ProgressModel {
+	return &journeys.ProgressModel{
+		ID:            p.ID,
+		JourneyID:     p.JourneyID,
+		DeviceID:      p.DeviceID,
+		ApplicationID: p.ApplicationID,
+		StepKey:       p.StepKey,
+		Status:        journeys.ProgressStatus(p.Status),
+		Waiting:       p.Waiting,
+		NextRunAt:     p.NextRunAt,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+	}
+}
+
+func fromJourneyModel(model journeys.JourneyModel) (journey, error) {
+	steps, err := json.Marshal(model.Steps)
+	if err != nil {
+		return journey{}, errors.Wrap(err, "failed to encode journey steps")
+	}
+	if model.ExitRules == nil {
+		model.ExitRules = []journeys.ConditionModel{}
+	}
+	exitRules, err := json.Marshal(model.ExitRules)
+	if err != nil {
+		return journey{}, errors.Wrap(err, "failed to encode journey exit rules")
+	}
+	return journey{
+		Name:          model.Name,
+		Active:        model.Active,
+		TriggerType:   string(model.Trigger.Type),
+		TriggerKey:    model.Trigger.Key,
+		TriggerValue:  model.Trigger.Value,
+		Steps:         string(steps),
+		ExitRules:     string(exitRules),
+		ApplicationID: model.ApplicationID,
+	}, nil
+}
+
+func (r *repository) CreateJourney(model journeys.JourneyModel) (*journeys.JourneyModel, error) {
+	item, err := fromJourneyModel(model)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) UpdateJourney(model journeys.JourneyModel) (*journeys.JourneyModel, error) {
+	changes, err := fromJourneyModel(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var item journey
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("uuid = ? AND application_id = ?", model.UUID, model.ApplicationID).First(&item).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+
+		item.Name = changes.Name
+		item.Active = changes.Active
+		item.TriggerType = changes.TriggerType
+		item.TriggerKey = changes.TriggerKey
+		item.TriggerValue = changes.TriggerValue
+		item.Steps = changes.Steps
+		item.ExitRules = changes.ExitRules
+		return tx.Save(&item).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetJourneys(applicationID uint) ([]*journeys.JourneyModel, error) {
+	var items []journey
+	err := r.db.Where("application_id = ?", applicationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*journeys.JourneyModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetJourney(applicationID uint, UUID string) (*journeys.JourneyModel, error) {
+	var item journey
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetJourneyByID(ID uint) (*journeys.JourneyModel, error) {
+	var item journey
+	err := r.db.Where("id = ?", ID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetActiveJourneysByTrigger(applicationID uint, trigger journeys.TriggerType) ([]*journeys.JourneyModel, error) {
+	var items []journey
+	err := r.db.Where("application_id = ? AND trigger_type = ? AND active = ?", applicationID, string(trigger), true).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*journeys.JourneyModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) DeleteJourney(applicationID uint, UUID string) error {
+	res := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).Delete(journey{})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) EnrollDevice(model journeys.ProgressModel) error {
+	item := journeyProgress{
+		JourneyID:     model.JourneyID,
+		DeviceID:      model.DeviceID,
+		ApplicationID: model.ApplicationID,
+		StepKey:       model.StepKey,
+		Status:        string(model.Status),
+		NextRunAt:     model.NextRunAt,
+	}
+	// A device enters each journey only once
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "journey_id"}, {Name: "device_id"}},
+		DoNothing: true,
+	}).Create(&item).Error
+}
+
+func (r *repository) ClaimDueProgresses(limit int, lease time.Duration) ([]*journeys.ProgressModel, error) {
+	var items []journeyProgress
+	// Claimed rows are pushed forward by the lease, so parallel workers skip them and
+	// crashed workers hand them over to others after the lease is over
+	err := r.db.Raw(`UPDATE journey_progresses SET next_run_at = ?
+		WHERE id IN (
+			SELECT id FROM journey_progresses
+			WHERE status = ? AND next_run_at <= ?
+				AND application_id NOT IN (SELECT id FROM applications WHERE deleted_at IS NOT NULL)
+			ORDER BY next_run_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		) RETURNING *`, time.Now().Add(lease), string(journeys.ProgressActive), time.Now(), limit).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*journeys.ProgressModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) UpdateProgress(model journeys.ProgressModel) error {
+	return r.db.Model(&journeyProgress{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
+		"step_key":    model.StepKey,
+		"status":      string(model.Status),
+		"waiting":     model.Waiting,
+		"next_run_at": model.NextRunAt,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+func (r *repository) GetDeviceTags(deviceID uint) (map[string]string, error) {
+	var items []tag
+	err := r.db.Where("device_id = ?", deviceID).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make(map[string]string)
+	for _, item := range items {
+		result[item.Key] = item.Value
+	}
+	return result, nil
+}
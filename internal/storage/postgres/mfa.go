@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type recoveryCode struct {
+	ID        uint   `gorm:"primary_key"`
+	Hash      string `gorm:"size:64;index"` // sha256 hash of the recovery code
+	UsedAt    sql.NullTime
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	AccountID uint      `gorm:"index"`
+	Account   account
+}
+
+func (r *repository) GetMFASecret(ID uint) (string, error) {
+	var acc account
+	err := r.db.Select("id", "mfa_secret").Where("id = ?", ID).First(&acc).Error
+	if err != nil {
+		return "", getProcessedDBError(err)
+	}
+	if acc.MFASecret == "" {
+		return "", nil
+	}
+	return r.decryptSecret(acc.MFASecret)
+}
+
+func (r *repository) UpdateMFASecret(ID uint, secret string) error {
+	encrypted, err := r.encryptSecret(secret)
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&account{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"mfa_secret":  encrypted,
+		"mfa_enabled": false,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+func (r *repository) UpdateMFAStep(ID uint, step int64) error {
+	res := r.db.Model(&account{}).Where("id = ? AND mfa_last_step < ?", ID, step).UpdateColumn("mfa_last_step", step)
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) EnableMFA(ID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&account{}).Where("id = ?", ID).Updates(map[string]interface{}{
+			"mfa_enabled": true,
+			"updated_at":  time.Now(),
+		}).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		return replaceRecoveryCodes(tx, ID, codeHashes)
+	})
+}
+
+func (r *repository) DisableMFA(ID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&account{}).Where("id = ?", ID).Updates(map[string]interface{}{
+			"mfa_secret":  "",
+			"mfa_enabled": false,
+			"updated_at":  time.Now(),
+		}).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		return replaceRecoveryCodes(tx, ID, nil)
+	})
+}
+
+func (r *repository) ReplaceRecoveryCodes(ID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, ID, codeHashes)
+	})
+}
+
+func (r *repository) UseRecoveryCode(ID uint, codeHash string) error {
+	res := r.db.Model(&recoveryCode{}).Where("account_id = ? AND hash = ? AND used_at IS NULL", ID, codeHash).
+		UpdateColumn("used_at", time.Now())
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// rekeyMFASecrets re-encrypts the two-factor secrets encrypted with a retired key, see RekeySecrets
+func (r *repository) rekeyMFASecrets(batchSize int) (int, error) {
+	updated := 0
+	lastID := uint(0)
+	for {
+		var items []account
+		err := r.db.Select("id", "uuid", "mfa_secret").Where("id > ? AND mfa_secret <> ''", lastID).
+			Order("id").Limit(batchSize).Find(&items).Error
+		if err != nil {
+			return updated, getProcessedDBError(err)
+		}
+		for _, item := range items {
+			lastID = item.ID
+			if !r.secrets.NeedsRekey(item.MFASecret) {
+				continue
+			}
+			secret, err := r.rekeySecret(item.MFASecret)
+			if err != nil {
+				return updated, errors.Wrapf(err, "failed to rekey two-factor secret of account %s", item.UUID)
+			}
+			// The secret is only replaced if it has not been changed meanwhile
+			err = r.db.Model(&account{}).Where("id = ? AND mfa_secret = ?", item.ID, item.MFASecret).
+				UpdateColumn("mfa_secret", secret).Error
+			if err != nil {
+				return updated, errors.Wrapf(err, "failed to rekey two-factor secret of account %s", item.UUID)
+			}
+			updated++
+		}
+		if len(items) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, accountID uint, codeHashes []string) error {
+	err := tx.Where("account_id = ?", accountID).Delete(&recoveryCode{}).Error
+	if err != nil {
+		return getProcessedDBError(err)
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	items := make([]recoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		items = append(items, recoveryCode{AccountID: accountID, Hash: hash})
+	}
+	err = tx.Create(&items).Error
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return nil
+}
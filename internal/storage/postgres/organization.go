@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/applications"
+	"github.com/subzerobo/ratatoskr/internal/services/organizations"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type organization struct {
+	ID        uint      `gorm:"primary_key"`
+	UUID      string    `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	Name      string    `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt time.Time `gorm:"default:current_timestamp"`
+}
+
+func (o organization) ToServiceModel(role applications.Role) *organizations.OrganizationModel {
+	return &organizations.OrganizationModel{
+		ID:        o.ID,
+		UUID:      o.UUID,
+		Name:      o.Name,
+		Role:      role,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+type organizationMember struct {
+	ID             uint      `gorm:"primary_key"`
+	UUID           string    `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	Role           string    `gorm:"size:16"`
+	CreatedAt      time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt      time.Time `gorm:"default:current_timestamp"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_organization_member"`
+	Organization   organization
+	AccountID      uint `gorm:"uniqueIndex:idx_organization_member;index"`
+	Account        account
+}
+
+func (m organizationMember) ToServiceModel() *organizations.MemberModel {
+	return &organizations.MemberModel{
+		ID:             m.ID,
+		UUID:           m.UUID,
+		OrganizationID: m.OrganizationID,
+		AccountID:      m.AccountID,
+		AccountUUID:    m.Account.UUID,
+		Email:          m.Account.Email,
+		Role:           applications.Role(m.Role),
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+type organizationInvitation struct {
+	ID             uint      `gorm:"primary_key"`
+	UUID           string    `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	Email          string    `gorm:"size:255;uniqueIndex:idx_organization_invitation"`
+	Role           string    `gorm:"size:16"`
+	TokenHash      string    `gorm:"size:64;uniqueIndex"` // sha256 hash of the token sent in the invitation email
+	ExpiresAt      time.Time `gorm:"index"`
+	InvitedByID    uint
+	CreatedAt      time.Time `gorm:"default:current_timestamp"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_organization_invitation"`
+	Organization   organization
+}
+
+func (i organizationInvitation) ToServiceModel() *organizations.InvitationModel {
+	return &organizations.InvitationModel{
+		ID:             i.ID,
+		UUID:           i.UUID,
+		OrganizationID: i.OrganizationID,
+		Email:          i.Email,
+		Role:           applications.Role(i.Role),
+		TokenHash:      i.TokenHash,
+		InvitedByID:    i.InvitedByID,
+		ExpiresAt:      i.ExpiresAt,
+		CreatedAt:      i.CreatedAt,
+	}
+}
+
+// applicationMember is the role a member of the organization has been given on one of its applications
+type applicationMember struct {
+	ID            uint      `gorm:"primary_key"`
+	Role          string    `gorm:"size:16"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"uniqueIndex:idx_application_member"`
+	Application   application
+	AccountID     uint `gorm:"uniqueIndex:idx_application_member;index"`
+	Account       account
+}
+
+func (r *repository) CreateOrganization(model organizations.OrganizationModel, ownerID uint) (*organizations.OrganizationModel, error) {
+	item := organization{Name: model.Name}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&item).Error
+		if err != nil {
+			return err
+		}
+		return tx.Omit("Organization", "Account").Create(&organizationMember{
+			OrganizationID: item.ID,
+			AccountID:      ownerID,
+			Role:           string(applications.RoleOwner),
+		}).Error
+	})
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(applications.RoleOwner), nil
+}
+
+func (r *repository) GetAccountOrganizations(accountID uint) ([]*organizations.OrganizationModel, error) {
+	var items []organizationMember
+	err := r.db.Preload("Organization").Where("account_id = ?", accountID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*organizations.OrganizationModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Organization.ToServiceModel(applications.Role(item.Role)))
+	}
+	return result, nil
+}
+
+func (r *repository) GetAccountOrganization(accountID uint, UUID string) (*organizations.OrganizationModel, error) {
+	var item organization
+	err := r.db.Where("uuid = ?", UUID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	var member organizationMember
+	err = r.db.Where("organization_id = ? AND account_id = ?", item.ID, accountID).First(&member).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(applications.Role(member.Role)), nil
+}
+
+func (r *repository) GetMembers(organizationID uint) ([]*organizations.MemberModel, error) {
+	var items []organizationMember
+	err := r.db.Preload("Account").Where("organization_id = ?", organizationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*organizations.MemberModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetMember(organizationID uint, UUID string) (*organizations.MemberModel, error) {
+	var item organizationMember
+	err := r.db.Preload("Account").Where("uuid = ? AND organization_id = ?", UUID, organizationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) CountOwners(organizationID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&organizationMember{}).
+		Where("organization_id = ? AND role = ?", organizationID, string(applications.RoleOwner)).
+		Count(&count).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return count, nil
+}
+
+func (r *repository) UpdateMemberRole(ID uint, role applications.Role) error {
+	res := r.db.Model(&organizationMember{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"role":       string(role),
+		"updated_at": time.Now(),
+	})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) DeleteMember(ID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var item organizationMember
+		err := tx.First(&item, ID).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		appIDs := tx.Unscoped().Model(&application{}).Select("id").Where("organization_id = ?", item.OrganizationID)
+		err = tx.Where("account_id = ? AND application_id IN (?)", item.AccountID, appIDs).Delete(&applicationMember{}).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to delete application roles of the member")
+		}
+		return tx.Delete(&item).Error
+	})
+}
+
+func (r *repository) SaveInvitation(model organizations.InvitationModel) (*organizations.InvitationModel, error) {
+	item := organizationInvitation{
+		Email:          model.Email,
+		Role:           string(model.Role),
+		TokenHash:      model.TokenHash,
+		ExpiresAt:      model.ExpiresAt,
+		InvitedByID:    model.InvitedByID,
+		OrganizationID: model.OrganizationID,
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("organization_id = ? AND email = ?", model.OrganizationID, model.Email).Delete(&organizationInvitation{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Omit("Organization").Create(&item).Error
+	})
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetInvitations(organizationID uint) ([]*organizations.InvitationModel, error) {
+	var items []organizationInvitation
+	err := r.db.Where("organization_id = ?", organizationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*organizations.InvitationModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetInvitationByTokenHash(tokenHash string) (*organizations.InvitationModel, error) {
+	var item organizationInvitation
+	err := r.db.Where("token_hash = ?", tokenHash).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) DeleteInvitation(organizationID uint, UUID string) error {
+	res := r.db.Where("uuid = ? AND organization_id = ?", UUID, organizationID).Delete(&organizationInvitation{})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) AcceptInvitation(invitation organizations.InvitationModel, accountID uint) (*organizations.OrganizationModel, error) {
+	var item organization
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// The invitation is deleted first, so it can only be accepted once by concurrent requests
+		res := tx.Where("id = ?", invitation.ID).Delete(&organizationInvitation{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return getProcessedDBError(gorm.ErrRecordNotFound)
+		}
+		res = tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Organization", "Account").Create(&organizationMember{
+			OrganizationID: invitation.OrganizationID,
+			AccountID:      accountID,
+			Role:           string(invitation.Role),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.WithKindCtx(errors.New("account is already a member of the organization"), "", errors.Conflict, nil)
+		}
+		return tx.First(&item, invitation.OrganizationID).Error
+	})
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(invitation.Role), nil
+}
+
+func (r *repository) MoveApplication(applicationID uint, organizationID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("application_id = ?", applicationID).Delete(&applicationMember{}).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to delete application roles")
+		}
+		return tx.Model(&application{}).Where("id = ?", applicationID).Updates(map[string]interface{}{
+			"organization_id": organizationID,
+			"updated_at":      time.Now(),
+		}).Error
+	})
+}
+
+func (r *repository) GetApplicationMembers(applicationID uint) ([]*organizations.ApplicationMemberModel, error) {
+	var items []applicationMember
+	err := r.db.Preload("Account").Where("application_id = ?", applicationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*organizations.ApplicationMemberModel, 0, len(items))
+	if len(items) == 0 {
+		return result, nil
+	}
+
+	accountIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		accountIDs = append(accountIDs, item.AccountID)
+	}
+	var members []organizationMember
+	orgID := r.db.Model(&application{}).Select("organization_id").Where("id = ?", applicationID)
+	err = r.db.Where("organization_id = (?) AND account_id IN ?", orgID, accountIDs).Find(&members).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	memberUUIDs := make(map[uint]string, len(members))
+	for _, member := range members {
+		memberUUIDs[member.AccountID] = member.UUID
+	}
+
+	for _, item := range items {
+		result = append(result, &organizations.ApplicationMemberModel{
+			MemberUUID:  memberUUIDs[item.AccountID],
+			AccountID:   item.AccountID,
+			AccountUUID: item.Account.UUID,
+			Email:       item.Account.Email,
+			Role:        applications.Role(item.Role),
+			CreatedAt:   item.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+func (r *repository) SetApplicationRole(applicationID uint, accountID uint, role applications.Role) error {
+	item := applicationMember{ApplicationID: applicationID, AccountID: accountID, Role: string(role)}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "application_id"}, {Name: "account_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"role":       item.Role,
+			"updated_at": time.Now(),
+		}),
+	}).Omit("Application", "Account").Create(&item).Error
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return nil
+}
+
+func (r *repository) DeleteApplicationRole(applicationID uint, accountID uint) error {
+	res := r.db.Where("application_id = ? AND account_id = ?", applicationID, accountID).Delete(&applicationMember{})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// accountApplicationRole returns the role of the account on the application, personal applications only have their
+// account as the owner and the applications of organizations are only accessible by the members of the organization
+func (r *repository) accountApplicationRole(item application, accountID uint) (applications.Role, error) {
+	if item.OrganizationID == nil {
+		if item.AccountID != accountID {
+			return "", getProcessedDBError(gorm.ErrRecordNotFound)
+		}
+		return applications.RoleOwner, nil
+	}
+	var member organizationMember
+	err := r.db.Where("organization_id = ? AND account_id = ?", *item.OrganizationID, accountID).First(&member).Error
+	if err != nil {
+		return "", getProcessedDBError(err)
+	}
+	var given applicationMember
+	err = r.db.Where("application_id = ? AND account_id = ?", item.ID, accountID).Limit(1).Find(&given).Error
+	if err != nil {
+		return "", getProcessedDBError(err)
+	}
+	return applications.EffectiveRole(applications.Role(member.Role), applications.Role(given.Role)), nil
+}
@@ -0,0 +1,499 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/privacy"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type privacyRequest struct {
+	ID             uint         `gorm:"primary_key"`
+	UUID           string       `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	AccountID      uint         `gorm:"index"`
+	Type           string       `gorm:"size:10"`
+	ExternalUserID string       `gorm:"size:255"`
+	DeviceUUID     string       `gorm:"size:36"`
+	SubjectHash    string       `gorm:"size:64;index"`
+	Status         string       `gorm:"size:20;index:idx_privacy_due,priority:1"`
+	Summary        string       `gorm:"type:text"` // JSON encoded privacy.SummaryModel
+	BlobKey        string       `gorm:"size:512"`
+	Size           int64        `gorm:"not null;default:0"`
+	Error          string       `gorm:"type:text"`
+	Attempts       int          `gorm:"not null;default:0"`
+	ErasedDevices  string       `gorm:"type:text"` // JSON encoded UUIDs of the devices erased by failed attempts
+	NextRunAt      time.Time    `gorm:"index:idx_privacy_due,priority:2"`
+	ExpiresAt      sql.NullTime `gorm:"index"`
+	FinishedAt     sql.NullTime
+	CreatedAt      time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt      time.Time `gorm:"default:current_timestamp"`
+	ApplicationID  uint      `gorm:"index"`
+	Application    application
+}
+
+type subjectEventRow struct {
+	ID             uint
+	DeviceUUID     *string
+	ExternalUserID string
+	Name           string
+	Properties     string
+	OccurredAt     time.Time
+}
+
+func (p privacyRequest) ToServiceModel() *privacy.RequestModel {
+	res := &privacy.RequestModel{
+		ID:              p.ID,
+		UUID:            p.UUID,
+		ApplicationID:   p.ApplicationID,
+		ApplicationUUID: p.Application.UUID,
+		AccountID:       p.AccountID,
+		Type:            privacy.RequestType(p.Type),
+		Subject: privacy.SubjectModel{
+			ExternalUserID: p.ExternalUserID,
+			DeviceUUID:     p.DeviceUUID,
+		},
+		SubjectHash: p.SubjectHash,
+		Status:      privacy.Status(p.Status),
+		BlobKey:     p.BlobKey,
+		Size:        p.Size,
+		Error:       p.Error,
+		Attempts:    p.Attempts,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(p.Summary), &res.Summary)
+	if p.ErasedDevices != "" {
+		_ = json.Unmarshal([]byte(p.ErasedDevices), &res.ErasedDeviceUUIDs)
+	}
+	if p.ExpiresAt.Valid {
+		res.ExpiresAt = &p.ExpiresAt.Time
+	}
+	if p.FinishedAt.Valid {
+		res.FinishedAt = &p.FinishedAt.Time
+	}
+	return res
+}
+
+// subjectDevices limits a query on devices to the devices of the subject
+func subjectDevices(tx *gorm.DB, applicationID uint, subject privacy.SubjectModel) *gorm.DB {
+	query := tx.Model(&device{}).Where("devices.application_id = ?", applicationID)
+	if subject.DeviceUUID != "" {
+		return query.Where("devices.uuid = ?", subject.DeviceUUID)
+	}
+	return query.Where("devices.external_user_id = ?", subject.ExternalUserID)
+}
+
+// subjectEvents limits a query on events to the events of the subject, events of an external user are either
+// sent by its devices or addressed to the user directly
+func subjectEvents(tx *gorm.DB, applicationID uint, subject privacy.SubjectModel) *gorm.DB {
+	ids := subjectDevices(tx.Session(&gorm.Session{NewDB: true}), applicationID, subject).Select("devices.id")
+	query := tx.Where("events.application_id = ?", applicationID)
+	if subject.DeviceUUID != "" {
+		return query.Where("events.device_id IN (?)", ids)
+	}
+	return query.Where("events.external_user_id = ? OR events.device_id IN (?)", subject.ExternalUserID, ids)
+}
+
+func (r *repository) CreatePrivacyRequest(model privacy.RequestModel) (*privacy.RequestModel, error) {
+	item := privacyRequest{
+		AccountID:      model.AccountID,
+		Type:           string(model.Type),
+		ExternalUserID: model.Subject.ExternalUserID,
+		DeviceUUID:     model.Subject.DeviceUUID,
+		SubjectHash:    model.SubjectHash,
+		Status:         string(model.Status),
+		Summary:        "{}",
+		BlobKey:        model.BlobKey,
+		NextRunAt:      time.Now(),
+		ApplicationID:  model.ApplicationID,
+	}
+	err := r.db.Omit("Application").Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetPrivacyRequests(applicationID uint) ([]*privacy.RequestModel, error) {
+	var items []privacyRequest
+	err := r.db.Where("application_id = ?", applicationID).Order("id DESC").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*privacy.RequestModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetPrivacyRequest(applicationID uint, UUID string) (*privacy.RequestModel, error) {
+	var item privacyRequest
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetPrivacyRequestByUUID(UUID string) (*privacy.RequestModel, error) {
+	var item privacyRequest
+	err := r.db.Where("uuid = ?", UUID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) ClaimDuePrivacyRequest(lease time.Duration) (*privacy.RequestModel, error) {
+	var items []privacyRequest
+	err := r.db.Raw(`UPDATE privacy_requests SET status = ?, next_run_at = ?
+		WHERE id IN (
+			SELECT id FROM privacy_requests
+			WHERE status IN (?, ?) AND next_run_at <= ?
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) RETURNING id`, string(privacy.StatusRunning), time.Now().Add(lease),
+		string(privacy.StatusPending), string(privacy.StatusRunning), time.Now()).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(items) == 0 {
+		return nil, getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+
+	// The application is needed to address the cached data of the subject
+	var item privacyRequest
+	err = r.db.Preload("Application").First(&item, items[0].ID).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) FinishPrivacyRequest(ID uint, result privacy.ResultModel) error {
+	summary, err := json.Marshal(result.Summary)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode privacy request summary")
+	}
+	changes := map[string]interface{}{
+		"status":      string(result.Status),
+		"summary":     string(summary),
+		"size":        result.Size,
+		"error":       result.Error,
+		"finished_at": time.Now(),
+	}
+	if !result.ExpiresAt.IsZero() {
+		changes["expires_at"] = result.ExpiresAt
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&privacyRequest{}).Where("id = ?", ID).Updates(changes).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to update privacy request")
+		}
+		// Completed erasures must not keep the identifier of the subject they have erased, failed ones keep it
+		// so the subject can be erased again
+		if result.Status != privacy.StatusCompleted {
+			return nil
+		}
+		err = tx.Model(&privacyRequest{}).Where("id = ? AND type = ?", ID, string(privacy.TypeErase)).
+			Updates(map[string]interface{}{"external_user_id": "", "device_uuid": "", "erased_devices": ""}).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove privacy request subject")
+		}
+		return nil
+	})
+}
+
+func (r *repository) RetryPrivacyRequest(ID uint, result privacy.ResultModel, erasedDeviceUUIDs []string, nextRunAt time.Time) error {
+	summary, err := json.Marshal(result.Summary)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode privacy request summary")
+	}
+	erased, err := json.Marshal(erasedDeviceUUIDs)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode erased devices")
+	}
+	err = r.db.Model(&privacyRequest{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"status":         string(privacy.StatusPending),
+		"summary":        string(summary),
+		"error":          result.Error,
+		"attempts":       gorm.Expr("attempts + 1"),
+		"erased_devices": string(erased),
+		"next_run_at":    nextRunAt,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to update privacy request")
+	}
+	return nil
+}
+
+func (r *repository) GetExpiredPrivacyRequests(limit int) ([]*privacy.RequestModel, error) {
+	var items []privacyRequest
+	err := r.db.Where("type = ? AND status = ? AND expires_at <= ?", string(privacy.TypeExport), string(privacy.StatusCompleted), time.Now()).
+		Order("expires_at").Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*privacy.RequestModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) ExpirePrivacyRequest(ID uint) error {
+	return r.db.Model(&privacyRequest{}).Where("id = ?", ID).Update("status", string(privacy.StatusExpired)).Error
+}
+
+func (r *repository) GetSubjectUser(applicationID uint, subject privacy.SubjectModel) (*privacy.UserDataModel, error) {
+	if subject.ExternalUserID == "" {
+		return nil, getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	var item user
+	err := r.db.Preload("Tags").Where("application_id = ? AND external_user_id = ?", applicationID, subject.ExternalUserID).
+		First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	res := &privacy.UserDataModel{
+		ExternalUserID: item.ExternalUserID,
+		Tags:           make(map[string]string, len(item.Tags)),
+		CreatedAt:      item.CreatedAt,
+		UpdatedAt:      item.UpdatedAt,
+	}
+	for _, t := range item.Tags {
+		res.Tags[t.Key] = t.Value
+	}
+	return res, nil
+}
+
+func (r *repository) GetSubjectDevices(applicationID uint, subject privacy.SubjectModel) ([]*privacy.DeviceDataModel, error) {
+	var items []device
+	err := subjectDevices(r.db, applicationID, subject).Preload("Tags").Order("devices.id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(items) == 0 {
+		return []*privacy.DeviceDataModel{}, nil
+	}
+
+	ids := make([]uint, 0, len(items))
+	result := make([]*privacy.DeviceDataModel, 0, len(items))
+	byID := make(map[uint]*privacy.DeviceDataModel, len(items))
+	for _, d := range items {
+		row := &privacy.DeviceDataModel{
+			ID:                d.ID,
+			UUID:              d.UUID,
+			Identifier:        d.Identifier,
+			DeviceType:        d.DeviceType,
+			ADID:              d.ADID,
+			Language:          d.Language,
+			Timezone:          d.Timezone,
+			AppVersion:        d.AppVersion,
+			DeviceVendor:      d.DeviceVendor,
+			DeviceModel:       d.DeviceModel,
+			DeviceOS:          d.DeviceOS,
+			DeviceOSVersion:   d.DeviceOSVersion,
+			SDK:               d.SDK,
+			SessionCount:      d.SessionCount,
+			NotificationTypes: d.NotificationTypes,
+			Long:              d.Long,
+			Lat:               d.Lat,
+			Country:           d.Country,
+			ExternalUserID:    d.ExternalUserID,
+			BadgeCount:        d.BadgeCount,
+			AmountSpent:       d.AmountSpent,
+			TotalUsageTime:    d.TotalUsageTime,
+			Tags:              make(map[string]string, len(d.Tags)),
+			Purchases:         []privacy.PurchaseDataModel{},
+			Journeys:          []privacy.JourneyDataModel{},
+			WebhookDeliveries: []privacy.WebhookDataModel{},
+			CreatedAt:         d.CreatedAt,
+			UpdatedAt:         d.UpdatedAt,
+		}
+		if d.LastActiveAt.Valid {
+			row.LastActiveAt = &d.LastActiveAt.Time
+		}
+		for _, t := range d.Tags {
+			row.Tags[t.Key] = t.Value
+		}
+		ids = append(ids, d.ID)
+		byID[d.ID] = row
+		result = append(result, row)
+	}
+
+	var purchases []purchase
+	err = r.db.Where("device_id IN ?", ids).Order("id").Find(&purchases).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	for _, p := range purchases {
+		byID[p.DeviceID].Purchases = append(byID[p.DeviceID].Purchases, privacy.PurchaseDataModel{
+			SKU:         p.SKU,
+			Amount:      p.Amount,
+			Currency:    p.Currency,
+			AmountSpent: p.AmountSpent,
+			CreatedAt:   p.CreatedAt,
+		})
+	}
+
+	var progresses []journeyProgress
+	err = r.db.Preload("Journey").Where("device_id IN ?", ids).Order("id").Find(&progresses).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	for _, p := range progresses {
+		byID[p.DeviceID].Journeys = append(byID[p.DeviceID].Journeys, privacy.JourneyDataModel{
+			JourneyUUID: p.Journey.UUID,
+			JourneyName: p.Journey.Name,
+			StepKey:     p.StepKey,
+			Status:      p.Status,
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.UpdatedAt,
+		})
+	}
+
+	// Queued deliveries hold a copy of the event, the attempts tell which events have been delivered
+	var deliveries []webhookDelivery
+	err = r.db.Where("device_id IN ?", ids).Order("id").Find(&deliveries).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	queued := make(map[string]bool, len(deliveries))
+	for _, d := range deliveries {
+		queued[d.UUID] = true
+		row := privacy.WebhookDataModel{
+			DeliveryUUID: d.UUID,
+			EventType:    d.EventType,
+			Attempts:     d.Attempts,
+			CreatedAt:    d.CreatedAt,
+		}
+		_ = json.Unmarshal([]byte(d.Payload), &row.Payload)
+		byID[d.DeviceID].WebhookDeliveries = append(byID[d.DeviceID].WebhookDeliveries, row)
+	}
+	var attempts []webhookAttempt
+	err = r.db.Where("device_id IN ?", ids).Order("id").Find(&attempts).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	// Attempts of the delivered events are grouped by their delivery, in the order of the first attempt
+	delivered := make(map[string]int)
+	for _, a := range attempts {
+		if queued[a.DeliveryUUID] {
+			continue
+		}
+		rows := byID[a.DeviceID].WebhookDeliveries
+		index, ok := delivered[a.DeliveryUUID]
+		if !ok {
+			rows = append(rows, privacy.WebhookDataModel{
+				DeliveryUUID: a.DeliveryUUID,
+				EventType:    a.EventType,
+				CreatedAt:    a.CreatedAt,
+			})
+			index = len(rows) - 1
+			delivered[a.DeliveryUUID] = index
+		}
+		rows[index].Attempts = a.Attempt
+		rows[index].Delivered = rows[index].Delivered || a.Success
+		byID[a.DeviceID].WebhookDeliveries = rows
+	}
+	return result, nil
+}
+
+func (r *repository) GetSubjectEvents(applicationID uint, subject privacy.SubjectModel, lastID uint, limit int) ([]*privacy.EventDataModel, error) {
+	var items []subjectEventRow
+	err := subjectEvents(r.db.Table("events"), applicationID, subject).
+		Select("events.id, devices.uuid AS device_uuid, events.external_user_id, events.name, events.properties, events.occurred_at").
+		Joins("LEFT JOIN devices ON devices.id = events.device_id").
+		Where("events.id > ?", lastID).Order("events.id").Limit(limit).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*privacy.EventDataModel, 0, len(items))
+	for _, item := range items {
+		model := &privacy.EventDataModel{
+			ID:             item.ID,
+			ExternalUserID: item.ExternalUserID,
+			Name:           item.Name,
+			OccurredAt:     item.OccurredAt,
+		}
+		if item.DeviceUUID != nil {
+			model.DeviceUUID = *item.DeviceUUID
+		}
+		_ = json.Unmarshal([]byte(item.Properties), &model.Properties)
+		result = append(result, model)
+	}
+	return result, nil
+}
+
+func (r *repository) EraseSubject(applicationID uint, subject privacy.SubjectModel) (*privacy.SummaryModel, []string, error) {
+	summary := &privacy.SummaryModel{}
+	var uuids []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var items []device
+		err := subjectDevices(tx, applicationID, subject).Select("id", "uuid").Find(&items).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to load subject devices")
+		}
+		ids := make([]uint, 0, len(items))
+		for _, d := range items {
+			ids = append(ids, d.ID)
+			uuids = append(uuids, d.UUID)
+		}
+
+		// Events are removed before the devices, as the subject query finds the events by their devices
+		res := subjectEvents(tx, applicationID, subject).Delete(&event{})
+		if res.Error != nil {
+			return errors.Wrap(res.Error, "failed to erase subject events")
+		}
+		summary.Events = res.RowsAffected
+
+		if len(ids) > 0 {
+			steps := []struct {
+				model interface{}
+				count *int64
+			}{
+				{&tag{}, &summary.Tags},
+				{&purchase{}, &summary.Purchases},
+				{&journeyProgress{}, &summary.Journeys},
+				{&webhookDelivery{}, &summary.WebhookDeliveries},
+				{&webhookAttempt{}, &summary.WebhookDeliveries},
+			}
+			for _, step := range steps {
+				res = tx.Where("device_id IN ?", ids).Delete(step.model)
+				if res.Error != nil {
+					return errors.Wrap(res.Error, "failed to erase subject device data")
+				}
+				*step.count += res.RowsAffected
+			}
+			res = tx.Where("id IN ?", ids).Delete(&device{})
+			if res.Error != nil {
+				return errors.Wrap(res.Error, "failed to erase subject devices")
+			}
+			summary.Devices = res.RowsAffected
+		}
+
+		if subject.ExternalUserID != "" {
+			res = tx.Where("user_id IN (?)", tx.Model(&user{}).Select("id").
+				Where("application_id = ? AND external_user_id = ?", applicationID, subject.ExternalUserID)).Delete(&userTag{})
+			if res.Error != nil {
+				return errors.Wrap(res.Error, "failed to erase subject user tags")
+			}
+			summary.Tags += res.RowsAffected
+			res = tx.Where("application_id = ? AND external_user_id = ?", applicationID, subject.ExternalUserID).Delete(&user{})
+			if res.Error != nil {
+				return errors.Wrap(res.Error, "failed to erase subject user")
+			}
+			summary.Users = res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return summary, uuids, nil
+}
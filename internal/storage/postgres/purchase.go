@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type purchase struct {
+	ID            uint      `gorm:"primary_key"`
+	DeviceID      uint      `gorm:"index"`
+	ApplicationID uint      `gorm:"index"`
+	SKU           string    `gorm:"size:255"`
+	Amount        float64   `gorm:"type:numeric(16,4)"`
+	Currency      string    `gorm:"size:3"`
+	AmountSpent   float64   `gorm:"type:numeric(16,4)"` // Amount in reporting currency
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	Device        device    `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (p purchase) ToServiceModel() *devices.PurchaseModel {
+	return &devices.PurchaseModel{
+		ID:            p.ID,
+		DeviceID:      p.DeviceID,
+		ApplicationID: p.ApplicationID,
+		SKU:           p.SKU,
+		Amount:        p.Amount,
+		Currency:      p.Currency,
+		AmountSpent:   p.AmountSpent,
+		CreatedAt:     p.CreatedAt,
+	}
+}
+
+func (r *repository) CreatePurchase(uuid string, model devices.PurchaseModel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var dev device
+		err := tx.Select("id").Where("uuid = ? AND application_id = ?", uuid, model.ApplicationID).First(&dev).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+
+		item := purchase{
+			DeviceID:      dev.ID,
+			ApplicationID: model.ApplicationID,
+			SKU:           model.SKU,
+			Amount:        model.Amount,
+			Currency:      model.Currency,
+			AmountSpent:   model.AmountSpent,
+		}
+		err = tx.Create(&item).Error
+		if err != nil {
+			return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+		}
+
+		// Total is increased in place, so concurrent purchases of the same device are not lost
+		return tx.Model(&device{}).Where("id = ?", dev.ID).Updates(map[string]interface{}{
+			"amount_spent":   gorm.Expr("amount_spent + ?", model.AmountSpent),
+			"last_active_at": time.Now(),
+		}).Error
+	})
+}
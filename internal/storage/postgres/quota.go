@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/quotas"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// accountUsage holds the metered usage of an account in a month, Period is formatted as 2006-01
+type accountUsage struct {
+	ID            uint      `gorm:"primary_key"`
+	AccountID     uint      `gorm:"uniqueIndex:idx_account_usage"`
+	Period        string    `gorm:"size:7;uniqueIndex:idx_account_usage"`
+	Notifications int64     `gorm:"not null;default:0"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	Account       account
+}
+
+func (r *repository) GetApplicationAccountID(applicationID uint) (uint, error) {
+	var item application
+	err := r.db.Unscoped().Select("id, account_id").Where("id = ?", applicationID).First(&item).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return item.AccountID, nil
+}
+
+func (r *repository) CountAccountApplications(accountID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&application{}).Where("account_id = ?", accountID).Count(&count).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return count, nil
+}
+
+func (r *repository) CountApplicationDevices(applicationID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&device{}).Where("application_id = ?", applicationID).Count(&count).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return count, nil
+}
+
+func (r *repository) GetAccountApplicationsUsage(accountID uint) ([]*quotas.ApplicationUsageModel, error) {
+	var items []struct {
+		UUID    string
+		Name    string
+		Devices int64
+	}
+	err := r.db.Model(&application{}).
+		Select("applications.uuid, applications.name, count(devices.id) AS devices").
+		Joins("LEFT JOIN devices ON devices.application_id = applications.id").
+		Where("applications.account_id = ?", accountID).
+		Group("applications.id").Order("applications.id").Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*quotas.ApplicationUsageModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, &quotas.ApplicationUsageModel{
+			UUID:    item.UUID,
+			Name:    item.Name,
+			Devices: item.Devices,
+		})
+	}
+	return result, nil
+}
+
+func (r *repository) GetCounter(accountID uint, period string) (*quotas.CounterModel, error) {
+	var items []accountUsage
+	err := r.db.Where("account_id = ? AND period = ?", accountID, period).Limit(1).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	counter := &quotas.CounterModel{AccountID: accountID, Period: period}
+	if len(items) > 0 {
+		counter.Notifications = items[0].Notifications
+	}
+	return counter, nil
+}
+
+func (r *repository) IncrementNotifications(accountID uint, period string, count int64, limit int64) (bool, error) {
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&accountUsage{AccountID: accountID, Period: period}).Error
+	if err != nil {
+		return false, getProcessedDBError(err)
+	}
+	// The limit is checked by the update itself so concurrent senders can not exceed it together
+	res := r.db.Model(&accountUsage{}).
+		Where("account_id = ? AND period = ? AND notifications + ? <= ?", accountID, period, count, limit).
+		Updates(map[string]interface{}{
+			"notifications": gorm.Expr("notifications + ?", count),
+			"updated_at":    time.Now(),
+		})
+	if res.Error != nil {
+		return false, getProcessedDBError(res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
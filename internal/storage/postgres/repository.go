@@ -2,11 +2,17 @@ package postgres
 
 import (
 	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"github.com/subzerobo/ratatoskr/pkg/utils"
 	"gorm.io/gorm"
+	"sync"
 )
 
 type repository struct {
 	db *gorm.DB
+	// secrets encrypts the provider secrets of applications at rest
+	secrets *utils.Envelope
+	// eventPartitions keeps the names of already created events partitions
+	eventPartitions sync.Map
 }
 
 var models = []interface{}{
@@ -16,11 +22,37 @@ var models = []interface{}{
 	&tag{},
 	&androidGroup{},
 	&androidGroupCategory{},
+	&journey{},
+	&journeyProgress{},
+	&segment{},
+	&purchase{},
+	&deviceImport{},
+	&deviceImportError{},
+	&deviceExport{},
+	&tagKey{},
+	&tagLimit{},
+	&user{},
+	&userTag{},
+	&privacyRequest{},
+	&apiKey{},
+	&session{},
+	&recoveryCode{},
+	&organization{},
+	&organizationMember{},
+	&organizationInvitation{},
+	&applicationMember{},
+	&impersonation{},
+	&accountUsage{},
+	&auditEntry{},
+	&webhook{},
+	&webhookDelivery{},
+	&webhookAttempt{},
 }
 
-func CreateRepository(db *gorm.DB) (*repository, error) {
+func CreateRepository(db *gorm.DB, secrets *utils.Envelope) (*repository, error) {
 	repo := &repository{
-		db: db,
+		db:      db,
+		secrets: secrets,
 	}
 
 	rawDB, err := db.DB()
@@ -34,10 +66,46 @@ func CreateRepository(db *gorm.DB) (*repository, error) {
 		return repo, errors.Wrap(err, "failed to migrate uuid extension")
 	}
 
+	// Tags written before tags had types are typed once their columns are added
+	typedTags := !db.Migrator().HasTable(&tag{}) || db.Migrator().HasColumn(&tag{}, "NumberValue")
+
+	// External users of devices linked before users existed are added once their table is created
+	backfillUsers := !db.Migrator().HasTable(&user{})
+
+	// Auth keys are unique by their hashes since they are encrypted, the hashes of existing applications
+	// are filled once their column is added
+	hashAuthKeys := db.Migrator().HasTable(&application{}) && !db.Migrator().HasColumn(&application{}, "AuthKeyHash")
+
 	err = db.AutoMigrate(models...)
 	if err != nil {
 		return repo, errors.Wrap(err, "failed to auto migrate models")
 	}
+
+	if backfillUsers {
+		err = repo.migrateUsers()
+		if err != nil {
+			return repo, err
+		}
+	}
+
+	if hashAuthKeys {
+		err = repo.migrateAuthKeys()
+		if err != nil {
+			return repo, err
+		}
+	}
+
+	if !typedTags {
+		err = repo.migrateTags()
+		if err != nil {
+			return repo, err
+		}
+	}
+
+	err = repo.migrateEvents()
+	if err != nil {
+		return repo, err
+	}
 	return repo, nil
 }
 
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/segments"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+type segment struct {
+	ID            uint      `gorm:"primary_key"`
+	UUID          string    `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	Name          string    `gorm:"size:255"`
+	Filters       string    `gorm:"type:text"` // JSON encoded []segments.FilterModel
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	ApplicationID uint      `gorm:"index"`
+	Application   application
+}
+
+func (s segment) ToServiceModel() *segments.SegmentModel {
+	res := &segments.SegmentModel{
+		ID:            s.ID,
+		UUID:          s.UUID,
+		ApplicationID: s.ApplicationID,
+		Name:          s.Name,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(s.Filters), &res.Filters)
+	return res
+}
+
+func (r *repository) CreateSegment(model segments.SegmentModel) (*segments.SegmentModel, error) {
+	filters, err := json.Marshal(model.Filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode segment filters")
+	}
+	item := segment{
+		Name:          model.Name,
+		Filters:       string(filters),
+		ApplicationID: model.ApplicationID,
+	}
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) UpdateSegment(model segments.SegmentModel) (*segments.SegmentModel, error) {
+	filters, err := json.Marshal(model.Filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode segment filters")
+	}
+
+	var item segment
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("uuid = ? AND application_id = ?", model.UUID, model.ApplicationID).First(&item).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		item.Name = model.Name
+		item.Filters = string(filters)
+		return tx.Save(&item).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetSegments(applicationID uint) ([]*segments.SegmentModel, error) {
+	var items []segment
+	err := r.db.Where("application_id = ?", applicationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*segments.SegmentModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) GetSegment(applicationID uint, UUID string) (*segments.SegmentModel, error) {
+	var item segment
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) DeleteSegment(applicationID uint, UUID string) error {
+	return r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).Delete(segment{}).Error
+}
+
+func (r *repository) CountSegmentDevices(applicationID uint, filters []segments.FilterModel) (int64, error) {
+	var count int64
+	err := r.segmentQuery(applicationID, filters).Count(&count).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return count, nil
+}
+
+// segmentQuery builds the query on devices table matching all of the segment filters
+func (r *repository) segmentQuery(applicationID uint, filters []segments.FilterModel) *gorm.DB {
+	query := r.db.Model(&device{}).Where("devices.application_id = ?", applicationID)
+	for _, f := range filters {
+		switch f.Field {
+		case segments.FieldTag:
+			column, value := tagFilterOperand(f)
+			switch f.Relation {
+			case segments.RelationEqual:
+				query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ? AND "+column+" = ?)", f.Key, value)
+			case segments.RelationNotEqual:
+				query = query.Where("NOT EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ? AND "+column+" = ?)", f.Key, value)
+			case segments.RelationGreater:
+				query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ? AND "+column+" > ?)", f.Key, value)
+			case segments.RelationLess:
+				query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ? AND "+column+" < ?)", f.Key, value)
+			case segments.RelationExists:
+				query = query.Where("EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ?)", f.Key)
+			case segments.RelationNotExists:
+				query = query.Where("NOT EXISTS (SELECT 1 FROM tags WHERE tags.device_id = devices.id AND tags.key = ?)", f.Key)
+			}
+		case segments.FieldEvent:
+			// Events are either performed by the device itself or by the external user logged-in on the device
+			performed := `EXISTS (SELECT 1 FROM events WHERE events.application_id = devices.application_id AND events.name = ? AND events.occurred_at >= ?
+				AND (events.device_id = devices.id OR (events.external_user_id <> '' AND events.external_user_id = devices.external_user_id)))`
+			since := time.Now().AddDate(0, 0, -f.Days)
+			switch f.Relation {
+			case segments.RelationPerformed:
+				query = query.Where(performed, f.Key, since)
+			case segments.RelationNotPerformed:
+				query = query.Where("NOT "+performed, f.Key, since)
+			}
+		case segments.FieldAmountSpent:
+			// Filters are validated before being stored, so the value is always numeric
+			amount, _ := strconv.ParseFloat(f.Value, 64)
+			switch f.Relation {
+			case segments.RelationEqual:
+				query = query.Where("devices.amount_spent = ?", amount)
+			case segments.RelationNotEqual:
+				query = query.Where("devices.amount_spent <> ?", amount)
+			case segments.RelationGreater:
+				query = query.Where("devices.amount_spent > ?", amount)
+			case segments.RelationLess:
+				query = query.Where("devices.amount_spent < ?", amount)
+			}
+		}
+	}
+	return query
+}
+
+// tagFilterOperand returns the tags column and the parsed value a tag filter compares by its value type,
+// typed columns are indexed together with the key
+func tagFilterOperand(f segments.FilterModel) (string, interface{}) {
+	// Filters are validated before being stored, so the value is always of its type
+	switch f.ValueType {
+	case tags.TypeNumber:
+		n, _ := tags.ParseNumber(f.Value)
+		return "tags.number_value", n
+	case tags.TypeTime:
+		t, _ := tags.ParseTime(f.Value)
+		return "tags.time_value", t
+	case tags.TypeBoolean:
+		b, _ := tags.ParseBool(f.Value)
+		return "lower(trim(tags.value))", strconv.FormatBool(b)
+	}
+	return "tags.value", f.Value
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	authentication2 "github.com/subzerobo/ratatoskr/internal/services/authentication"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type session struct {
+	ID                uint      `gorm:"primary_key"`
+	UUID              string    `gorm:"type:uuid;not null;default:uuid_generate_v4();uniqueIndex"`
+	TokenHash         string    `gorm:"size:64;uniqueIndex"` // sha256 hash of the current refresh token
+	PreviousTokenHash string    `gorm:"size:64;index"`       // sha256 hash of the replaced refresh token, kept to detect its reuse
+	ExpiresAt         time.Time `gorm:"index"`
+	CreatedAt         time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt         time.Time `gorm:"default:current_timestamp"`
+	AccountID         uint      `gorm:"index"`
+	Account           account
+}
+
+func (s session) ToServiceModel() *authentication2.SessionModel {
+	return &authentication2.SessionModel{
+		ID:                s.ID,
+		UUID:              s.UUID,
+		AccountID:         s.AccountID,
+		TokenHash:         s.TokenHash,
+		PreviousTokenHash: s.PreviousTokenHash,
+		ExpiresAt:         s.ExpiresAt,
+		CreatedAt:         s.CreatedAt,
+		UpdatedAt:         s.UpdatedAt,
+	}
+}
+
+func (r *repository) CreateSession(model authentication2.SessionModel) (*authentication2.SessionModel, error) {
+	item := session{
+		AccountID: model.AccountID,
+		TokenHash: model.TokenHash,
+		ExpiresAt: model.ExpiresAt,
+	}
+	err := r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetSessionByTokenHash(tokenHash string) (*authentication2.SessionModel, error) {
+	var item session
+	err := r.db.Where("token_hash = ? OR previous_token_hash = ?", tokenHash, tokenHash).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) RotateSession(ID uint, oldHash string, newHash string) error {
+	res := r.db.Model(&session{}).Where("id = ? AND token_hash = ?", ID, oldHash).Updates(map[string]interface{}{
+		"token_hash":          newHash,
+		"previous_token_hash": oldHash,
+		"updated_at":          time.Now(),
+	})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) DeleteSession(accountID uint, UUID string) error {
+	res := r.db.Where("uuid = ? AND account_id = ?", UUID, accountID).Delete(&session{})
+	if res.Error != nil {
+		return getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (r *repository) DeleteAccountSessions(accountID uint) ([]string, error) {
+	var UUIDs []string
+	err := r.db.Model(&session{}).Where("account_id = ?", accountID).Pluck("uuid", &UUIDs).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	if len(UUIDs) == 0 {
+		return UUIDs, nil
+	}
+	err = r.db.Where("uuid IN ?", UUIDs).Delete(&session{}).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return UUIDs, nil
+}
+
+func (r *repository) DeleteExpiredSessions(accountID uint) error {
+	err := r.db.Where("account_id = ? AND expires_at < ?", accountID, time.Now()).Delete(&session{}).Error
+	if err != nil {
+		return getProcessedDBError(err)
+	}
+	return nil
+}
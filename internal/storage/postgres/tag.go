@@ -0,0 +1,403 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// tagBackfillBatch is the number of tags typed per statement while migrating existing tags
+const tagBackfillBatch = 1000
+
+// inferredTypeSQL infers the type of a tag key from all of its values, it has to be used on tags grouped by key
+const inferredTypeSQL = `CASE
+	WHEN bool_and(tags.number_value IS NOT NULL) THEN 'number'
+	WHEN bool_and(lower(trim(tags.value)) IN ('true', 'false')) THEN 'boolean'
+	WHEN bool_and(tags.time_value IS NOT NULL) THEN 'time'
+	ELSE 'string' END`
+
+type tagKey struct {
+	ID            uint      `gorm:"primary_key"`
+	ApplicationID uint      `gorm:"uniqueIndex:idx_tag_key"`
+	Key           string    `gorm:"size:255;uniqueIndex:idx_tag_key"`
+	Type          string    `gorm:"size:20"`
+	Declared      bool      `gorm:"not null;default:false"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
+	Application   application
+}
+
+type tagLimit struct {
+	ID               uint `gorm:"primary_key"`
+	ApplicationID    uint `gorm:"uniqueIndex"`
+	MaxKeys          int
+	MaxValueLength   int
+	KeyPattern       string    `gorm:"size:255"`
+	ReservedPrefixes string    `gorm:"type:text"` // JSON encoded []string
+	CreatedAt        time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt        time.Time `gorm:"default:current_timestamp"`
+	Application      application
+}
+
+type tagKeyStats struct {
+	Key            string
+	Devices        int64
+	DistinctValues int64
+}
+
+func (t tagKey) ToServiceModel() *tags.TagKeyModel {
+	return &tags.TagKeyModel{
+		ApplicationID: t.ApplicationID,
+		Key:           t.Key,
+		Type:          tags.TagType(t.Type),
+		Declared:      t.Declared,
+		CreatedAt:     t.CreatedAt,
+		UpdatedAt:     t.UpdatedAt,
+	}
+}
+
+func (t tagLimit) ToServiceModel() *tags.LimitsModel {
+	res := &tags.LimitsModel{
+		MaxKeys:          t.MaxKeys,
+		MaxValueLength:   t.MaxValueLength,
+		KeyPattern:       t.KeyPattern,
+		ReservedPrefixes: []string{},
+	}
+	_ = json.Unmarshal([]byte(t.ReservedPrefixes), &res.ReservedPrefixes)
+	return res
+}
+
+// newTag builds a tag with its typed columns filled, so numeric and time comparisons can use their indexes. Only the
+// column of the declared type of the key is filled, values of undeclared keys fill every column they can be parsed to
+func newTag(deviceID uint, key string, value string, declared tags.TagType) (tag, error) {
+	item := tag{DeviceID: deviceID, Key: key, Value: value}
+	if err := tags.CheckType(key, value, declared); err != nil {
+		return item, err
+	}
+	if declared == "" || declared == tags.TypeNumber {
+		if f, ok := tags.ParseNumber(value); ok {
+			item.NumberValue = sql.NullFloat64{Float64: f, Valid: true}
+		}
+	}
+	if declared == "" || declared == tags.TypeTime {
+		if t, ok := tags.ParseTime(value); ok {
+			item.TimeValue = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return item, nil
+}
+
+// saveTags upserts the tags of the device, tags with empty value are removed
+func saveTags(tx *gorm.DB, applicationID uint, deviceID uint, values map[string]string) error {
+	types, err := declaredTagTypes(tx, applicationID, values)
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		if v == "" {
+			// Remove tag if value is empty
+			err = tx.Where("device_id = ? AND key = ?", deviceID, k).Delete(tag{}).Error
+		} else {
+			// Upsert tag if value is not empty
+			var tagM tag
+			if tagM, err = newTag(deviceID, k, v, types[k]); err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "device_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "number_value", "time_value"}),
+			}).Omit("Device").Create(&tagM).Error
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert tag record %s", k)
+		}
+	}
+	return recordTagKeys(tx, applicationID, values)
+}
+
+// declaredTagTypes returns the declared types of the keys of values, keys without a declared type are left out
+func declaredTagTypes(tx *gorm.DB, applicationID uint, values map[string]string) (map[string]tags.TagType, error) {
+	result := make(map[string]tags.TagType)
+	if len(values) == 0 {
+		return result, nil
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	var items []tagKey
+	err := tx.Select("key", "type").Where("application_id = ? AND declared = ? AND key IN ?", applicationID, true, keys).Find(&items).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load declared tag types")
+	}
+	for _, item := range items {
+		result[item.Key] = tags.TagType(item.Type)
+	}
+	return result, nil
+}
+
+// retypeTags refills the typed columns of the tags of the key after its declared type has changed, values which
+// do not match the declared type are kept without typed columns
+func retypeTags(tx *gorm.DB, applicationID uint, key string, declared tags.TagType) error {
+	var lastID uint
+	for {
+		var items []tag
+		err := tx.Select("tags.device_id", "tags.value").
+			Joins("JOIN devices ON devices.id = tags.device_id").
+			Where("devices.application_id = ? AND tags.key = ? AND tags.device_id > ?", applicationID, key, lastID).
+			Order("tags.device_id").Limit(tagBackfillBatch).Find(&items).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to load tags")
+		}
+		for _, item := range items {
+			typed, _ := newTag(item.DeviceID, key, item.Value, declared)
+			err = tx.Model(&tag{}).Where("device_id = ? AND key = ?", item.DeviceID, key).Updates(map[string]interface{}{
+				"number_value": typed.NumberValue,
+				"time_value":   typed.TimeValue,
+			}).Error
+			if err != nil {
+				return errors.Wrap(err, "failed to type tag")
+			}
+		}
+		if len(items) < tagBackfillBatch {
+			return nil
+		}
+		lastID = items[len(items)-1].DeviceID
+	}
+}
+
+// recordTagKeys adds the unknown keys to the tag keys schema of the application with the type inferred
+// from their value, types of known keys are never changed by writes
+func recordTagKeys(tx *gorm.DB, applicationID uint, values map[string]string) error {
+	items := make([]tagKey, 0, len(values))
+	for k, v := range values {
+		if v == "" {
+			continue
+		}
+		items = append(items, tagKey{ApplicationID: applicationID, Key: k, Type: string(tags.Infer(v))})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	// Keys are inserted in the same order by all writers to avoid deadlocks
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "application_id"}, {Name: "key"}},
+		DoNothing: true,
+	}).Omit("Application").CreateInBatches(items, importInsertBatch).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to record tag keys")
+	}
+	return nil
+}
+
+func (r *repository) GetTagKeys(applicationID uint) ([]*tags.TagKeyModel, error) {
+	var items []tagKey
+	err := r.db.Where("application_id = ?", applicationID).Order("key").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	stats, err := r.getTagKeyStats(applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*tags.TagKeyModel, 0, len(items))
+	for _, item := range items {
+		model := item.ToServiceModel()
+		model.Devices = stats[item.Key].Devices
+		model.DistinctValues = stats[item.Key].DistinctValues
+		result = append(result, model)
+	}
+	return result, nil
+}
+
+func (r *repository) GetTagKeyTypes(applicationID uint) (map[string]tags.TagType, error) {
+	var items []tagKey
+	err := r.db.Select("key", "type").Where("application_id = ?", applicationID).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make(map[string]tags.TagType, len(items))
+	for _, item := range items {
+		result[item.Key] = tags.TagType(item.Type)
+	}
+	return result, nil
+}
+
+func (r *repository) GetDeclaredTagKeyTypes(applicationID uint) (map[string]tags.TagType, error) {
+	var items []tagKey
+	err := r.db.Select("key", "type").Where("application_id = ? AND declared = ?", applicationID, true).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make(map[string]tags.TagType, len(items))
+	for _, item := range items {
+		result[item.Key] = tags.TagType(item.Type)
+	}
+	return result, nil
+}
+
+func (r *repository) DeclareTagKey(applicationID uint, key string, tagType tags.TagType) (*tags.TagKeyModel, error) {
+	item := tagKey{ApplicationID: applicationID, Key: key, Type: string(tagType), Declared: true}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "application_id"}, {Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"type":       item.Type,
+				"declared":   true,
+				"updated_at": time.Now(),
+			}),
+		}).Omit("Application").Create(&item).Error
+		if err != nil {
+			return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+		}
+		return retypeTags(tx, applicationID, key, tagType)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Where("application_id = ? AND key = ?", applicationID, key).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	stats, err := r.getTagKeyStats(applicationID, key)
+	if err != nil {
+		return nil, err
+	}
+	model := item.ToServiceModel()
+	model.Devices = stats[key].Devices
+	model.DistinctValues = stats[key].DistinctValues
+	return model, nil
+}
+
+func (r *repository) UndeclareTagKey(applicationID uint, key string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Typed columns are refilled first, the inferred type is computed from them
+		if err := retypeTags(tx, applicationID, key, ""); err != nil {
+			return err
+		}
+		res := tx.Exec(`UPDATE tag_keys SET declared = false, updated_at = ?, type = (
+				SELECT `+inferredTypeSQL+` FROM tags JOIN devices ON devices.id = tags.device_id
+				WHERE devices.application_id = tag_keys.application_id AND tags.key = tag_keys.key
+			) WHERE application_id = ? AND key = ?`, time.Now(), applicationID, key)
+		if res.Error != nil {
+			return getProcessedDBError(res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return getProcessedDBError(gorm.ErrRecordNotFound)
+		}
+		return nil
+	})
+}
+
+func (r *repository) GetTagLimits(applicationID uint) (*tags.LimitsModel, error) {
+	var item tagLimit
+	err := r.db.Where("application_id = ?", applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) SaveTagLimits(applicationID uint, model tags.LimitsModel) (*tags.LimitsModel, error) {
+	prefixes, err := json.Marshal(model.ReservedPrefixes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode reserved prefixes")
+	}
+	item := tagLimit{
+		ApplicationID:    applicationID,
+		MaxKeys:          model.MaxKeys,
+		MaxValueLength:   model.MaxValueLength,
+		KeyPattern:       model.KeyPattern,
+		ReservedPrefixes: string(prefixes),
+	}
+	err = r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "application_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"max_keys":          item.MaxKeys,
+			"max_value_length":  item.MaxValueLength,
+			"key_pattern":       item.KeyPattern,
+			"reserved_prefixes": item.ReservedPrefixes,
+			"updated_at":        time.Now(),
+		}),
+	}).Omit("Application").Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+// getTagKeyStats counts the devices and distinct values of the tag keys of the application, optionally limited to some keys
+func (r *repository) getTagKeyStats(applicationID uint, keys ...string) (map[string]tagKeyStats, error) {
+	query := r.db.Table("tags").
+		Select("tags.key, count(*) AS devices, count(DISTINCT tags.value) AS distinct_values").
+		Joins("JOIN devices ON devices.id = tags.device_id").
+		Where("devices.application_id = ?", applicationID)
+	if len(keys) > 0 {
+		query = query.Where("tags.key IN ?", keys)
+	}
+	var items []tagKeyStats
+	err := query.Group("tags.key").Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make(map[string]tagKeyStats, len(items))
+	for _, item := range items {
+		result[item.Key] = item
+	}
+	return result, nil
+}
+
+// migrateTags fills the typed columns of the tags written before tags had types and builds the
+// tag keys schema of all applications from them
+func (r *repository) migrateTags() error {
+	var last tag
+	for {
+		var items []tag
+		err := r.db.Select("device_id", "key", "value").
+			Where("(device_id, key) > (?, ?)", last.DeviceID, last.Key).
+			Order("device_id, key").Limit(tagBackfillBatch).Find(&items).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to load tags")
+		}
+		for _, item := range items {
+			typed, err := newTag(item.DeviceID, item.Key, item.Value, "")
+			if err != nil {
+				return errors.Wrap(err, "failed to type tag")
+			}
+			if !typed.NumberValue.Valid && !typed.TimeValue.Valid {
+				continue
+			}
+			err = r.db.Model(&tag{}).Where("device_id = ? AND key = ?", item.DeviceID, item.Key).Updates(map[string]interface{}{
+				"number_value": typed.NumberValue,
+				"time_value":   typed.TimeValue,
+			}).Error
+			if err != nil {
+				return errors.Wrap(err, "failed to type tag")
+			}
+		}
+		if len(items) < tagBackfillBatch {
+			break
+		}
+		last = items[len(items)-1]
+	}
+
+	err := r.db.Exec(`INSERT INTO tag_keys (application_id, key, type, declared, created_at, updated_at)
+		SELECT devices.application_id, tags.key, ` + inferredTypeSQL + `, false, now(), now()
+		FROM tags JOIN devices ON devices.id = tags.device_id
+		GROUP BY devices.application_id, tags.key
+		ON CONFLICT (application_id, key) DO NOTHING`).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate tag keys")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"github.com/subzerobo/ratatoskr/internal/services/tags"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"testing"
+)
+
+func TestNewTagUndeclaredFillsParsedColumns(t *testing.T) {
+	item, err := newTag(1, "zip", "01234", "")
+	if err != nil {
+		t.Fatalf("failed to build the tag: %v", err)
+	}
+	if !item.NumberValue.Valid || item.NumberValue.Float64 != 1234 {
+		t.Fatalf("we got %v but expected number 1234", item.NumberValue)
+	}
+	item, err = newTag(1, "since", "2021-03-04", "")
+	if err != nil || !item.TimeValue.Valid || item.NumberValue.Valid {
+		t.Fatalf("we got %v, %v, %v but expected only a time", item.NumberValue, item.TimeValue, err)
+	}
+}
+
+func TestNewTagDeclaredFillsOnlyItsColumn(t *testing.T) {
+	item, err := newTag(1, "zip", "01234", tags.TypeString)
+	if err != nil {
+		t.Fatalf("failed to build the tag: %v", err)
+	}
+	if item.NumberValue.Valid || item.TimeValue.Valid {
+		t.Fatalf("string tag got typed columns %v, %v", item.NumberValue, item.TimeValue)
+	}
+	item, err = newTag(1, "age", "42", tags.TypeNumber)
+	if err != nil || !item.NumberValue.Valid || item.TimeValue.Valid {
+		t.Fatalf("we got %v, %v, %v but expected only a number", item.NumberValue, item.TimeValue, err)
+	}
+	item, err = newTag(1, "paid", "true", tags.TypeBoolean)
+	if err != nil || item.NumberValue.Valid || item.TimeValue.Valid {
+		t.Fatalf("we got %v, %v, %v but expected no typed columns", item.NumberValue, item.TimeValue, err)
+	}
+}
+
+func TestNewTagRejectsMismatchingValue(t *testing.T) {
+	_, err := newTag(1, "age", "abc", tags.TypeNumber)
+	if !errors.HasKind(err, errors.UnprocessableEntity) {
+		t.Fatalf("we got %v but expected an unprocessable entity error", err)
+	}
+	if _, err = newTag(1, "since", "yesterday", tags.TypeTime); err == nil {
+		t.Fatalf("non time value of a time key has been accepted")
+	}
+}
@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/devices"
+	"github.com/subzerobo/ratatoskr/internal/services/users"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type user struct {
+	ID             uint      `gorm:"primary_key"`
+	ExternalUserID string    `gorm:"size:255;uniqueIndex:idx_user_external_id"`
+	CreatedAt      time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt      time.Time `gorm:"default:current_timestamp"`
+	ApplicationID  uint      `gorm:"uniqueIndex:idx_user_external_id"`
+	Application    application
+	Tags           []userTag `gorm:"foreignKey:UserID"`
+}
+
+type userTag struct {
+	UserID uint   `gorm:"uniqueIndex:idx_user_tag"`
+	Key    string `gorm:"size:255;uniqueIndex:idx_user_tag"`
+	Value  string `gorm:"size:255"`
+	User   user   `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (u user) ToServiceModel() *users.UserModel {
+	res := &users.UserModel{
+		ID:             u.ID,
+		ApplicationID:  u.ApplicationID,
+		ExternalUserID: u.ExternalUserID,
+		Tags:           make(map[string]string, len(u.Tags)),
+		Devices:        []users.UserDeviceModel{},
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+	}
+	for _, t := range u.Tags {
+		res.Tags[t.Key] = t.Value
+	}
+	return res
+}
+
+// ensureUsers adds the external users of the application which have not been seen yet
+func ensureUsers(tx *gorm.DB, applicationID uint, externalUserIDs ...string) error {
+	items := make([]user, 0, len(externalUserIDs))
+	seen := make(map[string]bool, len(externalUserIDs))
+	for _, externalUserID := range externalUserIDs {
+		if externalUserID == "" || seen[externalUserID] {
+			continue
+		}
+		seen[externalUserID] = true
+		items = append(items, user{ApplicationID: applicationID, ExternalUserID: externalUserID})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "application_id"}, {Name: "external_user_id"}},
+		DoNothing: true,
+	}).Omit("Application", "Tags").CreateInBatches(items, importInsertBatch).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to insert user records")
+	}
+	return nil
+}
+
+// saveUsersTags stores the user level tags of the entries, tags with empty value are removed
+func saveUsersTags(tx *gorm.DB, applicationID uint, items []devices.UserTagsModel) error {
+	externalUserIDs := make([]string, 0, len(items))
+	upserts := make([]userTagRow, 0, len(items))
+	deletes := make([]userTagRow, 0)
+	for _, item := range items {
+		externalUserIDs = append(externalUserIDs, item.ExternalUserID)
+		for k, v := range item.Tags {
+			row := userTagRow{ExternalUserID: item.ExternalUserID, Key: k, Value: v}
+			if v == "" {
+				deletes = append(deletes, row)
+			} else {
+				upserts = append(upserts, row)
+			}
+		}
+	}
+	if err := ensureUsers(tx, applicationID, externalUserIDs...); err != nil {
+		return err
+	}
+
+	if len(upserts) > 0 {
+		payload, err := json.Marshal(upserts)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode user tags")
+		}
+		err = tx.Exec(`INSERT INTO user_tags (user_id, key, value)
+			SELECT users.id, t.key, t.value
+			FROM jsonb_to_recordset(?::jsonb) AS t(external_user_id text, key text, value text)
+			JOIN users ON users.external_user_id = t.external_user_id AND users.application_id = ?
+			ON CONFLICT (user_id, key) DO UPDATE SET value = excluded.value`, string(payload), applicationID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to upsert user tags")
+		}
+	}
+	if len(deletes) > 0 {
+		payload, err := json.Marshal(deletes)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode user tags")
+		}
+		err = tx.Exec(`DELETE FROM user_tags
+			USING users, jsonb_to_recordset(?::jsonb) AS t(external_user_id text, key text)
+			WHERE user_tags.user_id = users.id AND users.application_id = ?
+			AND users.external_user_id = t.external_user_id AND user_tags.key = t.key`, string(payload), applicationID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to delete user tags")
+		}
+	}
+	return nil
+}
+
+func (r *repository) LinkDevice(applicationID uint, deviceUUID string, externalUserID string) (*users.LinkModel, error) {
+	link := &users.LinkModel{ExternalUserID: externalUserID, Tags: map[string]string{}}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var dev device
+		err := tx.Where("uuid = ? AND application_id = ?", deviceUUID, applicationID).First(&dev).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		link.DeviceID = dev.ID
+
+		if err = ensureUsers(tx, applicationID, externalUserID); err != nil {
+			return err
+		}
+		var item user
+		err = tx.Preload("Tags").Where("application_id = ? AND external_user_id = ?", applicationID, externalUserID).First(&item).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+
+		// Devices switching users lose the tags of their previous user
+		if dev.ExternalUserID != "" && dev.ExternalUserID != externalUserID {
+			keys, err := userTagKeys(tx, applicationID, dev.ExternalUserID)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				link.Tags[k] = ""
+			}
+		}
+		for _, t := range item.Tags {
+			link.Tags[t.Key] = t.Value
+		}
+
+		err = tx.Model(&device{}).Where("id = ?", dev.ID).Update("external_user_id", externalUserID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to link device")
+		}
+		return saveTags(tx, applicationID, dev.ID, link.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+func (r *repository) UnlinkDevice(applicationID uint, deviceUUID string) (*users.LinkModel, error) {
+	link := &users.LinkModel{Tags: map[string]string{}}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var dev device
+		err := tx.Where("uuid = ? AND application_id = ?", deviceUUID, applicationID).First(&dev).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		link.DeviceID = dev.ID
+		link.ExternalUserID = dev.ExternalUserID
+		if dev.ExternalUserID == "" {
+			return nil
+		}
+
+		keys, err := userTagKeys(tx, applicationID, dev.ExternalUserID)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			link.Tags[k] = ""
+		}
+
+		err = tx.Model(&device{}).Where("id = ?", dev.ID).Update("external_user_id", "").Error
+		if err != nil {
+			return errors.Wrap(err, "failed to unlink device")
+		}
+		return saveTags(tx, applicationID, dev.ID, link.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// userTagKeys returns the keys of the user level tags of the external user
+func userTagKeys(tx *gorm.DB, applicationID uint, externalUserID string) ([]string, error) {
+	var keys []string
+	err := tx.Model(&userTag{}).Joins("JOIN users ON users.id = user_tags.user_id").
+		Where("users.application_id = ? AND users.external_user_id = ?", applicationID, externalUserID).
+		Pluck("user_tags.key", &keys).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load user tags")
+	}
+	return keys, nil
+}
+
+func (r *repository) GetUserTags(applicationID uint, externalUserID string) (map[string]string, error) {
+	var items []userTag
+	err := r.db.Joins("JOIN users ON users.id = user_tags.user_id").
+		Where("users.application_id = ? AND users.external_user_id = ?", applicationID, externalUserID).
+		Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	res := make(map[string]string, len(items))
+	for _, t := range items {
+		res[t.Key] = t.Value
+	}
+	return res, nil
+}
+
+func (r *repository) GetUser(applicationID uint, externalUserID string) (*users.UserModel, error) {
+	var item user
+	err := r.db.Preload("Tags").Where("application_id = ? AND external_user_id = ?", applicationID, externalUserID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+
+	var items []device
+	err = r.db.Where("application_id = ? AND external_user_id = ?", applicationID, externalUserID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+
+	res := item.ToServiceModel()
+	for _, dev := range items {
+		model := users.UserDeviceModel{
+			UUID:        dev.UUID,
+			DeviceType:  dev.DeviceType,
+			DeviceModel: dev.DeviceModel,
+			DeviceOS:    dev.DeviceOS,
+			AppVersion:  dev.AppVersion,
+			CreatedAt:   dev.CreatedAt,
+		}
+		if dev.LastActiveAt.Valid {
+			model.LastActiveAt = &dev.LastActiveAt.Time
+		}
+		res.Devices = append(res.Devices, model)
+	}
+	return res, nil
+}
+
+// migrateUsers creates the users of the external user ids devices have been linked to before users existed
+func (r *repository) migrateUsers() error {
+	err := r.db.Exec(`INSERT INTO users (application_id, external_user_id, created_at, updated_at)
+		SELECT DISTINCT application_id, external_user_id, now(), now() FROM devices WHERE external_user_id <> ''
+		ON CONFLICT (application_id, external_user_id) DO NOTHING`).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate users")
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/subzerobo/ratatoskr/internal/services/webhooks"
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type webhook struct {
+	ID                  uint   `gorm:"primary_key"`
+	UUID                string `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	URL                 string `gorm:"size:2048"`
+	Secret              string `gorm:"type:text"`
+	Events              string `gorm:"type:text"` // JSON encoded []webhooks.EventType
+	Active              bool   `gorm:"not null;default:false"`
+	Paused              bool   `gorm:"not null;default:false"`
+	ConsecutiveFailures int    `gorm:"not null;default:0"`
+	PausedAt            *time.Time
+	CreatedAt           time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt           time.Time `gorm:"default:current_timestamp"`
+	ApplicationID       uint      `gorm:"index"`
+	Application         application
+}
+
+type webhookDelivery struct {
+	ID            uint      `gorm:"primary_key"`
+	UUID          string    `gorm:"type:uuid;not null;default:uuid_generate_v4()"`
+	WebhookID     uint      `gorm:"index"`
+	DeviceID      uint      `gorm:"index"`
+	EventType     string    `gorm:"size:50"`
+	Payload       string    `gorm:"type:text"`
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	Webhook       webhook   `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+type webhookAttempt struct {
+	ID           uint   `gorm:"primary_key"`
+	WebhookID    uint   `gorm:"index"`
+	DeviceID     uint   `gorm:"index"`
+	DeliveryUUID string `gorm:"type:uuid"`
+	EventType    string `gorm:"size:50"`
+	Attempt      int
+	Success      bool
+	StatusCode   int
+	Error        string    `gorm:"type:text"`
+	Duration     int64     // Milliseconds
+	CreatedAt    time.Time `gorm:"default:current_timestamp"`
+	Webhook      webhook   `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (w webhook) ToServiceModel() *webhooks.WebhookModel {
+	res := &webhooks.WebhookModel{
+		ID:                  w.ID,
+		UUID:                w.UUID,
+		ApplicationID:       w.ApplicationID,
+		URL:                 w.URL,
+		Active:              w.Active,
+		Paused:              w.Paused,
+		ConsecutiveFailures: w.ConsecutiveFailures,
+		PausedAt:            w.PausedAt,
+		CreatedAt:           w.CreatedAt,
+		UpdatedAt:           w.UpdatedAt,
+	}
+	_ = json.Unmarshal([]byte(w.Events), &res.Events)
+	return res
+}
+
+func (d webhookDelivery) ToServiceModel() *webhooks.DeliveryModel {
+	return &webhooks.DeliveryModel{
+		ID:            d.ID,
+		UUID:          d.UUID,
+		WebhookID:     d.WebhookID,
+		DeviceID:      d.DeviceID,
+		EventType:     webhooks.EventType(d.EventType),
+		Payload:       d.Payload,
+		Attempts:      d.Attempts,
+		NextAttemptAt: d.NextAttemptAt,
+		CreatedAt:     d.CreatedAt,
+	}
+}
+
+func (a webhookAttempt) ToServiceModel() *webhooks.AttemptModel {
+	return &webhooks.AttemptModel{
+		ID:           a.ID,
+		WebhookID:    a.WebhookID,
+		DeviceID:     a.DeviceID,
+		DeliveryUUID: a.DeliveryUUID,
+		EventType:    webhooks.EventType(a.EventType),
+		Attempt:      a.Attempt,
+		Success:      a.Success,
+		StatusCode:   a.StatusCode,
+		Error:        a.Error,
+		Duration:     a.Duration,
+		CreatedAt:    a.CreatedAt,
+	}
+}
+
+func (r *repository) CreateWebhook(model webhooks.WebhookModel) (*webhooks.WebhookModel, error) {
+	events, err := json.Marshal(model.Events)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode webhook events")
+	}
+	secret, err := r.encryptSecret(model.Secret)
+	if err != nil {
+		return nil, err
+	}
+	item := webhook{
+		ApplicationID: model.ApplicationID,
+		URL:           model.URL,
+		Secret:        secret,
+		Events:        string(events),
+		Active:        model.Active,
+	}
+	err = r.db.Create(&item).Error
+	if err != nil {
+		return nil, errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetWebhooks(applicationID uint) ([]*webhooks.WebhookModel, error) {
+	var items []webhook
+	err := r.db.Where("application_id = ?", applicationID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return webhookModels(items), nil
+}
+
+func (r *repository) GetWebhook(applicationID uint, UUID string) (*webhooks.WebhookModel, error) {
+	var item webhook
+	err := r.db.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return item.ToServiceModel(), nil
+}
+
+func (r *repository) GetWebhookByID(ID uint) (*webhooks.WebhookModel, error) {
+	var item webhook
+	err := r.db.Where("id = ?", ID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	res := item.ToServiceModel()
+	res.Secret, err = r.decryptSecret(item.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *repository) CountWebhooks(applicationID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&webhook{}).Where("application_id = ?", applicationID).Count(&count).Error
+	if err != nil {
+		return 0, getProcessedDBError(err)
+	}
+	return count, nil
+}
+
+func (r *repository) UpdateWebhook(model webhooks.WebhookModel) (*webhooks.WebhookModel, error) {
+	events, err := json.Marshal(model.Events)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode webhook events")
+	}
+	res := r.db.Model(&webhook{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
+		"url":                  model.URL,
+		"events":               string(events),
+		"active":               model.Active,
+		"paused":               model.Paused,
+		"consecutive_failures": model.ConsecutiveFailures,
+		"paused_at":            model.PausedAt,
+		"updated_at":           time.Now(),
+	})
+	if res.Error != nil {
+		return nil, getProcessedDBError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, getProcessedDBError(gorm.ErrRecordNotFound)
+	}
+	return r.GetWebhook(model.ApplicationID, model.UUID)
+}
+
+func (r *repository) DeleteWebhook(applicationID uint, UUID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var item webhook
+		err := tx.Where("uuid = ? AND application_id = ?", UUID, applicationID).First(&item).Error
+		if err != nil {
+			return getProcessedDBError(err)
+		}
+		if err = tx.Where("webhook_id = ?", item.ID).Delete(&webhookAttempt{}).Error; err != nil {
+			return getProcessedDBError(err)
+		}
+		if err = tx.Where("webhook_id = ?", item.ID).Delete(&webhookDelivery{}).Error; err != nil {
+			return getProcessedDBError(err)
+		}
+		return getProcessedDBError(tx.Delete(&item).Error)
+	})
+}
+
+func (r *repository) GetActiveWebhooks(applicationID uint) ([]*webhooks.WebhookModel, error) {
+	var items []webhook
+	err := r.db.Where("application_id = ? AND active = ? AND paused = ?", applicationID, true, false).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return webhookModels(items), nil
+}
+
+func (r *repository) GetApplicationUUID(ID uint) (string, error) {
+	var item application
+	err := r.db.Unscoped().Select("id", "uuid").Where("id = ?", ID).First(&item).Error
+	if err != nil {
+		return "", getProcessedDBError(err)
+	}
+	return item.UUID, nil
+}
+
+func (r *repository) GetDeviceData(deviceID uint) (*webhooks.DeviceDataModel, error) {
+	var item device
+	err := r.db.Select("id", "uuid", "device_type", "external_user_id").Where("id = ?", deviceID).First(&item).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	return &webhooks.DeviceDataModel{
+		UUID:           item.UUID,
+		DeviceType:     item.DeviceType,
+		ExternalUserID: item.ExternalUserID,
+	}, nil
+}
+
+func (r *repository) CreateDeliveries(items []webhooks.DeliveryModel) error {
+	if len(items) == 0 {
+		return nil
+	}
+	rows := make([]webhookDelivery, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, webhookDelivery{
+			WebhookID:     item.WebhookID,
+			DeviceID:      item.DeviceID,
+			EventType:     string(item.EventType),
+			Payload:       item.Payload,
+			Attempts:      item.Attempts,
+			NextAttemptAt: item.NextAttemptAt,
+		})
+	}
+	err := r.db.Omit("Webhook").Create(&rows).Error
+	if err != nil {
+		return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+	}
+	return nil
+}
+
+func (r *repository) ClaimDueDeliveries(limit int, lease time.Duration) ([]*webhooks.DeliveryModel, error) {
+	var items []webhookDelivery
+	// Claimed rows are pushed forward by the lease, so parallel workers skip them and crashed workers hand them
+	// over to others after the lease is over. Deliveries of paused webhooks wait in the queue until they are resumed
+	err := r.db.Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.next_attempt_at <= ? AND w.active AND NOT w.paused
+				AND w.application_id NOT IN (SELECT id FROM applications WHERE deleted_at IS NOT NULL)
+			ORDER BY d.next_attempt_at
+			LIMIT ?
+			FOR UPDATE OF d SKIP LOCKED
+		) RETURNING *`, time.Now().Add(lease), time.Now(), limit).Scan(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*webhooks.DeliveryModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) RescheduleDelivery(ID uint, attempts int, nextAttemptAt time.Time) error {
+	return r.db.Model(&webhookDelivery{}).Where("id = ?", ID).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+	}).Error
+}
+
+func (r *repository) DeleteDelivery(ID uint) error {
+	return r.db.Where("id = ?", ID).Delete(&webhookDelivery{}).Error
+}
+
+func (r *repository) CreateAttempt(model webhooks.AttemptModel, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		item := webhookAttempt{
+			WebhookID:    model.WebhookID,
+			DeviceID:     model.DeviceID,
+			DeliveryUUID: model.DeliveryUUID,
+			EventType:    string(model.EventType),
+			Attempt:      model.Attempt,
+			Success:      model.Success,
+			StatusCode:   model.StatusCode,
+			Error:        model.Error,
+			Duration:     model.Duration,
+		}
+		if err := tx.Omit("Webhook").Create(&item).Error; err != nil {
+			return errors.WithKindCtx(err, "failed to insert record to database", errors.InternalServerError, nil)
+		}
+		latest := tx.Model(&webhookAttempt{}).Select("id").Where("webhook_id = ?", model.WebhookID).
+			Order("id DESC").Limit(keep)
+		err := tx.Where("webhook_id = ? AND id NOT IN (?)", model.WebhookID, latest).Delete(&webhookAttempt{}).Error
+		return getProcessedDBError(err)
+	})
+}
+
+func (r *repository) GetAttempts(webhookID uint, offset int, limit int) ([]*webhooks.AttemptModel, error) {
+	var items []webhookAttempt
+	err := r.db.Where("webhook_id = ?", webhookID).Order("id DESC").Offset(offset).Limit(limit).Find(&items).Error
+	if err != nil {
+		return nil, getProcessedDBError(err)
+	}
+	result := make([]*webhooks.AttemptModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result, nil
+}
+
+func (r *repository) RecordFailure(ID uint, threshold int) (bool, error) {
+	var item webhook
+	// Failures of parallel workers are counted in a single statement, so the webhook is paused exactly once
+	err := r.db.Raw(`UPDATE webhooks SET consecutive_failures = consecutive_failures + 1,
+			paused = paused OR consecutive_failures + 1 >= ?,
+			paused_at = CASE WHEN NOT paused AND consecutive_failures + 1 >= ? THEN ? ELSE paused_at END,
+			updated_at = ?
+		WHERE id = ? RETURNING *`, threshold, threshold, time.Now(), time.Now(), ID).Scan(&item).Error
+	if err != nil {
+		return false, getProcessedDBError(err)
+	}
+	return item.Paused, nil
+}
+
+func (r *repository) ResetFailures(ID uint) error {
+	return r.db.Model(&webhook{}).Where("id = ?", ID).UpdateColumn("consecutive_failures", 0).Error
+}
+
+// rekeyWebhookSecrets re-encrypts the webhook secrets encrypted with a retired key, see RekeySecrets
+func (r *repository) rekeyWebhookSecrets(batchSize int) (int, error) {
+	updated := 0
+	lastID := uint(0)
+	for {
+		var items []webhook
+		err := r.db.Select("id", "uuid", "secret").Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&items).Error
+		if err != nil {
+			return updated, getProcessedDBError(err)
+		}
+		for _, item := range items {
+			lastID = item.ID
+			if !r.secrets.NeedsRekey(item.Secret) {
+				continue
+			}
+			secret, err := r.rekeySecret(item.Secret)
+			if err != nil {
+				return updated, errors.Wrapf(err, "failed to rekey secret of webhook %s", item.UUID)
+			}
+			// Secrets are never changed after the webhook is created, the row is only updated if it still exists
+			err = r.db.Model(&webhook{}).Where("id = ? AND secret = ?", item.ID, item.Secret).
+				UpdateColumn("secret", secret).Error
+			if err != nil {
+				return updated, errors.Wrapf(err, "failed to rekey secret of webhook %s", item.UUID)
+			}
+			updated++
+		}
+		if len(items) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+func webhookModels(items []webhook) []*webhooks.WebhookModel {
+	result := make([]*webhooks.WebhookModel, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ToServiceModel())
+	}
+	return result
+}
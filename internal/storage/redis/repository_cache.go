@@ -39,3 +39,9 @@ func (s *redisStore) SetApplicationData(appUUID string, model applications.Appli
 	_, err = s.redis.Set(context.Background(), key, string(jsonData),0).Result()
 	return err
 }
+
+func (s *redisStore) DeleteApplicationData(appUUID string) error {
+	key := fmt.Sprintf(ApplicationCachedKey, appUUID)
+	_, err := s.redis.Del(context.Background(), key).Result()
+	return err
+}
@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	// DeviceCachedKeys and UserCachedKeys are the namespaces of the data cached about a single device or
+	// external user of an application, everything under them is removed when the subject is erased
+	DeviceCachedKeys = "App:%s:Device:%s:*"
+	UserCachedKeys   = "App:%s:User:%s:*"
+
+	subjectScanCount = 1000
+)
+
+// globEscaper escapes the characters of identifiers which have a meaning in SCAN patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+func (s *redisStore) DeleteSubjectKeys(appUUID string, externalUserID string, deviceUUIDs []string) (int64, error) {
+	patterns := make([]string, 0, len(deviceUUIDs)+1)
+	for _, deviceUUID := range deviceUUIDs {
+		patterns = append(patterns, fmt.Sprintf(DeviceCachedKeys, appUUID, globEscaper.Replace(deviceUUID)))
+	}
+	if externalUserID != "" {
+		patterns = append(patterns, fmt.Sprintf(UserCachedKeys, appUUID, globEscaper.Replace(externalUserID)))
+	}
+
+	ctx := context.Background()
+	deleted := int64(0)
+	for _, pattern := range patterns {
+		iter := s.redis.Scan(ctx, 0, pattern, subjectScanCount).Iterator()
+		for iter.Next(ctx) {
+			n, err := s.redis.Del(ctx, iter.Val()).Result()
+			if err != nil {
+				return deleted, errors.Wrap(err, "failed to delete subject key")
+			}
+			deleted += n
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, errors.Wrap(err, "failed to scan subject keys")
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	// RevokedSessionKey marks a logged out session, it is kept as long as the access tokens of the session are valid
+	RevokedSessionKey = "Auth:Revoked:Session:%s"
+	// MFAAttemptsKey counts the two-factor codes tried by an account, the window starts with the first attempt
+	MFAAttemptsKey = "Auth:MFA:Attempts:%d"
+)
+
+func (s redisStore) RevokeSessions(UUIDs []string, ttl time.Duration) error {
+	if len(UUIDs) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, UUID := range UUIDs {
+			pipe.Set(ctx, fmt.Sprintf(RevokedSessionKey, UUID), 1, ttl)
+		}
+		return nil
+	})
+	return errors.Wrap(err, "failed to set revoked session keys")
+}
+
+func (s redisStore) IsSessionRevoked(UUID string) (bool, error) {
+	n, err := s.redis.Exists(context.Background(), fmt.Sprintf(RevokedSessionKey, UUID)).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get revoked session key")
+	}
+	return n > 0, nil
+}
+
+// CountMFAAttempt increments the attempts of the account, the window is set on the first attempt or on any later one
+// when setting it has failed before, so a counter can never be kept forever
+func (s redisStore) CountMFAAttempt(accountID uint, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf(MFAAttemptsKey, accountID)
+	var incr *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		ttl = pipe.TTL(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to increment mfa attempts key")
+	}
+	if ttl.Val() < 0 {
+		_, err = s.redis.Expire(ctx, key, window).Result()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to expire mfa attempts key")
+		}
+	}
+	return incr.Val(), nil
+}
+
+func (s redisStore) ResetMFAAttempts(accountID uint) error {
+	_, err := s.redis.Del(context.Background(), fmt.Sprintf(MFAAttemptsKey, accountID)).Result()
+	return errors.Wrap(err, "failed to delete mfa attempts key")
+}
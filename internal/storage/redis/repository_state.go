@@ -2,16 +2,34 @@ package redis
 
 import (
 	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
 	"time"
 )
 
+// OAuthStateKey is the key of the states of started oauth logins
+const OAuthStateKey = "OAuth:State:%s"
+
 func (s redisStore) SetState(key, value string) error {
-	_, err := s.redis.Set(context.Background(), key, value, 30*time.Minute).Result()
+	_, err := s.redis.Set(context.Background(), fmt.Sprintf(OAuthStateKey, key), value, 30*time.Minute).Result()
 	return errors.Wrap(err, "failed to set state key")
 }
 
-func (s redisStore) GetState(key string) (string, error) {
-	res, err := s.redis.Get(context.Background(), key).Result()
-	return res, errors.Wrap(err, "failed to get state key")
+func (s redisStore) PopState(key string) (string, error) {
+	ctx := context.Background()
+	var get *redis.StringCmd
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, fmt.Sprintf(OAuthStateKey, key))
+		pipe.Del(ctx, fmt.Sprintf(OAuthStateKey, key))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return "", errors.Wrap(err, "failed to pop state key")
+	}
+	res, err := get.Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return res, errors.Wrap(err, "failed to pop state key")
 }
@@ -0,0 +1,14 @@
+package streaming
+
+import "github.com/nats-io/stan.go"
+
+type streamingStore struct {
+	conn stan.Conn
+}
+
+func CreateStreamingStore(conn stan.Conn) *streamingStore {
+	store := &streamingStore{
+		conn: conn,
+	}
+	return store
+}
@@ -0,0 +1,20 @@
+package streaming
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/subzerobo/ratatoskr/internal/services/journeys"
+)
+
+const (
+	// NotificationSubject is the channel consumed by Odin to deliver the notifications
+	NotificationSubject = "ratatoskr.notifications"
+)
+
+func (s *streamingStore) Dispatch(model journeys.DispatchModel) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dispatch message")
+	}
+	return errors.Wrap(s.conn.Publish(NotificationSubject, data), "failed to publish dispatch message")
+}
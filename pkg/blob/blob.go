@@ -0,0 +1,24 @@
+package blob
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"io"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps large binary objects such as uploaded or generated files outside of the database
+type Store interface {
+	// Put writes the content of the reader under the key and returns the number of written bytes
+	Put(key string, r io.Reader) (int64, error)
+	// Get opens the object of the key for reading, the caller has to close it
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object of the key, removing a missing object is not an error
+	Delete(key string) error
+}
+
+type Config struct {
+	Path string `yaml:"PATH" envconfig:"BLOB_PATH"`
+}
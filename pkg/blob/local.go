@@ -0,0 +1,93 @@
+package blob
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore is a Store backed by a directory of the local file system
+type LocalStore struct {
+	root string
+}
+
+// CreateLocalStore creates a local store in the configured path, the OS temp directory is used when no path is set
+func CreateLocalStore(cfg Config) (*LocalStore, error) {
+	root := cfg.Path
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "ratatoskr")
+	}
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, errors.Wrapf(err, "failed to create blob directory %s", root)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+func (s *LocalStore) Put(key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return 0, errors.Wrapf(err, "failed to create blob directory of %s", key)
+	}
+
+	// Content is written to a temporary file first, so readers never see partial objects
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to create blob %s", key)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, errors.Wrapf(err, "failed to write blob %s", key)
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, errors.Wrapf(err, "failed to write blob %s", key)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return 0, errors.Wrapf(err, "failed to store blob %s", key)
+	}
+	return n, nil
+}
+
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, errors.WithKindCtx(err, key, errors.NotFound, nil)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open blob %s", key)
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete blob %s", key)
+	}
+	return nil
+}
+
+// path maps the key to a file inside the root directory, keys are not allowed to escape the root
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || strings.Contains(key, "..") {
+		return "", errors.WithKindCtx(ErrInvalidKey, key, errors.BadRequest, nil)
+	}
+	return filepath.Join(s.root, clean), nil
+}
@@ -0,0 +1,53 @@
+package currency
+
+import (
+	"github.com/subzerobo/ratatoskr/pkg/errors"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+)
+
+// Config holds the reporting currency and the exchange rates of other currencies to it,
+// e.g. with USD as base currency a rate of 1.08 for EUR means 1 EUR = 1.08 USD
+type Config struct {
+	Base  string             `yaml:"BASE" envconfig:"CURRENCY_BASE"`
+	Rates map[string]float64 `yaml:"RATES" envconfig:"CURRENCY_RATES"`
+}
+
+type Converter struct {
+	base  string
+	rates map[string]float64
+}
+
+// CreateConverter creates a converter using the static rates of the config, USD is used when no base is set
+func CreateConverter(cfg Config) *Converter {
+	base := strings.ToUpper(cfg.Base)
+	if base == "" {
+		base = "USD"
+	}
+	rates := make(map[string]float64, len(cfg.Rates)+1)
+	for code, rate := range cfg.Rates {
+		rates[strings.ToUpper(code)] = rate
+	}
+	rates[base] = 1
+	return &Converter{
+		base:  base,
+		rates: rates,
+	}
+}
+
+// Base returns the ISO 4217 code of the reporting currency
+func (c *Converter) Base() string {
+	return c.base
+}
+
+// Convert converts the amount from the given currency to the reporting currency
+func (c *Converter) Convert(amount float64, code string) (float64, error) {
+	rate, ok := c.rates[strings.ToUpper(code)]
+	if !ok || rate <= 0 {
+		return 0, errors.WithKindCtx(ErrUnknownCurrency, code, errors.UnprocessableEntity, nil)
+	}
+	return amount * rate, nil
+}
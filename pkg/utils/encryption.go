@@ -7,13 +7,18 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// CheckHMACHash checks the HMAC hash
-func CheckHMACHash(data string, hash string, secret string) bool {
+// GenerateHMACHash creates the hex encoded HMAC-SHA256 hash of data
+func GenerateHMACHash(data string, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
 	h.Write([]byte(data))
 	// Get result and encode as hexadecimal string
-	sha := hex.EncodeToString(h.Sum(nil))
-	return sha == hash
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckHMACHash checks the HMAC hash
+func CheckHMACHash(data string, hash string, secret string) bool {
+	sha := GenerateHMACHash(data, secret)
+	return hmac.Equal([]byte(sha), []byte(hash))
 }
 
 // HashPassword creates hash out of provided password
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// envelopePrefix marks the values encrypted by Envelope, values without it are treated as legacy plaintext
+	envelopePrefix = "enc:v1:"
+	// dataKeySize is the size of the AES-256 key generated for every encrypted value
+	dataKeySize = 32
+)
+
+var (
+	ErrUnknownKey        = errors.New("encryption key is unknown")
+	ErrMalformedEnvelope = errors.New("encrypted value is malformed")
+)
+
+// KeyProvider wraps and unwraps the data keys of envelopes with its key encryption keys, it can be backed by
+// local keys or a key management service
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the current key and returns the id of the key used
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the key with the given id
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+	// CurrentKeyID returns the id of the key new data keys are wrapped with
+	CurrentKeyID() string
+}
+
+// Envelope encrypts values with a fresh data key each, which is stored next to the value wrapped by the key provider.
+// Encrypted values look like enc:v1:<key id>:<wrapped data key>:<nonce and ciphertext>
+type Envelope struct {
+	provider KeyProvider
+}
+
+func CreateEnvelope(provider KeyProvider) *Envelope {
+	return &Envelope{provider: provider}
+}
+
+// Encrypt encrypts the value, empty values are kept empty
+func (e *Envelope) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", errors.Wrap(err, "failed to generate data key")
+	}
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := e.provider.WrapKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt, legacy plaintext values are returned as they are
+func (e *Envelope) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, envelopePrefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformedEnvelope
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformedEnvelope
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformedEnvelope
+	}
+	dataKey, err := e.provider.UnwrapKey(parts[0], wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRekey reports whether the value is plaintext or encrypted with another key than the current one
+func (e *Envelope) NeedsRekey(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !strings.HasPrefix(value, envelopePrefix) {
+		return true
+	}
+	return !strings.HasPrefix(value, envelopePrefix+e.provider.CurrentKeyID()+":")
+}
+
+// KeyConfig holds the local key encryption keys, either inline or in a file. Keys are written as
+// comma or newline separated <id>:<base64 encoded 32 bytes key> entries and the first one is the current key
+type KeyConfig struct {
+	Keys    string `yaml:"KEYS" envconfig:"ENCRYPTION_KEYS"`
+	KeyFile string `yaml:"KEY_FILE" envconfig:"ENCRYPTION_KEY_FILE"`
+}
+
+// LocalKeyProvider wraps data keys with AES-256-GCM keys held in memory
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func CreateLocalKeyProvider(cfg KeyConfig) (*LocalKeyProvider, error) {
+	source := cfg.Keys
+	if cfg.KeyFile != "" {
+		data, err := ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read encryption key file")
+		}
+		source = string(data)
+	}
+
+	provider := &LocalKeyProvider{keys: make(map[string][]byte)}
+	entries := strings.FieldsFunc(source, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("encryption keys must be written as <id>:<base64 key>")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil || len(key) != dataKeySize {
+			return nil, errors.Errorf("encryption key %s must be 32 bytes encoded as base64", parts[0])
+		}
+		if _, ok := provider.keys[parts[0]]; ok {
+			return nil, errors.Errorf("encryption key %s is duplicated", parts[0])
+		}
+		if provider.current == "" {
+			provider.current = parts[0]
+		}
+		provider.keys[parts[0]] = key
+	}
+	if provider.current == "" {
+		return nil, errors.New("at least one encryption key is required")
+	}
+	return provider, nil
+}
+
+func (p *LocalKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.current], dataKey)
+	return p.current, wrapped, err
+}
+
+func (p *LocalKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownKey, keyID)
+	}
+	return open(key, wrapped)
+}
+
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+// seal encrypts data with AES-GCM and prepends the random nonce to the ciphertext
+func seal(key []byte, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformedEnvelope
+	}
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt value")
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	return cipher.NewGCM(block)
+}
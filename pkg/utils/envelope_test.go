@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), dataKeySize)))
+}
+
+func createTestEnvelope(t *testing.T, keys string) *Envelope {
+	provider, err := CreateLocalKeyProvider(KeyConfig{Keys: keys})
+	if err != nil {
+		t.Fatalf("failed to create the key provider: %v", err)
+	}
+	return CreateEnvelope(provider)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	envelope := createTestEnvelope(t, "k1:"+testKey('a'))
+	sealed, err := envelope.Encrypt("secret value")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if !strings.HasPrefix(sealed, envelopePrefix+"k1:") || strings.Contains(sealed, "secret value") {
+		t.Fatalf("we got %s which is not an envelope of key k1", sealed)
+	}
+	again, _ := envelope.Encrypt("secret value")
+	if again == sealed {
+		t.Fatalf("same value has been encrypted to the same envelope twice")
+	}
+	opened, err := envelope.Decrypt(sealed)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if opened != "secret value" {
+		t.Fatalf("we got %q but expected %q", opened, "secret value")
+	}
+	if res, _ := envelope.Encrypt(""); res != "" {
+		t.Fatalf("we got %q but expected empty values to stay empty", res)
+	}
+}
+
+func TestEnvelopeRekeyWithOldKey(t *testing.T) {
+	old := createTestEnvelope(t, "k1:"+testKey('a'))
+	sealed, err := old.Encrypt("secret value")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	// k2 is the current key after the rotation, k1 is kept to decrypt the existing values
+	rotated := createTestEnvelope(t, "k2:"+testKey('b')+",k1:"+testKey('a'))
+	if !rotated.NeedsRekey(sealed) {
+		t.Fatalf("value of the retired key does not need a rekey")
+	}
+	opened, err := rotated.Decrypt(sealed)
+	if err != nil || opened != "secret value" {
+		t.Fatalf("we got %q, %v but expected the value of the retired key", opened, err)
+	}
+	rekeyed, err := rotated.Encrypt(opened)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if rotated.NeedsRekey(rekeyed) {
+		t.Fatalf("rekeyed value still needs a rekey")
+	}
+
+	// Values of removed keys can not be decrypted anymore
+	retired := createTestEnvelope(t, "k2:"+testKey('b'))
+	if _, err = retired.Decrypt(sealed); errors.Cause(err) != ErrUnknownKey {
+		t.Fatalf("we got %v but expected an unknown key error", err)
+	}
+}
+
+func TestEnvelopeNeedsRekey(t *testing.T) {
+	envelope := createTestEnvelope(t, "k1:"+testKey('a'))
+	sealed, _ := envelope.Encrypt("secret value")
+	cases := map[string]bool{
+		"":                             false,
+		sealed:                         false,
+		"plaintext":                    true,
+		envelopePrefix + "k0:abc:def":  true,
+		envelopePrefix + "k10:abc:def": true,
+	}
+	for value, expected := range cases {
+		if res := envelope.NeedsRekey(value); res != expected {
+			t.Fatalf("we got %v for %q but expected %v", res, value, expected)
+		}
+	}
+}
+
+func TestEnvelopeLegacyPlaintext(t *testing.T) {
+	envelope := createTestEnvelope(t, "k1:"+testKey('a'))
+	opened, err := envelope.Decrypt("legacy-auth-key")
+	if err != nil || opened != "legacy-auth-key" {
+		t.Fatalf("we got %q, %v but expected the plaintext back", opened, err)
+	}
+	if _, err = envelope.Decrypt(envelopePrefix + "k1:abc"); err != ErrMalformedEnvelope {
+		t.Fatalf("we got %v but expected a malformed envelope error", err)
+	}
+}
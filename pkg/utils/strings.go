@@ -1,12 +1,16 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"github.com/pkg/errors"
 	"math/rand"
 	"time"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
+var ErrInvalidCharset = errors.New("charset must have 1 to 256 characters")
+
 var seededRand *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 func RandomStringWithCharset(length int, charset string) string {
@@ -21,3 +25,33 @@ func RandomStringWithCharset(length int, charset string) string {
 func RandomString(length int) string {
 	return RandomStringWithCharset(length, charset)
 }
+
+// SecureRandomString generates random string with provided length using the crypto random source,
+// it has to be used for secrets instead of RandomString
+func SecureRandomString(length int) (string, error) {
+	return SecureRandomStringWithCharset(length, charset)
+}
+
+// SecureRandomStringWithCharset generates random string with provided length and charset using the crypto random source
+func SecureRandomStringWithCharset(length int, charset string) (string, error) {
+	if len(charset) == 0 || len(charset) > 256 {
+		return "", ErrInvalidCharset
+	}
+	// Bytes above the largest multiple of the charset length are skipped so all characters are equally likely,
+	// none are skipped when the charset length divides 256
+	limit := 256 - 256%len(charset)
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(b) < length {
+		if _, err := crand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if int(c) >= limit || len(b) == length {
+				continue
+			}
+			b = append(b, charset[int(c)%len(charset)])
+		}
+	}
+	return string(b), nil
+}
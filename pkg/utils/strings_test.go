@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecureRandomStringWithCharset(t *testing.T) {
+	// 32 divides 256, so no byte has to be skipped
+	const base32 = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	res, err := SecureRandomStringWithCharset(64, base32)
+	if err != nil {
+		t.Fatalf("failed to generate the string: %v", err)
+	}
+	if len(res) != 64 {
+		t.Fatalf("we got %d characters but expected 64", len(res))
+	}
+	for _, c := range res {
+		if !strings.ContainsRune(base32, c) {
+			t.Fatalf("we got %q which is not in the charset", c)
+		}
+	}
+
+	res, err = SecureRandomString(40)
+	if err != nil || len(res) != 40 {
+		t.Fatalf("we got %q, %v but expected 40 characters", res, err)
+	}
+}
+
+func TestSecureRandomStringRejectsInvalidCharsets(t *testing.T) {
+	if _, err := SecureRandomStringWithCharset(8, ""); err != ErrInvalidCharset {
+		t.Fatalf("we got %v for an empty charset", err)
+	}
+	if _, err := SecureRandomStringWithCharset(8, strings.Repeat("a", 257)); err != ErrInvalidCharset {
+		t.Fatalf("we got %v for a charset longer than 256 characters", err)
+	}
+}
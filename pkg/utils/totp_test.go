@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the base32 encoding of the SHA1 key of the RFC 6238 test vectors
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the eight digit codes of RFC 6238 Appendix B
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("failed to generate the code: %v", err)
+		}
+		if code != expected {
+			t.Fatalf("we got %s as the code at %d but expected %s", code, unix, expected)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := CheckTOTP(rfc6238Secret, "050471", now)
+	if !ok || step != 1111111111/TOTPPeriod {
+		t.Fatalf("we got %d, %v for the current code", step, ok)
+	}
+	if _, ok = CheckTOTP(rfc6238Secret, "050471", now.Add(TOTPPeriod*time.Second)); !ok {
+		t.Fatalf("code of the previous period has not been accepted")
+	}
+	if _, ok = CheckTOTP(rfc6238Secret, "050471", now.Add(3*TOTPPeriod*time.Second)); ok {
+		t.Fatalf("code of an old period has been accepted")
+	}
+	if _, ok = CheckTOTP(rfc6238Secret, "050472", now); ok {
+		t.Fatalf("invalid code has been accepted")
+	}
+}